@@ -0,0 +1,122 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Admin configures the server to serve operational endpoints on addr, a
+// listener separate from the API, so that they are not exposed publicly.
+// Addr is a TCP address or, prefixed with "unix:", the path of a unix domain
+// socket. The endpoints are:
+//
+//	GET /healthz               204 No Content while the process serves
+//	GET /readyz                readiness; see Readiness
+//	GET /debug/vars            expvar variables, such as Metrics
+//	GET /debug/pprof/          names of runtime profiles
+//	GET /debug/pprof/profile   CPU profile of ?seconds=30
+//	GET /debug/pprof/{name}    runtime profile such as heap or goroutine
+//	GET /routes                the given route patterns
+//	GET, PATCH /settings       runtime settings when settings is not nil
+//
+// Further endpoints can be added to the returned mux.
+func (s *Server) Admin(addr string, settings *Settings, routes ...string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle("GET /readyz", s.Readiness())
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/pprof/{$}", func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, p := range pprof.Profiles() {
+			names = append(names, p.Name())
+		}
+		names = append(names, "profile")
+		slices.Sort(names)
+		s.writeAdmin(w, names)
+	})
+	mux.HandleFunc("GET /debug/pprof/profile", s.cpuProfile)
+	mux.HandleFunc("GET /debug/pprof/{name}", func(w http.ResponseWriter, r *http.Request) {
+		p := pprof.Lookup(r.PathValue("name"))
+		if p == nil {
+			writeError(s.Log, w, http.StatusNotFound, ErrNotFound.Errors()...)
+			return
+		}
+		debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+		if debug == 0 {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		if err := p.WriteTo(w, debug); err != nil {
+			s.Log.Printf("restflex: admin: profile %v: %v", p.Name(), err)
+		}
+	})
+	sorted := slices.Sorted(slices.Values(routes))
+	mux.HandleFunc("GET /routes", func(w http.ResponseWriter, r *http.Request) {
+		s.writeAdmin(w, sorted)
+	})
+	if settings != nil {
+		mux.Handle("/settings", settings.Handler())
+	}
+	s.adminAddr = addr
+	s.admin = mux
+	return mux
+}
+
+func (s *Server) writeAdmin(w http.ResponseWriter, v any) {
+	if err := WriteJSON(w, http.StatusOK, v); err != nil {
+		s.Log.Printf("restflex: admin: %v", err)
+	}
+}
+
+// cpuProfile responds with a CPU profile of the number of seconds given in
+// the query, 30 by default.
+func (s *Server) cpuProfile(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+	if err != nil || seconds <= 0 {
+		seconds = 30
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Type")
+		writeError(s.Log, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	select {
+	case <-time.After(time.Duration(seconds) * time.Second):
+	case <-r.Context().Done():
+	}
+	pprof.StopCPUProfile()
+}
+
+// serveAdmin serves the admin endpoints until the returned function is
+// called.
+func (s *Server) serveAdmin() (stop func(), err error) {
+	ln, err := s.listenAddr(s.adminAddr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Handler:           s.admin,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+	}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			s.Log.Printf("restflex: admin server: %v", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,89 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_Admin(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	logger := resttest.NewLogger()
+	srv := restflex.NewServer(logger, "127.0.0.1:0", http.NotFoundHandler())
+	srv.Admin("unix:"+path, restflex.NewSettings(logger), "GET /users/{id}", "DELETE /users/{id}")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	get := func(path string) *http.Response {
+		t.Helper()
+		var (
+			res *http.Response
+			err error
+		)
+		for i := 0; i < 50; i++ {
+			if res, err = client.Get("http://admin" + path); err == nil {
+				return res
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("unexpected error: %v", err)
+		return nil
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/healthz", status: http.StatusNoContent},
+		{path: "/readyz", status: http.StatusNoContent},
+		{path: "/debug/vars", status: http.StatusOK},
+		{path: "/debug/pprof/", status: http.StatusOK},
+		{path: "/debug/pprof/goroutine?debug=1", status: http.StatusOK},
+		{path: "/debug/pprof/unknown", status: http.StatusNotFound},
+		{path: "/settings", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		res := get(tt.path)
+		res.Body.Close()
+		if tt.path == "/readyz" && res.StatusCode != tt.status {
+			// Readiness is reported once the server has started.
+			time.Sleep(50 * time.Millisecond)
+			res = get(tt.path)
+			res.Body.Close()
+		}
+		if res.StatusCode != tt.status {
+			t.Errorf("%v: expected status code %d, but got %d", tt.path, tt.status, res.StatusCode)
+		}
+	}
+
+	res := get("/routes")
+	var routes []string
+	if err := json.NewDecoder(res.Body).Decode(&routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if len(routes) != 2 || routes[0] != "DELETE /users/{id}" {
+		t.Errorf("expected sorted routes, got %v", routes)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package restflex
+
+import (
+	"container/heap"
+	"net/http"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// Admission is a middleware limiting the number of requests served
+// concurrently. Requests over the limit wait in a queue ordered by priority,
+// so that during overload authenticated internal clients are served before
+// anonymous traffic. Requests which are not admitted within QueueTimeout, or
+// which do not fit in a full queue, are rejected with 503 Service
+// Unavailable.
+type Admission struct {
+	// MaxConcurrent is the number of requests served concurrently.
+	MaxConcurrent int
+	// MaxQueue is the number of requests waiting for admission. A request
+	// of a higher priority than the lowest queued one takes its place when
+	// the queue is full.
+	MaxQueue int
+	// QueueTimeout is the time a request waits for admission.
+	QueueTimeout time.Duration
+	// Priority returns the priority of a request; higher is admitted first.
+	// Defaults to 1 for requests with a Principal and 0 for others.
+	Priority func(*http.Request) int
+	// Log logs messages
+	Log infra.Logger
+
+	mu     sync.Mutex
+	active int
+	queue  admissionQueue
+	seq    uint64
+}
+
+func NewAdmission(l infra.Logger, maxConcurrent int) *Admission {
+	return &Admission{
+		MaxConcurrent: maxConcurrent,
+		MaxQueue:      4 * maxConcurrent,
+		QueueTimeout:  time.Second,
+		Priority:      PrincipalPriority,
+		Log:           l,
+	}
+}
+
+// PrincipalPriority prioritizes authenticated requests; see WithPrincipal.
+func PrincipalPriority(r *http.Request) int {
+	if Principal(r.Context()) != "" {
+		return 1
+	}
+	return 0
+}
+
+// Wrap returns a handler admitting requests to next.
+func (a *Admission) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.admit(r) {
+			a.Log.Printf("restflex: admission: rejecting %v %v: overloaded", r.Method, r.URL.Path)
+			err := NewServiceUnavailable(time.Second, http.StatusText(http.StatusServiceUnavailable))
+			setRetryAfter(w, err)
+			writeError(a.Log, w, err.StatusCode(), err.Errors()...)
+			return
+		}
+		defer a.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// admit waits until r may be served and reports whether it was admitted.
+func (a *Admission) admit(r *http.Request) bool {
+	a.mu.Lock()
+	if a.active < a.MaxConcurrent && len(a.queue) == 0 {
+		a.active++
+		a.mu.Unlock()
+		return true
+	}
+	priority := 0
+	if a.Priority != nil {
+		priority = a.Priority(r)
+	}
+	if len(a.queue) >= a.MaxQueue {
+		lowest := a.queue.lowest()
+		if lowest < 0 || a.queue[lowest].priority >= priority {
+			a.mu.Unlock()
+			return false
+		}
+		evicted := heap.Remove(&a.queue, lowest).(*admissionWaiter)
+		evicted.result <- false
+	}
+	a.seq++
+	wr := &admissionWaiter{priority: priority, seq: a.seq, result: make(chan bool, 1)}
+	heap.Push(&a.queue, wr)
+	a.mu.Unlock()
+
+	timer := time.NewTimer(a.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case admitted := <-wr.result:
+		return admitted
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if wr.index >= 0 {
+		heap.Remove(&a.queue, wr.index)
+		return false
+	}
+	// Admitted or evicted while timing out.
+	if <-wr.result {
+		a.active--
+		a.next()
+	}
+	return false
+}
+
+// release frees the slot of a served request.
+func (a *Admission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.active--
+	a.next()
+}
+
+// next admits queued requests while there are free slots.
+func (a *Admission) next() {
+	for a.active < a.MaxConcurrent && len(a.queue) > 0 {
+		wr := heap.Pop(&a.queue).(*admissionWaiter)
+		a.active++
+		wr.result <- true
+	}
+}
+
+// admissionWaiter is a request waiting for admission.
+type admissionWaiter struct {
+	priority int
+	seq      uint64
+	index    int
+	result   chan bool
+}
+
+// admissionQueue is a heap of waiters, the highest priority and then the
+// earliest first.
+type admissionQueue []*admissionWaiter
+
+func (q admissionQueue) Len() int { return len(q) }
+
+func (q admissionQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q admissionQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *admissionQueue) Push(x any) {
+	wr := x.(*admissionWaiter)
+	wr.index = len(*q)
+	*q = append(*q, wr)
+}
+
+func (q *admissionQueue) Pop() any {
+	old := *q
+	wr := old[len(old)-1]
+	old[len(old)-1] = nil
+	wr.index = -1
+	*q = old[:len(old)-1]
+	return wr
+}
+
+// lowest returns the index of the lowest priority, latest waiter or -1.
+func (q admissionQueue) lowest() int {
+	lowest := -1
+	for i := range q {
+		if lowest < 0 || q.Less(lowest, i) {
+			lowest = i
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,99 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestAdmission(t *testing.T) {
+	t.Parallel()
+	admission := restflex.NewAdmission(resttest.NewLogger(), 1)
+	admission.QueueTimeout = time.Second
+	admission.Priority = func(r *http.Request) int {
+		if r.Header.Get("X-Internal") != "" {
+			return 1
+		}
+		return 0
+	}
+	release := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	h := admission.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocking" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(path string, internal bool) <-chan int {
+		status := make(chan int, 1)
+		go func() {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if internal {
+				req.Header.Set("X-Internal", "1")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			status <- rec.Code
+		}()
+		return status
+	}
+	blocking := serve("/blocking", false)
+	time.Sleep(20 * time.Millisecond)
+	anonymous := serve("/anonymous", false)
+	time.Sleep(20 * time.Millisecond)
+	internal := serve("/internal", true)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for _, c := range []<-chan int{blocking, anonymous, internal} {
+		if s := <-c; s != http.StatusNoContent {
+			t.Errorf("expected status code %d, but got %d", http.StatusNoContent, s)
+		}
+	}
+	want := []string{"/blocking", "/internal", "/anonymous"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected internal request to be served first, got %v", order)
+		}
+	}
+}
+
+func TestAdmission_overloaded(t *testing.T) {
+	t.Parallel()
+	admission := restflex.NewAdmission(resttest.NewLogger(), 1)
+	admission.MaxQueue = 1
+	admission.QueueTimeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	h := admission.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	time.Sleep(10 * time.Millisecond)
+	queued := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		queued <- rec.Code
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	res := resttest.Get("/").To(h).Expect(t).Status(http.StatusServiceUnavailable)
+	res.Header("Retry-After", "1").Error(http.StatusText(http.StatusServiceUnavailable))
+	if s := <-queued; s != http.StatusServiceUnavailable {
+		t.Errorf("expected queued request to time out with %d, but got %d", http.StatusServiceUnavailable, s)
+	}
+	close(release)
+}
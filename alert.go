@@ -0,0 +1,113 @@
+package restflex
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Alert describes a crossed threshold reported by an Alerter.
+type Alert struct {
+	// Reason is "5xx" or "panic".
+	Reason string
+	// Count is the number of events within Window.
+	Count  int
+	Window time.Duration
+	Time   time.Time
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%d %v within %v", a.Count, a.Reason, a.Window)
+}
+
+// Alerter calls Notify when the number of 5xx responses or panics within
+// Window reaches a threshold. Alerts of the same reason are sent at most once
+// per Cooldown to avoid alert storms.
+type Alerter struct {
+	// ServerErrors is the number of 5xx responses triggering an alert.
+	// Zero disables 5xx alerts.
+	ServerErrors int
+	// Panics is the number of panics triggering an alert. Zero disables
+	// panic alerts.
+	Panics   int
+	Window   time.Duration
+	Cooldown time.Duration
+	// Notify is called on the goroutine serving the request crossing the
+	// threshold and should not block.
+	Notify func(Alert)
+
+	mu       sync.Mutex
+	counters map[string]*alertCounter
+}
+
+// alertCounter counts events of a reason within a fixed window.
+type alertCounter struct {
+	start    time.Time
+	count    int
+	lastSent time.Time
+}
+
+// NewAlerter returns an Alerter alerting on 10 server errors or a single
+// panic within a minute at most once per 10 minutes.
+func NewAlerter(notify func(Alert)) *Alerter {
+	return &Alerter{
+		ServerErrors: 10,
+		Panics:       1,
+		Window:       time.Minute,
+		Cooldown:     10 * time.Minute,
+		Notify:       notify,
+	}
+}
+
+// WithAlerter reports the 5xx responses and panics of the handler to a.
+func WithAlerter(a *Alerter) Option {
+	return func(h *handler) {
+		h.Alerter = a
+	}
+}
+
+// ServerError records a 5xx response.
+func (a *Alerter) ServerError() {
+	if a == nil {
+		return
+	}
+	a.record("5xx", a.ServerErrors)
+}
+
+// Panic records a recovered panic.
+func (a *Alerter) Panic() {
+	if a == nil {
+		return
+	}
+	a.record("panic", a.Panics)
+}
+
+func (a *Alerter) record(reason string, threshold int) {
+	if threshold <= 0 {
+		return
+	}
+	now := time.Now()
+	a.mu.Lock()
+	if a.counters == nil {
+		a.counters = make(map[string]*alertCounter)
+	}
+	c, ok := a.counters[reason]
+	if !ok {
+		c = &alertCounter{}
+		a.counters[reason] = c
+	}
+	if now.Sub(c.start) >= a.Window {
+		c.start = now
+		c.count = 0
+	}
+	c.count++
+	send := c.count >= threshold && (c.lastSent.IsZero() || now.Sub(c.lastSent) >= a.Cooldown)
+	if send {
+		c.lastSent = now
+	}
+	alert := Alert{Reason: reason, Count: c.count, Window: a.Window, Time: now}
+	a.mu.Unlock()
+	if send && a.Notify != nil {
+		a.Notify(alert)
+	}
+}
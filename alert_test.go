@@ -0,0 +1,90 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestAlerter(t *testing.T) {
+	t.Parallel()
+	var alerts []restflex.Alert
+	alerter := restflex.NewAlerter(func(a restflex.Alert) {
+		alerts = append(alerts, a)
+	})
+	alerter.ServerErrors = 3
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		return restflex.ErrInternal
+	}), restflex.WithAlerter(alerter))
+
+	for i := 0; i < 5; i++ {
+		resttest.Get("/").To(api).Expect(t).Status(http.StatusInternalServerError)
+	}
+	if len(alerts) != 1 || alerts[0].Reason != "5xx" || alerts[0].Count != 3 {
+		t.Fatalf("expected a single 5xx alert after 3 errors, but got %v", alerts)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic to be propagated")
+			}
+		}()
+		api.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	}()
+	if len(alerts) != 2 || alerts[1].Reason != "panic" {
+		t.Fatalf("expected a panic alert, but got %v", alerts)
+	}
+}
+
+func TestAlerterCooldown(t *testing.T) {
+	t.Parallel()
+	var n int
+	alerter := restflex.NewAlerter(func(restflex.Alert) { n++ })
+	alerter.ServerErrors = 1
+	alerter.Cooldown = 20 * time.Millisecond
+	alerter.ServerError()
+	alerter.ServerError()
+	if n != 1 {
+		t.Fatalf("expected alerts within cooldown to be throttled, but got %d", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	alerter.ServerError()
+	if n != 2 {
+		t.Errorf("expected alert after cooldown, but got %d alerts", n)
+	}
+}
+
+func TestAlerter_abort(t *testing.T) {
+	t.Parallel()
+	var alerts []restflex.Alert
+	alerter := restflex.NewAlerter(func(a restflex.Alert) {
+		alerts = append(alerts, a)
+	})
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		panic(http.ErrAbortHandler)
+	}), restflex.WithAlerter(alerter))
+
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("expected http.ErrAbortHandler to be propagated, got %v", p)
+			}
+		}()
+		api.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if len(alerts) != 0 {
+		t.Errorf("expected no alerts for an aborted response, got %v", alerts)
+	}
+}
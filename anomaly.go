@@ -0,0 +1,184 @@
+package restflex
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// AuthBurst describes a principal or a client crossing the authentication
+// failure threshold of AuthAnomalies.
+type AuthBurst struct {
+	// Key is "principal:" followed by the principal or "ip:" followed by
+	// the client IP address.
+	Key string
+	// Failures is the number of failures within Window.
+	Failures int
+	Window   time.Duration
+	Time     time.Time
+}
+
+func (b AuthBurst) String() string {
+	return fmt.Sprintf("%d auth failures of %v within %v", b.Failures, b.Key, b.Window)
+}
+
+// AuthAnomalies is a middleware detecting bursts of authentication
+// failures, such as a leaked API key being tried against many endpoints or
+// a client probing for valid credentials. 401 Unauthorized and 403
+// Forbidden responses are counted per principal and per client IP address
+// in sliding windows, and OnBurst is called when a count reaches Threshold,
+// so that e.g. the key of the principal can be revoked automatically. A
+// burst of the same key is reported at most once per Window.
+type AuthAnomalies struct {
+	// Threshold is the number of failures within Window reported as a
+	// burst.
+	Threshold int
+	Window    time.Duration
+	// Principal returns the principal a request attempts to authenticate
+	// as, such as the ID of its API key, or an empty string. It is called
+	// on failed requests, so it has to extract the principal from the
+	// request itself: the principal set in the request context by an
+	// authenticating middleware is not available when the authentication
+	// fails.
+	Principal func(*http.Request) string
+	// OnBurst is called on the goroutine serving the request crossing the
+	// threshold and should not block.
+	OnBurst func(AuthBurst)
+	// Log logs messages
+	Log infra.Logger
+
+	mu        sync.Mutex
+	counters  map[string]*slidingCounter
+	lastPrune time.Time
+}
+
+func NewAuthAnomalies(l infra.Logger, threshold int, window time.Duration, principal func(*http.Request) string, onBurst func(AuthBurst)) *AuthAnomalies {
+	a := &AuthAnomalies{
+		Threshold: threshold,
+		Window:    window,
+		Principal: principal,
+		OnBurst:   onBurst,
+		Log:       l,
+	}
+	a.validate()
+	return a
+}
+
+// Wrap returns a handler counting the authentication failures of next.
+func (a *AuthAnomalies) Wrap(next http.Handler) http.Handler {
+	a.validate()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseWriter(w)
+		defer rw.release()
+		next.ServeHTTP(rw, r)
+		if rw.status != http.StatusUnauthorized && rw.status != http.StatusForbidden {
+			return
+		}
+		if p := a.Principal(r); p != "" {
+			a.fail("principal:" + p)
+		}
+		a.fail("ip:" + requestIP(r))
+	})
+}
+
+// validate panics if a is not configured.
+func (a *AuthAnomalies) validate() {
+	switch {
+	case a.Threshold <= 0:
+		panic("restflex: auth anomalies without a positive threshold")
+	case a.Window <= 0:
+		panic("restflex: auth anomalies without a positive window")
+	case a.Principal == nil:
+		panic("restflex: auth anomalies without a principal func")
+	}
+}
+
+// Failures returns the number of failures of key within the current
+// window.
+func (a *AuthAnomalies) Failures(key string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.counters[key]
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+	c.advance(now, a.Window)
+	return c.count(now, a.Window)
+}
+
+func (a *AuthAnomalies) fail(key string) {
+	now := time.Now()
+	a.mu.Lock()
+	if a.counters == nil {
+		a.counters = make(map[string]*slidingCounter)
+	}
+	a.prune(now)
+	c, ok := a.counters[key]
+	if !ok {
+		c = &slidingCounter{}
+		a.counters[key] = c
+	}
+	c.advance(now, a.Window)
+	c.current++
+	failures := c.count(now, a.Window)
+	burst := failures >= a.Threshold && (c.lastBurst.IsZero() || now.Sub(c.lastBurst) >= a.Window)
+	if burst {
+		c.lastBurst = now
+	}
+	a.mu.Unlock()
+	if !burst {
+		return
+	}
+	b := AuthBurst{Key: key, Failures: failures, Window: a.Window, Time: now}
+	a.Log.Printf("restflex: auth failure burst: %v", b)
+	if a.OnBurst != nil {
+		a.OnBurst(b)
+	}
+}
+
+// prune forgets the keys without failures in the last two windows. It is
+// called with a.mu held.
+func (a *AuthAnomalies) prune(now time.Time) {
+	if now.Sub(a.lastPrune) < a.Window {
+		return
+	}
+	a.lastPrune = now
+	for key, c := range a.counters {
+		if now.Sub(c.start) >= 2*a.Window {
+			delete(a.counters, key)
+		}
+	}
+}
+
+// slidingCounter approximates the number of events within a sliding window
+// from the counts of the current and the previous fixed window, weighting
+// the previous count by its share of the sliding window.
+type slidingCounter struct {
+	// start is the start of the current fixed window.
+	start     time.Time
+	current   int
+	previous  int
+	lastBurst time.Time
+}
+
+// advance moves the fixed windows to now.
+func (c *slidingCounter) advance(now time.Time, window time.Duration) {
+	switch elapsed := now.Sub(c.start); {
+	case elapsed >= 2*window:
+		c.start = now
+		c.previous, c.current = 0, 0
+	case elapsed >= window:
+		c.start = c.start.Add(window)
+		c.previous, c.current = c.current, 0
+	}
+}
+
+// count returns the estimated number of events within window ending at now.
+func (c *slidingCounter) count(now time.Time, window time.Duration) int {
+	weight := 1 - float64(now.Sub(c.start))/float64(window)
+	return c.current + int(float64(c.previous)*weight)
+}
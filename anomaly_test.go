@@ -0,0 +1,81 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestAuthAnomalies(t *testing.T) {
+	t.Parallel()
+	var bursts []restflex.AuthBurst
+	principal := func(r *http.Request) string {
+		return r.Header.Get("X-Api-Key-Id")
+	}
+	anomalies := restflex.NewAuthAnomalies(resttest.NewLogger(), 3, time.Minute, principal, func(b restflex.AuthBurst) {
+		bursts = append(bursts, b)
+	})
+	h := anomalies.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/admin":
+			w.WriteHeader(http.StatusForbidden)
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	resttest.Get("/ok").WithHeader("X-Api-Key-Id", "k1").To(h).Expect(t).Status(http.StatusNoContent)
+	resttest.Get("/admin").WithHeader("X-Api-Key-Id", "k1").To(h).Expect(t).Status(http.StatusForbidden)
+	resttest.Get("/orders").WithHeader("X-Api-Key-Id", "k1").To(h).Expect(t).Status(http.StatusUnauthorized)
+	if len(bursts) != 0 {
+		t.Fatalf("expected no bursts below the threshold, but got %v", bursts)
+	}
+	resttest.Get("/orders").WithHeader("X-Api-Key-Id", "k1").To(h).Expect(t).Status(http.StatusUnauthorized)
+	if len(bursts) != 2 || bursts[0].Key != "principal:k1" || bursts[0].Failures != 3 || bursts[1].Key != "ip:192.0.2.1" {
+		t.Fatalf("expected bursts of the principal and the client, but got %v", bursts)
+	}
+	resttest.Get("/orders").WithHeader("X-Api-Key-Id", "k1").To(h).Expect(t).Status(http.StatusUnauthorized)
+	if len(bursts) != 2 {
+		t.Errorf("expected a burst to be reported once per window, but got %v", bursts)
+	}
+	if n := anomalies.Failures("principal:k1"); n != 4 {
+		t.Errorf("expected 4 failures of the principal, but got %d", n)
+	}
+	if n := anomalies.Failures("principal:k2"); n != 0 {
+		t.Errorf("expected no failures of an unknown principal, but got %d", n)
+	}
+}
+
+func TestNewAuthAnomalies_invalid(t *testing.T) {
+	t.Parallel()
+	principal := func(r *http.Request) string { return "" }
+	tests := []struct {
+		name      string
+		threshold int
+		window    time.Duration
+		principal func(*http.Request) string
+	}{
+		{"zero threshold", 0, time.Minute, principal},
+		{"zero window", 3, 0, principal},
+		{"nil principal", 3, time.Minute, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			restflex.NewAuthAnomalies(resttest.NewLogger(), tt.threshold, tt.window, tt.principal, nil)
+		})
+	}
+}
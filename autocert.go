@@ -0,0 +1,56 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Autocert configures the server to obtain and renew certificates for hosts
+// from Let's Encrypt, caching them in cacheDir. Email is given to the CA for
+// expiry notices and may be empty. Run then serves HTTPS and, on
+// ChallengeAddr, HTTP-01 challenges and redirects from plain HTTP.
+func (s *Server) Autocert(email, cacheDir string, hosts ...string) *autocert.Manager {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Email:      email,
+	}
+	cfg := NewTLSConfig()
+	cfg.GetCertificate = m.GetCertificate
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+	s.TLSConfig = cfg
+	s.challenge = m.HTTPHandler(nil)
+	return m
+}
+
+// serveChallenges serves ACME HTTP-01 challenges until the returned function
+// is called.
+func (s *Server) serveChallenges() (stop func(), err error) {
+	addr := s.ChallengeAddr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Handler:           s.challenge,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+	}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			s.Log.Printf("restflex: ACME challenge server: %v", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
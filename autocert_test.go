@@ -0,0 +1,27 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_Autocert(t *testing.T) {
+	t.Parallel()
+	srv := restflex.NewServer(resttest.NewLogger(), ":https", http.NotFoundHandler())
+	m := srv.Autocert("ops@example.com", t.TempDir(), "api.example.com")
+	if srv.TLSConfig == nil || srv.TLSConfig.GetCertificate == nil {
+		t.Fatal("expected TLS config with GetCertificate")
+	}
+	if err := m.HostPolicy(context.Background(), "api.example.com"); err != nil {
+		t.Errorf("expected configured host to be allowed: %v", err)
+	}
+	if err := m.HostPolicy(context.Background(), "other.example.com"); err == nil {
+		t.Error("expected other host to be rejected")
+	}
+}
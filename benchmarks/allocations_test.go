@@ -0,0 +1,57 @@
+//go:build !integration && !race
+
+// The race detector allocates on its own, so allocation budgets are only
+// checked without it.
+
+package benchmarks_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+)
+
+// TestAllocations guards the allocation budgets of hot paths. Raise a budget
+// only with a justification in review.
+func TestAllocations(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := newDiscardWriter()
+	tests := []struct {
+		name   string
+		f      func()
+		budget float64
+	}{
+		{
+			name: "ServeHTTP",
+			f:    serve(restflex.NewHandlerWithContext(discardLogger, httpx.HandlerWithContextFunc(noContent)), get),
+			// The request ID and its response header value, and the
+			// requestInfo of the request logger with the context and
+			// request carrying it.
+			budget: 5,
+		},
+		{
+			name: "ServeHTTP with stock API error",
+			f:    serve(restflex.NewHandlerWithContext(discardLogger, httpx.HandlerWithContextFunc(notFound)), get),
+			// ServeHTTP and the client error log line: its message, the
+			// cached request fields, the line joining them and the
+			// arguments boxed for Printf.
+			budget: 11,
+		},
+		{
+			name: "WriteJSON",
+			f: func() {
+				clear(w.header)
+				_ = restflex.WriteJSON(w, http.StatusOK, &payload)
+			},
+			budget: 3,
+		},
+	}
+	for _, tt := range tests {
+		if allocs := testing.AllocsPerRun(100, tt.f); allocs > tt.budget {
+			t.Errorf("%v: expected at most %v allocations, got %v", tt.name, tt.budget, allocs)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+//go:build !integration
+
+package benchmarks_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+)
+
+type item struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags"`
+	Price float64  `json:"price"`
+}
+
+var (
+	discardLogger = log.New(io.Discard, "", 0)
+	payload       = item{ID: 42, Name: "widget", Tags: []string{"a", "b"}, Price: 9.5}
+	payloadJSON   = []byte(`{"id":42,"name":"widget","tags":["a","b"],"price":9.5}`)
+)
+
+// discardWriter is an http.ResponseWriter doing as little work as possible.
+type discardWriter struct {
+	header http.Header
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{header: make(http.Header)}
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func noContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func notFound(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return restflex.ErrNotFound
+}
+
+func withMiddlewares(h http.Handler) http.Handler {
+	for _, m := range []restflex.Middleware{
+		restflex.Vary("Accept"),
+		restflex.Languages("en", "fi"),
+		restflex.AltSvc(443),
+	} {
+		h = m(h)
+	}
+	return h
+}
+
+func serve(h http.Handler, r *http.Request) func() {
+	w := newDiscardWriter()
+	return func() {
+		clear(w.header)
+		h.ServeHTTP(w, r)
+	}
+}
+
+func benchmark(b *testing.B, f func()) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f()
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	b.Run("no content", func(b *testing.B) {
+		benchmark(b, serve(restflex.NewHandlerWithContext(discardLogger, httpx.HandlerWithContextFunc(noContent)), get))
+	})
+	b.Run("API error", func(b *testing.B) {
+		benchmark(b, serve(restflex.NewHandlerWithContext(discardLogger, httpx.HandlerWithContextFunc(notFound)), get))
+	})
+	b.Run("middleware chain", func(b *testing.B) {
+		benchmark(b, serve(withMiddlewares(restflex.NewHandlerWithContext(discardLogger, httpx.HandlerWithContextFunc(noContent))), get))
+	})
+}
+
+func BenchmarkJSON(b *testing.B) {
+	b.Run("WriteJSON", func(b *testing.B) {
+		w := newDiscardWriter()
+		benchmark(b, func() {
+			_ = restflex.WriteJSON(w, http.StatusOK, &payload)
+		})
+	})
+	b.Run("EncodeJSON", func(b *testing.B) {
+		w := newDiscardWriter()
+		benchmark(b, func() {
+			_ = restflex.EncodeJSON(w, &payload)
+		})
+	})
+	b.Run("DecodeJSON", func(b *testing.B) {
+		var v item
+		benchmark(b, func() {
+			_ = restflex.DecodeJSON(bytes.NewReader(payloadJSON), &v)
+		})
+	})
+}
@@ -0,0 +1,6 @@
+// Package benchmarks measures the overhead restflex adds to request
+// handling. Its tests also assert allocation budgets, so changes affecting
+// performance show up in review:
+//
+//	go test -bench . -benchmem ./benchmarks
+package benchmarks
@@ -0,0 +1,135 @@
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"kkn.fi/httpx"
+)
+
+// Validator is implemented by request types validating their values.
+type Validator interface {
+	Validate() error
+}
+
+type requestBodyContextKey[T any] struct{}
+
+// Bind returns a handler declaring the request type of a route. The JSON
+// request body is decoded into a T, validated if T implements Validator, and
+// passed to next in the request context; see RequestBody. Malformed bodies
+// are rejected with 400 Bad Request, naming the field of a value of the
+// wrong type such as a malformed ID, and invalid ones with 422
+// Unprocessable Entity, or the status of an APIError returned by Validate,
+// so that handlers only receive valid input. Limits declared by T, see
+// LimitedRequest, are checked before validation. The errors are returned to
+// the handler created with NewHandlerWithContext serving the route, which
+// writes them like the errors of next:
+//
+//	mux.Handle("POST /users", restflex.NewHandlerWithContext(l, restflex.Bind[CreateUser](h)))
+func Bind[T any](next httpx.HandlerWithContext) httpx.HandlerWithContext {
+	fieldLimits := hasFieldLimits(reflect.TypeFor[T]())
+	return httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		v := new(T)
+		body, err := readLimited(r.Body, v)
+		if err != nil {
+			return err
+		}
+		var data bytes.Buffer
+		if err := DecodeJSON(io.TeeReader(body, &data), v); err != nil {
+			if field := invalidField(err, reflect.TypeFor[T](), data.Bytes()); field != "" {
+				return NewAPIError(http.StatusBadRequest, err, fmt.Sprintf("invalid field %q", field))
+			}
+			return ErrInvalidRequestBody
+		}
+		if fieldLimits {
+			if err := checkFieldLimits(reflect.ValueOf(v).Elem(), ""); err != nil {
+				return err
+			}
+		}
+		if validator, ok := any(v).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				var apiError APIError
+				if errors.As(err, &apiError) {
+					return err
+				}
+				return NewAPIError(http.StatusUnprocessableEntity, err, err.Error())
+			}
+		}
+		ctx = context.WithValue(ctx, requestBodyContextKey[T]{}, v)
+		return next.ServeHTTPWithContext(ctx, w, r.WithContext(ctx))
+	})
+}
+
+// RequestBody returns the request body decoded by Bind.
+func RequestBody[T any](ctx context.Context) (*T, bool) {
+	v, ok := ctx.Value(requestBodyContextKey[T]{}).(*T)
+	return v, ok
+}
+
+// invalidField returns the path of the field of a T, such as "owner.id",
+// whose value in the JSON body data failed to decode with err, or an empty
+// string. The decoder names the field of a value of the wrong type, but not
+// the field of a value rejected by its UnmarshalJSON or UnmarshalText method,
+// such as a malformed ID, so the fields of data are decoded one by one to
+// find it.
+func invalidField(err error, t reflect.Type, data []byte) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return typeErr.Field
+	}
+	return invalidFieldOf(t, data)
+}
+
+func invalidFieldOf(t reflect.Type, data []byte) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return ""
+	}
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&fields); err != nil {
+		return ""
+	}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || f.Anonymous || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		raw, ok := fields[name]
+		if !ok {
+			// names are matched case-insensitively like the decoder does
+			for k, v := range fields {
+				if strings.EqualFold(k, name) {
+					raw, ok = v, true
+					break
+				}
+			}
+		}
+		if !ok || json.Unmarshal(raw, reflect.New(f.Type).Interface()) == nil {
+			continue
+		}
+		if sub := invalidFieldOf(f.Type, raw); sub != "" {
+			return name + "." + sub
+		}
+		return name
+	}
+	return ""
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
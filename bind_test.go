@@ -0,0 +1,65 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type createUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func (u *createUser) Validate() error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	if u.Email == "taken@example.com" {
+		return restflex.NewAPIError(http.StatusConflict, nil, "email is taken")
+	}
+	return nil
+}
+
+func TestBind(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	api := restflex.NewHandlerWithContext(logger, restflex.Bind[createUser](httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		u, ok := restflex.RequestBody[createUser](ctx)
+		if !ok {
+			t.Fatal("expected request body in context")
+		}
+		return restflex.WriteJSON(w, http.StatusCreated, u)
+	})))
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		errors []string
+	}{
+		{name: "valid", body: `{"name":"alice","email":"alice@example.com"}`, status: http.StatusCreated},
+		{name: "malformed", body: `{"name":`, status: http.StatusBadRequest, errors: restflex.ErrInvalidRequestBody.Errors()},
+		{name: "wrong type", body: `{"name":1}`, status: http.StatusBadRequest, errors: []string{`invalid field "name"`}},
+		{name: "invalid", body: `{"email":"alice@example.com"}`, status: http.StatusUnprocessableEntity, errors: []string{"name is required"}},
+		{name: "API error", body: `{"name":"bob","email":"taken@example.com"}`, status: http.StatusConflict, errors: []string{"email is taken"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			res := resttest.Post("/users").WithBody("application/json", []byte(tt.body)).To(api).Expect(t).Status(tt.status)
+			if tt.errors != nil {
+				res.Error(tt.errors...)
+				return
+			}
+			res.JSONPath("$.name", "alice")
+		})
+	}
+}
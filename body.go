@@ -0,0 +1,98 @@
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"kkn.fi/infra"
+)
+
+// replayableBody is a request body read into memory which can be read again
+// after rewinding.
+type replayableBody struct {
+	*bytes.Reader
+}
+
+func (replayableBody) Close() error {
+	return nil
+}
+
+type bufferedBodyContextKey struct{}
+
+// bufferedBody is a request body read by BufferBody.
+type bufferedBody struct {
+	data []byte
+	// decoded is set if data was read through the body decoding of the
+	// handler, as BufferBody was used inside the handler.
+	decoded bool
+}
+
+// reader returns a reader of the body decoded like the request body of the
+// handler serving ctx.
+func (b *bufferedBody) reader(ctx context.Context) io.ReadCloser {
+	body := io.ReadCloser(replayableBody{Reader: bytes.NewReader(b.data)})
+	if b.decoded {
+		return body
+	}
+	return requestDecoding(ctx).wrap(body)
+}
+
+// BufferBody returns a middleware reading request bodies of up to max bytes
+// into memory so that middlewares, such as signature verification, audit
+// logging or idempotency key hashing, can read the body with BufferedBody
+// and leave it intact for the handler. Larger bodies are rejected with 413
+// Request Entity Too Large.
+func BufferBody(l infra.Logger, max int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, ok := r.Context().Value(bufferedBodyContextKey{}).(*bufferedBody); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					status := http.StatusRequestEntityTooLarge
+					writeError(l, w, status, http.StatusText(status))
+					return
+				}
+				writeError(l, w, http.StatusBadRequest, ErrInvalidRequestBody.Errors()...)
+				return
+			}
+			buf := &bufferedBody{
+				data:    b,
+				decoded: requestDecoding(r.Context()) != bodyDecoding{},
+			}
+			r = r.WithContext(context.WithValue(r.Context(), bufferedBodyContextKey{}, buf))
+			r.Body = replayableBody{Reader: bytes.NewReader(b)}
+			r.GetBody = func() (io.ReadCloser, error) {
+				return replayableBody{Reader: bytes.NewReader(b)}, nil
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BufferedBody returns the request body read by BufferBody and rewinds
+// r.Body so the next reader sees the whole body again, decoded like the
+// request body of the handler. The returned bytes must not be modified.
+func BufferedBody(r *http.Request) ([]byte, bool) {
+	buf, ok := r.Context().Value(bufferedBodyContextKey{}).(*bufferedBody)
+	if !ok {
+		return nil, false
+	}
+	if body, ok := r.Body.(replayableBody); ok {
+		_, _ = body.Seek(0, io.SeekStart)
+	} else {
+		r.Body = buf.reader(r.Context())
+	}
+	return buf.data, true
+}
@@ -0,0 +1,129 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestBufferBody(t *testing.T) {
+	t.Parallel()
+	const body = `{"name":"alice"}`
+	verify := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, ok := restflex.BufferedBody(r)
+			if !ok || string(b) != body {
+				t.Errorf("expected buffered body %q, got %q", body, b)
+			}
+			// Consuming the body must not hide it from the handler.
+			_, _ = io.ReadAll(r.Body)
+			if b, _ := restflex.BufferedBody(r); string(b) != body {
+				t.Errorf("expected buffered body %q again, got %q", body, b)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := restflex.BufferBody(resttest.NewLogger(), 64)(verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil || string(b) != body {
+			t.Errorf("expected handler to read body %q, got %q (%v)", body, b, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	resttest.Post("/").WithBody("application/json", []byte(body)).To(h).Expect(t).Status(http.StatusNoContent)
+}
+
+func TestBufferBodyTooLarge(t *testing.T) {
+	t.Parallel()
+	h := restflex.BufferBody(resttest.NewLogger(), 4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected handler not to be called")
+	}))
+	resttest.Post("/").WithBody("application/json", []byte("too large")).To(h).Expect(t).
+		Status(http.StatusRequestEntityTooLarge).
+		Error(http.StatusText(http.StatusRequestEntityTooLarge))
+}
+
+func TestDecodeJSONRaw(t *testing.T) {
+	t.Parallel()
+	const body = `{"name":"alice"}`
+	decode := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			Name string `json:"name"`
+		}
+		raw, err := restflex.DecodeJSONRaw(r, &v)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(raw) != body || v.Name != "alice" {
+			t.Errorf("expected raw body %q and name alice, got %q and %q", body, raw, v.Name)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		name string
+		h    http.Handler
+	}{
+		{name: "unbuffered", h: decode},
+		{name: "buffered", h: restflex.BufferBody(resttest.NewLogger(), 64)(decode)},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resttest.Post("/").WithBody("application/json", []byte(body)).To(tt.h).Expect(t).Status(http.StatusNoContent)
+		})
+	}
+}
+
+func TestDecodeJSONRawInvalid(t *testing.T) {
+	t.Parallel()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{"))
+	var v map[string]any
+	raw, err := restflex.DecodeJSONRaw(r, &v)
+	var apiError restflex.APIError
+	if !errors.As(err, &apiError) || apiError.StatusCode() != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %v", err)
+	}
+	if string(raw) != "{" {
+		t.Errorf("expected raw body to be returned, got %q", raw)
+	}
+}
+
+func TestBufferBody_latin1(t *testing.T) {
+	t.Parallel()
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if _, ok := restflex.BufferedBody(r); !ok {
+			t.Error("expected buffered body")
+		}
+		var v struct {
+			Name string `json:"name"`
+		}
+		if err := restflex.DecodeJSON(r.Body, &v); err != nil {
+			return err
+		}
+		var raw struct {
+			Name string `json:"name"`
+		}
+		if _, err := restflex.DecodeJSONRaw(r, &raw); err != nil {
+			return err
+		}
+		if raw != v {
+			t.Errorf("expected DecodeJSONRaw to decode %v like r.Body, got %v", v, raw)
+		}
+		return restflex.WriteJSON(w, http.StatusOK, v)
+	}), restflex.WithLatin1JSON())
+	h := restflex.BufferBody(resttest.NewLogger(), 1<<10)(api)
+	resttest.Post("/").WithBody("application/json; charset=iso-8859-1", []byte("{\"name\":\"J\xfcrgen\"}")).To(h).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.name", "Jürgen")
+}
@@ -0,0 +1,225 @@
+package restflex
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all requests.
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of probe requests through.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops calls to a failing dependency. It opens when the
+// ratio of failures among the latest WindowSize calls reaches FailureRatio,
+// rejects calls while open and, after OpenTimeout, lets HalfOpenRequests
+// probe calls through to decide whether to close again. Rejected calls fail
+// with a 503 APIError carrying Retry-After.
+type CircuitBreaker struct {
+	// Name identifies the dependency in errors and state changes.
+	Name string
+	// FailureRatio is the ratio of failed calls opening the breaker.
+	FailureRatio float64
+	// MinRequests is the number of calls needed before the breaker may open.
+	MinRequests int
+	// WindowSize is the number of latest calls considered.
+	WindowSize int
+	// OpenTimeout is the time the breaker stays open before probing.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of concurrent probe calls.
+	HalfOpenRequests int
+	// OnStateChange, if set, is called on every state change, e.g. to
+	// record metrics. It must not call the breaker.
+	OnStateChange func(name string, from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	outcomes []bool
+	next     int
+	openedAt time.Time
+	probes   int
+}
+
+// NewCircuitBreaker returns a breaker opening when half of at least 10 of
+// the latest 20 calls fail, probing with one call after 30 seconds.
+func NewCircuitBreaker(name string) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:             name,
+		FailureRatio:     0.5,
+		MinRequests:      10,
+		WindowSize:       20,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Allow reports whether a call may proceed. If it may, done must be called
+// with the outcome of the call.
+func (cb *CircuitBreaker) Allow() (done func(success bool), err error) {
+	done, _, err = cb.allow()
+	return done, err
+}
+
+// allow is Allow also returning release, which ends the call without an
+// outcome, for calls abandoned by their caller.
+func (cb *CircuitBreaker) allow() (done func(success bool), release func(), err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case BreakerOpen:
+		wait := cb.OpenTimeout - time.Since(cb.openedAt)
+		if wait > 0 {
+			return nil, nil, NewServiceUnavailable(wait, cb.Name+" is unavailable")
+		}
+		cb.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if cb.probes >= max(cb.HalfOpenRequests, 1) {
+			return nil, nil, NewServiceUnavailable(cb.OpenTimeout, cb.Name+" is unavailable")
+		}
+		cb.probes++
+		return cb.probeDone, cb.releaseProbe, nil
+	}
+	return cb.record, func() {}, nil
+}
+
+// Do calls fn if the breaker allows it, counting a non-nil error as failure.
+func (cb *CircuitBreaker) Do(fn func() error) error {
+	done, err := cb.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err == nil)
+	return err
+}
+
+func (cb *CircuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state != BreakerClosed {
+		return
+	}
+	size := max(cb.WindowSize, 1)
+	if len(cb.outcomes) < size {
+		cb.outcomes = append(cb.outcomes, success)
+	} else {
+		cb.outcomes[cb.next] = success
+		cb.next = (cb.next + 1) % size
+	}
+	if len(cb.outcomes) < cb.MinRequests {
+		return
+	}
+	failures := 0
+	for _, ok := range cb.outcomes {
+		if !ok {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(cb.outcomes)) >= cb.FailureRatio {
+		cb.open()
+	}
+}
+
+func (cb *CircuitBreaker) probeDone(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probes--
+	if cb.state != BreakerHalfOpen {
+		return
+	}
+	if !success {
+		cb.open()
+		return
+	}
+	cb.outcomes = cb.outcomes[:0]
+	cb.next = 0
+	cb.setState(BreakerClosed)
+}
+
+// releaseProbe ends a probe call without deciding the state.
+func (cb *CircuitBreaker) releaseProbe() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probes--
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.openedAt = time.Now()
+	cb.setState(BreakerOpen)
+}
+
+func (cb *CircuitBreaker) setState(s BreakerState) {
+	if cb.state == s {
+		return
+	}
+	from := cb.state
+	cb.state = s
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(cb.Name, from, s)
+	}
+}
+
+// Transport returns an http.RoundTripper making requests with next, or
+// http.DefaultTransport if next is nil, through the breaker. Transport errors
+// and 5xx responses count as failures. Wrap the transport of a proxy to
+// protect its upstream:
+//
+//	p := restflex.NewProxy(l, target, policy)
+//	p.Transport = cb.Transport(p.Transport)
+func (cb *CircuitBreaker) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		done, release, err := cb.allow()
+		if err != nil {
+			return nil, err
+		}
+		res, err := next.RoundTrip(req)
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			// The caller gave up, which tells nothing about the
+			// dependency.
+			release()
+		case err != nil:
+			done(false)
+		default:
+			done(res.StatusCode < http.StatusInternalServerError)
+		}
+		return res, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,130 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	var changes []string
+	cb := restflex.NewCircuitBreaker("billing")
+	cb.MinRequests = 2
+	cb.WindowSize = 4
+	cb.OpenTimeout = 20 * time.Millisecond
+	cb.OnStateChange = func(name string, from, to restflex.BreakerState) {
+		changes = append(changes, from.String()+"->"+to.String())
+	}
+	errFailed := errors.New("upstream failed")
+	fail := func() error { return errFailed }
+	succeed := func() error { return nil }
+
+	if err := cb.Do(succeed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cb.Do(fail); !errors.Is(err, errFailed) {
+		t.Fatalf("expected call error, got %v", err)
+	}
+	if state := cb.State(); state != restflex.BreakerOpen {
+		t.Fatalf("expected breaker to be open, got %v", state)
+	}
+	err := cb.Do(succeed)
+	var apiErr restflex.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode() != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 API error from open breaker, got %v", err)
+	}
+	var ra restflex.RetryAfterError
+	if !errors.As(err, &ra) || ra.RetryAfter() <= 0 {
+		t.Errorf("expected positive Retry-After, got %v", err)
+	}
+
+	time.Sleep(cb.OpenTimeout)
+	if err := cb.Do(succeed); err != nil {
+		t.Fatalf("expected probe call to be allowed, got %v", err)
+	}
+	if state := cb.State(); state != restflex.BreakerClosed {
+		t.Errorf("expected breaker to be closed, got %v", state)
+	}
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("expected state changes %v, got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("expected state changes %v, got %v", want, changes)
+		}
+	}
+}
+
+func TestCircuitBreaker_rejection_sets_Retry_After(t *testing.T) {
+	t.Parallel()
+	cb := restflex.NewCircuitBreaker("search")
+	cb.MinRequests = 1
+	_ = cb.Do(func() error { return errors.New("down") })
+	h := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return cb.Do(func() error {
+			w.WriteHeader(http.StatusOK)
+			return nil
+		})
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	res := rec.Result()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, but got %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if got := res.Header.Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After %q, got %q", "30", got)
+	}
+}
+
+func TestCircuitBreaker_cancelled_probe(t *testing.T) {
+	t.Parallel()
+	cb := restflex.NewCircuitBreaker("billing")
+	cb.MinRequests = 1
+	cb.OpenTimeout = 10 * time.Millisecond
+	_ = cb.Do(func() error { return errors.New("down") })
+	var calls int
+	client := &http.Client{Transport: cb.Transport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))}
+
+	time.Sleep(cb.OpenTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://billing.test/", nil)
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the probe to be cancelled, got %v", err)
+	}
+	if state := cb.State(); state != restflex.BreakerHalfOpen {
+		t.Fatalf("expected a cancelled probe to leave the breaker half-open, got %v", state)
+	}
+	res, err := client.Get("http://billing.test/")
+	if err != nil {
+		t.Fatalf("expected the next probe to be allowed, got %v", err)
+	}
+	res.Body.Close()
+	if state := cb.State(); state != restflex.BreakerClosed || calls != 2 {
+		t.Errorf("expected the breaker to close after a successful probe, got %v after %d calls", state, calls)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,273 @@
+package restflex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// DropPolicy decides what happens to an event published to a subscriber
+// whose buffer is full.
+type DropPolicy int
+
+const (
+	// DropNewest drops the published event.
+	DropNewest DropPolicy = iota
+	// DropOldest drops the oldest buffered event to make room.
+	DropOldest
+	// DropSubscriber closes the subscription, so that a slow client
+	// reconnects instead of silently missing events.
+	DropSubscriber
+)
+
+// Broker is an in-process topic based publish/subscribe broker, for example
+// for broadcasting events to clients connected to EventStream. Every
+// subscriber has a buffer of its own so that slow subscribers don't hold up
+// publishers or each other.
+type Broker struct {
+	// Buffer is the number of events buffered per subscriber.
+	Buffer int
+	// Drop is the policy for subscribers whose buffer is full.
+	Drop DropPolicy
+
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroker returns a broker buffering buffer events per subscriber. Streams
+// of EventStream run until the broker is closed or their clients go away,
+// so a server shutting down waits for them unless the broker is closed
+// with it:
+//
+//	s.RegisterOnShutdown(b.Close)
+func NewBroker(buffer int) *Broker {
+	return &Broker{
+		Buffer: buffer,
+		topics: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events published to its topics.
+type Subscription struct {
+	broker  *Broker
+	topics  []string
+	mu      sync.Mutex
+	events  chan Event
+	closed  bool
+	dropped atomic.Uint64
+	// reconnect is the time the client is asked to reconnect after once
+	// the broker has shut down.
+	reconnect time.Duration
+}
+
+// Subscribe returns a subscription to topics. It must be closed when no
+// longer used. The subscription is closed right away if the broker is.
+func (b *Broker) Subscribe(topics ...string) *Subscription {
+	s := &Subscription{broker: b, topics: topics, events: make(chan Event, b.Buffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.closed = true
+		close(s.events)
+		return s
+	}
+	for _, topic := range topics {
+		if b.topics[topic] == nil {
+			b.topics[topic] = make(map[*Subscription]struct{})
+		}
+		b.topics[topic][s] = struct{}{}
+	}
+	return s
+}
+
+// Publish sends e to the subscribers of topic and returns the number of
+// subscribers it was delivered to.
+func (b *Broker) Publish(topic string, e Event) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	delivered := 0
+	for s := range b.topics[topic] {
+		if s.send(e, b.Drop) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// Close closes all subscriptions. Later subscriptions are closed at once.
+func (b *Broker) Close() {
+	b.Shutdown(0)
+}
+
+// Shutdown closes all subscriptions asking their clients to reconnect after
+// about retry, with jitter so that they don't all reconnect at once. Streams
+// of EventStream end with a final reconnect event instead of being cut off
+// while the server drains. Register it to run when the server shuts down:
+//
+//	s.RegisterOnShutdown(func() { broker.Shutdown(5 * time.Second) })
+func (b *Broker) Shutdown(retry time.Duration) {
+	b.mu.Lock()
+	b.closed = true
+	topics := b.topics
+	b.topics = make(map[string]map[*Subscription]struct{})
+	b.mu.Unlock()
+	for _, subs := range topics {
+		for s := range subs {
+			var reconnect time.Duration
+			if retry > 0 {
+				reconnect = retry + rand.N(retry)
+			}
+			s.close(reconnect)
+		}
+	}
+}
+
+// Events returns the channel of events, which is closed when the
+// subscription is.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Reconnect returns the time after which the client should reconnect if the
+// subscription was closed by Shutdown. It must only be called once the
+// events channel has been closed.
+func (s *Subscription) Reconnect() (time.Duration, bool) {
+	return s.reconnect, s.reconnect > 0
+}
+
+// Close unsubscribes from the broker and closes the events channel.
+func (s *Subscription) Close() {
+	b := s.broker
+	b.mu.Lock()
+	for _, topic := range s.topics {
+		delete(b.topics[topic], s)
+		if len(b.topics[topic]) == 0 {
+			delete(b.topics, topic)
+		}
+	}
+	b.mu.Unlock()
+	s.close(0)
+}
+
+// close closes the events channel asking the client to reconnect after
+// reconnect if it is positive.
+func (s *Subscription) close(reconnect time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.reconnect = reconnect
+		close(s.events)
+	}
+}
+
+// send buffers e applying policy if the buffer is full and reports whether
+// e was buffered.
+func (s *Subscription) send(e Event, policy DropPolicy) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.events <- e:
+		return true
+	default:
+	}
+	s.dropped.Add(1)
+	switch policy {
+	case DropOldest:
+		select {
+		case <-s.events:
+		default:
+		}
+		select {
+		case s.events <- e:
+			return true
+		default:
+			return false
+		}
+	case DropSubscriber:
+		s.closed = true
+		close(s.events)
+	}
+	return false
+}
+
+// EventStream returns a handler streaming the events published to the
+// topics returned by topics as server-sent events. The Type of an event is
+// sent as the event name, its ID as the event ID and its Payload encoded as
+// JSON as the data. Events whose Type or ID contain line breaks, which would
+// let them forge events, are dropped. The stream ends when the client goes away or the subscription is closed,
+// after a final reconnect event if the broker was shut down.
+func EventStream(l infra.Logger, b *Broker, topics func(*http.Request) []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub := b.Subscribe(topics(r)...)
+		defer sub.Close()
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			l.Printf("restflex: event stream: %v", err)
+			return
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-sub.Events():
+				if !ok {
+					if retry, ok := sub.Reconnect(); ok {
+						_, _ = fmt.Fprintf(w, ": server shutting down\nretry: %d\nevent: reconnect\ndata: {\"retry_ms\":%[1]d}\n\n", retry.Milliseconds())
+						_ = rc.Flush()
+					}
+					return
+				}
+				if strings.ContainsAny(e.Type, "\r\n") || strings.ContainsAny(e.ID, "\r\n\x00") {
+					l.Printf("error: restflex: event stream: dropped event %q with a line break in its type or ID", e.Type)
+					continue
+				}
+				if err := writeEvent(w, e); err != nil {
+					l.Printf("restflex: event stream: %v", err)
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// writeEvent writes e in the server-sent events format.
+func writeEvent(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e.Payload)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Type)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,158 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		policy restflex.DropPolicy
+		want   []any
+		closed bool
+	}{
+		{name: "drop newest", policy: restflex.DropNewest, want: []any{1, 2}},
+		{name: "drop oldest", policy: restflex.DropOldest, want: []any{2, 3}},
+		{name: "drop subscriber", policy: restflex.DropSubscriber, want: []any{1, 2}, closed: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := restflex.NewBroker(2)
+			b.Drop = tt.policy
+			sub := b.Subscribe("users")
+			other := b.Subscribe("orders")
+			defer other.Close()
+			for i := 1; i <= 3; i++ {
+				b.Publish("users", restflex.Event{Type: "user.created", Payload: i})
+			}
+			if !tt.closed {
+				sub.Close()
+			}
+			var got []any
+			for e := range sub.Events() {
+				got = append(got, e.Payload)
+			}
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			if sub.Dropped() != 1 {
+				t.Errorf("expected 1 dropped event, got %d", sub.Dropped())
+			}
+			if n := b.Publish("users", restflex.Event{}); n != 0 {
+				t.Errorf("expected no subscribers after close, got %d", n)
+			}
+		})
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	t.Parallel()
+	b := restflex.NewBroker(8)
+	srv := httptest.NewServer(restflex.EventStream(resttest.NewLogger(), b, func(r *http.Request) []string {
+		return []string{r.URL.Query().Get("topic")}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?topic=users", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected event stream, got %q", ct)
+	}
+	for b.Publish("users", restflex.Event{Type: "user.created", Payload: map[string]string{"name": "alice"}}) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+	body := new(strings.Builder)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		body.WriteString(scanner.Text() + "\n")
+	}
+	if want := "event: user.created\ndata: {\"name\":\"alice\"}\n\n"; body.String() != want {
+		t.Errorf("expected %q, got %q", want, body.String())
+	}
+}
+
+func TestEventStream_shutdown(t *testing.T) {
+	t.Parallel()
+	b := restflex.NewBroker(8)
+	srv := httptest.NewServer(restflex.EventStream(resttest.NewLogger(), b, func(r *http.Request) []string {
+		return []string{"users"}
+	}))
+	defer srv.Close()
+	srv.Config.RegisterOnShutdown(func() { b.Shutdown(time.Second) })
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	for b.Publish("users", restflex.Event{Type: "ping"}) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = srv.Config.Shutdown(ctx) }()
+	body := new(strings.Builder)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		body.WriteString(scanner.Text() + "\n")
+	}
+	if !regexp.MustCompile(`^event: ping\ndata: null\n\n: server shutting down\nretry: 1\d{3}\nevent: reconnect\ndata: \{"retry_ms":1\d{3}\}\n\n$`).MatchString(body.String()) {
+		t.Errorf("unexpected stream %q", body.String())
+	}
+}
+
+func TestEventStream_line_breaks(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	b := restflex.NewBroker(8)
+	srv := httptest.NewServer(restflex.EventStream(logger, b, func(r *http.Request) []string {
+		return []string{"users"}
+	}))
+	defer srv.Close()
+	srv.Config.RegisterOnShutdown(b.Close)
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	for b.Publish("users", restflex.Event{Type: "user.created\ndata: forged"}) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Publish("users", restflex.Event{Type: "user.created", ID: "1\r\nevent: forged"})
+	b.Publish("users", restflex.Event{Type: "user.created", ID: "2", Payload: "alice"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = srv.Config.Shutdown(ctx) }()
+	body := new(strings.Builder)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		body.WriteString(scanner.Text() + "\n")
+	}
+	if want := "id: 2\nevent: user.created\ndata: \"alice\"\n\n"; body.String() != want {
+		t.Errorf("expected %q, got %q", want, body.String())
+	}
+	logger.ExpectCount(t, "error: restflex: event stream: dropped event", 2)
+}
@@ -0,0 +1,85 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"kkn.fi/infra"
+)
+
+// ItemResult is the result of an item of a bulk request.
+type ItemResult struct {
+	// Index is the position of the item in the request.
+	Index  int      `json:"index"`
+	Status int      `json:"status"`
+	Errors []string `json:"errors,omitempty"`
+	Data   any      `json:"data,omitempty"`
+}
+
+// MultiStatus is the response body of a bulk request reporting the result
+// of each item, so that clients only need to resubmit the failed ones.
+type MultiStatus struct {
+	Results []ItemResult `json:"results"`
+}
+
+// Add records the result of item index. A nil err is 200 OK with data, an
+// APIError its status and messages, and any other error 500 Internal Server
+// Error.
+func (m *MultiStatus) Add(index int, data any, err error) {
+	result := ItemResult{Index: index, Status: http.StatusOK, Data: data}
+	var apiError APIError
+	switch {
+	case err == nil:
+	case errors.As(err, &apiError):
+		result.Status = apiError.StatusCode()
+		result.Errors = apiError.Errors()
+		result.Data = nil
+	default:
+		result.Status = http.StatusInternalServerError
+		result.Errors = []string{http.StatusText(http.StatusInternalServerError)}
+		result.Data = nil
+	}
+	m.Results = append(m.Results, result)
+}
+
+// Status returns the status of the whole response: the status shared by
+// all items, or 207 Multi-Status if they differ.
+func (m *MultiStatus) Status() int {
+	if len(m.Results) == 0 {
+		return http.StatusOK
+	}
+	status := m.Results[0].Status
+	for _, r := range m.Results[1:] {
+		if r.Status != status {
+			return http.StatusMultiStatus
+		}
+	}
+	return status
+}
+
+// Bulk calls fn for each item in order and collects the results. Errors
+// other than APIErrors are logged with the index of the item. Items left
+// when ctx is done are reported with 503 Service Unavailable.
+func Bulk[T any](ctx context.Context, l infra.Logger, items []T, fn func(ctx context.Context, item T) (any, error)) *MultiStatus {
+	m := &MultiStatus{Results: make([]ItemResult, 0, len(items))}
+	for i, item := range items {
+		if ctx.Err() != nil {
+			m.Add(i, nil, NewServiceUnavailable(0, "request canceled before item was processed"))
+			continue
+		}
+		data, err := fn(ctx, item)
+		var apiError APIError
+		if err != nil && !errors.As(err, &apiError) {
+			l.Printf("error: restflex: bulk item %d: %v", i, err)
+		}
+		m.Add(i, data, err)
+	}
+	return m
+}
+
+// WriteMultiStatus writes m as JSON with the status returned by its Status
+// method.
+func WriteMultiStatus(w http.ResponseWriter, m *MultiStatus) error {
+	return WriteJSON(w, m.Status(), m)
+}
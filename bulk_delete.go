@@ -0,0 +1,152 @@
+package restflex
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+const (
+	// DryRunParam is the query parameter asking a destructive bulk
+	// operation for a preview of the items it would affect.
+	DryRunParam = "dry_run"
+	// ConfirmationTokenHeader carries the confirmation token of a preview
+	// in the request running the operation.
+	ConfirmationTokenHeader = "X-Confirmation-Token"
+)
+
+var (
+	// ErrConfirmationRequired is returned when a destructive bulk operation
+	// is run without the confirmation token of a preview.
+	ErrConfirmationRequired = NewAPIError(http.StatusPreconditionRequired, nil, "confirmation token from a dry run required")
+
+	// ErrInvalidConfirmation is returned for a confirmation token which is
+	// malformed, expired or issued for another request.
+	ErrInvalidConfirmation = NewAPIError(http.StatusForbidden, nil, "invalid or expired confirmation token")
+
+	// ErrPreviewChanged is returned when the items the operation would
+	// affect have changed since the preview.
+	ErrPreviewChanged = NewAPIError(http.StatusConflict, nil, "affected items have changed since the dry run")
+)
+
+// BulkPreview is the response of a dry run.
+type BulkPreview[T any] struct {
+	Items             []T       `json:"items"`
+	Count             int       `json:"count"`
+	ConfirmationToken string    `json:"confirmation_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// BulkDelete is a handler for destructive bulk operations such as deleting
+// the items matching a filter. A request with the dry_run query parameter
+// set responds with the items Select returns and a confirmation token
+// without changing anything. The real run must send the token in the
+// X-Confirmation-Token header and is refused if Select no longer returns
+// the same items, so that only the previewed items are deleted.
+type BulkDelete[T any] struct {
+	// Select returns the items the request affects.
+	Select func(ctx context.Context, r *http.Request) ([]T, error)
+	// Delete deletes an item. Its results are reported as in Bulk.
+	Delete func(ctx context.Context, item T) (any, error)
+	// Key signs the confirmation tokens.
+	Key []byte
+	// TTL is how long a confirmation token is valid. Defaults to 5 minutes.
+	TTL time.Duration
+	Log infra.Logger
+}
+
+func NewBulkDelete[T any](l infra.Logger, key []byte, sel func(ctx context.Context, r *http.Request) ([]T, error), del func(ctx context.Context, item T) (any, error)) *BulkDelete[T] {
+	return &BulkDelete[T]{
+		Select: sel,
+		Delete: del,
+		Key:    key,
+		TTL:    5 * time.Minute,
+		Log:    l,
+	}
+}
+
+func (d *BulkDelete[T]) ServeHTTPWithContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	dryRun := false
+	if v := r.URL.Query().Get(DryRunParam); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return NewBadRequest("invalid " + DryRunParam + " parameter")
+		}
+	}
+	token := r.Header.Get(ConfirmationTokenHeader)
+	if !dryRun && token == "" {
+		return ErrConfirmationRequired
+	}
+	items, err := d.Select(ctx, r)
+	if err != nil {
+		return err
+	}
+	digest, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if dryRun {
+		expires := now.Add(cmp.Or(d.TTL, 5*time.Minute)).Truncate(time.Second)
+		return WriteJSON(w, http.StatusOK, BulkPreview[T]{
+			Items:             items,
+			Count:             len(items),
+			ConfirmationToken: d.token(r, expires, digest),
+			ExpiresAt:         expires.UTC(),
+		})
+	}
+	if err := d.verify(r, token, digest, now); err != nil {
+		return err
+	}
+	return WriteMultiStatus(w, Bulk(ctx, d.Log, items, d.Delete))
+}
+
+// token returns a confirmation token for the request r affecting the
+// encoded items digest, valid until expires.
+func (d *BulkDelete[T]) token(r *http.Request, expires time.Time, digest []byte) string {
+	b := binary.BigEndian.AppendUint64(nil, uint64(expires.Unix()))
+	b = append(b, d.mac(r, b, nil)...)
+	b = append(b, d.mac(r, b[:8], digest)...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// verify checks that token was issued for r and has not expired, and that
+// the items digest has not changed.
+func (d *BulkDelete[T]) verify(r *http.Request, token string, digest []byte, now time.Time) error {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 8+2*sha256.Size {
+		return ErrInvalidConfirmation
+	}
+	expires, request, items := b[:8], b[8:8+sha256.Size], b[8+sha256.Size:]
+	if !hmac.Equal(request, d.mac(r, expires, nil)) || now.Unix() > int64(binary.BigEndian.Uint64(expires)) {
+		return ErrInvalidConfirmation
+	}
+	if !hmac.Equal(items, d.mac(r, expires, digest)) {
+		return ErrPreviewChanged
+	}
+	return nil
+}
+
+// mac returns the MAC of the method, path and query of r without the dry
+// run parameter, the expiry and, if set, the items digest.
+func (d *BulkDelete[T]) mac(r *http.Request, expires, digest []byte) []byte {
+	q := r.URL.Query()
+	q.Del(DryRunParam)
+	m := hmac.New(sha256.New, d.Key)
+	m.Write([]byte(r.Method + " " + r.URL.Path + "?" + q.Encode() + "\n"))
+	m.Write(expires)
+	if digest != nil {
+		m.Write([]byte("\n"))
+		m.Write(digest)
+	}
+	return m.Sum(nil)
+}
@@ -0,0 +1,80 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestBulkDelete(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	items := []string{"old-1", "old-2", "new-1"}
+	remove := func(item string) {
+		mu.Lock()
+		defer mu.Unlock()
+		items = slices.DeleteFunc(items, func(s string) bool { return s == item })
+	}
+	d := restflex.NewBulkDelete(resttest.NewLogger(), []byte("secret"),
+		func(ctx context.Context, r *http.Request) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var selected []string
+			for _, item := range items {
+				if strings.HasPrefix(item, r.URL.Query().Get("tag")+"-") {
+					selected = append(selected, item)
+				}
+			}
+			return selected, nil
+		},
+		func(ctx context.Context, item string) (any, error) {
+			remove(item)
+			return item, nil
+		})
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), d)
+
+	resttest.Delete("/items").WithQuery("tag", "old").To(api).Expect(t).
+		Status(http.StatusPreconditionRequired)
+	resttest.Delete("/items").WithQuery("tag", "old").WithQuery(restflex.DryRunParam, "maybe").To(api).Expect(t).
+		Status(http.StatusBadRequest)
+
+	res := resttest.Delete("/items").WithQuery("tag", "old").WithQuery(restflex.DryRunParam, "true").To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.count", 2.0).
+		JSONPath("$.items[1]", "old-2")
+	var preview restflex.BulkPreview[string]
+	if err := json.Unmarshal(res.Body, &preview); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("dry run deleted items: %v", items)
+	}
+
+	resttest.Delete("/items").WithQuery("tag", "new").WithHeader(restflex.ConfirmationTokenHeader, preview.ConfirmationToken).To(api).Expect(t).
+		Status(http.StatusForbidden)
+	resttest.Delete("/items").WithQuery("tag", "old").WithHeader(restflex.ConfirmationTokenHeader, "bogus").To(api).Expect(t).
+		Status(http.StatusForbidden)
+
+	remove("old-2")
+	resttest.Delete("/items").WithQuery("tag", "old").WithHeader(restflex.ConfirmationTokenHeader, preview.ConfirmationToken).To(api).Expect(t).
+		Status(http.StatusConflict)
+	mu.Lock()
+	items = append(items, "old-2")
+	mu.Unlock()
+
+	resttest.Delete("/items").WithQuery("tag", "old").WithHeader(restflex.ConfirmationTokenHeader, preview.ConfirmationToken).To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.results[0].data", "old-1")
+	if !slices.Equal(items, []string{"new-1"}) {
+		t.Errorf("items = %v, want [new-1]", items)
+	}
+}
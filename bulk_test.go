@@ -0,0 +1,48 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestBulk(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var names []string
+		if err := restflex.DecodeJSON(r.Body, &names); err != nil {
+			return err
+		}
+		results := restflex.Bulk(ctx, logger, names, func(ctx context.Context, name string) (any, error) {
+			switch name {
+			case "":
+				return nil, restflex.NewValidationError(http.StatusUnprocessableEntity, nil, "name is required")
+			case "crash":
+				return nil, errors.New("database unavailable")
+			}
+			return map[string]string{"name": name}, nil
+		})
+		return restflex.WriteMultiStatus(w, results)
+	}))
+
+	resttest.Post("/users/bulk").WithJSON([]string{"alice", "", "crash"}).To(api).Expect(t).
+		Status(http.StatusMultiStatus).
+		JSONPath("$.results[0].status", float64(http.StatusOK)).
+		JSONPath("$.results[0].data.name", "alice").
+		JSONPath("$.results[1].index", float64(1)).
+		JSONPath("$.results[1].status", float64(http.StatusUnprocessableEntity)).
+		JSONPath("$.results[1].errors[0]", "name is required").
+		JSONPath("$.results[2].status", float64(http.StatusInternalServerError))
+	logger.ExpectCount(t, "bulk item 2: database unavailable", 1)
+	resttest.Post("/users/bulk").WithJSON([]string{"alice", "bob"}).To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.results[1].data.name", "bob")
+}
@@ -0,0 +1,372 @@
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// CachedResponse is a stored HTTP response.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Created is the time the response was produced.
+	Created time.Time
+	// Expires is the time after which the response is stale.
+	Expires time.Time
+	// StaleUntil is the time until which a stale response may still be
+	// served while it is being revalidated.
+	StaleUntil time.Time
+	// StaleIfErrorUntil is the time until which a stale response may be
+	// served in place of a server error response.
+	StaleIfErrorUntil time.Time
+}
+
+// RetainUntil returns the time after which the response can't be served.
+func (res *CachedResponse) RetainUntil() time.Time {
+	if res.StaleIfErrorUntil.After(res.StaleUntil) {
+		return res.StaleIfErrorUntil
+	}
+	return res.StaleUntil
+}
+
+// CacheStore stores cached responses. Implementations must be safe for
+// concurrent use and may drop entries after RetainUntil has passed.
+type CacheStore interface {
+	// Get returns the response stored with key. Found is false if there is
+	// no such response.
+	Get(ctx context.Context, key string) (res *CachedResponse, found bool, err error)
+	// Set stores the response with key.
+	Set(ctx context.Context, key string, res *CachedResponse) error
+	// DeletePrefix removes all responses whose key starts with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// Cache is a middleware caching responses to GET requests.
+type Cache struct {
+	// Store holds cached responses.
+	Store CacheStore
+	// TTL is the time a response is served from cache without calling the handler.
+	TTL time.Duration
+	// StaleWhileRevalidate is the time after TTL during which a stale
+	// response is served while a fresh one is produced in the background.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is the time after TTL during which a stale response is
+	// served with a Warning header when the handler fails with a 5xx
+	// status.
+	StaleIfError time.Duration
+	// Vary lists request headers that are part of the cache key. Responses
+	// varying on other headers are not cached.
+	//
+	// Requests with Authorization or Cookie headers are cached apart from
+	// anonymous ones by their principal, and only responses marked
+	// Cache-Control: public are cached for them, so that responses of a
+	// user are never served to other users.
+	Vary []string
+	// Log logs messages
+	Log infra.Logger
+
+	revalidating sync.Map
+}
+
+func NewCache(l infra.Logger, s CacheStore, ttl time.Duration) *Cache {
+	return &Cache{
+		Store: s,
+		TTL:   ttl,
+		Log:   l,
+	}
+}
+
+type cacheContextKey struct{}
+
+// Wrap returns a handler serving GET responses from cache. Requests with
+// other methods are passed to next with the cache available to
+// InvalidateCache.
+func (c *Cache) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), cacheContextKey{}, c))
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := c.key(r)
+		res, found, err := c.Store.Get(r.Context(), key)
+		if err != nil {
+			c.Log.Printf("restflex: cache get: %v", err)
+		}
+		now := time.Now()
+		if found && now.Before(res.StaleUntil) {
+			if !now.Before(res.Expires) {
+				c.revalidate(next, r, key)
+			}
+			writeCachedResponse(w, res, now)
+			return
+		}
+		if found && now.Before(res.StaleIfErrorUntil) {
+			c.serveStaleIfError(next, w, r, key, res)
+			return
+		}
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+		c.store(r, key, cw.response())
+	})
+}
+
+// serveStaleIfError calls next and serves the stale response res instead
+// of a server error response.
+func (c *Cache) serveStaleIfError(next http.Handler, w http.ResponseWriter, r *http.Request, key string, res *CachedResponse) {
+	header := make(http.Header)
+	for k, v := range w.Header() {
+		header[k] = v
+	}
+	cw := &captureWriter{ResponseWriter: &discardWriter{header: header}, status: http.StatusOK}
+	next.ServeHTTP(cw, r)
+	if cw.status >= 500 {
+		c.Log.Printf("restflex: cache: serving stale response to %v after status %d", r.URL.Path, cw.status)
+		w.Header().Set("Warning", `111 - "Revalidation Failed"`)
+		writeCachedResponse(w, res, time.Now())
+		return
+	}
+	fresh := cw.response()
+	writeResponse(w, fresh)
+	c.store(r, key, fresh)
+}
+
+// Invalidate removes cached responses for the given URL paths regardless of
+// query or varying headers.
+func (c *Cache) Invalidate(ctx context.Context, paths ...string) error {
+	for _, p := range paths {
+		if err := c.Store.DeletePrefix(ctx, p+"?"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateCache removes cached responses for the given URL paths from the
+// cache serving the request. It is intended to be called from handlers
+// mutating resources and does nothing if no cache is in use.
+func InvalidateCache(ctx context.Context, paths ...string) error {
+	c, ok := ctx.Value(cacheContextKey{}).(*Cache)
+	if !ok {
+		return nil
+	}
+	return c.Invalidate(ctx, paths...)
+}
+
+// key returns the cache key of r. Credentialed requests are keyed by their
+// principal too and never share keys with anonymous requests.
+func (c *Cache) key(r *http.Request) string {
+	key := requestKey(r, c.Vary)
+	if hasCredentials(r) {
+		key += "\nPrincipal:" + Principal(r.Context())
+	}
+	return key
+}
+
+// hasCredentials reports whether r carries credentials, making its response
+// potentially specific to a user.
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// requestKey identifies a request by its path, query and the values of the
+// given request headers. Query parameter order does not affect the key.
+func requestKey(r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(r.URL.Query().Encode())
+	for _, h := range vary {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(h))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+func (c *Cache) revalidate(next http.Handler, r *http.Request, key string) {
+	if _, busy := c.revalidating.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	r = r.Clone(context.WithoutCancel(r.Context()))
+	go func() {
+		defer c.revalidating.Delete(key)
+		cw := &captureWriter{ResponseWriter: &discardWriter{header: make(http.Header)}, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+		c.store(r, key, cw.response())
+	}()
+}
+
+// store caches the response res to r with key.
+func (c *Cache) store(r *http.Request, key string, res *CachedResponse) {
+	if !isCacheable(res, hasCredentials(r)) || !c.coversVary(res) {
+		return
+	}
+	ctx := r.Context()
+	res.Expires = res.Created.Add(c.TTL)
+	res.StaleUntil = res.Expires.Add(c.StaleWhileRevalidate)
+	res.StaleIfErrorUntil = res.Expires.Add(c.StaleIfError)
+	if err := c.Store.Set(ctx, key, res); err != nil {
+		c.Log.Printf("restflex: cache set: %v", err)
+	}
+}
+
+// coversVary reports whether every header the response varies on is part of
+// the cache key.
+func (c *Cache) coversVary(res *CachedResponse) bool {
+	return coversVary(res, c.Vary)
+}
+
+// coversVary reports whether every header res varies on is listed in vary.
+func coversVary(res *CachedResponse, vary []string) bool {
+	for _, name := range VaryHeaders(res.Header) {
+		found := false
+		for _, v := range vary {
+			if http.CanonicalHeaderKey(v) == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isCacheable reports whether res may be cached. Responses to credentialed
+// requests must be explicitly public.
+func isCacheable(res *CachedResponse, credentialed bool) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+	if res.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(res.Header.Get("Cache-Control"))
+	if credentialed && !strings.Contains(cc, "public") {
+		return false
+	}
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+func writeCachedResponse(w http.ResponseWriter, res *CachedResponse, now time.Time) {
+	w.Header().Set("Age", strconv.Itoa(int(now.Sub(res.Created).Seconds())))
+	writeResponse(w, res)
+}
+
+// writeResponse writes a recorded response to w.
+func writeResponse(w http.ResponseWriter, res *CachedResponse) {
+	h := w.Header()
+	for k, v := range res.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(res.StatusCode)
+	_, _ = w.Write(res.Body)
+}
+
+// captureWriter writes a response through to the underlying
+// http.ResponseWriter while keeping a copy of it.
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if !w.wroteHeader && !isInformational(status) {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// flush writes the captured status and body to dst sharing its headers.
+func (w *captureWriter) flush(dst http.ResponseWriter) {
+	dst.WriteHeader(w.status)
+	_, _ = dst.Write(w.body.Bytes())
+}
+
+func (w *captureWriter) response() *CachedResponse {
+	return &CachedResponse{
+		StatusCode: w.status,
+		Header:     w.Header().Clone(),
+		Body:       bytes.Clone(w.body.Bytes()),
+		Created:    time.Now(),
+	}
+}
+
+// discardWriter is an http.ResponseWriter that discards everything written to it.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+// MemoryCacheStore is a CacheStore keeping responses in memory.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]*CachedResponse
+}
+
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{
+		entries: make(map[string]*CachedResponse),
+	}
+}
+
+func (s *MemoryCacheStore) Get(_ context.Context, key string) (*CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(res.RetainUntil()) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return res, true, nil
+}
+
+func (s *MemoryCacheStore) Set(_ context.Context, key string, res *CachedResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = res
+	return nil
+}
+
+func (s *MemoryCacheStore) DeletePrefix(_ context.Context, prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.entries, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			if err := restflex.InvalidateCache(r.Context(), r.URL.Path); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		n := calls.Add(1)
+		fmt.Fprintf(w, "%d", n)
+	})
+	cache := restflex.NewCache(resttest.NewLogger(), restflex.NewMemoryCacheStore(), time.Minute)
+	srv := cache.Wrap(next)
+	get := func(target string) string {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		body, _ := io.ReadAll(rec.Result().Body)
+		return string(body)
+	}
+
+	if got := get("/users/1?a=1&b=2"); got != "1" {
+		t.Errorf("expected first response to be %q, got %q", "1", got)
+	}
+	if got := get("/users/1?b=2&a=1"); got != "1" {
+		t.Errorf("expected cached response %q, got %q", "1", got)
+	}
+	if got := get("/users/1"); got != "2" {
+		t.Errorf("expected different query to miss cache, got %q", got)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/users/1", nil))
+	if got := get("/users/1?a=1&b=2"); got != "3" {
+		t.Errorf("expected invalidated response to miss cache, got %q", got)
+	}
+}
+
+func TestCache_stale_while_revalidate(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	revalidated := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		fmt.Fprintf(w, "%d", n)
+		if n == 2 {
+			close(revalidated)
+		}
+	})
+	cache := restflex.NewCache(resttest.NewLogger(), restflex.NewMemoryCacheStore(), 0)
+	cache.StaleWhileRevalidate = time.Minute
+	srv := cache.Wrap(next)
+
+	for i, want := range []string{"1", "1"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("request %d: expected %q, got %q", i, want, got)
+		}
+	}
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("expected stale response to be revalidated")
+	}
+}
+
+func TestCache_stale_if_error(t *testing.T) {
+	t.Parallel()
+	var failing atomic.Bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "fresh")
+	})
+	logger := resttest.NewLogger()
+	cache := restflex.NewCache(logger, restflex.NewMemoryCacheStore(), time.Millisecond)
+	cache.StaleIfError = time.Minute
+	srv := cache.Wrap(next)
+
+	resttest.Get("/users/1").To(srv).Expect(t).Status(http.StatusOK)
+	time.Sleep(5 * time.Millisecond)
+	failing.Store(true)
+	res := resttest.Get("/users/1").To(srv).Expect(t).
+		Status(http.StatusOK).
+		Header("Warning", `111 - "Revalidation Failed"`)
+	if string(res.Body) != "fresh" {
+		t.Errorf("expected stale response, got %q", res.Body)
+	}
+	logger.ExpectCount(t, "serving stale response", 1)
+
+	failing.Store(false)
+	resttest.Get("/users/1").To(srv).Expect(t).Status(http.StatusOK).Header("Warning", "")
+	resttest.Get("/users/2").To(srv).Expect(t).Status(http.StatusOK)
+	failing.Store(true)
+	resttest.Get("/users/3").To(srv).Expect(t).Status(http.StatusServiceUnavailable)
+}
+
+func TestCache_credentials(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/public" {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		}
+		fmt.Fprintf(w, "%d %s", calls.Add(1), restflex.Principal(r.Context()))
+	})
+	cache := restflex.NewCache(resttest.NewLogger(), restflex.NewMemoryCacheStore(), time.Minute)
+	srv := cache.Wrap(next)
+	get := func(target, principal string) string {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if principal != "" {
+			r.Header.Set("Authorization", "Bearer "+principal)
+			r = r.WithContext(restflex.WithPrincipal(r.Context(), principal))
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		body, _ := io.ReadAll(rec.Result().Body)
+		return string(body)
+	}
+
+	if got := get("/private", "alice"); got != "1 alice" {
+		t.Errorf("unexpected response %q", got)
+	}
+	if got := get("/private", "alice"); got != "2 alice" {
+		t.Errorf("expected response without Cache-Control: public not to be cached, got %q", got)
+	}
+	if got := get("/public", "alice"); got != "3 alice" {
+		t.Errorf("unexpected response %q", got)
+	}
+	if got := get("/public", "alice"); got != "3 alice" {
+		t.Errorf("expected public response to be cached, got %q", got)
+	}
+	if got := get("/public", "bob"); got != "4 bob" {
+		t.Errorf("expected cached response of another principal not to be served, got %q", got)
+	}
+	if got := get("/public", ""); got != "5 " {
+		t.Errorf("expected credentialed response not to be served to anonymous request, got %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package restflex
+
+import (
+	"hash/fnv"
+	"net/http"
+)
+
+// CanaryHeader is the request header forcing a request to the "canary" or
+// the "stable" handler of a Canary, such as for testing the canary.
+const CanaryHeader = "X-Canary"
+
+// Canary is a handler splitting the traffic of a route between the stable
+// and the rewritten canary handler of a gradual rollout:
+//
+//	mux.Handle("GET /orders", restflex.NewCanary("orders-v2", ordersV1, ordersV2, 5))
+//
+// Requests with the X-Canary header are routed as it asks. Other requests
+// with a principal are assigned by a hash of it, so that a principal stays
+// on the same handler while Percent is raised. Requests without a principal
+// are assigned by a cookie named after the canary when Cookie is set, and
+// otherwise at random.
+type Canary struct {
+	// Name distinguishes the assignments of canaries sharing principals.
+	Name   string
+	Stable http.Handler
+	Canary http.Handler
+	// Percent is the percentage of principals and requests routed to
+	// Canary.
+	Percent float64
+	// Key returns the key of sticky assignment. Defaults to the principal.
+	Key func(r *http.Request) string
+	// Cookie enables sticky assignment of requests without a key with a
+	// cookie.
+	Cookie bool
+}
+
+func NewCanary(name string, stable, canary http.Handler, percent float64) *Canary {
+	return &Canary{
+		Name:    name,
+		Stable:  stable,
+		Canary:  canary,
+		Percent: percent,
+		Key: func(r *http.Request) string {
+			return Principal(r.Context())
+		},
+	}
+}
+
+func (c *Canary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.assign(w, r) {
+		c.Canary.ServeHTTP(w, r)
+		return
+	}
+	c.Stable.ServeHTTP(w, r)
+}
+
+// assign reports whether r is routed to the canary handler.
+func (c *Canary) assign(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Header.Get(CanaryHeader) {
+	case "canary":
+		return true
+	case "stable":
+		return false
+	}
+	if c.Key != nil {
+		if key := c.Key(r); key != "" {
+			return canaryBucket(c.Name, key) < c.Percent
+		}
+	}
+	if !c.Cookie {
+		return chance(c.Percent)
+	}
+	name := "canary_" + c.Name
+	if cookie, err := r.Cookie(name); err == nil {
+		return canaryBucket(c.Name, cookie.Value) < c.Percent
+	}
+	// the cookie holds a random key rather than the assignment, so that
+	// raising Percent moves clients to the canary
+	key := newRequestID()
+	http.SetCookie(w, &http.Cookie{Name: name, Value: key, Path: "/", MaxAge: 30 * 24 * 60 * 60, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	return canaryBucket(c.Name, key) < c.Percent
+}
+
+// canaryBucket returns the percentile of key in the canary name.
+func canaryBucket(name, key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum64()%10000) / 100
+}
@@ -0,0 +1,83 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func newTestCanary(percent float64) *restflex.Canary {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		})
+	}
+	c := restflex.NewCanary("orders-v2", handler("stable"), handler("canary"), percent)
+	c.Key = func(r *http.Request) string {
+		return r.URL.Query().Get("user")
+	}
+	return c
+}
+
+func TestCanary_header(t *testing.T) {
+	t.Parallel()
+	for _, percent := range []float64{0, 100} {
+		c := newTestCanary(percent)
+		for _, want := range []string{"stable", "canary"} {
+			res := resttest.Get("/").WithHeader(restflex.CanaryHeader, want).To(c).Expect(t).Status(http.StatusOK)
+			if string(res.Body) != want {
+				t.Errorf("%v%%: %s forced to %s", percent, want, res.Body)
+			}
+		}
+	}
+}
+
+func TestCanary_sticky(t *testing.T) {
+	t.Parallel()
+	assigned := func(c *restflex.Canary, user string) string {
+		return string(resttest.Get("/").WithQuery("user", user).To(c).Expect(t).Body)
+	}
+	small, large := newTestCanary(10), newTestCanary(50)
+	canaries := 0
+	for i := 0; i < 1000; i++ {
+		user := strconv.Itoa(i)
+		got := assigned(small, user)
+		if again := assigned(small, user); again != got {
+			t.Fatalf("user %s assigned to %s and %s", user, got, again)
+		}
+		if got == "canary" {
+			canaries++
+			if assigned(large, user) != "canary" {
+				t.Errorf("user %s moved back to stable when percent was raised", user)
+			}
+		}
+	}
+	if canaries < 50 || canaries > 150 {
+		t.Errorf("expected about 100 of 1000 users on canary, got %d", canaries)
+	}
+}
+
+func TestCanary_cookie(t *testing.T) {
+	t.Parallel()
+	c := newTestCanary(50)
+	c.Cookie = true
+	res := resttest.Get("/").To(c).Expect(t).Status(http.StatusOK)
+	cookies := res.Response.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "canary_orders-v2" {
+		t.Fatalf("expected canary cookie, got %v", cookies)
+	}
+	for i := 0; i < 10; i++ {
+		again := resttest.Get("/").WithHeader("Cookie", cookies[0].String()).To(c).Expect(t)
+		if string(again.Body) != string(res.Body) {
+			t.Fatalf("cookie assigned to %s and %s", res.Body, again.Body)
+		}
+		if len(again.Response.Cookies()) != 0 {
+			t.Error("expected cookie not to be set again")
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package restflex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WithCanonicalJSON makes WriteJSON emit canonical JSON, see CanonicalJSON,
+// for endpoints whose responses are signed or hashed by clients.
+func WithCanonicalJSON() Option {
+	return func(h *handler) {
+		h.CanonicalJSON = true
+	}
+}
+
+// CanonicalJSON returns v encoded as canonical JSON in the manner of
+// RFC 8785: object keys are sorted, there is no insignificant whitespace,
+// HTML characters are not escaped, and numbers are written in their
+// shortest round-tripping form as IEEE 754 doubles, such as 1e+21 or 0.1.
+// Equal values thus always encode to equal bytes. Keys are sorted by their
+// UTF-8 bytes, which differs from RFC 8785 only for keys with characters
+// outside the Basic Multilingual Plane.
+func CanonicalJSON(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		buf.WriteByte('{')
+		for i, k := range slices.Sorted(maps.Keys(v)) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		writeCanonicalString(buf, v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil || math.IsInf(f, 0) {
+			return fmt.Errorf("restflex: number %v out of range", v)
+		}
+		buf.WriteString(canonicalNumber(f))
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Truncate(buf.Len() - 1)
+}
+
+// canonicalNumber formats f like ECMAScript Number.prototype.toString.
+func canonicalNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp, _ := strings.Cut(s, "e")
+	sign := exp[:1]
+	exp = strings.TrimLeft(exp[1:], "0")
+	return mantissa + "e" + sign + exp
+}
+
+// canonicalJSON reports whether w is written by a handler created
+// WithCanonicalJSON.
+func canonicalJSON(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case *responseWriter:
+			return rw.canonicalJSON
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		in   any
+		want string
+	}{
+		{name: "sorted keys", in: struct {
+			B int               `json:"b"`
+			A map[string]string `json:"a"`
+		}{B: 1, A: map[string]string{"z": "1", "y": "2"}}, want: `{"a":{"y":"2","z":"1"},"b":1}`},
+		{name: "numbers", in: []float64{1.0, 0.1, 1e21, 1e-7, -0.5, 123456789012}, want: `[1,0.1,1e+21,1e-7,-0.5,123456789012]`},
+		{name: "no HTML escaping", in: map[string]string{"html": "<a>&"}, want: `{"html":"<a>&"}`},
+		{name: "literals", in: []any{nil, true, "x"}, want: `[null,true,"x"]`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := restflex.CanonicalJSON(tt.in)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithCanonicalJSON(t *testing.T) {
+	t.Parallel()
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.WriteJSON(w, http.StatusOK, map[string]any{"b": 2.50, "a": "<x>"})
+	}), restflex.WithCanonicalJSON())
+	res := resttest.Get("/").To(api).Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Length", "20")
+	if want := "{\"a\":\"<x>\",\"b\":2.5}\n"; string(res.Body) != want {
+		t.Errorf("expected %q, got %q", want, res.Body)
+	}
+}
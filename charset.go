@@ -0,0 +1,159 @@
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// WithUTF8JSON rejects JSON requests declaring a charset other than UTF-8
+// with 415 Unsupported Media Type, instead of letting mis-encoded payloads
+// fail later with an opaque decoding error. Requests without a charset are
+// treated as UTF-8, as required by RFC 8259.
+func WithUTF8JSON() Option {
+	return func(h *handler) {
+		h.UTF8JSON = true
+	}
+}
+
+// WithLatin1JSON transcodes JSON request bodies declared as ISO-8859-1 to
+// UTF-8 before they reach the handler. The Content-Type of such requests is
+// rewritten to declare UTF-8.
+func WithLatin1JSON() Option {
+	return func(h *handler) {
+		h.Latin1JSON = true
+	}
+}
+
+// WithBOMStripping strips a UTF-8 byte order mark from the start of JSON
+// request bodies, so that payloads exported by tools prepending one decode
+// with DecodeJSON. JSON text must not begin with a byte order mark, but
+// RFC 8259 allows parsers to ignore one.
+func WithBOMStripping() Option {
+	return func(h *handler) {
+		h.StripBOM = true
+	}
+}
+
+// checkCharset rejects JSON request bodies by their declared charset, or
+// reports latin1 if the body is to be transcoded from ISO-8859-1, in which
+// case the headers of r are rewritten to declare UTF-8. It reports false if
+// a response was written.
+func (h handler) checkCharset(w http.ResponseWriter, r *http.Request) (latin1, ok bool) {
+	contentType := r.Header.Get("Content-Type")
+	if !MatchContentType(contentType, "application/json") {
+		return false, true
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch charset := strings.ToLower(params["charset"]); charset {
+	case "", "utf-8", "us-ascii":
+		return false, true
+	case "iso-8859-1", "latin1":
+		if h.Latin1JSON {
+			r.ContentLength = -1
+			r.Header.Del("Content-Length")
+			params["charset"] = "utf-8"
+			r.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+			return true, true
+		}
+	}
+	if !h.UTF8JSON {
+		return false, true
+	}
+	h.error(w, r, http.StatusUnsupportedMediaType, "JSON requests must be encoded in UTF-8")
+	return false, false
+}
+
+// utf8BOM is the UTF-8 encoded byte order mark.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// bomReader strips a UTF-8 byte order mark from the start of a body.
+type bomReader struct {
+	io.ReadCloser
+	r io.Reader
+}
+
+func (b *bomReader) Read(p []byte) (int, error) {
+	if b.r == nil {
+		head := make([]byte, len(utf8BOM))
+		n, err := io.ReadFull(b.ReadCloser, head)
+		if n == len(utf8BOM) && bytes.Equal(head, utf8BOM) {
+			n = 0
+		}
+		switch err {
+		case nil:
+			b.r = io.MultiReader(bytes.NewReader(head[:n]), b.ReadCloser)
+		case io.EOF, io.ErrUnexpectedEOF:
+			// a body shorter than a byte order mark
+			b.r = bytes.NewReader(head[:n])
+		default:
+			b.r = io.MultiReader(bytes.NewReader(head[:n]), errReader{err})
+		}
+	}
+	return b.r.Read(p)
+}
+
+// errReader returns err from every read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// bodyDecoding is the decoding a handler applies to JSON request bodies.
+// It is kept in the request context so that bodies buffered before the
+// handler wrapped r.Body are decoded alike.
+type bodyDecoding struct {
+	stripBOM bool
+	latin1   bool
+}
+
+type bodyDecodingContextKey struct{}
+
+// requestDecoding returns the body decoding of the handler serving ctx.
+func requestDecoding(ctx context.Context) bodyDecoding {
+	d, _ := ctx.Value(bodyDecodingContextKey{}).(bodyDecoding)
+	return d
+}
+
+// wrap returns body decoded by d.
+func (d bodyDecoding) wrap(body io.ReadCloser) io.ReadCloser {
+	if d.stripBOM {
+		body = &bomReader{ReadCloser: body}
+	}
+	if d.latin1 {
+		body = &latin1Reader{ReadCloser: body}
+	}
+	return body
+}
+
+// latin1Reader transcodes an ISO-8859-1 body to UTF-8.
+type latin1Reader struct {
+	io.ReadCloser
+	buf     [512]byte
+	pending []byte
+	err     error
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	for len(l.pending) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		var n int
+		n, l.err = l.ReadCloser.Read(l.buf[:])
+		l.pending = l.pending[:0]
+		for _, b := range l.buf[:n] {
+			l.pending = utf8.AppendRune(l.pending, rune(b))
+		}
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
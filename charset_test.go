@@ -0,0 +1,140 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestJSONCharset(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		opts        []restflex.Option
+		contentType string
+		body        []byte
+		status      int
+		want        string
+	}{
+		{name: "UTF-8", opts: []restflex.Option{restflex.WithUTF8JSON()}, contentType: "application/json; charset=UTF-8", body: []byte(`{"name":"Jürgen"}`), status: http.StatusOK, want: "Jürgen"},
+		{name: "no charset", opts: []restflex.Option{restflex.WithUTF8JSON()}, contentType: "application/json", body: []byte(`{"name":"Jürgen"}`), status: http.StatusOK, want: "Jürgen"},
+		{name: "rejected", opts: []restflex.Option{restflex.WithUTF8JSON()}, contentType: "application/json; charset=iso-8859-1", body: []byte("{\"name\":\"J\xfcrgen\"}"), status: http.StatusUnsupportedMediaType},
+		{name: "transcoded", opts: []restflex.Option{restflex.WithUTF8JSON(), restflex.WithLatin1JSON()}, contentType: "application/json; charset=iso-8859-1", body: []byte("{\"name\":\"J\xfcrgen\"}"), status: http.StatusOK, want: "Jürgen"},
+		{name: "other charset", opts: []restflex.Option{restflex.WithLatin1JSON()}, contentType: "application/json; charset=utf-16", body: []byte(`{"name":"x"}`), status: http.StatusOK, want: "x"},
+		{name: "disabled", contentType: "application/json; charset=iso-8859-1", body: []byte(`{"name":"x"}`), status: http.StatusOK, want: "x"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				var req struct {
+					Name string `json:"name"`
+				}
+				if err := restflex.DecodeJSON(r.Body, &req); err != nil {
+					return err
+				}
+				return restflex.WriteJSON(w, http.StatusOK, req)
+			}), tt.opts...)
+			res := resttest.Post("/").WithBody(tt.contentType, tt.body).To(h).Expect(t).Status(tt.status)
+			if tt.want != "" {
+				res.JSONPath("$.name", tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBOMStripping(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		opts   []restflex.Option
+		body   string
+		status int
+	}{
+		{name: "byte order mark", opts: []restflex.Option{restflex.WithBOMStripping()}, body: "\xef\xbb\xbf{\"name\":\"x\"}", status: http.StatusOK},
+		{name: "no byte order mark", opts: []restflex.Option{restflex.WithBOMStripping()}, body: `{"name":"x"}`, status: http.StatusOK},
+		{name: "short body", opts: []restflex.Option{restflex.WithBOMStripping()}, body: `1`, status: http.StatusOK},
+		{name: "disabled", body: "\xef\xbb\xbf{\"name\":\"x\"}", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				var v any
+				if err := restflex.DecodeJSON(r.Body, &v); err != nil {
+					return err
+				}
+				return restflex.WriteJSON(w, http.StatusOK, v)
+			}), tt.opts...)
+			resttest.Post("/").WithBody("application/json", []byte(tt.body)).To(h).Expect(t).Status(tt.status)
+		})
+	}
+}
+
+func TestWithBOMStripping_buffered(t *testing.T) {
+	t.Parallel()
+	const body = "\xef\xbb\xbf{\"name\":\"x\"}"
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var v struct {
+			Name string `json:"name"`
+		}
+		raw, err := restflex.DecodeJSONRaw(r, &v)
+		if err != nil {
+			return err
+		}
+		if string(raw) != body {
+			t.Errorf("expected raw body %q, got %q", body, raw)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		if string(b) != `{"name":"x"}` {
+			t.Errorf("expected rewound body without byte order mark, got %q", b)
+		}
+		return restflex.WriteJSON(w, http.StatusOK, v)
+	}), restflex.WithBOMStripping())
+	h := restflex.BufferBody(resttest.NewLogger(), 1<<10)(api)
+	resttest.Post("/").WithBody("application/json", []byte(body)).To(h).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.name", "x")
+}
+
+func TestWithBOMStripping_bind(t *testing.T) {
+	t.Parallel()
+	h := restflex.NewHandlerWithContext(resttest.NewLogger(), restflex.Bind[createUser](httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		u, _ := restflex.RequestBody[createUser](ctx)
+		return restflex.WriteJSON(w, http.StatusOK, u)
+	})), restflex.WithBOMStripping())
+	resttest.Post("/").WithBody("application/json", []byte("\xef\xbb\xbf{\"name\":\"alice\"}")).To(h).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.name", "alice")
+}
+
+func TestWithBOMStripping_read_error(t *testing.T) {
+	t.Parallel()
+	errReset := errors.New("connection reset")
+	h := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if _, err := io.ReadAll(r.Body); !errors.Is(err, errReset) {
+			t.Errorf("expected read error %v, got %v", errReset, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), restflex.WithBOMStripping())
+	r := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("{"), iotest.ErrReader(errReset)))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+}
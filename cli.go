@@ -0,0 +1,279 @@
+package restflex
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Router registers handlers for route patterns. It is implemented by
+// http.ServeMux and Routes, so that routes registered through RouteGroups
+// are recorded in the route table.
+type Router interface {
+	Handle(pattern string, h http.Handler)
+	HandleFunc(pattern string, f func(http.ResponseWriter, *http.Request))
+}
+
+// Routes is a ServeMux recording the patterns registered with its Handle
+// and HandleFunc methods, for listing the route table.
+type Routes struct {
+	*http.ServeMux
+
+	mu       sync.Mutex
+	patterns []string
+}
+
+func NewRoutes(mux *http.ServeMux) *Routes {
+	return &Routes{
+		ServeMux: mux,
+	}
+}
+
+// Handle registers h for pattern on the ServeMux and records pattern.
+func (r *Routes) Handle(pattern string, h http.Handler) {
+	r.ServeMux.Handle(pattern, h)
+	r.record(pattern)
+}
+
+// HandleFunc registers f for pattern on the ServeMux and records pattern.
+func (r *Routes) HandleFunc(pattern string, f func(http.ResponseWriter, *http.Request)) {
+	r.ServeMux.HandleFunc(pattern, f)
+	r.record(pattern)
+}
+
+func (r *Routes) record(pattern string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, pattern)
+}
+
+// Patterns returns the recorded patterns ordered by path and method.
+func (r *Routes) Patterns() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	patterns := slices.Clone(r.patterns)
+	slices.SortFunc(patterns, func(a, b string) int {
+		am, ap := splitPattern(a)
+		bm, bp := splitPattern(b)
+		return cmp.Or(cmp.Compare(ap, bp), cmp.Compare(am, bm))
+	})
+	return patterns
+}
+
+// CLI implements the subcommands of a service built on restflex for CI and
+// debugging:
+//
+//	routes   print the route table with the declared errors
+//	openapi  print the OpenAPI document
+//	check    validate the configuration
+//
+// Services link it into their main before starting the server:
+//
+//	cli := restflex.NewCLI("orders", routes.Patterns)
+//	if code, ok := cli.Run(os.Args[1:]); ok {
+//		os.Exit(code)
+//	}
+type CLI struct {
+	// Name is the title of the OpenAPI document.
+	Name string
+	// Routes returns the route patterns of the service.
+	Routes func() []string
+	// OpenAPI returns the OpenAPI document. Defaults to OpenAPISpec of the
+	// routes.
+	OpenAPI func() (any, error)
+	// Check validates the configuration. Defaults to ConfigFromEnv with
+	// prefix "API".
+	Check  func() error
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func NewCLI(name string, routes func() []string) *CLI {
+	return &CLI{
+		Name:   name,
+		Routes: routes,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// Run runs the subcommand named by args[0] and returns its exit code. It
+// returns false if args does not name a subcommand, for the service to
+// start normally.
+func (c *CLI) Run(args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	var err error
+	switch args[0] {
+	case "routes":
+		err = c.routes()
+	case "openapi":
+		err = c.openAPI()
+	case "check":
+		err = c.check()
+	case "help", "-h", "-help", "--help":
+		_, err = fmt.Fprintf(c.Stdout, "usage: %s [routes|openapi|check]\n", c.Name)
+	default:
+		return 0, false
+	}
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "%s %s: %v\n", c.Name, args[0], err)
+		return 1, true
+	}
+	return 0, true
+}
+
+func (c *CLI) routes() error {
+	errs := make(map[string][]string)
+	for _, doc := range ErrorCatalog() {
+		for _, route := range doc.Routes {
+			errs[route] = append(errs[route], strconv.Itoa(doc.Status)+" "+doc.Name)
+		}
+	}
+	tw := tabwriter.NewWriter(c.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tERRORS")
+	for _, pattern := range c.Routes() {
+		method, path := splitPattern(pattern)
+		if method == "" {
+			method = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", method, path, strings.Join(errs[pattern], ", "))
+	}
+	return tw.Flush()
+}
+
+func (c *CLI) openAPI() error {
+	spec := c.OpenAPI
+	if spec == nil {
+		spec = func() (any, error) {
+			return OpenAPISpec(c.Name, BuildVersion(), c.Routes()), nil
+		}
+	}
+	doc, err := spec()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(c.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func (c *CLI) check() error {
+	check := c.Check
+	if check == nil {
+		check = func() error {
+			_, err := ConfigFromEnv("API")
+			return err
+		}
+	}
+	if err := check(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(c.Stdout, "configuration ok")
+	return err
+}
+
+// splitPattern splits a ServeMux pattern into its method and its host and
+// path.
+func splitPattern(pattern string) (method, path string) {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method, strings.TrimSpace(path)
+	}
+	return "", pattern
+}
+
+// OpenAPISpec returns a minimal OpenAPI 3.1 document listing the operations
+// of the route patterns with the errors declared for them. Patterns without
+// a method are not included, as they match any method. Services with a
+// hand written or generated document should use it instead.
+func OpenAPISpec(title, version string, patterns []string) map[string]any {
+	paths := make(map[string]any)
+	for _, pattern := range patterns {
+		method, path := splitPattern(pattern)
+		if method == "" {
+			continue
+		}
+		if i := strings.Index(path, "/"); i > 0 {
+			// host specific pattern
+			path = path[i:]
+		}
+		path = strings.TrimSuffix(path, "{$}")
+		path = strings.ReplaceAll(path, "...}", "}")
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = make(map[string]any)
+			paths[path] = item
+		}
+		responses := OpenAPIErrorResponses(pattern)
+		responses["default"] = map[string]any{"description": "response"}
+		op := map[string]any{
+			"responses": responses,
+		}
+		if params := openAPIPathParameters(path); len(params) > 0 {
+			op["parameters"] = params
+		}
+		item[strings.ToLower(method)] = op
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"ErrorMessage": map[string]any{
+					"type":     "object",
+					"required": []string{"errors"},
+					"properties": map[string]any{
+						"errors": map[string]any{
+							"type":  "array",
+							"items": map[string]any{"type": "string"},
+						},
+						"status":     map[string]any{"type": "integer"},
+						"request_id": map[string]any{"type": "string"},
+						"timestamp":  map[string]any{"type": "string", "format": "date-time"},
+						"incident":   map[string]any{"type": "string"},
+						"details":    map[string]any{"type": "object"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openAPIPathParameters returns the path parameters of the wildcards in
+// path.
+func openAPIPathParameters(path string) []map[string]any {
+	var params []map[string]any
+	for rest := path; ; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			return params
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return params
+		}
+		params = append(params, map[string]any{
+			"name":     rest[i+1 : i+j],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+		rest = rest[i+j+1:]
+	}
+}
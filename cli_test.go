@@ -0,0 +1,134 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func newTestCLI() (*restflex.CLI, *bytes.Buffer, *bytes.Buffer) {
+	routes := restflex.NewRoutes(http.NewServeMux())
+	routes.HandleFunc("GET /cli/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	routes.HandleFunc("POST /cli/orders", func(w http.ResponseWriter, r *http.Request) {})
+	routes.Handle("/cli/static/{path...}", http.NotFoundHandler())
+	restflex.DeclareErrors("GET /cli/orders/{id}", restflex.ErrNotFound)
+	cli := restflex.NewCLI("orders", routes.Patterns)
+	var stdout, stderr bytes.Buffer
+	cli.Stdout, cli.Stderr = &stdout, &stderr
+	return cli, &stdout, &stderr
+}
+
+func TestCLI_routes(t *testing.T) {
+	t.Parallel()
+	cli, stdout, _ := newTestCLI()
+	if code, ok := cli.Run([]string{"routes"}); code != 0 || !ok {
+		t.Fatalf("Run() = %v, %v", code, ok)
+	}
+	want := `METHOD  PATTERN                ERRORS
+POST    /cli/orders            
+GET     /cli/orders/{id}       404 not_found
+*       /cli/static/{path...}  
+`
+	if stdout.String() != want {
+		t.Errorf("routes =\n%s\nwant\n%s", stdout, want)
+	}
+}
+
+func TestCLI_openapi(t *testing.T) {
+	t.Parallel()
+	cli, stdout, _ := newTestCLI()
+	if code, ok := cli.Run([]string{"openapi"}); code != 0 || !ok {
+		t.Fatalf("Run() = %v, %v", code, ok)
+	}
+	var spec struct {
+		Info  map[string]string                    `json:"info"`
+		Paths map[string]map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Info["title"] != "orders" || len(spec.Paths) != 2 {
+		t.Fatalf("spec = %s", stdout)
+	}
+	if _, ok := spec.Paths["/cli/orders/{id}"]["get"]["responses"].(map[string]any)["404"]; !ok {
+		t.Errorf("expected declared 404 in spec %s", stdout)
+	}
+	if _, ok := spec.Paths["/cli/orders"]["post"]; !ok {
+		t.Errorf("expected POST /cli/orders in spec %s", stdout)
+	}
+}
+
+func TestCLI_check(t *testing.T) {
+	t.Parallel()
+	cli, stdout, stderr := newTestCLI()
+	cli.Check = func() error { return nil }
+	if code, ok := cli.Run([]string{"check"}); code != 0 || !ok || stdout.String() != "configuration ok\n" {
+		t.Errorf("Run() = %v, %v, output %q", code, ok, stdout)
+	}
+	cli.Check = func() error { return errors.New("API_ADDR: invalid") }
+	if code, ok := cli.Run([]string{"check"}); code != 1 || !ok || !strings.Contains(stderr.String(), "API_ADDR: invalid") {
+		t.Errorf("Run() = %v, %v, output %q", code, ok, stderr)
+	}
+}
+
+func TestCLI_notCommand(t *testing.T) {
+	t.Parallel()
+	cli, _, _ := newTestCLI()
+	for _, args := range [][]string{nil, {"serve"}} {
+		if _, ok := cli.Run(args); ok {
+			t.Errorf("Run(%q) handled", args)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	t.Parallel()
+	routes := restflex.NewRoutes(http.NewServeMux())
+	restflex.Production.Mount(resttest.NewLogger(), routes, restflex.RouteGroup{
+		Name: "orders",
+		Routes: func(mux restflex.Router) {
+			mux.HandleFunc("GET /spec/orders/{id}/items/{item}", func(w http.ResponseWriter, r *http.Request) {})
+		},
+	})
+	if got := routes.Patterns(); len(got) != 1 || got[0] != "GET /spec/orders/{id}/items/{item}" {
+		t.Fatalf("expected the mounted route to be recorded, but got %v", got)
+	}
+	b, err := json.Marshal(restflex.OpenAPISpec("orders", "1.0.0", routes.Patterns()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatal(err)
+	}
+	params := spec.Paths["/spec/orders/{id}/items/{item}"]["get"].Parameters
+	if len(params) != 2 || params[0].Name != "id" || params[1].Name != "item" || params[0].In != "path" || !params[1].Required {
+		t.Errorf("expected path parameters id and item, but got %+v in %s", params, b)
+	}
+	for _, field := range []string{"errors", "status", "request_id", "timestamp", "incident", "details"} {
+		if _, ok := spec.Components.Schemas["ErrorMessage"].Properties[field]; !ok {
+			t.Errorf("expected ErrorMessage property %q in %s", field, b)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package client is an HTTP client for restflex APIs.
+//
+// Requests and responses are encoded as JSON. Error responses are returned
+// as restflex.APIError values built from the restflex.ErrorMessage body.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"kkn.fi/restflex"
+)
+
+// Client makes requests to a restflex API.
+type Client struct {
+	// BaseURL is the URL request paths are resolved against.
+	BaseURL *url.URL
+	// HTTPClient makes the requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Header is added to every request.
+	Header http.Header
+	// Retry retries failed requests. Requests are not retried if it is nil.
+	Retry *RetryPolicy
+	// Middlewares wrap the transport of HTTPClient; see Use.
+	Middlewares []Middleware
+}
+
+// New returns a client for the API at baseURL.
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &Client{
+		BaseURL: u,
+		Header:  http.Header{},
+	}, nil
+}
+
+func (c *Client) Get(ctx context.Context, path string, out any) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out)
+}
+
+func (c *Client) Post(ctx context.Context, path string, in, out any) error {
+	return c.Do(ctx, http.MethodPost, path, in, out)
+}
+
+func (c *Client) Put(ctx context.Context, path string, in, out any) error {
+	return c.Do(ctx, http.MethodPut, path, in, out)
+}
+
+func (c *Client) Patch(ctx context.Context, path string, in, out any) error {
+	return c.Do(ctx, http.MethodPatch, path, in, out)
+}
+
+func (c *Client) Delete(ctx context.Context, path string, out any) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, out)
+}
+
+// Do sends a request with in encoded as the JSON body, unless in is nil, and
+// decodes a successful JSON response into out, unless out is nil. Responses
+// with a non-2xx status are returned as restflex.APIError.
+//
+// Failed requests are retried according to Retry.
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	req, err := c.NewRequest(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("client: decoding %v %v response: %w", method, path, err)
+	}
+	return nil
+}
+
+// send sends req, retrying according to Retry, and returns its successful
+// response.
+func (c *Client) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	var res *http.Response
+	err := c.Retry.retry(ctx, req, func() error {
+		attempt := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			attempt.Body = body
+		}
+		var err error
+		res, err = c.httpClient().Do(attempt)
+		if err != nil {
+			return err
+		}
+		if err := ResponseError(res); err != nil {
+			res.Body.Close()
+			return err
+		}
+		return nil
+	})
+	return res, err
+}
+
+// NewRequest returns a request for path relative to BaseURL with in encoded
+// as the JSON body unless it is nil.
+func (c *Client) NewRequest(ctx context.Context, method, path string, in any) (*http.Request, error) {
+	ref, err := url.Parse(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("client: encoding %v %v request: %w", method, path, err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL.ResolveReference(ref).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	hc := http.DefaultClient
+	if c.HTTPClient != nil {
+		hc = c.HTTPClient
+	}
+	if len(c.Middlewares) == 0 {
+		return hc
+	}
+	wrapped := *hc
+	wrapped.Transport = c.transport(hc.Transport)
+	return &wrapped
+}
+
+// maxErrorBodyBytes is the largest error response body read for its
+// messages.
+const maxErrorBodyBytes = 64 << 10
+
+// ResponseError returns nil for a 2xx response and otherwise a
+// restflex.APIError with the messages of the restflex.ErrorMessage body, or
+// the status text if the body is not one. Up to 64 KiB of the body is
+// consumed on error.
+func ResponseError(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	var msg restflex.ErrorMessage
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxErrorBodyBytes))
+	if err != nil || json.Unmarshal(body, &msg) != nil || len(msg.Errors) == 0 {
+		msg.Errors = []string{http.StatusText(res.StatusCode)}
+	}
+	apiErr := restflex.NewAPIError(res.StatusCode, nil, msg.Errors...)
+	if d, ok := retryAfter(res); ok {
+		return restflex.NewRetryAfterError(apiErr, d)
+	}
+	return apiErr
+}
+
+// retryAfter returns the delay of the Retry-After response header.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// IsStatus reports whether err is a restflex.APIError with status code.
+func IsStatus(err error, code int) bool {
+	var apiErr restflex.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode() == code
+}
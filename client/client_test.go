@@ -0,0 +1,142 @@
+//go:build !integration
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/client"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newClient(t *testing.T, h http.Handler) *client.Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := client.New(srv.URL + "/api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestClient_Do(t *testing.T) {
+	t.Parallel()
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/users" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		var u user
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		u.ID = 7
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(u)
+	}))
+	var got user
+	if err := c.Post(context.Background(), "/users", user{Name: "Ada"}, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != 7 || got.Name != "Ada" {
+		t.Errorf("unexpected response %+v", got)
+	}
+}
+
+func TestClient_Do_error_response(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		wantStatus     int
+		wantMessage    string
+		wantRetryAfter time.Duration
+	}{
+		{
+			name: "error message",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(restflex.NewErrorMessage("user not found"))
+			},
+			wantStatus:  http.StatusNotFound,
+			wantMessage: "user not found",
+		},
+		{
+			name: "non JSON body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "oops", http.StatusBadGateway)
+			},
+			wantStatus:  http.StatusBadGateway,
+			wantMessage: "Bad Gateway",
+		},
+		{
+			name: "retry after",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "5")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantMessage:    "Service Unavailable",
+			wantRetryAfter: 5 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := newClient(t, tt.handler)
+			err := c.Get(context.Background(), "users/1", &user{})
+			var apiErr restflex.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected API error, got %v", err)
+			}
+			if apiErr.StatusCode() != tt.wantStatus {
+				t.Errorf("expected status code %d, got %d", tt.wantStatus, apiErr.StatusCode())
+			}
+			if err.Error() != tt.wantMessage {
+				t.Errorf("expected message %q, got %q", tt.wantMessage, err.Error())
+			}
+			var (
+				ra         restflex.RetryAfterError
+				retryAfter time.Duration
+			)
+			if errors.As(err, &ra) {
+				retryAfter = ra.RetryAfter()
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("expected Retry-After %v, got %v", tt.wantRetryAfter, retryAfter)
+			}
+			if !client.IsStatus(err, tt.wantStatus) {
+				t.Errorf("expected IsStatus(%d) to be true", tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestResponseError_large_body(t *testing.T) {
+	t.Parallel()
+	body := strings.NewReader(`{"errors":["` + strings.Repeat("x", 1<<20) + `"]}`)
+	res := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}, Body: io.NopCloser(body)}
+	err := client.ResponseError(res)
+	if !client.IsStatus(err, http.StatusBadGateway) || err.Error() != http.StatusText(http.StatusBadGateway) {
+		t.Errorf("expected the status text of a truncated body, got %v", err)
+	}
+	if body.Len() == 0 {
+		t.Error("expected the body to be read up to the limit")
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"kkn.fi/infra"
+	"kkn.fi/restflex"
+)
+
+// Middleware wraps the transport of a client with additional behaviour, such
+// as signing requests, injecting trace headers, logging or recording
+// metrics, like restflex.Middleware wraps server handlers.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an http.RoundTripper calling itself.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use adds middlewares to the client. The first middleware added sees each
+// request first and its response last. Middlewares are called for every
+// attempt of a retried request.
+func (c *Client) Use(m ...Middleware) {
+	c.Middlewares = append(c.Middlewares, m...)
+}
+
+// transport returns rt wrapped with the client middlewares.
+func (c *Client) transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for i := len(c.Middlewares) - 1; i >= 0; i-- {
+		rt = c.Middlewares[i](rt)
+	}
+	return rt
+}
+
+// SetHeader returns a middleware setting a request header on every request.
+// A request already carrying the header is not modified.
+func SetHeader(key, value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(key) != "" {
+				return next.RoundTrip(req)
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set(key, value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Log returns a middleware logging each request with its status and duration.
+func Log(l infra.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				l.Printf("client: %v %v: %v (%v)", req.Method, req.URL, err, time.Since(start))
+				return res, err
+			}
+			l.Printf("client: %v %v: %v (%v)", req.Method, req.URL, res.StatusCode, time.Since(start))
+			return res, err
+		})
+	}
+}
+
+// Propagate returns a middleware injecting the span context of the request
+// context, set by restflex.Trace, into outgoing requests with p.
+func Propagate(p restflex.Propagator) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sc, ok := restflex.SpanContextFrom(req.Context())
+			if !ok {
+				return next.RoundTrip(req)
+			}
+			req = req.Clone(req.Context())
+			p.Inject(req.Header, sc)
+			return next.RoundTrip(req)
+		})
+	}
+}
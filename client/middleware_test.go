@@ -0,0 +1,65 @@
+//go:build !integration
+
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/client"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestClient_Use(t *testing.T) {
+	t.Parallel()
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Traceparent"); got != "00-trace" {
+			t.Errorf("expected trace header, got %q", got)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	var order []string
+	record := func(name string) client.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return client.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" request")
+				res, err := next.RoundTrip(req)
+				order = append(order, name+" response")
+				return res, err
+			})
+		}
+	}
+	logger := resttest.NewLogger()
+	c.Use(record("outer"), record("inner"), client.SetHeader("Traceparent", "00-trace"), client.Log(logger))
+	if err := c.Get(context.Background(), "/", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"outer request", "inner request", "inner response", "outer response"}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, order)
+		}
+	}
+	logger.ExpectCount(t, "client: GET", 1)
+}
+
+func TestPropagate(t *testing.T) {
+	t.Parallel()
+	sc := restflex.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+		if got := r.Header.Get("Traceparent"); got != want {
+			t.Errorf("expected traceparent %q, got %q", want, got)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	c.Use(client.Propagate(restflex.TraceContext{}))
+	if err := c.Get(restflex.WithSpanContext(context.Background(), sc), "/", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CursorParam is the query parameter carrying the cursor of the next page.
+const CursorParam = "cursor"
+
+// Page is a page of a collection whose response body is a JSON object.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Pages returns an iterator over the items of the collection at path,
+// fetching pages until the collection is exhausted. A page is either a JSON
+// array of items or a Page object. The next page is requested from the URL
+// of a Link response header with rel="next" or, if there is none, by setting
+// CursorParam to the NextCursor of the page. A Link to another scheme or
+// host is an error, so that Client.Header is not sent to it. Iteration stops
+// at the first error, which is yielded with the zero value of T.
+func Pages[T any](ctx context.Context, c *Client, path string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		req, err := c.NewRequest(ctx, http.MethodGet, path, nil)
+		for err == nil && req != nil {
+			var (
+				page Page[T]
+				next *url.URL
+			)
+			if page, next, err = fetchPage[T](ctx, c, req); err != nil {
+				break
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			switch {
+			case next != nil && (next.Scheme != req.URL.Scheme || next.Host != req.URL.Host):
+				// the next page would be requested with Client.Header,
+				// which may carry credentials
+				err = fmt.Errorf("client: next page %v is not on %v://%v", next, req.URL.Scheme, req.URL.Host)
+			case next != nil:
+				req, err = c.NewRequest(ctx, http.MethodGet, next.String(), nil)
+			case page.NextCursor != "":
+				u := *req.URL
+				q := u.Query()
+				q.Set(CursorParam, page.NextCursor)
+				u.RawQuery = q.Encode()
+				req, err = c.NewRequest(ctx, http.MethodGet, u.String(), nil)
+			default:
+				req = nil
+			}
+		}
+		if err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+func fetchPage[T any](ctx context.Context, c *Client, req *http.Request) (Page[T], *url.URL, error) {
+	var page Page[T]
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return page, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return page, nil, err
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &page.Items)
+	} else {
+		err = json.Unmarshal(body, &page)
+	}
+	if err != nil {
+		return page, nil, fmt.Errorf("client: decoding page %v: %w", req.URL, err)
+	}
+	next := nextLink(res.Header)
+	if next != nil {
+		next = req.URL.ResolveReference(next)
+	}
+	return page, next, nil
+}
+
+// nextLink returns the URL of the Link header value with rel="next".
+func nextLink(h http.Header) *url.URL {
+	for _, v := range h.Values("Link") {
+		for _, link := range strings.Split(v, ",") {
+			target, params, ok := strings.Cut(link, ";")
+			if !ok {
+				continue
+			}
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, p := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if !strings.EqualFold(k, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(v, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						u, err := url.Parse(target[1 : len(target)-1])
+						if err != nil {
+							return nil
+						}
+						return u
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+//go:build !integration
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"kkn.fi/restflex/client"
+)
+
+func collect(t *testing.T, c *client.Client, path string) []int {
+	t.Helper()
+	var got []int
+	for item, err := range client.Pages[int](context.Background(), c, path) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, item)
+	}
+	return got
+}
+
+func TestPages_Link_header(t *testing.T) {
+	t.Parallel()
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		switch page {
+		case "":
+			w.Header().Set("Link", `</api/numbers?page=2>; rel="next", </api/numbers?page=2>; rel="last"`)
+			_ = json.NewEncoder(w).Encode([]int{1, 2})
+		case "2":
+			_ = json.NewEncoder(w).Encode([]int{3})
+		default:
+			t.Errorf("unexpected page %q", page)
+		}
+	}))
+	got := collect(t, c, "numbers")
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("expected items [1 2 3], got %v", got)
+	}
+}
+
+func TestPages_cursor(t *testing.T) {
+	t.Parallel()
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter") != "odd" {
+			t.Errorf("expected query to be kept, got %q", r.URL.RawQuery)
+		}
+		switch cursor := r.URL.Query().Get(client.CursorParam); cursor {
+		case "":
+			_ = json.NewEncoder(w).Encode(client.Page[int]{Items: []int{1, 3}, NextCursor: "c1"})
+		case "c1":
+			_ = json.NewEncoder(w).Encode(client.Page[int]{Items: []int{5}})
+		default:
+			t.Errorf("unexpected cursor %q", cursor)
+		}
+	}))
+	got := collect(t, c, "numbers?filter=odd")
+	if fmt.Sprint(got) != "[1 3 5]" {
+		t.Errorf("expected items [1 3 5], got %v", got)
+	}
+}
+
+func TestPages_error(t *testing.T) {
+	t.Parallel()
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	for _, err := range client.Pages[int](context.Background(), c, "numbers") {
+		if !client.IsStatus(err, http.StatusForbidden) {
+			t.Errorf("expected 403 error, got %v", err)
+		}
+	}
+}
+
+func TestPages_Link_header_other_host(t *testing.T) {
+	t.Parallel()
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "" {
+			t.Errorf("unexpected request of %v", r.URL)
+		}
+		w.Header().Set("Link", `<https://attacker.example/numbers?page=2>; rel="next"`)
+		_ = json.NewEncoder(w).Encode([]int{1, 2})
+	}))
+	c.Header.Set("Authorization", "Bearer secret")
+	var got []int
+	var err error
+	for item, itemErr := range client.Pages[int](context.Background(), c, "numbers") {
+		if itemErr != nil {
+			err = itemErr
+			break
+		}
+		got = append(got, item)
+	}
+	if fmt.Sprint(got) != "[1 2]" || err == nil || !strings.Contains(err.Error(), "attacker.example") {
+		t.Errorf("expected items [1 2] and an error of the other host, got %v and %v", got, err)
+	}
+}
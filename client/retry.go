@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	"kkn.fi/restflex"
+)
+
+// RetryPolicy configures retrying of failed requests. Requests failing with
+// a network error or status 429, 502, 503 or 504 are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first.
+	MaxAttempts int
+	// Methods lists the retried request methods. Defaults to the idempotent
+	// methods GET, HEAD, OPTIONS, PUT and DELETE.
+	Methods []string
+	// Backoff is the base delay before a retry. It doubles on each retry up to
+	// MaxBackoff and is randomized with full jitter. A Retry-After response
+	// header takes precedence over it, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Budget limits retries in proportion to requests. A nil budget does
+	// not limit them.
+	Budget *restflex.RetryBudget
+	// OnRetry, if set, is called before each retry with the number of the
+	// failed attempt, the delay before the next one and the failure, for
+	// example to record metrics.
+	OnRetry func(req *http.Request, attempt int, delay time.Duration, err error)
+}
+
+// NewRetryPolicy returns a policy making up to 3 attempts with exponential
+// backoff starting from 100ms and limited to 5s.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+	}
+}
+
+func (p *RetryPolicy) allows(method string) bool {
+	if p.Methods != nil {
+		return slices.Contains(p.Methods, method)
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// delay returns the time to wait before retrying after attempt failed with err.
+func (p *RetryPolicy) delay(attempt int, err error) time.Duration {
+	var ra restflex.RetryAfterError
+	if errors.As(err, &ra) {
+		if p.MaxBackoff > 0 {
+			return min(ra.RetryAfter(), p.MaxBackoff)
+		}
+		return ra.RetryAfter()
+	}
+	d := p.Backoff << (attempt - 1)
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// isRetryable reports whether a request failing with err may succeed when
+// retried.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr restflex.APIError
+	if !errors.As(err, &apiErr) {
+		// Network error.
+		return true
+	}
+	switch apiErr.StatusCode() {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retry calls do until it succeeds or the policy gives up.
+func (p *RetryPolicy) retry(ctx context.Context, req *http.Request, do func() error) error {
+	if p == nil || p.MaxAttempts < 2 || !p.allows(req.Method) {
+		return do()
+	}
+	p.Budget.Deposit()
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil || attempt >= p.MaxAttempts || !isRetryable(ctx, err) || !p.Budget.Withdraw() {
+			return err
+		}
+		d := p.delay(attempt, err)
+		if p.OnRetry != nil {
+			p.OnRetry(req, attempt, d, err)
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
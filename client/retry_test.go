@@ -0,0 +1,118 @@
+//go:build !integration
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex/client"
+)
+
+func TestClient_Retry(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		failures   int32
+		wantCalls  int32
+		wantErr    bool
+		retryAfter string
+	}{
+		{
+			name:      "GET is retried until success",
+			method:    http.MethodGet,
+			status:    http.StatusServiceUnavailable,
+			failures:  2,
+			wantCalls: 3,
+		},
+		{
+			name:      "GET gives up after max attempts",
+			method:    http.MethodGet,
+			status:    http.StatusBadGateway,
+			failures:  5,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "POST is not retried",
+			method:    http.MethodPost,
+			status:    http.StatusServiceUnavailable,
+			failures:  1,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "client errors are not retried",
+			method:    http.MethodGet,
+			status:    http.StatusBadRequest,
+			failures:  1,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:       "Retry-After is honored",
+			method:     http.MethodPut,
+			status:     http.StatusTooManyRequests,
+			failures:   1,
+			wantCalls:  2,
+			retryAfter: "1",
+		},
+		{
+			name:       "Retry-After is capped at MaxBackoff",
+			method:     http.MethodGet,
+			status:     http.StatusServiceUnavailable,
+			failures:   1,
+			wantCalls:  2,
+			retryAfter: "3600",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				if r.Method != http.MethodGet {
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["a"] != "b" {
+						t.Errorf("expected replayed body, got %v: %v", body, err)
+					}
+				}
+				if calls.Add(1) <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			c.Retry = client.NewRetryPolicy()
+			c.Retry.Backoff = time.Millisecond
+			c.Retry.MaxBackoff = time.Second
+			var delays []time.Duration
+			c.Retry.OnRetry = func(req *http.Request, attempt int, delay time.Duration, err error) {
+				delays = append(delays, delay)
+			}
+			var in any
+			if tt.method != http.MethodGet {
+				in = map[string]string{"a": "b"}
+			}
+			err := c.Do(context.Background(), tt.method, "/", in, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, got)
+			}
+			if tt.retryAfter != "" && (len(delays) != 1 || delays[0] != time.Second) {
+				t.Errorf("expected a retry after 1s, got %v", delays)
+			}
+		})
+	}
+}
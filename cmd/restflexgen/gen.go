@@ -0,0 +1,687 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// document is the subset of an OpenAPI 3 document used by the generator.
+type document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*pathItem `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `json:"parameters"`
+	Get        *operation   `json:"get"`
+	Put        *operation   `json:"put"`
+	Post       *operation   `json:"post"`
+	Delete     *operation   `json:"delete"`
+	Patch      *operation   `json:"patch"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"responses"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Format      string             `json:"format"`
+	Description string             `json:"description"`
+	Properties  map[string]*schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Items       *schema            `json:"items"`
+	Enum        []string           `json:"enum"`
+}
+
+// op is an operation prepared for generation.
+type op struct {
+	Name    string
+	Summary string
+	Method  string
+	Path    string
+	Params  []*parameter
+	Body    string
+	// ValidateBody is set if the body type has a Validate method.
+	ValidateBody bool
+	Result       string
+	Status       int
+}
+
+// generator writes the Go source of a document.
+type generator struct {
+	doc     *document
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+// generate returns the formatted Go source of package pkg for the OpenAPI
+// document spec.
+func generate(spec []byte, pkg string) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+	g := &generator{doc: &doc, imports: make(map[string]bool)}
+	ops, err := g.operations()
+	if err != nil {
+		return nil, err
+	}
+	g.schemas()
+	g.requests(ops)
+	g.server(ops)
+	g.register(ops)
+	g.client(ops)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by restflexgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	std := true
+	for _, path := range slices.SortedFunc(maps.Keys(g.imports), compareImports) {
+		if std && strings.Contains(strings.Split(path, "/")[0], ".") {
+			std = false
+			src.WriteString("\n")
+		}
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	src.WriteString(")\n")
+	src.Write(g.buf.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated source: %w", err)
+	}
+	return formatted, nil
+}
+
+// compareImports orders standard library imports before others.
+func compareImports(a, b string) int {
+	aStd := !strings.Contains(strings.Split(a, "/")[0], ".")
+	bStd := !strings.Contains(strings.Split(b, "/")[0], ".")
+	if aStd != bStd {
+		if aStd {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) use(path string) {
+	g.imports[path] = true
+}
+
+// operations returns the operations of the document ordered by path and
+// method.
+func (g *generator) operations() ([]*op, error) {
+	var ops []*op
+	names := make(map[string]string)
+	for _, path := range slices.Sorted(maps.Keys(g.doc.Paths)) {
+		item := g.doc.Paths[path]
+		for _, m := range []struct {
+			method string
+			op     *operation
+		}{
+			{http.MethodGet, item.Get},
+			{http.MethodPut, item.Put},
+			{http.MethodPost, item.Post},
+			{http.MethodDelete, item.Delete},
+			{http.MethodPatch, item.Patch},
+		} {
+			if m.op == nil {
+				continue
+			}
+			o, err := g.operation(m.method, path, item, m.op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", m.method, path, err)
+			}
+			if other, ok := names[o.Name]; ok {
+				return nil, fmt.Errorf("%s %s: operation name %s is also used by %s", m.method, path, o.Name, other)
+			}
+			names[o.Name] = m.method + " " + path
+			ops = append(ops, o)
+		}
+	}
+	return ops, nil
+}
+
+func (g *generator) operation(method, path string, item *pathItem, o *operation) (*op, error) {
+	name := o.OperationID
+	if name == "" {
+		name = strings.ToLower(method) + " " + path
+	}
+	res := &op{
+		Name:    identifier(name),
+		Summary: o.Summary,
+		Method:  method,
+		Path:    path,
+		Status:  http.StatusNoContent,
+	}
+	params := make(map[string]*parameter)
+	for _, p := range slices.Concat(item.Parameters, o.Parameters) {
+		if p.In != "path" && p.In != "query" {
+			continue
+		}
+		if p.Schema != nil && p.Schema.Ref != "" {
+			if e := g.enum(p.Schema); e != nil {
+				// enum parameters are strings checked against the values
+				p = &parameter{Name: p.Name, In: p.In, Required: p.Required, Schema: e}
+			}
+		}
+		if p.Schema == nil || paramType(p.Schema) == "" {
+			return nil, fmt.Errorf("unsupported type of parameter %s", p.Name)
+		}
+		params[p.In+" "+p.Name] = p
+	}
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		res.Params = append(res.Params, params[key])
+	}
+	if o.RequestBody != nil {
+		mt, ok := o.RequestBody.Content["application/json"]
+		if !ok || mt.Schema == nil {
+			return nil, errors.New("request body is not JSON")
+		}
+		res.Body = g.goType(mt.Schema)
+		res.ValidateBody = g.hasValidate(mt.Schema)
+	}
+	for _, code := range slices.Sorted(maps.Keys(o.Responses)) {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 200 || status > 299 {
+			continue
+		}
+		res.Status = status
+		if mt, ok := o.Responses[code].Content["application/json"]; ok && mt.Schema != nil {
+			res.Result = g.goType(mt.Schema)
+			if g.isStruct(mt.Schema) {
+				res.Result = "*" + res.Result
+			}
+		}
+		break
+	}
+	return res, nil
+}
+
+// schemas writes the component schemas as types.
+func (g *generator) schemas() {
+	for _, name := range slices.Sorted(maps.Keys(g.doc.Components.Schemas)) {
+		s := g.doc.Components.Schemas[name]
+		typeName := identifier(name)
+		g.comment(typeName, "is", s.Description)
+		switch {
+		case len(s.Enum) > 0 && s.Type == "string":
+			g.printf("type %s string\n\nconst (\n", typeName)
+			for _, v := range s.Enum {
+				g.printf("%s%s %s = %q\n", typeName, identifier(v), typeName, v)
+			}
+			g.printf(")\n\n// EnumValues returns the values of %s.\nfunc (%[1]s) EnumValues() []string {\n\treturn %s\n}\n\n", typeName, enumValues(s))
+		case s.Type == "object" || s.Properties != nil:
+			g.printf("type %s struct {\n", typeName)
+			g.fields(s)
+			g.printf("}\n\n")
+			g.validate(typeName, s)
+		default:
+			g.printf("type %s %s\n\n", typeName, g.goType(s))
+		}
+	}
+}
+
+func (g *generator) fields(s *schema) {
+	for _, prop := range slices.Sorted(maps.Keys(s.Properties)) {
+		p := s.Properties[prop]
+		if p.Description != "" {
+			g.printf("// %s\n", strings.TrimSpace(p.Description))
+		}
+		tag := prop
+		if !slices.Contains(s.Required, prop) {
+			tag += ",omitempty"
+		}
+		g.printf("%s %s `json:%q`\n", identifier(prop), g.goType(p), tag)
+	}
+}
+
+// validate writes the Validate method of struct type typeName checking
+// the values of its enum properties, if it has any.
+func (g *generator) validate(typeName string, s *schema) {
+	var props []string
+	for _, prop := range slices.Sorted(maps.Keys(s.Properties)) {
+		if g.enum(s.Properties[prop]) != nil {
+			props = append(props, prop)
+		}
+	}
+	if len(props) == 0 {
+		return
+	}
+	g.printf("// Validate validates the enum values of %s.\nfunc (v %[1]s) Validate() error {\n", typeName)
+	for _, prop := range props {
+		field := "v." + identifier(prop)
+		check := fmt.Sprintf("if err := restflex.ValidateEnum(%q, %s); err != nil {\nreturn err\n}\n", prop, field)
+		if slices.Contains(s.Required, prop) {
+			g.printf("%s", check)
+			continue
+		}
+		g.printf("if %s != \"\" {\n%s}\n", field, check)
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+// hasValidate reports whether the Go type of s has a Validate method.
+func (g *generator) hasValidate(s *schema) bool {
+	if !g.isStruct(s) {
+		return false
+	}
+	target := g.doc.Components.Schemas[s.Ref[strings.LastIndex(s.Ref, "/")+1:]]
+	for _, p := range target.Properties {
+		if g.enum(p) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// enum returns the string enum schema s is or refers to, or nil.
+func (g *generator) enum(s *schema) *schema {
+	if s.Ref != "" {
+		s = g.doc.Components.Schemas[s.Ref[strings.LastIndex(s.Ref, "/")+1:]]
+	}
+	if s == nil || s.Type != "string" || len(s.Enum) == 0 {
+		return nil
+	}
+	return s
+}
+
+// enumValues returns the expression of the values of enum schema s.
+func enumValues(s *schema) string {
+	quoted := make([]string, len(s.Enum))
+	for i, v := range s.Enum {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
+
+// requests writes the request types of the operations.
+func (g *generator) requests(ops []*op) {
+	for _, o := range ops {
+		g.printf("// %sRequest is the request of %s.\ntype %[1]sRequest struct {\n", o.Name, o.Name)
+		for _, p := range o.Params {
+			g.printf("%s %s // %s parameter %q\n", identifier(p.Name), paramType(p.Schema), p.In, p.Name)
+		}
+		if o.Body != "" {
+			g.printf("Body %s\n", o.Body)
+		}
+		g.printf("}\n\n")
+	}
+}
+
+// server writes the Server interface.
+func (g *generator) server(ops []*op) {
+	g.use("context")
+	g.printf("// Server implements the operations of the API.\ntype Server interface {\n")
+	for _, o := range ops {
+		g.comment(o.Name, "", o.Summary)
+		g.printf("%s(ctx context.Context, req *%[1]sRequest) %s\n", o.Name, results(o))
+	}
+	g.printf("}\n\n")
+}
+
+// register writes the Register function.
+func (g *generator) register(ops []*op) {
+	g.use("net/http")
+	g.use("kkn.fi/httpx")
+	g.use("kkn.fi/infra")
+	g.use("kkn.fi/restflex")
+	g.printf(`// Register registers the operations of s as restflex handlers on mux.
+func Register(mux *http.ServeMux, l infra.Logger, s Server, opts ...restflex.Option) {
+`)
+	for _, o := range ops {
+		g.printf("mux.Handle(%q, restflex.NewHandlerWithContext(l, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {\n", o.Method+" "+o.Path)
+		g.printf("req := new(%sRequest)\n", o.Name)
+		if slices.ContainsFunc(o.Params, func(p *parameter) bool { return p.In == "query" }) {
+			g.printf("q := r.URL.Query()\n")
+		}
+		for _, p := range o.Params {
+			g.parseParam(p)
+		}
+		if o.Body != "" {
+			g.printf("if err := restflex.DecodeJSON(r.Body, &req.Body); err != nil {\nreturn err\n}\n")
+			if o.ValidateBody {
+				g.printf("if err := req.Body.Validate(); err != nil {\nreturn err\n}\n")
+			}
+		}
+		if o.Result == "" {
+			g.printf("if err := s.%s(ctx, req); err != nil {\nreturn err\n}\n", o.Name)
+			g.printf("w.WriteHeader(%s)\nreturn nil\n", statusExpr(o.Status))
+		} else {
+			g.printf("res, err := s.%s(ctx, req)\nif err != nil {\nreturn err\n}\n", o.Name)
+			g.printf("return restflex.WriteJSON(w, %s, res)\n", statusExpr(o.Status))
+		}
+		g.printf("}), opts...))\n")
+	}
+	g.printf("}\n\n")
+}
+
+// parseParam writes the parsing of parameter p into the request.
+func (g *generator) parseParam(p *parameter) {
+	field := "req." + identifier(p.Name)
+	value := fmt.Sprintf("r.PathValue(%q)", p.Name)
+	if p.In == "query" {
+		value = fmt.Sprintf("q.Get(%q)", p.Name)
+		if p.Required {
+			g.printf("if !q.Has(%q) {\nreturn restflex.NewAPIError(http.StatusBadRequest, nil, %q)\n}\n", p.Name, fmt.Sprintf("missing query parameter %q", p.Name))
+		}
+	}
+	var parse string
+	switch paramType(p.Schema) {
+	case "string":
+		g.printf("%s = %s\n", field, value)
+		if len(p.Schema.Enum) > 0 {
+			g.use("slices")
+			quoted := make([]string, len(p.Schema.Enum))
+			for i, v := range p.Schema.Enum {
+				quoted[i] = strconv.Quote(v)
+			}
+			msg := fmt.Sprintf("invalid %s parameter %q: must be one of %s", p.In, p.Name, strings.Join(quoted, ", "))
+			g.printf("if %s != \"\" && !slices.Contains(%s, %[1]s) {\nreturn restflex.NewAPIError(http.StatusBadRequest, nil, %[3]q)\n}\n", field, enumValues(p.Schema), msg)
+		}
+		return
+	case "int64":
+		parse = "strconv.ParseInt(param, 10, 64)"
+	case "float64":
+		parse = "strconv.ParseFloat(param, 64)"
+	case "bool":
+		parse = "strconv.ParseBool(param)"
+	}
+	g.use("strconv")
+	g.printf("if param := %s; param != \"\" {\nv, err := %s\nif err != nil {\nreturn restflex.NewAPIError(http.StatusBadRequest, err, %q)\n}\n%s = v\n}\n",
+		value, parse, fmt.Sprintf("invalid %s parameter %q", p.In, p.Name), field)
+}
+
+// pathParam matches the path wildcards of a pattern.
+var pathParam = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// client writes the typed Client.
+func (g *generator) client(ops []*op) {
+	g.use("kkn.fi/restflex/client")
+	g.printf(`// Client is a typed client of the API.
+type Client struct {
+	*client.Client
+}
+
+// NewClient returns a client for the API at baseURL.
+func NewClient(baseURL string) (*Client, error) {
+	c, err := client.New(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: c}, nil
+}
+
+`)
+	for _, o := range ops {
+		g.comment(o.Name, "", o.Summary)
+		g.printf("func (c *Client) %s(ctx context.Context, req *%[1]sRequest) %s {\n", o.Name, results(o))
+		params := make(map[string]*parameter)
+		for _, p := range o.Params {
+			params[p.In+" "+p.Name] = p
+		}
+		g.printf("path := %s\n", g.pathExpr(o.Path, params))
+		if slices.ContainsFunc(o.Params, func(p *parameter) bool { return p.In == "query" }) {
+			g.use("net/url")
+			g.printf("q := url.Values{}\n")
+			for _, p := range o.Params {
+				if p.In != "query" {
+					continue
+				}
+				field := "req." + identifier(p.Name)
+				if p.Required {
+					g.printf("q.Set(%q, %s)\n", p.Name, formatParam(p, field))
+					continue
+				}
+				g.printf("if %s != %s {\nq.Set(%q, %s)\n}\n", field, zero(paramType(p.Schema)), p.Name, formatParam(p, field))
+			}
+			g.printf("if len(q) > 0 {\npath += \"?\" + q.Encode()\n}\n")
+		}
+		in := "nil"
+		if o.Body != "" {
+			in = "req.Body"
+		}
+		method := "http.Method" + strings.ToUpper(o.Method[:1]) + strings.ToLower(o.Method[1:])
+		switch {
+		case o.Result == "":
+			g.printf("return c.Do(ctx, %s, path, %s, nil)\n", method, in)
+		case strings.HasPrefix(o.Result, "*"):
+			g.printf("res := new(%s)\nif err := c.Do(ctx, %s, path, %s, res); err != nil {\nreturn nil, err\n}\nreturn res, nil\n", o.Result[1:], method, in)
+		default:
+			g.printf("var res %s\nerr := c.Do(ctx, %s, path, %s, &res)\nreturn res, err\n", o.Result, method, in)
+		}
+		g.printf("}\n\n")
+	}
+}
+
+// pathExpr returns the expression of the request path of pattern path
+// with its wildcards replaced by the path parameters.
+func (g *generator) pathExpr(path string, params map[string]*parameter) string {
+	path = strings.TrimSuffix(path, "{$}")
+	var parts []string
+	last := 0
+	for _, m := range pathParam.FindAllStringSubmatchIndex(path, -1) {
+		if m[0] > last {
+			parts = append(parts, strconv.Quote(path[last:m[0]]))
+		}
+		name := path[m[2]:m[3]]
+		g.use("net/url")
+		parts = append(parts, "url.PathEscape("+formatParam(params["path "+name], "req."+identifier(name))+")")
+		last = m[1]
+	}
+	if last < len(path) {
+		parts = append(parts, strconv.Quote(path[last:]))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// comment writes a doc comment for name unless text is empty. Texts not
+// starting with name are joined to it with verb, if set.
+func (g *generator) comment(name, verb, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if !strings.HasPrefix(text, name+" ") {
+		if verb != "" {
+			name += " " + verb
+		}
+		text = name + " " + strings.ToLower(text[:1]) + text[1:]
+	}
+	g.printf("// %s\n", strings.ReplaceAll(text, "\n", "\n// "))
+}
+
+// goType returns the Go type of s.
+func (g *generator) goType(s *schema) string {
+	if s.Ref != "" {
+		return identifier(s.Ref[strings.LastIndex(s.Ref, "/")+1:])
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.use("time")
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		if s.Items == nil {
+			return "[]any"
+		}
+		return "[]" + g.goType(s.Items)
+	case "object":
+		return "map[string]any"
+	}
+	return "any"
+}
+
+// isStruct reports whether s refers to an object schema.
+func (g *generator) isStruct(s *schema) bool {
+	if s.Ref == "" {
+		return false
+	}
+	target, ok := g.doc.Components.Schemas[s.Ref[strings.LastIndex(s.Ref, "/")+1:]]
+	return ok && (target.Type == "object" || target.Properties != nil)
+}
+
+// results returns the result list of the methods of o.
+func results(o *op) string {
+	if o.Result == "" {
+		return "error"
+	}
+	return "(" + o.Result + ", error)"
+}
+
+// paramType returns the Go type of a parameter with schema s, or an empty
+// string if it is not supported.
+func paramType(s *schema) string {
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	}
+	return ""
+}
+
+// formatParam returns the expression formatting field of parameter p.
+func formatParam(p *parameter, field string) string {
+	if p == nil {
+		return field
+	}
+	switch paramType(p.Schema) {
+	case "int64":
+		return "strconv.FormatInt(" + field + ", 10)"
+	case "float64":
+		return "strconv.FormatFloat(" + field + ", 'g', -1, 64)"
+	case "bool":
+		return "strconv.FormatBool(" + field + ")"
+	}
+	return field
+}
+
+// statusExpr returns the http constant of the common success statuses.
+func statusExpr(status int) string {
+	switch status {
+	case http.StatusOK:
+		return "http.StatusOK"
+	case http.StatusCreated:
+		return "http.StatusCreated"
+	case http.StatusAccepted:
+		return "http.StatusAccepted"
+	case http.StatusNoContent:
+		return "http.StatusNoContent"
+	}
+	return strconv.Itoa(status)
+}
+
+// zero returns the zero value of a parameter type.
+func zero(typ string) string {
+	switch typ {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	}
+	return "0"
+}
+
+// initialisms are written in upper case in identifiers.
+var initialisms = map[string]bool{
+	"api": true, "http": true, "id": true, "json": true, "url": true, "uuid": true,
+}
+
+// identifier returns name as an exported Go identifier, such as PetID for
+// "pet_id" and ListPets for "listPets".
+func identifier(name string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for i, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]):
+			flush()
+			word = append(word, r)
+		case unicode.IsLower(r) && len(word) > 1 && unicode.IsUpper(word[len(word)-1]) && unicode.IsUpper(word[len(word)-2]):
+			// end of an upper case initialism such as HTTP in HTTPStatus
+			last := word[len(word)-1]
+			word = word[:len(word)-1]
+			flush()
+			word = append(word, last, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	var b strings.Builder
+	for _, w := range words {
+		lower := strings.ToLower(w)
+		if initialisms[lower] {
+			b.WriteString(strings.ToUpper(lower))
+			continue
+		}
+		b.WriteString(strings.ToUpper(lower[:1]) + lower[1:])
+	}
+	id := b.String()
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "X" + id
+	}
+	return id
+}
@@ -0,0 +1,125 @@
+//go:build !integration
+
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestGenerate(t *testing.T) {
+	spec, err := os.ReadFile("testdata/petstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate(spec, "petstore")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const golden = "testdata/petstore.go.golden"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("generated source differs from %s (run with -update to accept):\n%s", golden, got)
+	}
+	// internal/petstore compiles and tests the generated source against
+	// restflex
+	const compiled = "internal/petstore/petstore.go"
+	if *update {
+		if err := os.WriteFile(compiled, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if src, err := os.ReadFile(compiled); err != nil || string(src) != string(want) {
+		t.Errorf("%s differs from %s (run with -update to copy it)", compiled, golden)
+	}
+}
+
+func TestGenerate_invalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		spec string
+		err  string
+	}{
+		{name: "not JSON", spec: "openapi: 3.1.0", err: "parsing OpenAPI document"},
+		{name: "swagger", spec: `{"swagger": "2.0"}`, err: "unsupported OpenAPI version"},
+		{name: "parameter type", spec: `{"openapi": "3.1.0", "paths": {"/a/{b}": {"get": {"parameters": [{"name": "b", "in": "path", "schema": {"type": "array"}}]}}}}`, err: "unsupported type of parameter b"},
+		{name: "request body", spec: `{"openapi": "3.1.0", "paths": {"/a": {"post": {"requestBody": {"content": {"text/plain": {}}}}}}}`, err: "request body is not JSON"},
+		{name: "duplicate name", spec: `{"openapi": "3.1.0", "paths": {"/a": {"get": {"operationId": "a"}}, "/b": {"get": {"operationId": "a"}}}}`, err: "operation name A is also used by GET /a"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := generate([]byte(tt.spec), "api")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"pet_id":         "PetID",
+		"listPets":       "ListPets",
+		"get /pets/{id}": "GetPetsID",
+		"created-at":     "CreatedAt",
+		"HTTPStatus":     "HTTPStatus",
+		"2fa":            "X2fa",
+		"api_url":        "APIURL",
+		"available":      "Available",
+	}
+	for name, want := range tests {
+		if got := identifier(name); got != want {
+			t.Errorf("identifier(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestScaffold(t *testing.T) {
+	res, err := newResource("order_item", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != (resource{Package: "orderitems", Name: "OrderItem", Var: "orderItem", Plural: "orderitems"}) {
+		t.Fatalf("unexpected resource: %+v", res)
+	}
+	files, err := scaffold(res)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"orderitem.go", "orderitem_store.go", "orderitem_test.go"} {
+		got, ok := files[name]
+		if !ok {
+			t.Errorf("expected %s to be scaffolded", name)
+			continue
+		}
+		golden := "testdata/scaffold/" + name + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%v (run with -update to create it)", err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("scaffolded %s differs from %s (run with -update to accept):\n%s", name, golden, got)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Code generated by restflexgen. DO NOT EDIT.
+
+package petstore
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/infra"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/client"
+)
+
+type NewPet struct {
+	Name   string   `json:"name"`
+	Status Status   `json:"status,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// Validate validates the enum values of NewPet.
+func (v NewPet) Validate() error {
+	if v.Status != "" {
+		if err := restflex.ValidateEnum("status", v.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pet is a pet in the store.
+type Pet struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Status    Status    `json:"status,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// Validate validates the enum values of Pet.
+func (v Pet) Validate() error {
+	if v.Status != "" {
+		if err := restflex.ValidateEnum("status", v.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status is the availability of a pet.
+type Status string
+
+const (
+	StatusAvailable Status = "available"
+	StatusSold      Status = "sold"
+)
+
+// EnumValues returns the values of Status.
+func (Status) EnumValues() []string {
+	return []string{"available", "sold"}
+}
+
+// ListPetsRequest is the request of ListPets.
+type ListPetsRequest struct {
+	Limit  int64  // query parameter "limit"
+	Status string // query parameter "status"
+}
+
+// CreatePetRequest is the request of CreatePet.
+type CreatePetRequest struct {
+	Body NewPet
+}
+
+// GetPetRequest is the request of GetPet.
+type GetPetRequest struct {
+	PetID int64 // path parameter "pet_id"
+}
+
+// DeletePetsPetIDRequest is the request of DeletePetsPetID.
+type DeletePetsPetIDRequest struct {
+	PetID int64 // path parameter "pet_id"
+}
+
+// Server implements the operations of the API.
+type Server interface {
+	// ListPets lists the pets.
+	ListPets(ctx context.Context, req *ListPetsRequest) ([]Pet, error)
+	// CreatePet creates a pet.
+	CreatePet(ctx context.Context, req *CreatePetRequest) (*Pet, error)
+	GetPet(ctx context.Context, req *GetPetRequest) (*Pet, error)
+	DeletePetsPetID(ctx context.Context, req *DeletePetsPetIDRequest) error
+}
+
+// Register registers the operations of s as restflex handlers on mux.
+func Register(mux *http.ServeMux, l infra.Logger, s Server, opts ...restflex.Option) {
+	mux.Handle("GET /pets", restflex.NewHandlerWithContext(l, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req := new(ListPetsRequest)
+		q := r.URL.Query()
+		if param := q.Get("limit"); param != "" {
+			v, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return restflex.NewAPIError(http.StatusBadRequest, err, "invalid query parameter \"limit\"")
+			}
+			req.Limit = v
+		}
+		req.Status = q.Get("status")
+		if req.Status != "" && !slices.Contains([]string{"available", "sold"}, req.Status) {
+			return restflex.NewAPIError(http.StatusBadRequest, nil, "invalid query parameter \"status\": must be one of \"available\", \"sold\"")
+		}
+		res, err := s.ListPets(ctx, req)
+		if err != nil {
+			return err
+		}
+		return restflex.WriteJSON(w, http.StatusOK, res)
+	}), opts...))
+	mux.Handle("POST /pets", restflex.NewHandlerWithContext(l, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req := new(CreatePetRequest)
+		if err := restflex.DecodeJSON(r.Body, &req.Body); err != nil {
+			return err
+		}
+		if err := req.Body.Validate(); err != nil {
+			return err
+		}
+		res, err := s.CreatePet(ctx, req)
+		if err != nil {
+			return err
+		}
+		return restflex.WriteJSON(w, http.StatusCreated, res)
+	}), opts...))
+	mux.Handle("GET /pets/{pet_id}", restflex.NewHandlerWithContext(l, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req := new(GetPetRequest)
+		if param := r.PathValue("pet_id"); param != "" {
+			v, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return restflex.NewAPIError(http.StatusBadRequest, err, "invalid path parameter \"pet_id\"")
+			}
+			req.PetID = v
+		}
+		res, err := s.GetPet(ctx, req)
+		if err != nil {
+			return err
+		}
+		return restflex.WriteJSON(w, http.StatusOK, res)
+	}), opts...))
+	mux.Handle("DELETE /pets/{pet_id}", restflex.NewHandlerWithContext(l, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req := new(DeletePetsPetIDRequest)
+		if param := r.PathValue("pet_id"); param != "" {
+			v, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return restflex.NewAPIError(http.StatusBadRequest, err, "invalid path parameter \"pet_id\"")
+			}
+			req.PetID = v
+		}
+		if err := s.DeletePetsPetID(ctx, req); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), opts...))
+}
+
+// Client is a typed client of the API.
+type Client struct {
+	*client.Client
+}
+
+// NewClient returns a client for the API at baseURL.
+func NewClient(baseURL string) (*Client, error) {
+	c, err := client.New(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: c}, nil
+}
+
+// ListPets lists the pets.
+func (c *Client) ListPets(ctx context.Context, req *ListPetsRequest) ([]Pet, error) {
+	path := "/pets"
+	q := url.Values{}
+	if req.Limit != 0 {
+		q.Set("limit", strconv.FormatInt(req.Limit, 10))
+	}
+	if req.Status != "" {
+		q.Set("status", req.Status)
+	}
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var res []Pet
+	err := c.Do(ctx, http.MethodGet, path, nil, &res)
+	return res, err
+}
+
+// CreatePet creates a pet.
+func (c *Client) CreatePet(ctx context.Context, req *CreatePetRequest) (*Pet, error) {
+	path := "/pets"
+	res := new(Pet)
+	if err := c.Do(ctx, http.MethodPost, path, req.Body, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) GetPet(ctx context.Context, req *GetPetRequest) (*Pet, error) {
+	path := "/pets/" + url.PathEscape(strconv.FormatInt(req.PetID, 10))
+	res := new(Pet)
+	if err := c.Do(ctx, http.MethodGet, path, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) DeletePetsPetID(ctx context.Context, req *DeletePetsPetIDRequest) error {
+	path := "/pets/" + url.PathEscape(strconv.FormatInt(req.PetID, 10))
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
@@ -0,0 +1,61 @@
+//go:build !integration
+
+package petstore_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/cmd/restflexgen/internal/petstore"
+	"kkn.fi/restflex/resttest"
+)
+
+type server struct{}
+
+func (server) ListPets(ctx context.Context, req *petstore.ListPetsRequest) ([]petstore.Pet, error) {
+	return []petstore.Pet{{ID: 1, Name: "Rex", Status: petstore.Status(req.Status)}}, nil
+}
+
+func (server) CreatePet(ctx context.Context, req *petstore.CreatePetRequest) (*petstore.Pet, error) {
+	return &petstore.Pet{ID: 2, Name: req.Body.Name, Status: req.Body.Status, CreatedAt: time.Now()}, nil
+}
+
+func (server) GetPet(ctx context.Context, req *petstore.GetPetRequest) (*petstore.Pet, error) {
+	return nil, restflex.ErrNotFound
+}
+
+func (server) DeletePetsPetID(ctx context.Context, req *petstore.DeletePetsPetIDRequest) error {
+	return nil
+}
+
+func TestRegister_enums(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	petstore.Register(mux, resttest.NewLogger(), server{})
+
+	resttest.Get("/pets").WithQuery("status", "sold").To(mux).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$[0].status", "sold")
+	resttest.Get("/pets").WithQuery("status", "lost").To(mux).Expect(t).
+		Status(http.StatusBadRequest).
+		Error(`invalid query parameter "status": must be one of "available", "sold"`)
+	resttest.Post("/pets").WithJSON(map[string]string{"name": "Rex", "status": "available"}).To(mux).Expect(t).
+		Status(http.StatusCreated).
+		JSONPath("$.status", "available")
+	resttest.Post("/pets").WithJSON(map[string]string{"name": "Rex", "status": "lost"}).To(mux).Expect(t).
+		Status(http.StatusUnprocessableEntity).
+		Error(`status must be one of "available", "sold", got "lost"`)
+	resttest.Post("/pets").WithJSON(map[string]string{"name": "Rex"}).To(mux).Expect(t).
+		Status(http.StatusCreated)
+}
+
+func TestStatus_EnumValues(t *testing.T) {
+	t.Parallel()
+	schema := restflex.EnumSchema[petstore.Status]()
+	if values := schema["enum"].([]string); len(values) != 2 || values[0] != string(petstore.StatusAvailable) || values[1] != string(petstore.StatusSold) {
+		t.Errorf("unexpected enum values %v", values)
+	}
+}
@@ -0,0 +1,68 @@
+// Command restflexgen generates restflex handlers from an OpenAPI document.
+//
+// It reads an OpenAPI 3 document in JSON and writes a Go file with
+// the schemas as types, a Server interface with a method per operation, a
+// Register function registering the operations as restflex handlers on a
+// ServeMux, and a typed Client:
+//
+//	restflexgen -package petstore -o petstore_gen.go openapi.json
+//
+// Operations use the JSON request body and the first 2xx response. Path
+// and query parameters may be strings, integers, numbers or booleans. The
+// values of string enums in parameters and request bodies are validated.
+//
+// The scaffold subcommand writes the skeleton of a new CRUD resource
+// following the conventions of restflex: the resource and request types with
+// validation, a store interface with an in-memory implementation, the
+// handlers with their route registration, and tests:
+//
+//	restflexgen scaffold -dir internal/orders Order
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "scaffold" {
+		if err := scaffoldMain(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "restflexgen: scaffold: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	pkg := flag.String("package", "api", "package name of the generated file")
+	out := flag.String("o", "", "output file, standard output if empty")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: restflexgen [-package name] [-o file] openapi.json")
+		fmt.Fprintln(flag.CommandLine.Output(), "       restflexgen scaffold [flags] Resource")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *pkg, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "restflexgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, pkg, out string) error {
+	spec, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	src, err := generate(spec, pkg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// resource names a scaffolded resource, such as Order served at /orders.
+type resource struct {
+	Package string
+	// Name is the type name of the resource, such as Order.
+	Name string
+	// Var is Name as an unexported identifier, such as order.
+	Var string
+	// Plural names the collection, such as orders.
+	Plural string
+}
+
+// scaffoldMain runs the scaffold subcommand with args.
+func scaffoldMain(args []string) error {
+	fset := flag.NewFlagSet("scaffold", flag.ExitOnError)
+	pkg := fset.String("package", "", "package name, the plural of the resource if empty")
+	dir := fset.String("dir", ".", "directory to write the files to")
+	plural := fset.String("plural", "", "plural of the resource used in paths and identifiers, name + \"s\" if empty")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "usage: restflexgen scaffold [-package name] [-plural name] [-dir dir] Resource")
+		fset.PrintDefaults()
+	}
+	_ = fset.Parse(args)
+	if fset.NArg() != 1 {
+		fset.Usage()
+		os.Exit(2)
+	}
+	res, err := newResource(fset.Arg(0), *plural, *pkg)
+	if err != nil {
+		return err
+	}
+	files, err := scaffold(res)
+	if err != nil {
+		return err
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(*dir, name)); !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s exists, not overwriting", filepath.Join(*dir, name))
+		}
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(*dir, name), src, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newResource returns the resource named name, such as Order.
+func newResource(name, plural, pkg string) (resource, error) {
+	name = identifier(name)
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		return resource{}, fmt.Errorf("invalid resource name %q", name)
+	}
+	v := strings.ToLower(name[:1]) + name[1:]
+	if plural == "" {
+		plural = strings.ToLower(name) + "s"
+	}
+	if pkg == "" {
+		pkg = strings.ToLower(plural)
+	}
+	return resource{Package: pkg, Name: name, Var: v, Plural: plural}, nil
+}
+
+// scaffold returns the formatted files of res by file name.
+func scaffold(res resource) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, t := range scaffoldTemplates.Templates() {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, res); err != nil {
+			return nil, err
+		}
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("formatting %s: %w", t.Name(), err)
+		}
+		files[strings.ReplaceAll(t.Name(), "resource", strings.ToLower(res.Name))] = src
+	}
+	return files, nil
+}
+
+var scaffoldTemplates = template.Must(template.New("resource.go").Parse(`package {{.Package}}
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/infra"
+	"kkn.fi/restflex"
+)
+
+// {{.Name}} is a resource of the {{.Plural}} API.
+type {{.Name}} struct {
+	ID        restflex.UUID ` + "`json:\"id\"`" + `
+	Name      string        ` + "`json:\"name\"`" + `
+	CreatedAt time.Time     ` + "`json:\"created_at\"`" + `
+	UpdatedAt time.Time     ` + "`json:\"updated_at\"`" + `
+}
+
+// {{.Name}}Input is the request body creating or updating {{.Plural}}.
+type {{.Name}}Input struct {
+	Name string ` + "`json:\"name\" limit:\"maxlen=200\"`" + `
+}
+
+func (in *{{.Name}}Input) Validate() error {
+	if strings.TrimSpace(in.Name) == "" {
+		return restflex.NewValidationError(http.StatusUnprocessableEntity, nil, "name is required")
+	}
+	return nil
+}
+
+// {{.Name}}Store stores {{.Plural}}. Get, Update and Delete return
+// restflex.ErrNotFound for unknown IDs.
+type {{.Name}}Store interface {
+	List(ctx context.Context) ([]{{.Name}}, error)
+	Get(ctx context.Context, id restflex.UUID) (*{{.Name}}, error)
+	Create(ctx context.Context, {{.Var}} *{{.Name}}) error
+	Update(ctx context.Context, {{.Var}} *{{.Name}}) error
+	Delete(ctx context.Context, id restflex.UUID) error
+}
+
+// {{.Name}}Handler serves the {{.Plural}} API.
+type {{.Name}}Handler struct {
+	Store {{.Name}}Store
+	Log   infra.Logger
+}
+
+func New{{.Name}}Handler(l infra.Logger, store {{.Name}}Store) *{{.Name}}Handler {
+	return &{{.Name}}Handler{
+		Store: store,
+		Log:   l,
+	}
+}
+
+// Routes registers the routes of the {{.Plural}} API on mux.
+func (h *{{.Name}}Handler) Routes(mux restflex.Router) {
+	bind := func(f httpx.HandlerWithContextFunc) http.Handler {
+		return restflex.NewHandlerWithContext(h.Log, restflex.Bind[{{.Name}}Input](f))
+	}
+	mux.Handle("GET /{{.Plural}}", h.handler(h.list))
+	mux.Handle("POST /{{.Plural}}", bind(h.create))
+	mux.Handle("GET /{{.Plural}}/{id}", h.handler(h.get))
+	mux.Handle("PUT /{{.Plural}}/{id}", bind(h.update))
+	mux.Handle("DELETE /{{.Plural}}/{id}", h.handler(h.delete))
+	restflex.DeclareErrors("GET /{{.Plural}}/{id}", restflex.ErrNotFound)
+	restflex.DeclareErrors("PUT /{{.Plural}}/{id}", restflex.ErrNotFound)
+	restflex.DeclareErrors("DELETE /{{.Plural}}/{id}", restflex.ErrNotFound)
+}
+
+func (h *{{.Name}}Handler) handler(f httpx.HandlerWithContextFunc) http.Handler {
+	return restflex.NewHandlerWithContext(h.Log, f)
+}
+
+func (h *{{.Name}}Handler) list(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	{{.Plural}}, err := h.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	return restflex.WriteJSON(w, http.StatusOK, {{.Plural}})
+}
+
+func (h *{{.Name}}Handler) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	in, _ := restflex.RequestBody[{{.Name}}Input](ctx)
+	now := time.Now().UTC()
+	{{.Var}} := &{{.Name}}{
+		ID:        restflex.NewUUIDv7(),
+		Name:      in.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.Store.Create(ctx, {{.Var}}); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/{{.Plural}}/"+{{.Var}}.ID.String())
+	return restflex.WriteJSON(w, http.StatusCreated, {{.Var}})
+}
+
+func (h *{{.Name}}Handler) get(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var id restflex.UUID
+	if err := restflex.PathParam(r, "id", &id); err != nil {
+		return err
+	}
+	{{.Var}}, err := h.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return restflex.WriteJSON(w, http.StatusOK, {{.Var}})
+}
+
+func (h *{{.Name}}Handler) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var id restflex.UUID
+	if err := restflex.PathParam(r, "id", &id); err != nil {
+		return err
+	}
+	in, _ := restflex.RequestBody[{{.Name}}Input](ctx)
+	{{.Var}}, err := h.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	{{.Var}}.Name = in.Name
+	{{.Var}}.UpdatedAt = time.Now().UTC()
+	if err := h.Store.Update(ctx, {{.Var}}); err != nil {
+		return err
+	}
+	return restflex.WriteJSON(w, http.StatusOK, {{.Var}})
+}
+
+func (h *{{.Name}}Handler) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var id restflex.UUID
+	if err := restflex.PathParam(r, "id", &id); err != nil {
+		return err
+	}
+	if err := h.Store.Delete(ctx, id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+`))
+
+func init() {
+	template.Must(scaffoldTemplates.New("resource_store.go").Parse(`package {{.Package}}
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"kkn.fi/restflex"
+)
+
+// Memory{{.Name}}Store is a {{.Name}}Store keeping {{.Plural}} in memory, for
+// development and tests.
+type Memory{{.Name}}Store struct {
+	mu        sync.Mutex
+	{{.Plural}} map[restflex.UUID]{{.Name}}
+}
+
+func NewMemory{{.Name}}Store() *Memory{{.Name}}Store {
+	return &Memory{{.Name}}Store{
+		{{.Plural}}: make(map[restflex.UUID]{{.Name}}),
+	}
+}
+
+func (s *Memory{{.Name}}Store) List(ctx context.Context) ([]{{.Name}}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	{{.Plural}} := make([]{{.Name}}, 0, len(s.{{.Plural}}))
+	for _, {{.Var}} := range s.{{.Plural}} {
+		{{.Plural}} = append({{.Plural}}, {{.Var}})
+	}
+	slices.SortFunc({{.Plural}}, func(a, b {{.Name}}) int {
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return {{.Plural}}, nil
+}
+
+func (s *Memory{{.Name}}Store) Get(ctx context.Context, id restflex.UUID) (*{{.Name}}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	{{.Var}}, ok := s.{{.Plural}}[id]
+	if !ok {
+		return nil, restflex.ErrNotFound
+	}
+	return &{{.Var}}, nil
+}
+
+func (s *Memory{{.Name}}Store) Create(ctx context.Context, {{.Var}} *{{.Name}}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.{{.Plural}}[{{.Var}}.ID] = *{{.Var}}
+	return nil
+}
+
+func (s *Memory{{.Name}}Store) Update(ctx context.Context, {{.Var}} *{{.Name}}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.{{.Plural}}[{{.Var}}.ID]; !ok {
+		return restflex.ErrNotFound
+	}
+	s.{{.Plural}}[{{.Var}}.ID] = *{{.Var}}
+	return nil
+}
+
+func (s *Memory{{.Name}}Store) Delete(ctx context.Context, id restflex.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.{{.Plural}}[id]; !ok {
+		return restflex.ErrNotFound
+	}
+	delete(s.{{.Plural}}, id)
+	return nil
+}
+`))
+	template.Must(scaffoldTemplates.New("resource_test.go").Parse(`//go:build !integration
+
+package {{.Package}}
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex/resttest"
+)
+
+func new{{.Name}}API() http.Handler {
+	mux := http.NewServeMux()
+	New{{.Name}}Handler(resttest.NewLogger(), NewMemory{{.Name}}Store()).Routes(mux)
+	return mux
+}
+
+func Test{{.Name}}Handler(t *testing.T) {
+	t.Parallel()
+	api := new{{.Name}}API()
+
+	res := resttest.Post("/{{.Plural}}").WithJSON(map[string]string{"name": "first"}).To(api).Expect(t).
+		Status(http.StatusCreated).
+		JSONPath("$.name", "first")
+	var created {{.Name}}
+	if err := json.Unmarshal(res.Body, &created); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := "/{{.Plural}}/" + created.ID.String()
+
+	resttest.Get(path).To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.name", "first")
+	resttest.Get("/{{.Plural}}").To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$[0].name", "first")
+	resttest.Put(path).WithJSON(map[string]string{"name": "second"}).To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.name", "second")
+	resttest.Delete(path).To(api).Expect(t).
+		Status(http.StatusNoContent)
+	resttest.Get(path).To(api).Expect(t).
+		Status(http.StatusNotFound)
+}
+
+func Test{{.Name}}Handler_invalid(t *testing.T) {
+	t.Parallel()
+	api := new{{.Name}}API()
+	tests := []struct {
+		name   string
+		req    *resttest.Request
+		status int
+	}{
+		{name: "missing name", req: resttest.Post("/{{.Plural}}").WithJSON(map[string]string{"name": " "}), status: http.StatusUnprocessableEntity},
+		{name: "malformed id", req: resttest.Get("/{{.Plural}}/1"), status: http.StatusBadRequest},
+		{name: "unknown id", req: resttest.Delete("/{{.Plural}}/0190a5b8-5d3e-7000-8000-000000000000"), status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.req.To(api).Expect(t).Status(tt.status)
+		})
+	}
+}
+`))
+}
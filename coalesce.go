@@ -0,0 +1,94 @@
+package restflex
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Coalescer is a middleware that runs concurrent identical GET requests
+// through the handler only once and writes the resulting response to every
+// waiting client. Requests with Authorization or Cookie headers are never
+// coalesced as their responses may be specific to a user, and responses
+// varying on headers not listed in Vary are not shared. The shared call is
+// not cancelled when the client of the leading request goes away.
+type Coalescer struct {
+	// Vary lists request headers that make otherwise identical requests distinct.
+	Vary []string
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	res  *CachedResponse
+}
+
+func NewCoalescer(vary ...string) *Coalescer {
+	return &Coalescer{
+		Vary: vary,
+	}
+}
+
+// Wrap returns a handler coalescing anonymous GET requests to next.
+func (c *Coalescer) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || hasCredentials(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := requestKey(r, c.Vary)
+		c.mu.Lock()
+		if c.calls == nil {
+			c.calls = make(map[string]*coalescedCall)
+		}
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				return
+			}
+			if call.res == nil {
+				// The leading request panicked or its response varies on
+				// headers outside Vary; serve this one on its own.
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeResponse(w, call.res)
+			return
+		}
+		call := &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+		cw := &captureWriter{ResponseWriter: &discardWriter{header: make(http.Header)}, status: http.StatusOK}
+		next.ServeHTTP(cw, r.WithContext(context.WithoutCancel(r.Context())))
+		res := cw.response()
+		if coversVary(res, c.Vary) {
+			call.res = sharedResponse(res)
+		}
+		writeResponse(w, res)
+	})
+}
+
+// perRequestHeaders are response headers specific to the request they were
+// written for, which are not written to the other coalesced requests.
+var perRequestHeaders = []string{RequestIDHeader, "Set-Cookie"}
+
+// sharedResponse returns res without its per-request headers.
+func sharedResponse(res *CachedResponse) *CachedResponse {
+	shared := *res
+	shared.Header = res.Header.Clone()
+	for _, name := range perRequestHeaders {
+		shared.Header.Del(name)
+	}
+	return &shared
+}
@@ -0,0 +1,197 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+)
+
+func TestCoalescer(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	})
+	srv := restflex.NewCoalescer().Wrap(next)
+
+	const n = 5
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/expensive", nil))
+		}(recs[i])
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 handler call, got %d", got)
+	}
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK {
+			t.Errorf("response %d: expected status %d, got %d", i, http.StatusOK, rec.Code)
+		}
+		if body := rec.Body.String(); body != `{"ok":true}` {
+			t.Errorf("response %d: unexpected body %q", i, body)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("response %d: unexpected content type %q", i, ct)
+		}
+	}
+}
+
+func TestCoalescer_credentials(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		_, _ = w.Write([]byte(r.Header.Get("Cookie")))
+	})
+	srv := restflex.NewCoalescer().Wrap(next)
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 2)
+	for i, cookie := range []string{"session=alice", "session=bob"} {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			r.Header.Set("Cookie", cookie)
+			srv.ServeHTTP(rec, r)
+		}(recs[i])
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 handler calls, got %d", got)
+	}
+	for i, want := range []string{"session=alice", "session=bob"} {
+		if body := recs[i].Body.String(); body != want {
+			t.Errorf("response %d: expected body %q, got %q", i, want, body)
+		}
+	}
+}
+
+// serveConcurrently serves reqs with h concurrently. The first request is
+// the leader: the others are sent once h has been entered.
+func serveConcurrently(h http.Handler, entered <-chan struct{}, release chan struct{}, reqs ...*http.Request) []*httptest.ResponseRecorder {
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, len(reqs))
+	for i, r := range reqs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			h.ServeHTTP(rec, r)
+		}(recs[i])
+		if i == 0 {
+			<-entered
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return recs
+}
+
+func TestCoalescer_vary(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	entered, release := make(chan struct{}, 2), make(chan struct{})
+	srv := restflex.NewCoalescer().Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		entered <- struct{}{}
+		<-release
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	var reqs []*http.Request
+	for _, lang := range []string{"fi", "en"} {
+		r := httptest.NewRequest(http.MethodGet, "/greeting", nil)
+		r.Header.Set("Accept-Language", lang)
+		reqs = append(reqs, r)
+	}
+	recs := serveConcurrently(srv, entered, release, reqs...)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 handler calls, got %d", got)
+	}
+	for i, want := range []string{"fi", "en"} {
+		if body := recs[i].Body.String(); body != want {
+			t.Errorf("response %d: expected body %q, got %q", i, want, body)
+		}
+	}
+}
+
+func TestCoalescer_per_request_headers(t *testing.T) {
+	t.Parallel()
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	coalesced := restflex.NewCoalescer().Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.Header().Set(restflex.RequestIDHeader, r.Header.Get(restflex.RequestIDHeader))
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(restflex.RequestIDHeader, r.Header.Get(restflex.RequestIDHeader))
+		coalesced.ServeHTTP(w, r)
+	})
+	var reqs []*http.Request
+	for _, id := range []string{"leader", "follower"} {
+		r := httptest.NewRequest(http.MethodGet, "/expensive", nil)
+		r.Header.Set(restflex.RequestIDHeader, id)
+		reqs = append(reqs, r)
+	}
+	recs := serveConcurrently(srv, entered, release, reqs...)
+	for i, want := range []string{"leader", "follower"} {
+		if got := recs[i].Header().Get(restflex.RequestIDHeader); got != want {
+			t.Errorf("response %d: expected request ID %q, got %q", i, want, got)
+		}
+		if body := recs[i].Body.String(); body != "ok" {
+			t.Errorf("response %d: unexpected body %q", i, body)
+		}
+	}
+}
+
+func TestCoalescer_leader_cancelled(t *testing.T) {
+	t.Parallel()
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	srv := restflex.NewCoalescer().Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		if err := r.Context().Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	leader := httptest.NewRequest(http.MethodGet, "/expensive", nil).WithContext(ctx)
+	recs := serveConcurrently(srv, entered, release, leader, httptest.NewRequest(http.MethodGet, "/expensive", nil))
+	if rec := recs[1]; rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("expected the follower to get the response, got %d %q", rec.Code, rec.Body)
+	}
+}
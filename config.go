@@ -0,0 +1,263 @@
+package restflex
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// Config holds the settings of a server. ConfigFromEnv loads it from
+// environment variables for twelve-factor deployments.
+type Config struct {
+	// Addr defaults to ":http", or ":https" with TLS.
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	MaxHeaderBytes    int
+	// MaxConnections and MaxConnectionsPerIP limit concurrent connections;
+	// zero means no limit.
+	MaxConnections      int
+	MaxConnectionsPerIP int
+	// TLSCertFile and TLSKeyFile enable HTTPS. TLSClientCAFile additionally
+	// requires client certificates signed by its CAs.
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	// TLSReloadInterval is the interval of checking the certificate files
+	// for changes; see CertificateReloader.Watch. Defaults to a minute.
+	TLSReloadInterval time.Duration
+	// LogLevel is the lowest level of response log lines; see LogPolicy.
+	LogLevel LogLevel
+	// Environment selects the route groups to mount; see Environment.Mount.
+	// An empty Environment is Production.
+	Environment Environment
+}
+
+// DefaultConfig returns the defaults used by NewServer.
+func DefaultConfig() Config {
+	return Config{
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+		ShutdownTimeout:   30 * time.Second,
+		TLSReloadInterval: time.Minute,
+		MaxHeaderBytes:    DefaultMaxHeaderBytes,
+		LogLevel:          LevelInfo,
+		Environment:       Production,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by the environment variables
+// named by prefix and the setting, e.g. with prefix "API":
+//
+//	API_ADDR                    address, e.g. ":8080" or "unix:/run/api.sock"
+//	API_READ_HEADER_TIMEOUT     duration, e.g. "10s"
+//	API_READ_TIMEOUT            duration
+//	API_WRITE_TIMEOUT           duration
+//	API_IDLE_TIMEOUT            duration
+//	API_SHUTDOWN_TIMEOUT        duration
+//	API_MAX_HEADER_BYTES        integer
+//	API_MAX_CONNECTIONS         integer
+//	API_MAX_CONNECTIONS_PER_IP  integer
+//	API_TLS_CERT_FILE           path
+//	API_TLS_KEY_FILE            path
+//	API_TLS_CLIENT_CA_FILE      path
+//	API_TLS_RELOAD_INTERVAL     duration
+//	API_LOG_LEVEL               debug, info, warn or error
+//	API_ENVIRONMENT             development, staging or production
+//
+// All invalid variables are reported in the returned error.
+func ConfigFromEnv(prefix string) (Config, error) {
+	cfg := DefaultConfig()
+	env := configEnv{prefix: prefix}
+	env.string("ADDR", &cfg.Addr)
+	env.duration("READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout)
+	env.duration("READ_TIMEOUT", &cfg.ReadTimeout)
+	env.duration("WRITE_TIMEOUT", &cfg.WriteTimeout)
+	env.duration("IDLE_TIMEOUT", &cfg.IdleTimeout)
+	env.duration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	env.int("MAX_HEADER_BYTES", &cfg.MaxHeaderBytes)
+	env.int("MAX_CONNECTIONS", &cfg.MaxConnections)
+	env.int("MAX_CONNECTIONS_PER_IP", &cfg.MaxConnectionsPerIP)
+	env.string("TLS_CERT_FILE", &cfg.TLSCertFile)
+	env.string("TLS_KEY_FILE", &cfg.TLSKeyFile)
+	env.string("TLS_CLIENT_CA_FILE", &cfg.TLSClientCAFile)
+	env.duration("TLS_RELOAD_INTERVAL", &cfg.TLSReloadInterval)
+	if v, ok := env.lookup("ENVIRONMENT"); ok {
+		cfg.Environment = Environment(v)
+	}
+	if v, ok := env.lookup("LOG_LEVEL"); ok {
+		level, err := ParseLogLevel(v)
+		if err != nil {
+			env.fail("LOG_LEVEL", err)
+		}
+		cfg.LogLevel = level
+	}
+	if err := errors.Join(env.errs...); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports invalid combinations of settings. The errors are joined
+// in the order of the fields of Config.
+func (c Config) Validate() error {
+	var errs []error
+	for _, d := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read header timeout", c.ReadHeaderTimeout},
+		{"read timeout", c.ReadTimeout},
+		{"write timeout", c.WriteTimeout},
+		{"idle timeout", c.IdleTimeout},
+		{"shutdown timeout", c.ShutdownTimeout},
+	} {
+		if d.d < 0 {
+			errs = append(errs, fmt.Errorf("restflex: negative %v %v", d.name, d.d))
+		}
+	}
+	if c.MaxHeaderBytes < 0 || c.MaxConnections < 0 || c.MaxConnectionsPerIP < 0 {
+		errs = append(errs, errors.New("restflex: negative limit"))
+	}
+	if c.MaxConnections > 0 && c.MaxConnectionsPerIP > c.MaxConnections {
+		errs = append(errs, errors.New("restflex: per IP connection limit exceeds the connection limit"))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("restflex: TLS requires both certificate and key files"))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, errors.New("restflex: client certificates require TLS"))
+	}
+	if c.TLSReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("restflex: negative TLS reload interval %v", c.TLSReloadInterval))
+	}
+	if c.LogLevel < LevelDebug || c.LogLevel > LevelOff {
+		errs = append(errs, fmt.Errorf("restflex: invalid log level %d", c.LogLevel))
+	}
+	if !c.Environment.Valid() {
+		errs = append(errs, fmt.Errorf("restflex: unknown environment %q", c.Environment))
+	}
+	return errors.Join(errs...)
+}
+
+// LogPolicy returns DefaultLogPolicy with the configured log level.
+func (c Config) LogPolicy() LogPolicy {
+	p := DefaultLogPolicy()
+	p.MinLevel = c.LogLevel
+	return p
+}
+
+// NewServerFromConfig returns a server configured by cfg. Certificates are
+// loaded with a CertificateReloader, which watches the files for changes
+// every TLSReloadInterval and on SIGHUP while the server runs.
+func NewServerFromConfig(l infra.Logger, cfg Config, h http.Handler) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	s := NewServer(l, cfg.Addr, h)
+	s.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	s.ReadTimeout = cfg.ReadTimeout
+	s.WriteTimeout = cfg.WriteTimeout
+	s.IdleTimeout = cfg.IdleTimeout
+	s.ShutdownTimeout = cfg.ShutdownTimeout
+	s.MaxHeaderBytes = cfg.MaxHeaderBytes
+	s.MaxConnections = cfg.MaxConnections
+	s.MaxConnectionsPerIP = cfg.MaxConnectionsPerIP
+	if cfg.TLSCertFile == "" {
+		return s, nil
+	}
+	reloader, err := NewCertificateReloader(l, cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	s.TLSConfig = NewTLSConfig()
+	s.TLSConfig.GetCertificate = reloader.GetCertificate
+	interval := cmp.Or(cfg.TLSReloadInterval, DefaultConfig().TLSReloadInterval)
+	s.OnStartup("certificate reloader", 0, func(ctx context.Context) error {
+		// ctx is done when the server shuts down.
+		go reloader.Watch(ctx, interval)
+		return nil
+	})
+	if cfg.TLSClientCAFile != "" {
+		cas, err := LoadCertPool(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		RequireClientCertificates(s.TLSConfig, cas)
+	}
+	return s, nil
+}
+
+// ParseLogLevel parses a level name such as "warn".
+func ParseLogLevel(s string) (LogLevel, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("restflex: unknown log level %q", s)
+}
+
+// configEnv reads prefixed environment variables collecting parse errors.
+type configEnv struct {
+	prefix string
+	errs   []error
+}
+
+func (e *configEnv) lookup(name string) (string, bool) {
+	key := name
+	if e.prefix != "" {
+		key = e.prefix + "_" + name
+	}
+	v, ok := os.LookupEnv(key)
+	return strings.TrimSpace(v), ok && strings.TrimSpace(v) != ""
+}
+
+func (e *configEnv) fail(name string, err error) {
+	if e.prefix != "" {
+		name = e.prefix + "_" + name
+	}
+	e.errs = append(e.errs, fmt.Errorf("restflex: %v: %w", name, err))
+}
+
+func (e *configEnv) string(name string, dst *string) {
+	if v, ok := e.lookup(name); ok {
+		*dst = v
+	}
+}
+
+func (e *configEnv) duration(name string, dst *time.Duration) {
+	if v, ok := e.lookup(name); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.fail(name, err)
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e *configEnv) int(name string, dst *int) {
+	if v, ok := e.lookup(name); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.fail(name, err)
+			return
+		}
+		*dst = n
+	}
+}
@@ -0,0 +1,93 @@
+//go:build !integration
+
+package restflex
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("API_ADDR", ":8080")
+	t.Setenv("API_WRITE_TIMEOUT", "15s")
+	t.Setenv("API_MAX_CONNECTIONS", "100")
+	t.Setenv("API_LOG_LEVEL", "warn")
+	t.Setenv("API_ENVIRONMENT", "staging")
+	cfg, err := ConfigFromEnv("API")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Addr != ":8080" || cfg.WriteTimeout != 15*time.Second || cfg.MaxConnections != 100 || cfg.LogLevel != LevelWarn || cfg.Environment != Staging {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.ReadHeaderTimeout != DefaultReadHeaderTimeout {
+		t.Errorf("expected default read header timeout, got %v", cfg.ReadHeaderTimeout)
+	}
+
+	s, err := NewServerFromConfig(nil, cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Addr != ":8080" || s.WriteTimeout != 15*time.Second || s.MaxConnections != 100 || s.TLSConfig != nil {
+		t.Errorf("unexpected server: %+v", s)
+	}
+	if p := cfg.LogPolicy(); p.MinLevel != LevelWarn {
+		t.Errorf("expected log policy level %v, got %v", LevelWarn, p.MinLevel)
+	}
+}
+
+func TestConfigFromEnv_invalid(t *testing.T) {
+	t.Setenv("API_READ_TIMEOUT", "soon")
+	t.Setenv("API_MAX_CONNECTIONS", "many")
+	t.Setenv("API_LOG_LEVEL", "loud")
+	_, err := ConfigFromEnv("API")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, name := range []string{"API_READ_TIMEOUT", "API_MAX_CONNECTIONS", "API_LOG_LEVEL"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected %v to be reported, got %v", name, err)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		cfg  func(*Config)
+	}{
+		{name: "negative timeout", cfg: func(c *Config) { c.IdleTimeout = -time.Second }},
+		{name: "certificate without key", cfg: func(c *Config) { c.TLSCertFile = "cert.pem" }},
+		{name: "client CAs without TLS", cfg: func(c *Config) { c.TLSClientCAFile = "ca.pem" }},
+		{name: "per IP limit over total", cfg: func(c *Config) { c.MaxConnections, c.MaxConnectionsPerIP = 1, 2 }},
+		{name: "unknown environment", cfg: func(c *Config) { c.Environment = "prod" }},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := DefaultConfig()
+			tt.cfg(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("unexpected error of a zero config: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout, cfg.ShutdownTimeout = -1, -2, -3, -4
+	want := "restflex: negative read timeout -1ns\nrestflex: negative write timeout -2ns\nrestflex: negative idle timeout -3ns\nrestflex: negative shutdown timeout -4ns"
+	for range 10 {
+		if err := cfg.Validate(); err == nil || err.Error() != want {
+			t.Fatalf("expected errors in the order of the fields, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package restflex
+
+import (
+	"mime"
+	"strings"
+)
+
+// MatchContentType reports whether the media type of the Content-Type
+// header value contentType matches one of the accepted media ranges.
+//
+// Types and subtypes are compared case-insensitively and an accepted range
+// may be a wildcard such as "*/*" or "application/*". Parameters of an
+// accepted range, such as charset in "text/plain; charset=utf-8", must be
+// present in contentType with the same value; charset values are compared
+// case-insensitively. Other parameters of contentType are ignored. Malformed
+// and empty values never match.
+func MatchContentType(contentType string, accepted ...string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || typ == "*" || subtype == "*" {
+		return false
+	}
+	for _, a := range accepted {
+		aType, aParams, err := mime.ParseMediaType(a)
+		if err != nil {
+			continue
+		}
+		if matchMediaRange(typ, subtype, aType) && matchParams(params, aParams) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaRange reports whether type/subtype is in mediaRange.
+func matchMediaRange(typ, subtype, mediaRange string) bool {
+	rangeType, rangeSubtype, ok := strings.Cut(mediaRange, "/")
+	if !ok {
+		return false
+	}
+	if rangeType == "*" {
+		return rangeSubtype == "*"
+	}
+	return rangeType == typ && (rangeSubtype == "*" || rangeSubtype == subtype)
+}
+
+// matchParams reports whether params has all of the required parameters.
+func matchParams(params, required map[string]string) bool {
+	for k, want := range required {
+		got, ok := params[k]
+		if !ok {
+			return false
+		}
+		if k == "charset" {
+			if !strings.EqualFold(got, want) {
+				return false
+			}
+		} else if got != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"testing"
+
+	"kkn.fi/restflex"
+)
+
+func TestMatchContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		accepted    []string
+		want        bool
+	}{
+		{name: "exact", contentType: "application/json", accepted: []string{"application/json"}, want: true},
+		{name: "case insensitive", contentType: "Application/JSON", accepted: []string{"application/json"}, want: true},
+		{name: "second accepted", contentType: "text/csv", accepted: []string{"application/json", "text/csv"}, want: true},
+		{name: "extra parameter", contentType: "application/json; charset=utf-8", accepted: []string{"application/json"}, want: true},
+		{name: "required parameter", contentType: "text/plain; charset=UTF-8", accepted: []string{"text/plain; charset=utf-8"}, want: true},
+		{name: "missing parameter", contentType: "text/plain", accepted: []string{"text/plain; charset=utf-8"}},
+		{name: "different parameter", contentType: "text/plain; charset=iso-8859-1", accepted: []string{"text/plain; charset=utf-8"}},
+		{name: "subtype wildcard", contentType: "application/merge-patch+json", accepted: []string{"application/*"}, want: true},
+		{name: "full wildcard", contentType: "image/png", accepted: []string{"*/*"}, want: true},
+		{name: "wildcard other type", contentType: "text/plain", accepted: []string{"application/*"}},
+		{name: "prefix", contentType: "application/jsonp", accepted: []string{"application/json"}},
+		{name: "suffix", contentType: "application/problem+json", accepted: []string{"application/json"}},
+		{name: "list", contentType: "text/plain, application/json", accepted: []string{"application/json"}},
+		{name: "wildcard content type", contentType: "*/*", accepted: []string{"*/*"}},
+		{name: "no subtype", contentType: "application", accepted: []string{"*/*"}},
+		{name: "empty", contentType: "", accepted: []string{"*/*"}},
+		{name: "malformed parameter", contentType: "application/json; charset", accepted: []string{"application/json"}},
+		{name: "nothing accepted", contentType: "application/json"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := restflex.MatchContentType(tt.contentType, tt.accepted...); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// Deadlines is a middleware setting the read, handler and write deadlines of
+// the routes it wraps, overriding the server-wide timeouts. A streaming
+// export route can thus be given a long write deadline while other routes
+// keep tight ones. Zero durations leave the server timeouts in effect.
+type Deadlines struct {
+	// Read is the time allowed for reading the request body.
+	Read time.Duration
+	// Handler is the timeout of the request context passed to the handler.
+	Handler time.Duration
+	// Write is the time allowed for writing the response.
+	Write time.Duration
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewDeadlines(l infra.Logger, read, handler, write time.Duration) *Deadlines {
+	return &Deadlines{
+		Read:    read,
+		Handler: handler,
+		Write:   write,
+		Log:     l,
+	}
+}
+
+// Wrap returns a handler setting the deadlines before calling next.
+func (d *Deadlines) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		rc := http.NewResponseController(w)
+		if d.Read > 0 {
+			d.check(rc.SetReadDeadline(now.Add(d.Read)))
+		}
+		if d.Write > 0 {
+			d.check(rc.SetWriteDeadline(now.Add(d.Write)))
+		}
+		if d.Handler > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), d.Handler)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Deadlines) check(err error) {
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		d.Log.Printf("restflex: error while setting deadline: %v", err)
+	}
+}
+
+// DeadlineBudget returns the time left until the deadline of ctx. It
+// reports false if ctx has no deadline.
+func DeadlineBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// WithDeadlineBudget returns a child context for an outbound call, such as
+// a database query or an upstream request, which is given share of the time
+// left until the deadline of ctx. For example a share of 0.8 leaves 20% of
+// the budget for handling the result and encoding the response. The child
+// has no deadline of its own if ctx has none.
+func WithDeadlineBudget(ctx context.Context, share float64) (context.Context, context.CancelFunc) {
+	budget, ok := DeadlineBudget(ctx)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	share = min(max(share, 0), 1)
+	return context.WithTimeout(ctx, time.Duration(float64(budget)*share))
+}
+
+// RequestTimeoutHeader is the header in which callers pass the time they
+// will wait for a response.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// RequestTimeout returns a middleware tightening the deadline of the
+// request context to the timeout passed by the caller in the
+// X-Request-Timeout or Request-Timeout header, so that cascading timeouts
+// line up across services. The timeout is either a number of seconds or a
+// duration such as "1.5s". Only requests for which trusted returns true,
+// such as ones from internal callers, are considered. The deadline is never
+// extended and invalid values are ignored.
+func RequestTimeout(l infra.Logger, trusted func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(RequestTimeoutHeader)
+			if value == "" {
+				value = r.Header.Get("Request-Timeout")
+			}
+			if value == "" || !trusted(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timeout, err := parseDuration(value, time.Second)
+			if err != nil || timeout <= 0 {
+				l.Printf("restflex: ignoring invalid request timeout %q", value)
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestDeadlines_Handler(t *testing.T) {
+	t.Parallel()
+	d := restflex.NewDeadlines(resttest.NewLogger(), 0, 10*time.Millisecond, 0)
+	h := d.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", r.Context().Err())
+		}
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	resttest.Get("/").To(h).Expect(t).Status(http.StatusGatewayTimeout)
+}
+
+func TestDeadlines_Write(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	logger := resttest.NewLogger()
+	mux.Handle("GET /slow", restflex.NewDeadlines(logger, 0, 0, time.Second).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	mux.Handle("GET /fast", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/slow")
+	if err != nil {
+		t.Fatalf("expected route deadline to override the server write timeout, got %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status code %d, but got %d", http.StatusNoContent, res.StatusCode)
+	}
+	if res, err := http.Get(srv.URL + "/fast"); err == nil {
+		res.Body.Close()
+		t.Error("expected server write timeout to apply to other routes")
+	}
+	logger.ExpectNone(t, "deadline")
+}
+
+func TestWithDeadlineBudget(t *testing.T) {
+	t.Parallel()
+	if _, ok := restflex.DeadlineBudget(context.Background()); ok {
+		t.Error("expected no budget without a deadline")
+	}
+	child, cancel := restflex.WithDeadlineBudget(context.Background(), 0.5)
+	defer cancel()
+	if _, ok := child.Deadline(); ok {
+		t.Error("expected no deadline for a child of a context without one")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	child, cancelChild := restflex.WithDeadlineBudget(ctx, 0.8)
+	defer cancelChild()
+	budget, ok := restflex.DeadlineBudget(child)
+	if !ok || budget > 800*time.Millisecond || budget < 700*time.Millisecond {
+		t.Errorf("expected a budget of about 800ms, got %v", budget)
+	}
+	parent, _ := restflex.DeadlineBudget(ctx)
+	if parent <= budget {
+		t.Errorf("expected parent budget %v to exceed child budget %v", parent, budget)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		trusted bool
+		want    time.Duration
+	}{
+		{name: "seconds", header: restflex.RequestTimeoutHeader, value: "2", trusted: true, want: 2 * time.Second},
+		{name: "duration", header: "Request-Timeout", value: "500ms", trusted: true, want: 500 * time.Millisecond},
+		{name: "not extended", header: restflex.RequestTimeoutHeader, value: "60", trusted: true, want: 10 * time.Second},
+		{name: "untrusted", header: restflex.RequestTimeoutHeader, value: "2", want: 10 * time.Second},
+		{name: "invalid", header: restflex.RequestTimeoutHeader, value: "soon", trusted: true, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var budget time.Duration
+			h := restflex.RequestTimeout(resttest.NewLogger(), func(*http.Request) bool { return tt.trusted })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				budget, _ = restflex.DeadlineBudget(r.Context())
+			}))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			req.Header.Set(tt.header, tt.value)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if budget > tt.want || budget < tt.want-time.Second {
+				t.Errorf("expected a budget of about %v, got %v", tt.want, budget)
+			}
+		})
+	}
+}
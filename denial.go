@@ -0,0 +1,107 @@
+package restflex
+
+import (
+	"maps"
+	"net/http"
+
+	"kkn.fi/infra"
+)
+
+// DenialReason classifies why a request was rejected for security reasons.
+// Reasons are stable machine-readable identifiers which are logged as
+// denial_reason, counted in Metrics and optionally included in the details
+// of error responses, so that rejections can be classified without parsing
+// error messages.
+type DenialReason string
+
+const (
+	DenialUnauthenticated  DenialReason = "unauthenticated"
+	DenialAccountLocked    DenialReason = "account_locked"
+	DenialLoginRateLimited DenialReason = "login_rate_limited"
+	DenialNonceMissing     DenialReason = "nonce_missing"
+	DenialNonceUsed        DenialReason = "nonce_used"
+	DenialNonceExpired     DenialReason = "nonce_expired"
+	DenialInvalidSignature DenialReason = "invalid_signature"
+	DenialExpiredSignature DenialReason = "expired_signature"
+	DenialReplayed         DenialReason = "replayed"
+)
+
+// DeniedError is implemented by APIErrors rejecting a request for a
+// security reason.
+type DeniedError interface {
+	DenialReason() DenialReason
+}
+
+type deniedError struct {
+	APIError
+	reason DenialReason
+}
+
+// NewDeniedError returns err rejecting a request for reason.
+func NewDeniedError(err APIError, reason DenialReason) APIError {
+	return &deniedError{
+		APIError: err,
+		reason:   reason,
+	}
+}
+
+func (e *deniedError) DenialReason() DenialReason {
+	return e.reason
+}
+
+// Unwrap returns the rejecting error so that its RetryAfterError and cause
+// are found by errors.As and errors.Is.
+func (e *deniedError) Unwrap() error {
+	return e.APIError
+}
+
+// denialReason returns the denial reason of err or an empty string.
+func denialReason(err error) DenialReason {
+	if d, ok := errorAs[DeniedError](err); ok {
+		return d.DenialReason()
+	}
+	return ""
+}
+
+// denialDetails returns details with the denial reason added.
+func denialDetails(details map[string]any, reason DenialReason) map[string]any {
+	details = maps.Clone(details)
+	if details == nil {
+		details = make(map[string]any, 1)
+	}
+	details["denial_reason"] = string(reason)
+	return details
+}
+
+// logDenial logs the rejection of r with err for reason.
+func logDenial(l infra.Logger, r *http.Request, err error, reason DenialReason) {
+	l.Printf("restflex: denied %s %s from %s: %v denial_reason=%s", r.Method, r.URL.Path, requestIP(r), err, reason)
+}
+
+// deny writes the response of a middleware rejecting r with err. A denial
+// reason of err is logged, counted in m and, if details is set, included in
+// the details of the response.
+func deny(l infra.Logger, m *Metrics, details bool, w http.ResponseWriter, r *http.Request, err APIError) {
+	reason := denialReason(err)
+	if reason == "" {
+		writeAPIError(l, w, err, nil)
+		return
+	}
+	logDenial(l, r, err, reason)
+	m.denied(reason)
+	var d map[string]any
+	if details {
+		d = denialDetails(nil, reason)
+	}
+	writeAPIError(l, w, err, d)
+}
+
+// WithDenialDetails includes the denial reason of DeniedErrors returned by
+// the handler in the details of the error response. Denial reasons are
+// always logged and counted; they are left out of responses by default as
+// they tell attackers which check failed.
+func WithDenialDetails() Option {
+	return func(h *handler) {
+		h.DenialDetails = true
+	}
+}
@@ -0,0 +1,89 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestDenialReasons(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	metrics := restflex.NewMetrics(uniqueVarName(t))
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.ErrAuth
+	}), restflex.WithMetrics(metrics), restflex.WithDenialDetails())
+	resttest.Get("/account").To(api).Expect(t).
+		Status(http.StatusUnauthorized).
+		JSONPath("$.details.denial_reason", "unauthenticated").
+		Error(restflex.ErrAuth.Errors()...)
+	logger.ExpectCount(t, "denial_reason=unauthenticated", 1)
+	if n := metrics.Denials(restflex.DenialUnauthenticated); n != 1 {
+		t.Errorf("expected 1 unauthenticated denial, but got %d", n)
+	}
+
+	nonces := restflex.NewNonces(logger, restflex.NewMemoryNonceStore(), func(token string) (time.Time, error) {
+		return time.Now().Add(time.Hour), nil
+	})
+	nonces.Metrics = metrics
+	h := nonces.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	res := resttest.Post("/invites/accept").To(h).Expect(t).
+		Status(http.StatusBadRequest).
+		Error(restflex.ErrNonceMissing.Errors()...)
+	if bytes.Contains(res.Body, []byte("details")) {
+		t.Errorf("expected no details without DenialDetails, but got %s", res.Body)
+	}
+	nonces.DenialDetails = true
+	resttest.Post("/invites/accept").To(h).Expect(t).
+		Status(http.StatusBadRequest).
+		JSONPath("$.details.denial_reason", "nonce_missing")
+	logger.ExpectCount(t, "denial_reason=nonce_missing", 2)
+	if n := metrics.Denials(restflex.DenialNonceMissing); n != 2 {
+		t.Errorf("expected 2 nonce_missing denials, but got %d", n)
+	}
+}
+
+func TestNewDeniedError(t *testing.T) {
+	t.Parallel()
+	cause := errors.New("session expired")
+	err := restflex.NewDeniedError(restflex.NewRetryAfterError(restflex.NewAPIError(http.StatusUnauthorized, cause, "login required"), 0), restflex.DenialUnauthenticated)
+	var denied restflex.DeniedError
+	if !errors.As(err, &denied) || denied.DenialReason() != restflex.DenialUnauthenticated {
+		t.Errorf("expected denial reason %q, but got %v", restflex.DenialUnauthenticated, denied)
+	}
+	var retry restflex.RetryAfterError
+	if !errors.As(err, &retry) {
+		t.Error("expected the wrapped RetryAfterError to be found")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the cause to be found")
+	}
+}
+
+func TestDenialReasons_wrapped(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	metrics := restflex.NewMetrics(uniqueVarName(t))
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.NewRetryAfterError(restflex.ErrAuth, time.Minute)
+	}), restflex.WithMetrics(metrics), restflex.WithDenialDetails())
+	resttest.Get("/account").To(api).Expect(t).
+		Status(http.StatusUnauthorized).
+		Header("Retry-After", "60").
+		JSONPath("$.details.denial_reason", "unauthenticated")
+	logger.ExpectCount(t, "denial_reason=unauthenticated", 1)
+	if n := metrics.Denials(restflex.DenialUnauthenticated); n != 1 {
+		t.Errorf("expected 1 unauthenticated denial, but got %d", n)
+	}
+}
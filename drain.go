@@ -0,0 +1,59 @@
+package restflex
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// InFlight returns the number of requests being served.
+func (s *Server) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
+// Draining reports whether the server is shutting down and waiting for
+// in-flight requests to complete.
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// trackInFlight returns next counting the requests it serves.
+func (s *Server) trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// drain shuts the server down waiting for in-flight requests until ctx is
+// done, logging the progress every DrainLogInterval and the outcome, so that
+// ShutdownTimeout can be tuned from data.
+func (s *Server) drain(ctx context.Context) error {
+	s.draining.Store(true)
+	defer s.draining.Store(false)
+	start := time.Now()
+	s.Log.Printf("restflex: draining %d requests in flight", s.InFlight())
+	done := make(chan struct{})
+	defer close(done)
+	if s.DrainLogInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(s.DrainLogInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					s.Log.Printf("restflex: draining: %d requests in flight after %v", s.InFlight(), time.Since(start).Round(time.Millisecond))
+				}
+			}
+		}()
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		s.Log.Printf("restflex: draining timed out after %v with %d requests in flight", time.Since(start).Round(time.Millisecond), s.InFlight())
+		return err
+	}
+	s.Log.Printf("restflex: drained in %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_drain(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    string
+		err     error
+	}{
+		{name: "drained", timeout: time.Second, want: "restflex: drained in"},
+		{name: "timed out", timeout: 10 * time.Millisecond, want: "draining timed out after", err: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := resttest.NewLogger()
+			started := make(chan struct{})
+			srv := restflex.NewServer(logger, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(100 * time.Millisecond)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			srv.ShutdownTimeout = tt.timeout
+			srv.DrainLogInterval = 20 * time.Millisecond
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- srv.RunListener(ctx, ln)
+			}()
+			go func() {
+				if res, err := http.Get("http://" + ln.Addr().String()); err == nil {
+					res.Body.Close()
+				}
+			}()
+			<-started
+			if n := srv.InFlight(); n != 1 {
+				t.Errorf("expected 1 request in flight, but got %d", n)
+			}
+			cancel()
+			if err := <-done; !errors.Is(err, tt.err) {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			logger.ExpectCount(t, "restflex: draining 1 requests in flight", 1)
+			logger.ExpectCount(t, tt.want, 1)
+			if srv.Draining() {
+				t.Error("expected draining to be over")
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package restflex
+
+import "net/http"
+
+// EarlyHints sends a 103 Early Hints informational response carrying the
+// given Link header values, such as `</app.js>; rel=preload; as=script`,
+// before the handler writes its final response.
+func EarlyHints(w http.ResponseWriter, links ...string) {
+	for _, link := range links {
+		w.Header().Add("Link", link)
+	}
+	w.WriteHeader(http.StatusEarlyHints)
+}
@@ -0,0 +1,46 @@
+package restflex
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EnumType is a string type declaring its allowed values:
+//
+//	type Color string
+//
+//	func (Color) EnumValues() []string { return []string{"red", "green", "blue"} }
+type EnumType interface {
+	~string
+	EnumValues() []string
+}
+
+// ValidateEnum returns a 422 Unprocessable Entity validation error listing
+// the allowed values if v is not one of them. Call it from the Validate
+// method of a request type bound with Bind. The field is named in the
+// message as written by the client, such as its JSON name.
+func ValidateEnum[E EnumType](field string, v E) error {
+	allowed := v.EnumValues()
+	if slices.Contains(allowed, string(v)) {
+		return nil
+	}
+	quoted := make([]string, len(allowed))
+	for i, a := range allowed {
+		quoted[i] = strconv.Quote(a)
+	}
+	msg := fmt.Sprintf("%s must be one of %s, got %q", field, strings.Join(quoted, ", "), string(v))
+	return NewValidationError(http.StatusUnprocessableEntity, nil, msg)
+}
+
+// EnumSchema returns the OpenAPI schema object of E listing its allowed
+// values.
+func EnumSchema[E EnumType]() map[string]any {
+	var e E
+	return map[string]any{
+		"type": "string",
+		"enum": slices.Clone(e.EnumValues()),
+	}
+}
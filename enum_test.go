@@ -0,0 +1,46 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type color string
+
+func (color) EnumValues() []string { return []string{"red", "green"} }
+
+type paintRequest struct {
+	Color color `json:"color"`
+}
+
+func (r *paintRequest) Validate() error {
+	return restflex.ValidateEnum("color", r.Color)
+}
+
+func TestValidateEnum(t *testing.T) {
+	t.Parallel()
+	h := restflex.NewHandlerWithContext(resttest.NewLogger(), restflex.Bind[paintRequest](httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})))
+	resttest.Post("/").WithJSON(paintRequest{Color: "red"}).To(h).Expect(t).Status(http.StatusNoContent)
+	resttest.Post("/").WithJSON(paintRequest{Color: "blue"}).To(h).Expect(t).
+		Status(http.StatusUnprocessableEntity).
+		Error(`color must be one of "red", "green", got "blue"`)
+}
+
+func TestEnumSchema(t *testing.T) {
+	t.Parallel()
+	want := map[string]any{"type": "string", "enum": []string{"red", "green"}}
+	if got := restflex.EnumSchema[color](); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
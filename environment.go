@@ -0,0 +1,92 @@
+package restflex
+
+import (
+	"fmt"
+	"slices"
+
+	"kkn.fi/infra"
+)
+
+// Environment names the deployment environment of a service. An empty
+// Environment is Production, so that a service configured without one does
+// not mount routes meant for development.
+type Environment string
+
+const (
+	Development Environment = "development"
+	Staging     Environment = "staging"
+	Production  Environment = "production"
+)
+
+// Valid reports whether env is empty or one of the predefined environments.
+// Unknown names such as a misspelled "prod" are rejected rather than
+// treated as an environment of their own, as they would match no Except
+// list and mount groups excluded from production.
+func (env Environment) Valid() bool {
+	switch env {
+	case "", Development, Staging, Production:
+		return true
+	}
+	return false
+}
+
+// orDefault returns env, or Production if env is empty.
+func (env Environment) orDefault() Environment {
+	if env == "" {
+		return Production
+	}
+	return env
+}
+
+// RouteGroup is a group of routes mounted together, such as debug routes or
+// an experimental API version.
+type RouteGroup struct {
+	Name string
+	// Routes registers the routes of the group.
+	Routes func(mux Router)
+	// Only lists the environments the group is mounted in. The group is
+	// mounted in all environments if it is empty.
+	Only []Environment
+	// Except lists environments the group is not mounted in.
+	Except []Environment
+}
+
+// Enabled reports whether g is mounted in env.
+func (g RouteGroup) Enabled(env Environment) bool {
+	env = env.orDefault()
+	if len(g.Only) > 0 && !slices.Contains(g.Only, env) {
+		return false
+	}
+	return !slices.Contains(g.Except, env)
+}
+
+// Mount registers the route groups enabled in env on mux and logs the
+// skipped ones, replacing environment checks scattered through main:
+//
+//	cfg.Environment.Mount(l, mux,
+//		restflex.RouteGroup{Name: "api", Routes: apiRoutes},
+//		restflex.RouteGroup{Name: "debug", Routes: debugRoutes, Except: []restflex.Environment{restflex.Production}},
+//		restflex.RouteGroup{Name: "v2", Routes: v2Routes, Only: []restflex.Environment{restflex.Staging}},
+//	)
+//
+// Mount panics if env or an environment listed by a group is not Valid.
+func (env Environment) Mount(l infra.Logger, mux Router, groups ...RouteGroup) {
+	if !env.Valid() {
+		panic(fmt.Sprintf("restflex: unknown environment %q", env))
+	}
+	for _, g := range groups {
+		for _, e := range slices.Concat(g.Only, g.Except) {
+			if e == "" || !e.Valid() {
+				panic(fmt.Sprintf("restflex: unknown environment %q in %s routes", e, g.Name))
+			}
+		}
+	}
+	env = env.orDefault()
+	for _, g := range groups {
+		if !g.Enabled(env) {
+			l.Printf("restflex: not mounting %s routes in %s", g.Name, env)
+			continue
+		}
+		g.Routes(mux)
+	}
+}
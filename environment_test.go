@@ -0,0 +1,90 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestEnvironment_Mount(t *testing.T) {
+	t.Parallel()
+	route := func(pattern string) func(restflex.Router) {
+		return func(mux restflex.Router) {
+			mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+		}
+	}
+	groups := []restflex.RouteGroup{
+		{Name: "api", Routes: route("GET /users")},
+		{Name: "debug", Routes: route("GET /debug"), Except: []restflex.Environment{restflex.Production}},
+		{Name: "v2", Routes: route("GET /v2/users"), Only: []restflex.Environment{restflex.Staging}},
+	}
+	tests := []struct {
+		env     restflex.Environment
+		mounted map[string]bool
+	}{
+		{env: restflex.Production, mounted: map[string]bool{"/users": true}},
+		{env: restflex.Staging, mounted: map[string]bool{"/users": true, "/debug": true, "/v2/users": true}},
+		{env: restflex.Development, mounted: map[string]bool{"/users": true, "/debug": true}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.env), func(t *testing.T) {
+			t.Parallel()
+			logger := resttest.NewLogger()
+			mux := http.NewServeMux()
+			tt.env.Mount(logger, mux, groups...)
+			for _, path := range []string{"/users", "/debug", "/v2/users"} {
+				status := http.StatusNotFound
+				if tt.mounted[path] {
+					status = http.StatusNoContent
+				}
+				resttest.Get(path).To(mux).Expect(t).Status(status)
+			}
+			logger.ExpectCount(t, "not mounting", 3-len(tt.mounted))
+		})
+	}
+}
+
+func TestEnvironment_Mount_default(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	restflex.Environment("").Mount(resttest.NewLogger(), mux, restflex.RouteGroup{
+		Name: "debug",
+		Routes: func(mux restflex.Router) {
+			mux.HandleFunc("GET /debug", func(w http.ResponseWriter, r *http.Request) {})
+		},
+		Except: []restflex.Environment{restflex.Production},
+	})
+	resttest.Get("/debug").To(mux).Expect(t).Status(http.StatusNotFound)
+}
+
+func TestEnvironment_Mount_unknown(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		env   restflex.Environment
+		group restflex.RouteGroup
+	}{
+		{name: "environment", env: "prod", group: restflex.RouteGroup{Name: "api"}},
+		{name: "except", env: restflex.Production, group: restflex.RouteGroup{Name: "debug", Except: []restflex.Environment{"prod"}}},
+		{name: "only", env: restflex.Staging, group: restflex.RouteGroup{Name: "v2", Only: []restflex.Environment{"stage"}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.env.Mount(resttest.NewLogger(), http.NewServeMux(), tt.group)
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package restflex
 
-import "net/http"
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
 
 var (
-	ErrAuth = NewAPIError(http.StatusUnauthorized, nil, "authorization required")
+	ErrAuth = NewDeniedError(NewAPIError(http.StatusUnauthorized, nil, "authorization required"), DenialUnauthenticated)
 
 	ErrNotFound = NewAPIError(http.StatusNotFound, nil, "item not found")
 
@@ -62,6 +68,101 @@ func (e *validationError) ValidationError() string {
 	return e.Error()
 }
 
+// RetryAfterError is implemented by errors telling the client how long to
+// wait before retrying the request. The Retry-After response header is set
+// from it.
+type RetryAfterError interface {
+	RetryAfter() time.Duration
+}
+
+type retryAfterError struct {
+	APIError
+	retryAfter time.Duration
+}
+
+// NewServiceUnavailable is called when a request can't be served
+// temporarily. The client is asked to retry after retryAfter if it is
+// positive.
+func NewServiceUnavailable(retryAfter time.Duration, messages ...string) APIError {
+	return NewRetryAfterError(NewAPIError(http.StatusServiceUnavailable, nil, messages...), retryAfter)
+}
+
+// NewRetryAfterError returns err asking the client to retry after retryAfter.
+func NewRetryAfterError(err APIError, retryAfter time.Duration) APIError {
+	return &retryAfterError{
+		APIError:   err,
+		retryAfter: retryAfter,
+	}
+}
+
+func (e *retryAfterError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// Unwrap returns the wrapped error so that its DetailedError and cause are
+// found by errors.As and errors.Is.
+func (e *retryAfterError) Unwrap() error {
+	return e.APIError
+}
+
+// setRetryAfter sets the Retry-After header if err is a RetryAfterError.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	ra, ok := errorAs[RetryAfterError](err)
+	if !ok || ra.RetryAfter() <= 0 {
+		return
+	}
+	seconds := int(math.Ceil(ra.RetryAfter().Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// DetailedError is implemented by APIErrors with structured details, which
+// are included in the details field of the error response.
+type DetailedError interface {
+	Details() map[string]any
+}
+
+type detailedError struct {
+	APIError
+	details map[string]any
+}
+
+// NewDetailedError returns err with details included in its response.
+func NewDetailedError(err APIError, details map[string]any) APIError {
+	return &detailedError{
+		APIError: err,
+		details:  details,
+	}
+}
+
+func (e *detailedError) Details() map[string]any {
+	return e.details
+}
+
+// Unwrap returns the wrapped error so that its RetryAfterError and cause
+// are found by errors.As and errors.Is.
+func (e *detailedError) Unwrap() error {
+	return e.APIError
+}
+
+// NewGone is called when resource existed but was deleted at deletedAt. The
+// 410 Gone response tells the resource and the deletion time in its
+// details, distinguishing a deleted resource from one that never existed.
+func NewGone(resource string, deletedAt time.Time) APIError {
+	return NewDetailedError(NewAPIError(http.StatusGone, nil, resource+" has been deleted"), map[string]any{
+		"resource":   resource,
+		"deleted_at": deletedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// NotFoundOrGone returns ErrNotFound for a resource which never existed,
+// shown by a zero deletedAt, and NewGone for a soft deleted one.
+func NotFoundOrGone(resource string, deletedAt time.Time) APIError {
+	if deletedAt.IsZero() {
+		return ErrNotFound
+	}
+	return NewGone(resource, deletedAt)
+}
+
 func NewBadRequest(messages ...string) APIError {
 	return NewAPIError(http.StatusBadRequest, nil, messages...)
 }
@@ -94,3 +195,27 @@ func (e *apiError) Is(target error) bool {
 	}
 	return false
 }
+
+// errorAs is errors.As returning the target. Errors which are not wrapping
+// others, such as the stock APIErrors without a cause, are checked with a
+// type assertion only, as the target passed to errors.As escapes to the
+// heap and stock errors are returned on hot paths.
+func errorAs[T any](err error) (T, bool) {
+	if t, ok := err.(T); ok {
+		return t, true
+	}
+	if u, ok := err.(interface{ Unwrap() error }); ok && u.Unwrap() == nil {
+		if _, ok := err.(interface{ As(any) bool }); !ok {
+			var zero T
+			return zero, false
+		}
+	}
+	switch err.(type) {
+	case interface{ Unwrap() error }, interface{ Unwrap() []error }, interface{ As(any) bool }:
+		target := new(T)
+		ok := errors.As(err, target)
+		return *target, ok
+	}
+	var zero T
+	return zero, false
+}
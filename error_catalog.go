@@ -0,0 +1,185 @@
+package restflex
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// ErrorDoc documents an API error of the catalog.
+type ErrorDoc struct {
+	Name     string   `json:"name"`
+	Status   int      `json:"status"`
+	Messages []string `json:"messages"`
+	// Routes are the route patterns declaring the error.
+	Routes []string `json:"routes,omitempty"`
+	// Translations are the messages translated to locales by
+	// TranslateErrors, keyed by locale. Untranslated messages are kept.
+	Translations map[string][]string `json:"translations,omitempty"`
+}
+
+// errorRegistry holds the registered errors and the errors declared by
+// routes.
+var errorRegistry = struct {
+	mu     sync.Mutex
+	names  map[APIError]string
+	routes map[string][]APIError
+	// translations maps locales to messages to their translations.
+	translations map[string]map[string]string
+}{
+	names: map[APIError]string{
+		ErrAuth:               "auth",
+		ErrNotFound:           "not_found",
+		ErrInvalidRequestBody: "invalid_request_body",
+		ErrBadRequest:         "bad_request",
+		ErrInternal:           "internal",
+	},
+	routes:       make(map[string][]APIError),
+	translations: make(map[string]map[string]string),
+}
+
+// RegisterError adds err to the error catalog under name and returns it, so
+// that errors can be registered where they are declared:
+//
+//	var ErrUserExists = restflex.RegisterError("user_exists",
+//		restflex.NewAPIError(http.StatusConflict, nil, "user exists"))
+func RegisterError(name string, err APIError) APIError {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	errorRegistry.names[err] = name
+	return err
+}
+
+// DeclareErrors declares the errors a route, such as "GET /users/{id}", may
+// respond with. Undeclared errors are registered under their messages.
+func DeclareErrors(route string, errs ...APIError) {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	for _, err := range errs {
+		if _, ok := errorRegistry.names[err]; !ok {
+			errorRegistry.names[err] = err.Error()
+		}
+		if !slices.Contains(errorRegistry.routes[route], err) {
+			errorRegistry.routes[route] = append(errorRegistry.routes[route], err)
+		}
+	}
+}
+
+// TranslateErrors adds translations of error messages, such as those of the
+// registered errors and status texts, to locale. Handlers respond to
+// requests whose Locale has translations with the translated messages;
+// see Languages.
+//
+//	restflex.TranslateErrors("fi", map[string]string{
+//		"user exists": "käyttäjä on jo olemassa",
+//	})
+func TranslateErrors(locale string, translations map[string]string) {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	t, ok := errorRegistry.translations[locale]
+	if !ok {
+		t = make(map[string]string, len(translations))
+		errorRegistry.translations[locale] = t
+	}
+	for message, translation := range translations {
+		t[message] = translation
+	}
+}
+
+// localizeMessages returns messages translated to the locale of ctx, or
+// to its primary language, such as "fi" for "fi-FI". Messages without a
+// translation are returned as they are.
+func localizeMessages(ctx context.Context, messages []string) []string {
+	locale := Locale(ctx)
+	if locale == "" {
+		return messages
+	}
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	t, ok := errorRegistry.translations[locale]
+	if !ok {
+		t, ok = errorRegistry.translations[primaryLanguage(locale)]
+	}
+	if !ok {
+		return messages
+	}
+	return translateMessages(t, messages)
+}
+
+func translateMessages(translations map[string]string, messages []string) []string {
+	translated := make([]string, len(messages))
+	for i, m := range messages {
+		translated[i] = cmp.Or(translations[m], m)
+	}
+	return translated
+}
+
+// ErrorCatalog returns the registered errors, the routes declaring them and
+// their translations ordered by status and name, for generating error documentation which
+// can't drift from the code.
+func ErrorCatalog() []ErrorDoc {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	docs := make([]ErrorDoc, 0, len(errorRegistry.names))
+	index := make(map[APIError]int, len(errorRegistry.names))
+	for err, name := range errorRegistry.names {
+		index[err] = len(docs)
+		docs = append(docs, ErrorDoc{
+			Name:     name,
+			Status:   err.StatusCode(),
+			Messages: err.Errors(),
+		})
+	}
+	for route, errs := range errorRegistry.routes {
+		for _, err := range errs {
+			doc := &docs[index[err]]
+			doc.Routes = append(doc.Routes, route)
+		}
+	}
+	for i := range docs {
+		slices.Sort(docs[i].Routes)
+		for locale, t := range errorRegistry.translations {
+			messages := translateMessages(t, docs[i].Messages)
+			if slices.Equal(messages, docs[i].Messages) {
+				continue
+			}
+			if docs[i].Translations == nil {
+				docs[i].Translations = make(map[string][]string)
+			}
+			docs[i].Translations[locale] = messages
+		}
+	}
+	slices.SortFunc(docs, func(a, b ErrorDoc) int {
+		return cmp.Or(cmp.Compare(a.Status, b.Status), cmp.Compare(a.Name, b.Name))
+	})
+	return docs
+}
+
+// OpenAPIErrorResponses returns the OpenAPI responses object of the errors
+// declared by route, keyed by status code, referring to the ErrorMessage
+// schema at #/components/schemas/ErrorMessage.
+func OpenAPIErrorResponses(route string) map[string]any {
+	responses := make(map[string]any)
+	for _, doc := range ErrorCatalog() {
+		if !slices.Contains(doc.Routes, route) {
+			continue
+		}
+		code := strconv.Itoa(doc.Status)
+		if r, ok := responses[code].(map[string]any); ok {
+			r["description"] = r["description"].(string) + "; " + doc.Name
+			continue
+		}
+		responses[code] = map[string]any{
+			"description": http.StatusText(doc.Status) + ": " + doc.Name,
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{"$ref": "#/components/schemas/ErrorMessage"},
+				},
+			},
+		}
+	}
+	return responses
+}
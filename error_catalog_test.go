@@ -0,0 +1,70 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+var errUserExists = restflex.RegisterError("user_exists", restflex.NewAPIError(http.StatusConflict, nil, "user exists"))
+
+func TestErrorCatalog(t *testing.T) {
+	t.Parallel()
+	restflex.DeclareErrors("POST /catalog/users", errUserExists, restflex.ErrInvalidRequestBody, restflex.ErrBadRequest)
+
+	catalog := restflex.ErrorCatalog()
+	if !slices.IsSortedFunc(catalog, func(a, b restflex.ErrorDoc) int { return a.Status - b.Status }) {
+		t.Errorf("expected catalog to be sorted by status, got %+v", catalog)
+	}
+	i := slices.IndexFunc(catalog, func(d restflex.ErrorDoc) bool { return d.Name == "user_exists" })
+	if i < 0 {
+		t.Fatalf("expected registered error in catalog, got %+v", catalog)
+	}
+	if doc := catalog[i]; doc.Status != http.StatusConflict || !slices.Contains(doc.Routes, "POST /catalog/users") {
+		t.Errorf("unexpected error doc %+v", doc)
+	}
+
+	responses := restflex.OpenAPIErrorResponses("POST /catalog/users")
+	if len(responses) != 2 {
+		t.Fatalf("expected responses for 400 and 409, got %v", responses)
+	}
+	res, ok := responses["400"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected a 400 response, got %v", responses)
+	}
+	if want := "Bad Request: bad_request; invalid_request_body"; res["description"] != want {
+		t.Errorf("expected description %q, got %q", want, res["description"])
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	t.Parallel()
+	restflex.TranslateErrors("fi", map[string]string{"user exists": "käyttäjä on jo olemassa"})
+	api := restflex.Languages("en", "fi-FI")(restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return errUserExists
+	})))
+
+	resttest.Get("/users").WithHeader("Accept-Language", "fi").To(api).Expect(t).
+		Status(http.StatusConflict).
+		Header("Content-Language", "fi-FI").
+		Error("käyttäjä on jo olemassa")
+	resttest.Get("/users").WithHeader("Accept-Language", "en").To(api).Expect(t).
+		Status(http.StatusConflict).
+		Error("user exists")
+
+	catalog := restflex.ErrorCatalog()
+	i := slices.IndexFunc(catalog, func(d restflex.ErrorDoc) bool { return d.Name == "user_exists" })
+	if i < 0 {
+		t.Fatalf("expected registered error in catalog, got %+v", catalog)
+	}
+	if got := catalog[i].Translations["fi"]; !slices.Equal(got, []string{"käyttäjä on jo olemassa"}) {
+		t.Errorf("expected the translation in the catalog, got %v", catalog[i].Translations)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build !integration
+
+package restflex
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPrecomputedErrors(t *testing.T) {
+	t.Parallel()
+	for message, e := range precomputedErrors {
+		got := e.body
+		var want bytes.Buffer
+		if err := json.NewEncoder(&want).Encode(NewErrorMessage(message)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("expected %q to be encoded as %s, got %s", message, want.Bytes(), got)
+		}
+	}
+	if _, ok := precomputedErrors[ErrNotFound.Error()]; !ok {
+		t.Error("expected ErrNotFound to be precomputed")
+	}
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func TestWriteError_precomputed_does_not_allocate(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+	w := &discardResponseWriter{header: make(http.Header)}
+	allocs := testing.AllocsPerRun(100, func() {
+		writeError(l, w, http.StatusNotFound, ErrNotFound.Errors()...)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+	rec := httptest.NewRecorder()
+	writeError(log.New(io.Discard, "", 0), rec, http.StatusBadRequest, "a", "b")
+	res := rec.Result()
+	if ct := res.Header.Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if body := rec.Body.String(); body != "{\"errors\":[\"a\",\"b\"]}\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+	if cl := res.Header.Get("Content-Length"); cl != "21" {
+		t.Errorf("expected Content-Length %q, got %q", "21", cl)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	tests := []struct {
+		name              string
+		size              int
+		wantContentLength bool
+	}{
+		{
+			name:              "small response has content length",
+			size:              10,
+			wantContentLength: true,
+		},
+		{
+			name: "large response is streamed",
+			size: maxBufferedResponse,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := httptest.NewRecorder()
+			v := map[string]string{"data": strings.Repeat("x", tt.size)}
+			if err := WriteJSON(rec, http.StatusCreated, v); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res := rec.Result()
+			if res.StatusCode != http.StatusCreated {
+				t.Errorf("expected status code %d, but got %d", http.StatusCreated, res.StatusCode)
+			}
+			cl := res.Header.Get("Content-Length")
+			if (cl != "") != tt.wantContentLength {
+				t.Errorf("expected Content-Length %v, got %q", tt.wantContentLength, cl)
+			}
+			if cl != "" && cl != strconv.Itoa(rec.Body.Len()) {
+				t.Errorf("expected Content-Length %d, got %q", rec.Body.Len(), cl)
+			}
+			var got map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got["data"] != v["data"] {
+				t.Errorf("unexpected body: %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkWriteError(b *testing.B) {
+	l := log.New(io.Discard, "", 0)
+	w := &discardResponseWriter{header: make(http.Header)}
+	b.Run("precomputed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			writeError(l, w, http.StatusNotFound, ErrNotFound.Errors()...)
+		}
+	})
+	b.Run("encoded", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			writeError(l, w, http.StatusNotFound, "user 42 not found")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package restflex
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ExperimentHeader is the response header listing the experiment variants
+// assigned to a request, such as "checkout=b, search=control".
+const ExperimentHeader = "X-Experiments"
+
+// Experiment is a product experiment with variants, such as the control
+// and a new checkout flow.
+type Experiment struct {
+	Name     string
+	Variants []string
+	// Weights are the relative weights of the variants. Variants are
+	// weighted equally if it is empty.
+	Weights []float64
+}
+
+// pick returns the variant at the percentile p in [0, 100).
+func (e Experiment) pick(p float64) string {
+	if len(e.Variants) == 0 {
+		return ""
+	}
+	if len(e.Weights) != len(e.Variants) {
+		return e.Variants[int(p*float64(len(e.Variants))/100)]
+	}
+	var total float64
+	for _, w := range e.Weights {
+		total += w
+	}
+	target := p / 100 * total
+	for i, w := range e.Weights {
+		if target < w {
+			return e.Variants[i]
+		}
+		target -= w
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// Assigner assigns the variant of an experiment to a request. An empty
+// variant leaves the request out of the experiment.
+type Assigner interface {
+	Assign(r *http.Request, e Experiment) string
+}
+
+// AssignerFunc is an Assigner function.
+type AssignerFunc func(r *http.Request, e Experiment) string
+
+func (f AssignerFunc) Assign(r *http.Request, e Experiment) string {
+	return f(r, e)
+}
+
+// HashAssigner returns an Assigner assigning variants by a hash of the key
+// returned by key, such as the principal, so that the assignment is sticky.
+// Requests without a key are assigned at random.
+func HashAssigner(key func(r *http.Request) string) Assigner {
+	return AssignerFunc(func(r *http.Request, e Experiment) string {
+		if k := key(r); k != "" {
+			return e.pick(canaryBucket(e.Name, k))
+		}
+		return e.pick(rand.Float64() * 100)
+	})
+}
+
+type variantsContextKey struct{}
+
+// Experiments is a middleware assigning the variants of experiments to
+// requests. The variants are available to handlers with Variant, listed in
+// the X-Experiments response header and included in the log lines of the
+// request.
+type Experiments struct {
+	Experiments []Experiment
+	// Assigner defaults to HashAssigner of the principal.
+	Assigner Assigner
+}
+
+func NewExperiments(assigner Assigner, experiments ...Experiment) *Experiments {
+	return &Experiments{
+		Experiments: experiments,
+		Assigner:    assigner,
+	}
+}
+
+func (x *Experiments) Wrap(next http.Handler) http.Handler {
+	assigner := x.Assigner
+	if assigner == nil {
+		assigner = HashAssigner(func(r *http.Request) string {
+			return Principal(r.Context())
+		})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variants := make(map[string]string, len(x.Experiments))
+		for _, e := range x.Experiments {
+			if v := assigner.Assign(r, e); v != "" {
+				variants[e.Name] = v
+			}
+		}
+		if len(variants) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if parent, ok := r.Context().Value(variantsContextKey{}).(map[string]string); ok {
+			for name, v := range parent {
+				if _, ok := variants[name]; !ok {
+					variants[name] = v
+				}
+			}
+		}
+		w.Header().Set(ExperimentHeader, formatVariants(variants, "=", ", "))
+		ctx := context.WithValue(r.Context(), variantsContextKey{}, variants)
+		if info, ok := ctx.Value(requestInfoContextKey{}).(*requestInfo); ok {
+			info.mu.Lock()
+			info.experiments = formatVariants(variants, ":", ",")
+			info.formatted = ""
+			info.mu.Unlock()
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Variant returns the variant of experiment assigned to the request, or an
+// empty string if the request is not in the experiment.
+func Variant(ctx context.Context, experiment string) string {
+	variants, _ := ctx.Value(variantsContextKey{}).(map[string]string)
+	return variants[experiment]
+}
+
+// formatVariants returns the variants ordered by experiment name.
+func formatVariants(variants map[string]string, assign, sep string) string {
+	pairs := make([]string, 0, len(variants))
+	for name, v := range variants {
+		pairs = append(pairs, name+assign+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, sep)
+}
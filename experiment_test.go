@@ -0,0 +1,64 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestExperiments(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	assigner := restflex.HashAssigner(func(r *http.Request) string {
+		return r.URL.Query().Get("user")
+	})
+	x := restflex.NewExperiments(assigner,
+		restflex.Experiment{Name: "checkout", Variants: []string{"control", "one-click"}},
+		restflex.Experiment{Name: "search", Variants: []string{"control", "semantic"}, Weights: []float64{1, 0}},
+		restflex.Experiment{Name: "empty"},
+	)
+	api := x.Wrap(restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		restflex.Logger(ctx).Printf("checkout")
+		_, err := w.Write([]byte(restflex.Variant(ctx, "checkout")))
+		return err
+	})))
+
+	seen := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		user := strconv.Itoa(i)
+		res := resttest.Get("/").WithQuery("user", user).To(api).Expect(t).Status(http.StatusOK)
+		variant := string(res.Body)
+		seen[variant]++
+		res.Header(restflex.ExperimentHeader, "checkout="+variant+", search=control")
+		again := resttest.Get("/").WithQuery("user", user).To(api).Expect(t)
+		if string(again.Body) != variant {
+			t.Fatalf("user %s assigned to %s and %s", user, variant, again.Body)
+		}
+	}
+	if seen["control"] < 30 || seen["one-click"] < 30 {
+		t.Errorf("expected variants to be assigned evenly, got %v", seen)
+	}
+	logger.ExpectCount(t, "experiments=checkout:one-click,search:control", 2*seen["one-click"])
+}
+
+func TestExperiments_notEnrolled(t *testing.T) {
+	t.Parallel()
+	x := restflex.NewExperiments(restflex.AssignerFunc(func(r *http.Request, e restflex.Experiment) string {
+		return ""
+	}), restflex.Experiment{Name: "checkout", Variants: []string{"control", "b"}})
+	res := resttest.Get("/").To(x.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := restflex.Variant(r.Context(), "checkout"); v != "" {
+			t.Errorf("expected no variant, got %q", v)
+		}
+	}))).Expect(t).Status(http.StatusOK)
+	if h := res.Response.Header.Get(restflex.ExperimentHeader); h != "" {
+		t.Errorf("expected no experiment header, got %q", h)
+	}
+}
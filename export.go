@@ -0,0 +1,196 @@
+package restflex
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"kkn.fi/infra"
+)
+
+// ExportFormat is the archive format of a data export.
+type ExportFormat int
+
+const (
+	// ExportNDJSON writes the records of all sources as newline delimited
+	// JSON objects with the source name and the record.
+	ExportNDJSON ExportFormat = iota
+	// ExportZip writes a zip archive with a newline delimited JSON file per
+	// source.
+	ExportZip
+)
+
+// ExportSource is a source of the data of an export, such as the orders or
+// the messages of a user.
+type ExportSource struct {
+	Name string
+	// Records calls emit with each record of the source. Emit blocks while
+	// the archive is written to a slow client and returns an error when the
+	// export is cancelled or the write fails, which Records should return.
+	Records func(ctx context.Context, emit func(record any) error) error
+}
+
+// ExportProgress is the progress of an export.
+type ExportProgress struct {
+	Source    string `json:"source,omitempty"`
+	Completed int    `json:"completed_sources"`
+	Sources   int    `json:"sources"`
+	Records   int64  `json:"records"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Export assembles a data access export, such as the "export all my data"
+// response of a data subject access request, from multiple sources and
+// streams it either directly to the client with Serve or, for long running
+// exports, as an async job to storage with Stream.
+type Export struct {
+	Sources []ExportSource
+	Format  ExportFormat
+	// Progress, if set, is called after each source and when the export is
+	// done or fails. See PublishExportProgress to stream progress as
+	// server-sent events.
+	Progress func(ExportProgress)
+	Log      infra.Logger
+}
+
+func NewExport(l infra.Logger, format ExportFormat, sources ...ExportSource) *Export {
+	return &Export{
+		Sources: sources,
+		Format:  format,
+		Log:     l,
+	}
+}
+
+// ContentType returns the media type of the archive.
+func (e *Export) ContentType() string {
+	if e.Format == ExportZip {
+		return "application/zip"
+	}
+	return "application/x-ndjson"
+}
+
+// Serve streams the archive to w as an attachment named filename. Errors
+// before the archive is started are returned for the handler to return.
+// Once streaming has started, the response can not be changed to an error,
+// so a failure is logged and the connection aborted, so that the client
+// does not mistake a truncated archive for a complete one. A client
+// disconnecting ends the response quietly.
+func (e *Export) Serve(w http.ResponseWriter, r *http.Request, filename string) error {
+	if err := r.Context().Err(); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", e.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := e.Stream(r.Context(), &flushWriter{w: w, rc: http.NewResponseController(w)}); err != nil {
+		if r.Context().Err() != nil {
+			return nil
+		}
+		e.Log.Printf("error: restflex: export %s: %v", filename, err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// Stream writes the archive to w. It stops with the error of ctx when ctx
+// is done.
+func (e *Export) Stream(ctx context.Context, w io.Writer) (err error) {
+	p := ExportProgress{Sources: len(e.Sources)}
+	defer func() {
+		p.Source = ""
+		p.Done = err == nil
+		if err != nil {
+			p.Error = err.Error()
+		}
+		e.progress(p)
+	}()
+	var zw *zip.Writer
+	if e.Format == ExportZip {
+		zw = zip.NewWriter(w)
+	}
+	bw := bufio.NewWriter(w)
+	for _, src := range e.Sources {
+		p.Source = src.Name
+		out := io.Writer(bw)
+		if zw != nil {
+			if out, err = zw.Create(src.Name + ".ndjson"); err != nil {
+				return err
+			}
+		}
+		enc := json.NewEncoder(out)
+		err = src.Records(ctx, func(record any) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p.Records++
+			if zw != nil {
+				return enc.Encode(record)
+			}
+			return enc.Encode(exportRecord{Source: src.Name, Record: record})
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("source %s: %w", src.Name, err)
+		}
+		if zw == nil {
+			if err = bw.Flush(); err != nil {
+				return err
+			}
+		}
+		p.Completed++
+		e.progress(p)
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
+
+func (e *Export) progress(p ExportProgress) {
+	if e.Progress != nil {
+		e.Progress(p)
+	}
+}
+
+// exportRecord is a record of an NDJSON export.
+type exportRecord struct {
+	Source string `json:"source"`
+	Record any    `json:"record"`
+}
+
+// PublishExportProgress returns an Export.Progress function publishing the
+// progress as "progress" events to topic of b, for clients following an
+// export job with EventStream.
+func PublishExportProgress(b *Broker, topic string) func(ExportProgress) {
+	return func(p ExportProgress) {
+		b.Publish(topic, Event{Type: "progress", Payload: p})
+	}
+}
+
+// flushWriter flushes every write to the client, so that the archive is
+// streamed at the pace the client reads it.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := f.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
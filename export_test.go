@@ -0,0 +1,159 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func exportSources() []restflex.ExportSource {
+	records := func(rs ...any) func(context.Context, func(any) error) error {
+		return func(ctx context.Context, emit func(any) error) error {
+			for _, r := range rs {
+				if err := emit(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return []restflex.ExportSource{
+		{Name: "profile", Records: records(map[string]string{"name": "Ann"})},
+		{Name: "orders", Records: records(map[string]int{"id": 1}, map[string]int{"id": 2})},
+	}
+}
+
+func TestExport_Serve(t *testing.T) {
+	t.Parallel()
+	var progress []restflex.ExportProgress
+	export := restflex.NewExport(resttest.NewLogger(), restflex.ExportNDJSON, exportSources()...)
+	export.Progress = func(p restflex.ExportProgress) {
+		progress = append(progress, p)
+	}
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return export.Serve(w, r, "export.ndjson")
+	}))
+
+	res := resttest.Get("/me/export").To(api).Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/x-ndjson").
+		Header("Content-Disposition", "attachment; filename=export.ndjson")
+	want := `{"source":"profile","record":{"name":"Ann"}}
+{"source":"orders","record":{"id":1}}
+{"source":"orders","record":{"id":2}}
+`
+	if string(res.Body) != want {
+		t.Errorf("body = %s, want %s", res.Body, want)
+	}
+	if len(progress) != 3 || progress[1].Completed != 2 || !progress[2].Done || progress[2].Records != 3 {
+		t.Errorf("progress = %+v", progress)
+	}
+}
+
+func TestExport_Stream_zip(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	export := restflex.NewExport(resttest.NewLogger(), restflex.ExportZip, exportSources()...)
+	if err := export.Stream(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	if files["profile.ndjson"] != "{\"name\":\"Ann\"}\n" || files["orders.ndjson"] != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Errorf("files = %q", files)
+	}
+}
+
+func TestExport_Stream_cancel(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	var last restflex.ExportProgress
+	export := restflex.NewExport(resttest.NewLogger(), restflex.ExportNDJSON, restflex.ExportSource{
+		Name: "events",
+		Records: func(ctx context.Context, emit func(any) error) error {
+			for i := 0; ; i++ {
+				if i == 10 {
+					cancel()
+				}
+				if err := emit(i); err != nil {
+					return err
+				}
+			}
+		},
+	})
+	export.Progress = func(p restflex.ExportProgress) {
+		last = p
+	}
+	err := export.Stream(ctx, io.Discard)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream() = %v, want %v", err, context.Canceled)
+	}
+	if last.Done || last.Error == "" || last.Records != 10 {
+		t.Errorf("progress = %+v", last)
+	}
+}
+
+func TestPublishExportProgress(t *testing.T) {
+	t.Parallel()
+	b := restflex.NewBroker(1)
+	sub := b.Subscribe("export-1")
+	defer sub.Close()
+	restflex.PublishExportProgress(b, "export-1")(restflex.ExportProgress{Done: true})
+	e := <-sub.Events()
+	if p, ok := e.Payload.(restflex.ExportProgress); e.Type != "progress" || !ok || !p.Done {
+		t.Errorf("event = %+v", e)
+	}
+}
+
+func TestExport_Serve_disconnect(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var alerts int
+	alerter := restflex.NewAlerter(func(restflex.Alert) {
+		alerts++
+	})
+	logger := resttest.NewLogger()
+	export := restflex.NewExport(logger, restflex.ExportNDJSON, restflex.ExportSource{
+		Name: "orders",
+		Records: func(ctx context.Context, emit func(any) error) error {
+			if err := emit(1); err != nil {
+				return err
+			}
+			cancel()
+			return emit(2)
+		},
+	})
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return export.Serve(w, r, "export.ndjson")
+	}), restflex.WithAlerter(alerter))
+
+	api.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/me/export", nil).WithContext(ctx))
+	if alerts != 0 {
+		t.Errorf("expected no alerts for a disconnected client, got %d", alerts)
+	}
+	logger.ExpectNone(t, "error: restflex: export")
+}
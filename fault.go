@@ -0,0 +1,86 @@
+package restflex
+
+import (
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// FaultInjector is a middleware injecting latency, error responses and
+// connection resets into a percentage of requests for testing client
+// resilience. It does nothing unless Enabled is set.
+type FaultInjector struct {
+	// Enabled turns fault injection on.
+	Enabled bool
+	// Latency is added to LatencyPercent of requests.
+	Latency        time.Duration
+	LatencyPercent float64
+	// ErrorStatus is responded to ErrorPercent of requests instead of
+	// calling the handler. Defaults to 503.
+	ErrorStatus  int
+	ErrorPercent float64
+	// ResetPercent of requests have their connection reset without a response.
+	ResetPercent float64
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewFaultInjector(l infra.Logger) *FaultInjector {
+	return &FaultInjector{
+		ErrorStatus: http.StatusServiceUnavailable,
+		Log:         l,
+	}
+}
+
+// Wrap returns a handler injecting faults before calling next.
+func (f *FaultInjector) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if chance(f.ResetPercent) {
+			f.Log.Printf("restflex: fault injection: resetting connection of %v %v", r.Method, r.URL.Path)
+			resetConnection(w)
+			return
+		}
+		if chance(f.LatencyPercent) {
+			select {
+			case <-time.After(f.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if chance(f.ErrorPercent) {
+			status := f.ErrorStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			f.Log.Printf("restflex: fault injection: responding %v to %v %v", status, r.Method, r.URL.Path)
+			writeError(f.Log, w, status, http.StatusText(status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chance reports true for percent out of 100 calls on average.
+func chance(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+// resetConnection closes the client connection abruptly. TCP connections are
+// reset; otherwise the handler is aborted.
+func resetConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	conn.Close()
+}
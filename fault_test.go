@@ -0,0 +1,77 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestFaultInjector(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name       string
+		configure  func(f *restflex.FaultInjector)
+		wantStatus int
+	}{
+		{
+			name: "disabled injector passes requests through",
+			configure: func(f *restflex.FaultInjector) {
+				f.ErrorPercent = 100
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "errors are injected",
+			configure: func(f *restflex.FaultInjector) {
+				f.Enabled = true
+				f.ErrorPercent = 100
+				f.ErrorStatus = http.StatusInternalServerError
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "latency is injected",
+			configure: func(f *restflex.FaultInjector) {
+				f.Enabled = true
+				f.Latency = time.Millisecond
+				f.LatencyPercent = 100
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			f := restflex.NewFaultInjector(resttest.NewLogger())
+			tt.configure(f)
+			rec := httptest.NewRecorder()
+			f.Wrap(ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status code %d, but got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestFaultInjector_connection_reset(t *testing.T) {
+	t.Parallel()
+	f := restflex.NewFaultInjector(resttest.NewLogger())
+	f.Enabled = true
+	f.ResetPercent = 100
+	srv := httptest.NewServer(f.Wrap(http.NotFoundHandler()))
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("expected connection to be reset")
+	}
+}
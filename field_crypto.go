@@ -0,0 +1,260 @@
+package restflex
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// KMS is a key management service holding master keys which encrypt the
+// data keys of envelope encryption.
+type KMS interface {
+	// GenerateDataKey returns a new 256-bit data key both in plaintext and
+	// encrypted with the master key keyID.
+	GenerateDataKey(ctx context.Context, keyID string) (plaintext, encrypted []byte, err error)
+	// Decrypt returns the plaintext of a data key encrypted with the master
+	// key keyID. The error wraps ErrUnknownKey or ErrInvalidCiphertext if
+	// the data key can't be decrypted, as opposed to the KMS failing.
+	Decrypt(ctx context.Context, keyID string, encrypted []byte) ([]byte, error)
+}
+
+var (
+	// ErrUnknownKey is returned by KMS for master keys it does not hold.
+	ErrUnknownKey = errors.New("restflex: unknown master key")
+	// ErrInvalidCiphertext is returned by KMS for data keys which are
+	// malformed or fail authentication.
+	ErrInvalidCiphertext = errors.New("restflex: invalid ciphertext")
+)
+
+// encryptedFieldPrefix starts the values of encrypted fields.
+const encryptedFieldPrefix = "enc:"
+
+// FieldEncryption encrypts and decrypts the string fields of request and
+// response types tagged with `encrypt:"true"`, for regulated data passing
+// through intermediaries which should not see it. Fields are encrypted with
+// AES-GCM under a data key generated by KMS per Encrypt call, and replaced
+// with "enc:" followed by a base64 envelope carrying the encrypted data key.
+type FieldEncryption struct {
+	KMS KMS
+	// KeyID is the master key data keys are generated under.
+	KeyID string
+	// PreviousKeyIDs are the master keys accepted besides KeyID when
+	// decrypting, e.g. while rotating keys. Fields under other keys are
+	// rejected without calling KMS.
+	PreviousKeyIDs []string
+}
+
+func NewFieldEncryption(kms KMS, keyID string) *FieldEncryption {
+	return &FieldEncryption{
+		KMS:   kms,
+		KeyID: keyID,
+	}
+}
+
+// fieldEnvelope is the encrypted value of a field.
+type fieldEnvelope struct {
+	KeyID      string `json:"k"`
+	DataKey    []byte `json:"d"`
+	Ciphertext []byte `json:"c"`
+}
+
+// Encrypt encrypts the tagged fields of the struct v points to in place,
+// for example before v is passed to WriteJSON.
+func (e *FieldEncryption) Encrypt(ctx context.Context, v any) error {
+	var aead cipher.AEAD
+	var encryptedKey []byte
+	return walkEncryptedFields(reflect.ValueOf(v), "", func(field reflect.Value, path string) error {
+		if field.String() == "" {
+			return nil
+		}
+		if aead == nil {
+			plaintext, encrypted, err := e.KMS.GenerateDataKey(ctx, e.KeyID)
+			if err != nil {
+				return err
+			}
+			if aead, err = newGCM(plaintext); err != nil {
+				return err
+			}
+			encryptedKey = encrypted
+		}
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(field.String())+aead.Overhead())
+		_, _ = rand.Read(nonce)
+		b, err := json.Marshal(fieldEnvelope{
+			KeyID:      e.KeyID,
+			DataKey:    encryptedKey,
+			Ciphertext: aead.Seal(nonce, nonce, []byte(field.String()), []byte(path)),
+		})
+		if err != nil {
+			return err
+		}
+		field.SetString(encryptedFieldPrefix + base64.RawURLEncoding.EncodeToString(b))
+		return nil
+	})
+}
+
+// Decrypt decrypts the tagged fields of the struct v points to in place,
+// for example after a request body has been decoded. A malformed or tampered
+// field is returned as a 400 Bad Request APIError. Other errors of KMS, such
+// as outages, are returned as is.
+func (e *FieldEncryption) Decrypt(ctx context.Context, v any) error {
+	keys := make(map[string]cipher.AEAD)
+	return walkEncryptedFields(reflect.ValueOf(v), "", func(field reflect.Value, path string) error {
+		encoded, ok := strings.CutPrefix(field.String(), encryptedFieldPrefix)
+		if !ok {
+			if field.String() == "" {
+				return nil
+			}
+			return NewAPIError(http.StatusBadRequest, nil, fmt.Sprintf("field %s is not encrypted", path))
+		}
+		var env fieldEnvelope
+		b, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err == nil {
+			err = json.Unmarshal(b, &env)
+		}
+		if err != nil {
+			return NewAPIError(http.StatusBadRequest, err, fmt.Sprintf("malformed encrypted field %s", path))
+		}
+		if env.KeyID != e.KeyID && !slices.Contains(e.PreviousKeyIDs, env.KeyID) {
+			return NewAPIError(http.StatusBadRequest, nil, fmt.Sprintf("invalid encrypted field %s", path))
+		}
+		cacheKey := env.KeyID + "\x00" + string(env.DataKey)
+		aead, ok := keys[cacheKey]
+		if !ok {
+			plaintext, err := e.KMS.Decrypt(ctx, env.KeyID, env.DataKey)
+			if err != nil && !errors.Is(err, ErrUnknownKey) && !errors.Is(err, ErrInvalidCiphertext) {
+				return err
+			}
+			if err == nil {
+				aead, err = newGCM(plaintext)
+			}
+			if err != nil {
+				return NewAPIError(http.StatusBadRequest, err, fmt.Sprintf("invalid encrypted field %s", path))
+			}
+			keys[cacheKey] = aead
+		}
+		if len(env.Ciphertext) < aead.NonceSize() {
+			return NewAPIError(http.StatusBadRequest, nil, fmt.Sprintf("malformed encrypted field %s", path))
+		}
+		nonce, sealed := env.Ciphertext[:aead.NonceSize()], env.Ciphertext[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, sealed, []byte(path))
+		if err != nil {
+			return NewAPIError(http.StatusBadRequest, err, fmt.Sprintf("invalid encrypted field %s", path))
+		}
+		field.SetString(string(plaintext))
+		return nil
+	})
+}
+
+// walkEncryptedFields calls fn for the settable string fields tagged with
+// encrypt in v with their paths.
+func walkEncryptedFields(v reflect.Value, path string, fn func(field reflect.Value, path string) error) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return walkEncryptedFields(v.Elem(), path, fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkEncryptedFields(v.Index(i), path+"["+strconv.Itoa(i)+"]", fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := jsonFieldName(f)
+			if path != "" {
+				name = path + "." + name
+			}
+			field := v.Field(i)
+			if f.Tag.Get("encrypt") == "true" {
+				for field.Kind() == reflect.Pointer && !field.IsNil() {
+					field = field.Elem()
+				}
+				if field.Kind() == reflect.Pointer {
+					// nil pointers have nothing to encrypt
+					continue
+				}
+				if field.Kind() != reflect.String || !field.CanSet() {
+					return fmt.Errorf("restflex: encrypted field %s is not a settable string", name)
+				}
+				if err := fn(field, name); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walkEncryptedFields(field, name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LocalKMS is a KMS holding master keys in memory, for development and
+// tests.
+type LocalKMS struct {
+	keys map[string]cipher.AEAD
+}
+
+// NewLocalKMS returns a KMS with the AES master keys by key ID.
+func NewLocalKMS(keys map[string][]byte) (*LocalKMS, error) {
+	k := &LocalKMS{keys: make(map[string]cipher.AEAD)}
+	for id, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("restflex: master key %q: %v", id, err)
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+func (k *LocalKMS) GenerateDataKey(ctx context.Context, keyID string) (plaintext, encrypted []byte, err error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	plaintext = make([]byte, 32)
+	_, _ = rand.Read(plaintext)
+	nonce := make([]byte, aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	return plaintext, aead.Seal(nonce, nonce, plaintext, []byte(keyID)), nil
+}
+
+func (k *LocalKMS) Decrypt(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	if len(encrypted) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := aead.Open(nil, encrypted[:aead.NonceSize()], encrypted[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCiphertext, err)
+	}
+	return plaintext, nil
+}
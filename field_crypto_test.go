@@ -0,0 +1,156 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"kkn.fi/restflex"
+)
+
+type patient struct {
+	Name    string    `json:"name"`
+	SSN     string    `json:"ssn" encrypt:"true"`
+	Notes   *string   `json:"notes,omitempty" encrypt:"true"`
+	Contact []contact `json:"contacts"`
+}
+
+type contact struct {
+	Phone string `json:"phone" encrypt:"true"`
+}
+
+func newFieldEncryption(t *testing.T) *restflex.FieldEncryption {
+	t.Helper()
+	kms, err := restflex.NewLocalKMS(map[string][]byte{"master": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return restflex.NewFieldEncryption(kms, "master")
+}
+
+func TestFieldEncryption(t *testing.T) {
+	t.Parallel()
+	e := newFieldEncryption(t)
+	ctx := context.Background()
+	notes := "allergic"
+	p := patient{Name: "Ann", SSN: "010101-123A", Notes: &notes, Contact: []contact{{Phone: "555"}}}
+	if err := e.Encrypt(ctx, &p); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(p)
+	for _, plain := range []string{"010101-123A", "allergic", "555"} {
+		if bytes.Contains(b, []byte(plain)) {
+			t.Errorf("encrypted JSON %s contains %q", b, plain)
+		}
+	}
+	if p.Name != "Ann" || !strings.HasPrefix(p.SSN, "enc:") {
+		t.Errorf("encrypted = %+v", p)
+	}
+
+	var got patient
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Decrypt(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SSN != "010101-123A" || *got.Notes != "allergic" || got.Contact[0].Phone != "555" {
+		t.Errorf("decrypted = %+v", got)
+	}
+}
+
+func TestFieldEncryption_tampered(t *testing.T) {
+	t.Parallel()
+	e := newFieldEncryption(t)
+	ctx := context.Background()
+	p := patient{SSN: "010101-123A", Contact: []contact{{Phone: "555"}}}
+	if err := e.Encrypt(ctx, &p); err != nil {
+		t.Fatal(err)
+	}
+	envelope := func(keyID string, dataKey []byte) string {
+		b, _ := json.Marshal(map[string]any{"k": keyID, "d": dataKey, "c": bytes.Repeat([]byte{0}, 32)})
+		return "enc:" + base64.RawURLEncoding.EncodeToString(b)
+	}
+	tests := []struct {
+		name string
+		p    patient
+	}{
+		{name: "plaintext", p: patient{SSN: "010101-123A"}},
+		{name: "tampered data key", p: patient{SSN: envelope("master", bytes.Repeat([]byte{2}, 60))}},
+		{name: "foreign key ID", p: patient{SSN: envelope("other", bytes.Repeat([]byte{2}, 60))}},
+		{name: "malformed", p: patient{SSN: "enc:!!"}},
+		{name: "moved field", p: patient{SSN: p.Contact[0].Phone}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := e.Decrypt(ctx, &tt.p)
+			var apiErr restflex.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode() != http.StatusBadRequest {
+				t.Errorf("Decrypt() = %v, want 400 APIError", err)
+			}
+		})
+	}
+}
+
+func TestNewLocalKMS_invalidKey(t *testing.T) {
+	t.Parallel()
+	if _, err := restflex.NewLocalKMS(map[string][]byte{"short": []byte("key")}); err == nil {
+		t.Error("NewLocalKMS() succeeded with a 3 byte key")
+	}
+}
+
+// failingKMS is a KMS whose Decrypt fails with err.
+type failingKMS struct {
+	restflex.KMS
+	err error
+}
+
+func (k failingKMS) Decrypt(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	return nil, k.err
+}
+
+func TestFieldEncryption_KMS_errors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	errOutage := errors.New("kms: connection refused")
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "outage", err: errOutage},
+		{name: "timeout", err: context.DeadlineExceeded},
+		{name: "unknown key", err: fmt.Errorf("%w %q", restflex.ErrUnknownKey, "master"), wantStatus: http.StatusBadRequest},
+		{name: "invalid ciphertext", err: restflex.ErrInvalidCiphertext, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			e := newFieldEncryption(t)
+			p := patient{SSN: "010101-123A"}
+			if err := e.Encrypt(ctx, &p); err != nil {
+				t.Fatal(err)
+			}
+			e.KMS = failingKMS{KMS: e.KMS, err: tt.err}
+			err := e.Decrypt(ctx, &p)
+			var apiErr restflex.APIError
+			switch {
+			case tt.wantStatus == 0 && (err != tt.err || errors.As(err, &apiErr)):
+				t.Errorf("Decrypt() = %v, want %v unchanged", err, tt.err)
+			case tt.wantStatus != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode() != tt.wantStatus):
+				t.Errorf("Decrypt() = %v, want %d APIError", err, tt.wantStatus)
+			}
+		})
+	}
+}
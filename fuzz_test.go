@@ -0,0 +1,81 @@
+//go:build !integration
+
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/httpx"
+)
+
+// Run a fuzzer with, for example:
+//
+//	go test -run '^$' -fuzz FuzzDecodeJSON
+
+func FuzzDecodeJSON(f *testing.F) {
+	for _, seed := range []string{`{}`, `{"name":"a","tags":["x"]}`, `[1,2]`, `{"name":`, `null`, "\xef\xbb\xbf{}"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var v map[string]any
+		if err := DecodeJSON(bytes.NewReader(body), &v); err != nil {
+			if _, ok := err.(APIError); !ok {
+				t.Errorf("expected APIError, got %T", err)
+			}
+		}
+	})
+}
+
+type fuzzRequest struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func (r *fuzzRequest) Validate() error {
+	if r.Count < 0 {
+		return NewValidationError(http.StatusUnprocessableEntity, nil, "count must not be negative")
+	}
+	return nil
+}
+
+func FuzzBind(f *testing.F) {
+	for _, seed := range []string{`{"name":"a","count":1}`, `{"count":-1}`, `{"tags":[1]}`, `}`, ``} {
+		f.Add([]byte(seed))
+	}
+	h := NewHandlerWithContext(log.New(io.Discard, "", 0), Bind[fuzzRequest](httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if _, ok := RequestBody[fuzzRequest](ctx); !ok {
+			return errors.New("no request body")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(rec, r)
+		switch rec.Code {
+		case http.StatusNoContent, http.StatusBadRequest, http.StatusUnprocessableEntity:
+		default:
+			t.Errorf("unexpected status code %d for body %q", rec.Code, body)
+		}
+	})
+}
+
+func FuzzContentType(f *testing.F) {
+	for _, seed := range []string{"application/json", "application/json; charset=utf-8", "text/plain, application/json", ";;", "a/b; c=\"d"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, contentType string) {
+		MatchContentType(contentType, acceptedContentTypes...)
+		MatchContentType(contentType, "*/*", "text/*; charset=utf-8")
+	})
+}
@@ -3,12 +3,12 @@ module kkn.fi/restflex
 go 1.23
 
 require (
+	golang.org/x/crypto v0.32.0
 	kkn.fi/httpx v0.2.0
 	kkn.fi/infra v0.13.2
 )
 
 require (
-	golang.org/x/crypto v0.32.0 // indirect
 	golang.org/x/net v0.29.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 )
@@ -0,0 +1,88 @@
+package restflex
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"kkn.fi/infra"
+)
+
+// HostRouter routes requests by their Host header, so that one server can
+// serve several API surfaces, such as api.example.com, admin.example.com and
+// tenant subdomains, each with its own middleware stack. Requests for other
+// hosts are responded to with 421 Misdirected Request.
+type HostRouter struct {
+	hosts     map[string]http.Handler
+	wildcards []hostWildcard
+	// Log logs messages
+	Log infra.Logger
+}
+
+// hostWildcard routes the subdomains of suffix.
+type hostWildcard struct {
+	suffix  string
+	handler http.Handler
+}
+
+func NewHostRouter(l infra.Logger) *HostRouter {
+	return &HostRouter{
+		hosts: make(map[string]http.Handler),
+		Log:   l,
+	}
+}
+
+// Handle routes requests for host to h wrapped with middlewares, the first
+// one outermost. A host of the form "*.example.com" matches one level of
+// subdomains of example.com, which is available to the handler with
+// Subdomain; the longest matching wildcard wins. Hosts are matched
+// case-insensitively and without ports.
+func (hr *HostRouter) Handle(host string, h http.Handler, middlewares ...Middleware) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	host = normalizeHost(host)
+	if suffix, ok := strings.CutPrefix(host, "*"); ok {
+		hr.wildcards = append(hr.wildcards, hostWildcard{suffix: suffix, handler: h})
+		sort.SliceStable(hr.wildcards, func(i, j int) bool {
+			return len(hr.wildcards[i].suffix) > len(hr.wildcards[j].suffix)
+		})
+		return
+	}
+	hr.hosts[host] = h
+}
+
+func (hr *HostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := normalizeHost(r.Host)
+	if h, ok := hr.hosts[host]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	for _, wc := range hr.wildcards {
+		if sub, ok := strings.CutSuffix(host, wc.suffix); ok && sub != "" && !strings.Contains(sub, ".") {
+			wc.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), subdomainContextKey{}, sub)))
+			return
+		}
+	}
+	writeError(hr.Log, w, http.StatusMisdirectedRequest, "unknown host")
+}
+
+type subdomainContextKey struct{}
+
+// Subdomain returns the subdomain matched by a wildcard host of HostRouter,
+// such as "acme" of acme.tenants.example.com for *.tenants.example.com.
+func Subdomain(ctx context.Context) string {
+	sub, _ := ctx.Value(subdomainContextKey{}).(string)
+	return sub
+}
+
+// normalizeHost returns host in lower case without a port or a trailing
+// dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,56 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestHostRouter(t *testing.T) {
+	t.Parallel()
+	respond := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+":"+restflex.Subdomain(r.Context()))
+		})
+	}
+	tag := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Surface", "admin")
+			next.ServeHTTP(w, r)
+		})
+	}
+	hr := restflex.NewHostRouter(resttest.NewLogger())
+	hr.Handle("api.example.com", respond("api"))
+	hr.Handle("admin.example.com", respond("admin"), tag)
+	hr.Handle("*.example.com", respond("any"))
+	hr.Handle("*.tenants.example.com", respond("tenant"))
+
+	tests := []struct {
+		host   string
+		status int
+		body   string
+	}{
+		{host: "api.example.com", status: http.StatusOK, body: "api:"},
+		{host: "API.Example.com:8443", status: http.StatusOK, body: "api:"},
+		{host: "admin.example.com.", status: http.StatusOK, body: "admin:"},
+		{host: "acme.tenants.example.com", status: http.StatusOK, body: "tenant:acme"},
+		{host: "www.example.com", status: http.StatusOK, body: "any:www"},
+		{host: "a.b.c.example.com", status: http.StatusMisdirectedRequest},
+		{host: "example.org", status: http.StatusMisdirectedRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.host, func(t *testing.T) {
+			t.Parallel()
+			res := resttest.Get("/").WithHost(tt.host).To(hr).Expect(t).Status(tt.status)
+			if tt.body != "" && string(res.Body) != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, res.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package restflex
+
+import (
+	"bytes"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"kkn.fi/infra"
+)
+
+// WithHTMLErrors makes the handler write error responses as a minimal HTML
+// page, instead of JSON, to clients preferring text/html, such as a
+// developer opening an API URL in a browser.
+func WithHTMLErrors() Option {
+	return func(h *handler) {
+		h.HTMLErrors = true
+	}
+}
+
+var htmlErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Status}} {{.StatusText}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 4em auto; max-width: 40em; padding: 0 1em; color: #222; }
+h1 { font-size: 1.5em; }
+code { background: #eee; padding: 0.1em 0.3em; }
+</style>
+</head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+{{range .Messages}}<p>{{.}}</p>
+{{end}}{{with .Details}}<dl>
+{{range $k, $v := .}}<dt>{{$k}}</dt><dd>{{$v}}</dd>
+{{end}}</dl>
+{{end}}{{with .Incident}}<p>Incident: <code>{{.}}</code></p>
+{{end}}{{with .RequestID}}<p>Request ID: <code>{{.}}</code></p>
+{{end}}</body>
+</html>
+`))
+
+// prefersHTML reports whether an Accept header value prefers text/html over
+// JSON.
+func prefersHTML(accept string) bool {
+	for _, v := range parseWeightedValues(accept) {
+		t, _, err := mime.ParseMediaType(v.value)
+		if err != nil {
+			continue
+		}
+		switch t {
+		case "text/html", "application/xhtml+xml":
+			return true
+		case "application/json", "*/*", "application/*":
+			return false
+		}
+	}
+	return false
+}
+
+// writeHTMLError writes an HTML error page with an optional incident
+// reference and details.
+func writeHTMLError(l infra.Logger, w http.ResponseWriter, statusCode int, requestID, incident string, details map[string]any, messages ...string) {
+	var buf bytes.Buffer
+	err := htmlErrorTemplate.Execute(&buf, struct {
+		Status     int
+		StatusText string
+		Messages   []string
+		Details    map[string]any
+		Incident   string
+		RequestID  string
+	}{statusCode, http.StatusText(statusCode), messages, details, incident, requestID})
+	if err != nil {
+		l.Printf("restflex: error while rendering error page: %v", err)
+		writeError(l, w, statusCode, messages...)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		l.Printf("restflex: error while writing error response: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestWithHTMLErrors(t *testing.T) {
+	t.Parallel()
+	const browser = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	notFound := httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.NewAPIError(http.StatusNotFound, nil, "user <alice> not found")
+	})
+	tests := []struct {
+		name        string
+		opts        []restflex.Option
+		accept      string
+		contentType string
+	}{
+		{name: "browser", opts: []restflex.Option{restflex.WithHTMLErrors()}, accept: browser, contentType: "text/html; charset=utf-8"},
+		{name: "JSON client", opts: []restflex.Option{restflex.WithHTMLErrors()}, accept: "application/json", contentType: "application/json; charset=utf-8"},
+		{name: "JSON preferred", opts: []restflex.Option{restflex.WithHTMLErrors()}, accept: "application/json, text/html;q=0.5", contentType: "application/json; charset=utf-8"},
+		{name: "disabled", accept: browser, contentType: "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := restflex.NewHandlerWithContext(resttest.NewLogger(), notFound, tt.opts...)
+			res := resttest.Get("/").WithHeader("Accept", tt.accept).WithHeader(restflex.RequestIDHeader, "req-1").
+				To(api).Expect(t).Status(http.StatusNotFound).Header("Content-Type", tt.contentType)
+			if !strings.HasPrefix(tt.contentType, "text/html") {
+				res.Error("user <alice> not found")
+				return
+			}
+			body := string(res.Body)
+			for _, want := range []string{"404 Not Found", "user &lt;alice&gt; not found", "<code>req-1</code>"} {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected page to contain %q, got:\n%v", want, body)
+				}
+			}
+			res.Header("Vary", "Accept")
+		})
+	}
+}
+
+func TestWithHTMLErrors_incidentAndDetails(t *testing.T) {
+	t.Parallel()
+	const browser = "text/html"
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Path == "/broken" {
+			return errors.New("database down")
+		}
+		return restflex.NewDetailedError(restflex.NewAPIError(http.StatusConflict, nil, "order is locked"), map[string]any{"order": "<1>"})
+	}), restflex.WithHTMLErrors())
+
+	res := resttest.Get("/orders/1").WithHeader("Accept", browser).To(api).Expect(t).Status(http.StatusConflict)
+	if body := string(res.Body); !strings.Contains(body, "<dt>order</dt><dd>&lt;1&gt;</dd>") {
+		t.Errorf("expected page to contain the details, got:\n%v", body)
+	}
+	res = resttest.Get("/broken").WithHeader("Accept", browser).To(api).Expect(t).Status(http.StatusInternalServerError)
+	if body := string(res.Body); !strings.Contains(body, "<p>Incident: <code>") {
+		t.Errorf("expected page to contain the incident, got:\n%v", body)
+	}
+}
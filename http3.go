@@ -0,0 +1,49 @@
+package restflex
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTP3Server is an HTTP/3 server, such as http3.Server from
+// github.com/quic-go/quic-go. Support is experimental: restflex does not
+// depend on a QUIC implementation, so the server is configured by the caller
+// with the same handler and TLS configuration as the Server running it:
+//
+//	srv.HTTP3 = &http3.Server{
+//		Addr:      srv.Addr,
+//		Handler:   srv.Handler,
+//		TLSConfig: http3.ConfigureTLSConfig(srv.TLSConfig),
+//	}
+//	srv.Handler = restflex.AltSvc(443)(srv.Handler)
+type HTTP3Server interface {
+	ListenAndServe() error
+	Close() error
+}
+
+// serveHTTP3 runs the HTTP/3 server until the returned function is called.
+func (s *Server) serveHTTP3() (stop func()) {
+	go func() {
+		if err := s.HTTP3.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Log.Printf("restflex: HTTP/3 server: %v", err)
+		}
+	}()
+	return func() {
+		if err := s.HTTP3.Close(); err != nil {
+			s.Log.Printf("restflex: HTTP/3 server close: %v", err)
+		}
+	}
+}
+
+// AltSvc returns a middleware advertising HTTP/3 on the given UDP port with
+// the Alt-Svc header, letting clients switch to QUIC for later requests.
+func AltSvc(port int) Middleware {
+	value := fmt.Sprintf(`h3=":%d"; ma=86400`, port)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Alt-Svc", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
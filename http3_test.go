@@ -0,0 +1,66 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type fakeHTTP3Server struct {
+	started chan struct{}
+	closed  chan struct{}
+}
+
+func (s *fakeHTTP3Server) ListenAndServe() error {
+	close(s.started)
+	<-s.closed
+	return http.ErrServerClosed
+}
+
+func (s *fakeHTTP3Server) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestServer_Run_HTTP3(t *testing.T) {
+	t.Parallel()
+	h3 := &fakeHTTP3Server{started: make(chan struct{}), closed: make(chan struct{})}
+	srv := restflex.NewServer(resttest.NewLogger(), "", http.NotFoundHandler())
+	srv.HTTP3 = h3
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.RunListener(ctx, ln)
+	}()
+	<-h3.started
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error on shutdown: %v", err)
+	}
+	select {
+	case <-h3.closed:
+	default:
+		t.Error("expected HTTP/3 server to be closed on shutdown")
+	}
+}
+
+func TestAltSvc(t *testing.T) {
+	t.Parallel()
+	rec := httptest.NewRecorder()
+	restflex.AltSvc(8443)(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	want := `h3=":8443"; ma=86400`
+	if got := rec.Header().Get("Alt-Svc"); got != want {
+		t.Errorf("expected Alt-Svc %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,61 @@
+package restflex
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// APIVersionHeader is the response header carrying the API version.
+const APIVersionHeader = "X-API-Version"
+
+// Identify returns a middleware setting the Server header of every response
+// to server, or removing it when server is empty, and the X-API-Version
+// header to version unless it is empty. Values set by handlers are
+// overridden. Use BuildVersion for a version derived from build info.
+func Identify(server, version string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hw := &hookWriter{ResponseWriter: w, hook: func() {
+				if server == "" {
+					w.Header().Del("Server")
+				} else {
+					w.Header().Set("Server", server)
+				}
+				if version != "" {
+					w.Header().Set(APIVersionHeader, version)
+				}
+			}}
+			next.ServeHTTP(hw, r)
+			hw.runHook()
+		})
+	}
+}
+
+// BuildVersion returns the version of the main module of the binary, or
+// its VCS revision when built from a working tree, or an empty string when
+// build info is not available.
+func BuildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,37 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestIdentify(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		server  string
+		version string
+	}{
+		{name: "set", server: "api", version: "v1.2.3"},
+		{name: "strip", server: "", version: ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := restflex.Identify(tt.server, tt.version)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Server", "leaky/1.0")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			resttest.Get("/").To(h).Expect(t).
+				Status(http.StatusNoContent).
+				Header("Server", tt.server).
+				Header(restflex.APIVersionHeader, tt.version)
+		})
+	}
+}
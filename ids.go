@@ -0,0 +1,238 @@
+package restflex
+
+import (
+	"crypto/rand"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UUID is an RFC 9562 UUID in its canonical form, such as
+// "0190163d-8694-739b-aea5-966c26f8ad91". Parsing accepts upper case hex
+// digits and rejects the nil UUID and UUIDs of other variants.
+type UUID [16]byte
+
+// NewUUIDv4 returns a random UUID.
+func NewUUIDv4() UUID {
+	var u UUID
+	_, _ = rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// NewUUIDv7 returns a random UUID ordered by its creation time.
+func NewUUIDv7() UUID {
+	u := NewUUIDv4()
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(u[:6], ms[2:])
+	u[6] = u[6]&0x0f | 0x70
+	return u
+}
+
+// ParseUUID parses a UUID in its canonical form.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	return u, u.UnmarshalText([]byte(s))
+}
+
+// Version returns the version of u.
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+func (u UUID) String() string {
+	b, _ := u.MarshalText()
+	return string(b)
+}
+
+func (u UUID) MarshalText() ([]byte, error) {
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return b, nil
+}
+
+func (u *UUID) UnmarshalText(b []byte) error {
+	if len(b) != 36 || b[8] != '-' || b[13] != '-' || b[18] != '-' || b[23] != '-' {
+		return fmt.Errorf("restflex: invalid UUID %q", b)
+	}
+	var v UUID
+	src := string(b[0:8]) + string(b[9:13]) + string(b[14:18]) + string(b[19:23]) + string(b[24:])
+	if _, err := hex.Decode(v[:], []byte(src)); err != nil {
+		return fmt.Errorf("restflex: invalid UUID %q", b)
+	}
+	if v == (UUID{}) || v[8]&0xc0 != 0x80 || v.Version() < 1 || v.Version() > 8 {
+		return fmt.Errorf("restflex: invalid UUID %q", b)
+	}
+	*u = v
+	return nil
+}
+
+func (u UUID) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(u)
+}
+
+func (u *UUID) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, u)
+}
+
+// ULID is a lexicographically sortable identifier written as 26 characters
+// of Crockford's base32, such as "01ARZ3NDEKTSV4RRFFQ69G5FAV". Parsing is
+// case-insensitive.
+type ULID [16]byte
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// crockfordValues maps characters to their Crockford base32 values or 0xff.
+var crockfordValues = func() [256]byte {
+	var v [256]byte
+	for i := range v {
+		v[i] = 0xff
+	}
+	for i := 0; i < len(crockford); i++ {
+		c := crockford[i]
+		v[c] = byte(i)
+		if c >= 'A' {
+			v[c-'A'+'a'] = byte(i)
+		}
+	}
+	return v
+}()
+
+// ParseULID parses a ULID.
+func ParseULID(s string) (ULID, error) {
+	var u ULID
+	return u, u.UnmarshalText([]byte(s))
+}
+
+// Time returns the creation time encoded in u.
+func (u ULID) Time() time.Time {
+	var ms [8]byte
+	copy(ms[2:], u[:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(ms[:])))
+}
+
+func (u ULID) String() string {
+	b, _ := u.MarshalText()
+	return string(b)
+}
+
+func (u ULID) MarshalText() ([]byte, error) {
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	b := make([]byte, 26)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return b, nil
+}
+
+func (u *ULID) UnmarshalText(b []byte) error {
+	if len(b) != 26 || crockfordValues[b[0]] > 7 {
+		return fmt.Errorf("restflex: invalid ULID %q", b)
+	}
+	var hi, lo uint64
+	for _, c := range b {
+		v := crockfordValues[c]
+		if v == 0xff {
+			return fmt.Errorf("restflex: invalid ULID %q", b)
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	binary.BigEndian.PutUint64(u[:8], hi)
+	binary.BigEndian.PutUint64(u[8:], lo)
+	return nil
+}
+
+func (u ULID) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(u)
+}
+
+func (u *ULID) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, u)
+}
+
+// IDPrefix is implemented by types declaring the prefix of a PrefixedID.
+type IDPrefix interface {
+	IDPrefix() string
+}
+
+// PrefixedID is an identifier made of the prefix declared by P and a
+// positive integer without leading zeros, such as "user_123":
+//
+//	type userPrefix struct{}
+//
+//	func (userPrefix) IDPrefix() string { return "user_" }
+//
+//	type UserID = restflex.PrefixedID[userPrefix]
+type PrefixedID[P IDPrefix] struct {
+	ID int64
+}
+
+func (id PrefixedID[P]) String() string {
+	var p P
+	return p.IDPrefix() + strconv.FormatInt(id.ID, 10)
+}
+
+func (id PrefixedID[P]) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *PrefixedID[P]) UnmarshalText(b []byte) error {
+	var p P
+	s, ok := strings.CutPrefix(string(b), p.IDPrefix())
+	n, err := strconv.ParseInt(s, 10, 64)
+	if !ok || err != nil || n <= 0 || s[0] == '+' || s[0] == '0' {
+		return fmt.Errorf("restflex: invalid ID %q, expected %s followed by a number", b, p.IDPrefix())
+	}
+	id.ID = n
+	return nil
+}
+
+func (id PrefixedID[P]) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(id)
+}
+
+func (id *PrefixedID[P]) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, id)
+}
+
+// PathParam parses the path wildcard name of r, such as an ID, into v. A
+// malformed value is returned as a 400 Bad Request APIError naming the
+// parameter.
+func PathParam(r *http.Request, name string, v encoding.TextUnmarshaler) error {
+	if err := v.UnmarshalText([]byte(r.PathValue(name))); err != nil {
+		return NewAPIError(http.StatusBadRequest, err, fmt.Sprintf("invalid path parameter %q", name))
+	}
+	return nil
+}
+
+// QueryParam parses the query parameter name of r into v. A missing or
+// malformed value is returned as a 400 Bad Request APIError naming the
+// parameter.
+func QueryParam(r *http.Request, name string, v encoding.TextUnmarshaler) error {
+	values, ok := r.URL.Query()[name]
+	if !ok {
+		return NewAPIError(http.StatusBadRequest, nil, fmt.Sprintf("missing query parameter %q", name))
+	}
+	if err := v.UnmarshalText([]byte(values[0])); err != nil {
+		return NewAPIError(http.StatusBadRequest, err, fmt.Sprintf("invalid query parameter %q", name))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type userPrefix struct{}
+
+func (userPrefix) IDPrefix() string { return "user_" }
+
+type userID = restflex.PrefixedID[userPrefix]
+
+func TestIDTypes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		value interface {
+			UnmarshalText([]byte) error
+			MarshalText() ([]byte, error)
+		}
+		in      string
+		wantErr bool
+	}{
+		{name: "UUIDv4", value: new(restflex.UUID), in: "9b2f4c0e-3f2a-4d6b-8c1e-2a7f5e9d0b13"},
+		{name: "UUIDv7", value: new(restflex.UUID), in: "0190163d-8694-739b-aea5-966c26f8ad91"},
+		{name: "UUID upper case", value: new(restflex.UUID), in: "9B2F4C0E-3F2A-4D6B-8C1E-2A7F5E9D0B13"},
+		{name: "nil UUID", value: new(restflex.UUID), in: "00000000-0000-0000-0000-000000000000", wantErr: true},
+		{name: "UUID without dashes", value: new(restflex.UUID), in: "9b2f4c0e3f2a4d6b8c1e2a7f5e9d0b13", wantErr: true},
+		{name: "UUID wrong variant", value: new(restflex.UUID), in: "9b2f4c0e-3f2a-4d6b-0c1e-2a7f5e9d0b13", wantErr: true},
+		{name: "ULID", value: new(restflex.ULID), in: "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{name: "ULID overflow", value: new(restflex.ULID), in: "81ARZ3NDEKTSV4RRFFQ69G5FAV", wantErr: true},
+		{name: "ULID invalid character", value: new(restflex.ULID), in: "01ARZ3NDEKTSV4RRFFQ69G5FAU", wantErr: true},
+		{name: "prefixed ID", value: new(userID), in: "user_123"},
+		{name: "prefixed ID wrong prefix", value: new(userID), in: "team_123", wantErr: true},
+		{name: "prefixed ID not a number", value: new(userID), in: "user_abc", wantErr: true},
+		{name: "prefixed ID zero", value: new(userID), in: "user_0", wantErr: true},
+		{name: "prefixed ID leading zero", value: new(userID), in: "user_007", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.value.UnmarshalText([]byte(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error for %q", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, _ := tt.value.MarshalText()
+			if got, want := string(out), tt.in; got != want && tt.name != "UUID upper case" {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	t.Parallel()
+	for _, u := range []restflex.UUID{restflex.NewUUIDv4(), restflex.NewUUIDv7()} {
+		parsed, err := restflex.ParseUUID(u.String())
+		if err != nil || parsed != u {
+			t.Errorf("expected %v to round trip, got %v (%v)", u, parsed, err)
+		}
+	}
+	if v := restflex.NewUUIDv7().Version(); v != 7 {
+		t.Errorf("expected version 7, got %d", v)
+	}
+	var body struct {
+		ID userID `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(`{"id":"user_42"}`), &body); err != nil || body.ID.ID != 42 {
+		t.Errorf("expected ID 42, got %d (%v)", body.ID.ID, err)
+	}
+}
+
+func TestPathParam(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{id}", restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var id userID
+		if err := restflex.PathParam(r, "id", &id); err != nil {
+			return err
+		}
+		var since restflex.Date
+		if err := restflex.QueryParam(r, "since", &since); err != nil {
+			return err
+		}
+		return restflex.WriteJSON(w, http.StatusOK, map[string]any{"id": id, "since": since})
+	})))
+
+	resttest.Get("/users/user_7").WithQuery("since", "2024-01-02").To(mux).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.id", "user_7").
+		JSONPath("$.since", "2024-01-02")
+	resttest.Get("/users/7").WithQuery("since", "2024-01-02").To(mux).Expect(t).
+		Status(http.StatusBadRequest).
+		Error(`invalid path parameter "id"`)
+	resttest.Get("/users/user_7").To(mux).Expect(t).
+		Status(http.StatusBadRequest).
+		Error(`missing query parameter "since"`)
+}
+
+func TestBind_ID(t *testing.T) {
+	t.Parallel()
+	type request struct {
+		Owner struct {
+			ID userID `json:"id"`
+		} `json:"owner"`
+	}
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), restflex.Bind[request](httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req, _ := restflex.RequestBody[request](ctx)
+		return restflex.WriteJSON(w, http.StatusOK, req)
+	})))
+	resttest.Post("/items").WithJSON(map[string]any{"owner": map[string]string{"id": "user_7"}}).To(api).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.owner.id", "user_7")
+	resttest.Post("/items").WithJSON(map[string]any{"owner": map[string]string{"id": "team_7"}}).To(api).Expect(t).
+		Status(http.StatusBadRequest).
+		Error(`invalid field "owner.id"`)
+}
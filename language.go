@@ -0,0 +1,110 @@
+package restflex
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// weightedValue is an element of a header value list with a quality value,
+// such as Accept or Accept-Language.
+type weightedValue struct {
+	value string
+	q     float64
+}
+
+// parseWeightedValues parses a comma separated header value list with
+// optional quality values. Elements are returned in descending order of
+// quality, keeping header order for equal qualities. Elements with quality
+// zero are dropped.
+func parseWeightedValues(header string) []weightedValue {
+	var values []weightedValue
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "q") {
+				continue
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || f < 0 || f > 1 {
+				f = 0
+			}
+			q = f
+		}
+		if q == 0 {
+			continue
+		}
+		values = append(values, weightedValue{value: value, q: q})
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].q > values[j].q
+	})
+	return values
+}
+
+// NegotiateLanguage returns the supported language tag best matching the
+// Accept-Language header value. A supported tag matches a language range if
+// they are equal or share the primary language subtag. The first supported
+// tag is returned if nothing matches.
+func NegotiateLanguage(acceptLanguage string, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+	for _, lr := range parseWeightedValues(acceptLanguage) {
+		if lr.value == "*" {
+			return supported[0]
+		}
+		for _, tag := range supported {
+			if strings.EqualFold(tag, lr.value) {
+				return tag
+			}
+		}
+		primary := primaryLanguage(lr.value)
+		for _, tag := range supported {
+			if strings.EqualFold(primaryLanguage(tag), primary) {
+				return tag
+			}
+		}
+	}
+	return supported[0]
+}
+
+func primaryLanguage(tag string) string {
+	primary, _, _ := strings.Cut(tag, "-")
+	return primary
+}
+
+type localeContextKey struct{}
+
+// Languages returns a middleware choosing a locale among supported language
+// tags for each request. The chosen locale is available with Locale.
+func Languages(supported ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale := NegotiateLanguage(r.Header.Get("Accept-Language"), supported)
+			AddVary(w.Header(), "Accept-Language")
+			w.Header().Set("Content-Language", locale)
+			next.ServeHTTP(w, r.WithContext(WithLocale(r.Context(), locale)))
+		})
+	}
+}
+
+// WithLocale returns a copy of ctx carrying the locale.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, locale)
+}
+
+// Locale returns the locale chosen for the request or an empty string if no
+// locale has been chosen.
+func Locale(ctx context.Context) string {
+	locale, _ := ctx.Value(localeContextKey{}).(string)
+	return locale
+}
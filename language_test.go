@@ -0,0 +1,88 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/restflex"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	supported := []string{"en", "fi-FI", "sv"}
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{
+			name: "no header returns default",
+			want: "en",
+		},
+		{
+			name:           "exact match",
+			acceptLanguage: "sv",
+			want:           "sv",
+		},
+		{
+			name:           "match is case insensitive",
+			acceptLanguage: "FI-fi",
+			want:           "fi-FI",
+		},
+		{
+			name:           "primary subtag match",
+			acceptLanguage: "fi",
+			want:           "fi-FI",
+		},
+		{
+			name:           "quality values order preferences",
+			acceptLanguage: "de, sv;q=0.5, fi;q=0.8",
+			want:           "fi-FI",
+		},
+		{
+			name:           "zero quality excludes language",
+			acceptLanguage: "sv;q=0, fi;q=0.1",
+			want:           "fi-FI",
+		},
+		{
+			name:           "wildcard returns default",
+			acceptLanguage: "de, *;q=0.1",
+			want:           "en",
+		},
+		{
+			name:           "no match returns default",
+			acceptLanguage: "de",
+			want:           "en",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := restflex.NegotiateLanguage(tt.acceptLanguage, supported); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	t.Parallel()
+	var locale string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale = restflex.Locale(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "fi;q=0.9, en-US")
+	rec := httptest.NewRecorder()
+	restflex.Languages("fi", "en")(next).ServeHTTP(rec, req)
+
+	if locale != "en" {
+		t.Errorf("expected locale %q, got %q", "en", locale)
+	}
+	if v := rec.Header().Get("Vary"); v != "Accept-Language" {
+		t.Errorf("expected Vary %q, got %q", "Accept-Language", v)
+	}
+}
@@ -0,0 +1,136 @@
+package restflex
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// rejectResponse is written to plain HTTP connections over the limits.
+const rejectResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+	"Content-Type: application/json; charset=utf-8\r\n" +
+	"Content-Length: 35\r\n" +
+	"Connection: close\r\n" +
+	"\r\n" +
+	`{"errors":["Service Unavailable"]}` + "\n"
+
+// maxRejecting is the number of 503 responses to rejected connections
+// written at the same time. Connections rejected beyond it are closed
+// without a response.
+const maxRejecting = 64
+
+// limitListener limits the number of concurrent connections in total and
+// per client IP address. Connections over the limits are closed right after
+// being accepted, after writing a 503 response when plain is set. The
+// responses are written in the background so that a client not reading
+// them does not hold up Accept.
+type limitListener struct {
+	net.Listener
+	max   int
+	perIP int
+	plain bool
+	log   infra.Logger
+
+	mu        sync.Mutex
+	total     int
+	byIP      map[string]int
+	rejecting chan struct{}
+}
+
+func newLimitListener(l infra.Logger, ln net.Listener, max, perIP int, plain bool) *limitListener {
+	return &limitListener{
+		Listener:  ln,
+		max:       max,
+		perIP:     perIP,
+		plain:     plain,
+		log:       l,
+		byIP:      make(map[string]int),
+		rejecting: make(chan struct{}, maxRejecting),
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := connIP(c)
+		if l.acquire(ip) {
+			return &limitConn{Conn: c, release: func() { l.release(ip) }}, nil
+		}
+		l.log.Printf("restflex: rejecting connection from %v: connection limit reached", c.RemoteAddr())
+		l.reject(c)
+	}
+}
+
+func (l *limitListener) reject(c net.Conn) {
+	if !l.plain {
+		c.Close()
+		return
+	}
+	select {
+	case l.rejecting <- struct{}{}:
+	default:
+		c.Close()
+		return
+	}
+	go func() {
+		defer func() { <-l.rejecting }()
+		_ = c.SetWriteDeadline(time.Now().Add(time.Second))
+		_, _ = c.Write([]byte(rejectResponse))
+		c.Close()
+	}()
+}
+
+func (l *limitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.total >= l.max {
+		return false
+	}
+	if l.perIP > 0 && ip != "" && l.byIP[ip] >= l.perIP {
+		return false
+	}
+	l.total++
+	if ip != "" {
+		l.byIP[ip]++
+	}
+	return true
+}
+
+func (l *limitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if ip == "" {
+		return
+	}
+	if l.byIP[ip]--; l.byIP[ip] <= 0 {
+		delete(l.byIP, ip)
+	}
+}
+
+// connIP returns the IP address of the client of c or an empty string for
+// connections without one, such as unix domain socket connections.
+func connIP(c net.Conn) string {
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// limitConn releases its slot of a limitListener once closed.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,82 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_MaxConnectionsPerIP(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	srv := restflex.NewServer(logger, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.MaxConnectionsPerIP = 1
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = srv.RunListener(ctx, ln)
+	}()
+
+	request := func(conn net.Conn) *http.Response {
+		t.Helper()
+		if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: api\r\n\r\n"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+		return res
+	}
+	first, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res := request(first); res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status code %d, but got %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	second, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer second.Close()
+	res, err := http.ReadResponse(bufio.NewReader(second), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusServiceUnavailable || int64(len(body)) != res.ContentLength {
+		t.Errorf("expected status code %d with %d byte body, but got %d with %q", http.StatusServiceUnavailable, res.ContentLength, res.StatusCode, body)
+	}
+	logger.ExpectCount(t, "connection limit reached", 1)
+
+	first.Close()
+	for i := 0; i < 50; i++ {
+		third, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res := request(third)
+		third.Close()
+		if res.StatusCode == http.StatusNoContent {
+			return
+		}
+	}
+	t.Error("expected a connection to be accepted after the first one was closed")
+}
@@ -0,0 +1,219 @@
+package restflex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits bounds the structure of a JSON request body. Zero values are
+// unlimited.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of objects and arrays.
+	MaxDepth int
+	// MaxStringLength is the maximum length of strings, including object
+	// keys, in characters.
+	MaxStringLength int
+	// MaxArrayLength is the maximum number of elements in arrays.
+	MaxArrayLength int
+}
+
+// LimitedRequest is implemented by request types bound with Bind which
+// declare limits for their whole body. The body is checked against the
+// limits before it is decoded, so that pathological payloads are rejected
+// with 422 Unprocessable Entity before they are expanded into values.
+//
+// Limits of individual fields are declared with limit struct tags of the
+// form `limit:"maxlen=64"` for strings and `limit:"maxitems=100"` for
+// slices, arrays and maps, and checked after decoding.
+type LimitedRequest interface {
+	RequestLimits() Limits
+}
+
+// check returns a validation error if the JSON body b exceeds l. Malformed
+// bodies are left for decoding to reject.
+func (l Limits) check(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// counts holds the element counts of open arrays, or -1 for objects.
+	var counts []int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if n := len(counts); n > 0 && counts[n-1] >= 0 && tok != json.Delim(']') {
+			counts[n-1]++
+			if l.MaxArrayLength > 0 && counts[n-1] > l.MaxArrayLength {
+				return limitError("request body contains an array longer than %d elements", l.MaxArrayLength)
+			}
+		}
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '[':
+				counts = append(counts, 0)
+			case '{':
+				counts = append(counts, -1)
+			default:
+				counts = counts[:len(counts)-1]
+			}
+			if l.MaxDepth > 0 && len(counts) > l.MaxDepth {
+				return limitError("request body exceeds maximum nesting depth of %d", l.MaxDepth)
+			}
+		case string:
+			if l.MaxStringLength > 0 && utf8.RuneCountInString(tok) > l.MaxStringLength {
+				return limitError("request body contains a string longer than %d characters", l.MaxStringLength)
+			}
+		}
+	}
+}
+
+func limitError(format string, a ...any) error {
+	return NewValidationError(http.StatusUnprocessableEntity, nil, fmt.Sprintf(format, a...))
+}
+
+// readLimited reads body and checks it against the limits of v if it is a
+// LimitedRequest.
+func readLimited(body io.Reader, v any) (io.Reader, error) {
+	limited, ok := v.(LimitedRequest)
+	if !ok {
+		return body, nil
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, NewAPIError(http.StatusBadRequest, err, ErrInvalidRequestBody.Errors()...)
+	}
+	if err := limited.RequestLimits().check(b); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// hasFieldLimits reports whether t or a type it contains has limit tags. It
+// panics if a tag is malformed, so that mistakes are found when routes are
+// set up rather than when requests are served.
+func hasFieldLimits(t reflect.Type) bool {
+	return hasFieldLimitsSeen(t, make(map[reflect.Type]bool))
+}
+
+func hasFieldLimitsSeen(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasFieldLimitsSeen(t.Elem(), seen)
+	case reflect.Struct:
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if tag, ok := f.Tag.Lookup("limit"); ok {
+				parseLimitTag(tag, t.Name()+"."+f.Name)
+				found = true
+			}
+			if hasFieldLimitsSeen(f.Type, seen) {
+				found = true
+			}
+		}
+		return found
+	}
+	return false
+}
+
+// parseLimitTag returns the limits of a limit tag by their keys.
+func parseLimitTag(tag, name string) map[string]int {
+	limits := make(map[string]int)
+	for _, limit := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(limit, "=")
+		max, err := strconv.Atoi(value)
+		if err != nil || (key != "maxlen" && key != "maxitems") {
+			panic(fmt.Sprintf("restflex: invalid limit tag %q of %s", tag, name))
+		}
+		limits[key] = max
+	}
+	return limits
+}
+
+// checkFieldLimits returns a validation error naming the first field of v
+// exceeding the limits of its limit tag.
+func checkFieldLimits(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return checkFieldLimits(v.Elem(), path)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkFieldLimits(v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := checkFieldLimits(iter.Value(), path+"["+fmt.Sprint(iter.Key())+"]"); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := jsonFieldName(f)
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := checkTag(v.Field(i), name, f.Tag.Get("limit")); err != nil {
+				return err
+			}
+			if err := checkFieldLimits(v.Field(i), name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkTag checks v against the limit tag.
+func checkTag(v reflect.Value, name, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	for key, max := range parseLimitTag(tag, name) {
+		switch {
+		case key == "maxlen" && v.Kind() == reflect.String:
+			if utf8.RuneCountInString(v.String()) > max {
+				return limitError("%s must be at most %d characters", name, max)
+			}
+		case key == "maxitems" && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array || v.Kind() == reflect.Map):
+			if v.Len() > max {
+				return limitError("%s must have at most %d items", name, max)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonFieldName returns the name of f in JSON.
+func jsonFieldName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
@@ -0,0 +1,73 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type createPost struct {
+	Title string   `json:"title" limit:"maxlen=10"`
+	Tags  []string `json:"tags" limit:"maxitems=2"`
+	Body  *struct {
+		Text string `json:"text" limit:"maxlen=5"`
+	} `json:"body"`
+	Extra any `json:"extra"`
+}
+
+func (createPost) RequestLimits() restflex.Limits {
+	return restflex.Limits{MaxDepth: 3, MaxStringLength: 100, MaxArrayLength: 5}
+}
+
+func TestBind_limits(t *testing.T) {
+	t.Parallel()
+	h := restflex.NewHandlerWithContext(resttest.NewLogger(), restflex.Bind[createPost](httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})))
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		errors []string
+	}{
+		{name: "valid", body: `{"title":"hello","tags":["a","b"],"body":{"text":"hi"}}`, status: http.StatusNoContent},
+		{name: "string field", body: `{"title":"hello world!"}`, status: http.StatusUnprocessableEntity, errors: []string{"title must be at most 10 characters"}},
+		{name: "array field", body: `{"tags":["a","b","c"]}`, status: http.StatusUnprocessableEntity, errors: []string{"tags must have at most 2 items"}},
+		{name: "nested field", body: `{"body":{"text":"hello!"}}`, status: http.StatusUnprocessableEntity, errors: []string{"body.text must be at most 5 characters"}},
+		{name: "depth", body: `{"extra":{"a":[[1]]}}`, status: http.StatusUnprocessableEntity, errors: []string{"request body exceeds maximum nesting depth of 3"}},
+		{name: "string", body: `{"extra":"` + strings.Repeat("x", 101) + `"}`, status: http.StatusUnprocessableEntity, errors: []string{"request body contains a string longer than 100 characters"}},
+		{name: "array", body: `{"extra":[1,[2],3,{},5,6]}`, status: http.StatusUnprocessableEntity, errors: []string{"request body contains an array longer than 5 elements"}},
+		{name: "malformed", body: `{"title":`, status: http.StatusBadRequest, errors: restflex.ErrInvalidRequestBody.Errors()},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			res := resttest.Post("/posts").WithBody("application/json", []byte(tt.body)).To(h).Expect(t).Status(tt.status)
+			if tt.errors != nil {
+				res.Error(tt.errors...)
+			}
+		})
+	}
+}
+
+func TestBind_invalid_limit_tag(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid limit tag")
+		}
+	}()
+	type request struct {
+		Name string `limit:"max=1"`
+	}
+	restflex.Bind[request](nil)
+}
@@ -0,0 +1,99 @@
+package restflex
+
+// LogLevel is the severity of a log line. Lines are written with a leading
+// "debug:", "info:", "warn:" or "error:".
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelOff suppresses logging.
+	LevelOff
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelOff:
+		return "off"
+	}
+	return "unknown"
+}
+
+// LogPolicy chooses the level each response is logged at.
+type LogPolicy struct {
+	// Success is the level of 1xx-3xx responses.
+	Success LogLevel
+	// ClientError is the level of 4xx responses.
+	ClientError LogLevel
+	// ServerError is the level of 5xx responses.
+	ServerError LogLevel
+	// Statuses overrides the level of individual status codes, e.g. 429 at
+	// LevelWarn, or suppresses them with LevelOff.
+	Statuses map[int]LogLevel
+	// MinLevel is the lowest level written.
+	MinLevel LogLevel
+}
+
+// DefaultLogPolicy logs client errors at info and server errors at error
+// level. Successful responses are logged at debug level, which is not
+// written.
+func DefaultLogPolicy() LogPolicy {
+	return LogPolicy{
+		Success:     LevelDebug,
+		ClientError: LevelInfo,
+		ServerError: LevelError,
+		MinLevel:    LevelInfo,
+	}
+}
+
+// Suppress returns a copy of p not logging the given statuses.
+func (p LogPolicy) Suppress(statuses ...int) LogPolicy {
+	levels := make(map[int]LogLevel, len(p.Statuses)+len(statuses))
+	for s, l := range p.Statuses {
+		levels[s] = l
+	}
+	for _, s := range statuses {
+		levels[s] = LevelOff
+	}
+	p.Statuses = levels
+	return p
+}
+
+// Level returns the level a response with status is logged at.
+func (p LogPolicy) Level(status int) LogLevel {
+	if l, ok := p.Statuses[status]; ok {
+		return l
+	}
+	switch {
+	case status >= 500:
+		return p.ServerError
+	case status >= 400:
+		return p.ClientError
+	}
+	return p.Success
+}
+
+func (p LogPolicy) logResponse(log requestLogger, status int, err error) {
+	level := p.Level(status)
+	if level == LevelOff || level < p.MinLevel {
+		return
+	}
+	switch {
+	case status >= 500:
+		log.Printf("%v: server error: %v: %v", level, status, err)
+	case status >= 400:
+		log.Printf("%v: client error: %v", level, status)
+	default:
+		log.Printf("%v: response: %v", level, status)
+	}
+}
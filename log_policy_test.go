@@ -0,0 +1,56 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestLogPolicy(t *testing.T) {
+	t.Parallel()
+	policy := restflex.DefaultLogPolicy()
+	policy.ClientError = restflex.LevelDebug
+	policy.Statuses = map[int]restflex.LogLevel{http.StatusTooManyRequests: restflex.LevelWarn}
+	policy = policy.Suppress(http.StatusServiceUnavailable)
+	tests := []struct {
+		name   string
+		status int
+		level  resttest.Level
+		lines  int
+	}{
+		{name: "success is not logged", status: http.StatusOK, lines: 0},
+		{name: "client error below minimum level", status: http.StatusNotFound, lines: 0},
+		{name: "status override", status: http.StatusTooManyRequests, level: resttest.LevelWarn, lines: 1},
+		{name: "server error", status: http.StatusInternalServerError, level: resttest.LevelError, lines: 1},
+		{name: "suppressed status", status: http.StatusServiceUnavailable, lines: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := resttest.NewLogger()
+			api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				if tt.status < 400 {
+					w.WriteHeader(tt.status)
+					return nil
+				}
+				return restflex.NewAPIError(tt.status, nil, http.StatusText(tt.status))
+			}), restflex.WithLogPolicy(policy))
+			resttest.Get("/").To(api).Expect(t).Status(tt.status)
+			if n := logger.Count(""); n != tt.lines {
+				t.Fatalf("expected %d log lines, but got %d:\n%v", tt.lines, n, logger)
+			}
+			if tt.lines > 0 {
+				if n := logger.CountLevel(tt.level); n != tt.lines {
+					t.Errorf("expected %d %v level lines, but got:\n%v", tt.lines, tt.level, logger)
+				}
+			}
+		})
+	}
+}
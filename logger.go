@@ -0,0 +1,64 @@
+package restflex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"kkn.fi/infra"
+)
+
+// Logger returns the logger of the request being served. Its lines end with
+// the request ID, method, route and principal of the request so that they
+// can be correlated. Outside a request log.Default() is returned.
+func Logger(ctx context.Context) infra.Logger {
+	info, ok := ctx.Value(requestInfoContextKey{}).(*requestInfo)
+	if !ok {
+		return log.Default()
+	}
+	return requestLogger{info: info}
+}
+
+// requestLogger appends request fields to lines logged with the logger of the
+// request handler.
+type requestLogger struct {
+	info *requestInfo
+}
+
+func (l requestLogger) Printf(format string, v ...any) {
+	l.info.log.Printf("%s", fmt.Sprintf(format, v...)+" "+l.info.fields())
+}
+
+// fields returns the request fields formatted as key=value pairs.
+func (info *requestInfo) fields() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	if info.formatted == "" {
+		var b strings.Builder
+		b.Grow(len("request_id= parent_request_id= method= route= principal= experiments=") +
+			len(info.id) + len(info.parentID) + len(info.method) + len(info.route) + len(info.principal) + len(info.experiments))
+		b.WriteString("request_id=")
+		b.WriteString(info.id)
+		if info.parentID != "" {
+			b.WriteString(" parent_request_id=")
+			b.WriteString(info.parentID)
+		}
+		b.WriteString(" method=")
+		b.WriteString(info.method)
+		if info.route != "" {
+			b.WriteString(" route=")
+			b.WriteString(strings.ReplaceAll(info.route, " ", "_"))
+		}
+		if info.principal != "" {
+			b.WriteString(" principal=")
+			b.WriteString(info.principal)
+		}
+		if info.experiments != "" {
+			b.WriteString(" experiments=")
+			b.WriteString(info.experiments)
+		}
+		info.formatted = b.String()
+	}
+	return info.formatted
+}
@@ -0,0 +1,135 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		ctx = restflex.WithPrincipal(ctx, "alice")
+		restflex.Logger(ctx).Printf("loading user %v", r.PathValue("id"))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{id}", api)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(restflex.RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(restflex.RequestIDHeader); got != "abc-123" {
+		t.Errorf("expected request ID %q to be echoed, got %q", "abc-123", got)
+	}
+	want := "loading user 1 request_id=abc-123 method=GET route=GET_/users/{id} principal=alice"
+	logger.ExpectCount(t, want, 1)
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		wantEcho bool
+	}{
+		{
+			name: "generated when missing",
+		},
+		{
+			name:     "client ID is used",
+			clientID: "3f2a-b1",
+			wantEcho: true,
+		},
+		{
+			name:     "invalid client ID is replaced",
+			clientID: "bad id\nwith newline",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var id string
+			api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				id = restflex.RequestID(ctx)
+				w.WriteHeader(http.StatusOK)
+				return nil
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.clientID != "" {
+				req.Header.Set(restflex.RequestIDHeader, tt.clientID)
+			}
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if id == "" || strings.ContainsAny(id, " \n") {
+				t.Errorf("unexpected request ID %q", id)
+			}
+			if (id == tt.clientID) != tt.wantEcho {
+				t.Errorf("expected client ID used %v, got %q", tt.wantEcho, id)
+			}
+			if got := rec.Header().Get(restflex.RequestIDHeader); got != id {
+				t.Errorf("expected response header %q, got %q", id, got)
+			}
+		})
+	}
+}
+
+func TestSubRequest(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	upstream := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		restflex.Logger(ctx).Printf("upstream")
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}))
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		for i := 1; i <= 2; i++ {
+			sub := httptest.NewRequest(http.MethodGet, "/sub", nil)
+			restflex.SubRequest(ctx, sub, i)
+			upstream.ServeHTTP(httptest.NewRecorder(), sub)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}))
+	resttest.Get("/").WithHeader(restflex.RequestIDHeader, "batch-1").To(api).Expect(t).Status(http.StatusNoContent)
+	logger.ExpectCount(t, "upstream request_id=batch-1.1 parent_request_id=batch-1 method=GET", 1)
+	logger.ExpectCount(t, "upstream request_id=batch-1.2 parent_request_id=batch-1 method=GET", 1)
+}
+
+func TestNewProxy_sub_request(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(restflex.ParentRequestIDHeader); got != "req-1" {
+			t.Errorf("expected parent request ID %q, got %q", "req-1", got)
+		}
+		if got := r.Header.Get(restflex.RequestIDHeader); got != "req-1.1" {
+			t.Errorf("expected request ID %q, got %q", "req-1.1", got)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := resttest.NewLogger()
+	proxy := restflex.NewProxy(logger, target, nil)
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		proxy.ServeHTTP(w, r)
+		return nil
+	}))
+	resttest.Get("/").WithHeader(restflex.RequestIDHeader, "req-1").To(api).Expect(t).Status(http.StatusNoContent)
+}
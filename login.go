@@ -0,0 +1,342 @@
+package restflex
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// LoginAttempts is the login state of an account or a client.
+type LoginAttempts struct {
+	// Failures is the number of consecutive failed attempts.
+	Failures int
+	// Pending is the number of attempts in progress.
+	Pending int
+	// LockedUntil is the end of the current lockout, if any.
+	LockedUntil time.Time
+}
+
+// LoginStore keeps login attempts by key. Implementations must be safe for
+// concurrent use and may be shared by several servers. Begin and End must
+// each be a single atomic operation, so that parallel attempts can't exceed
+// the allowed failures.
+type LoginStore interface {
+	// Begin starts an attempt of key unless key is locked out or the
+	// failed and pending attempts of key already reach limit. After a
+	// lockout has ended one attempt at a time is allowed. It returns the
+	// attempts of key and whether the attempt was started.
+	Begin(ctx context.Context, key string, limit int) (a LoginAttempts, started bool, err error)
+	// End ends an attempt started with Begin. A failed attempt is counted
+	// and key is locked for the duration lockout returns for the new
+	// number of failures.
+	End(ctx context.Context, key string, failed bool, lockout func(failures int) time.Duration) (LoginAttempts, error)
+	// Reset forgets the failed attempts of key.
+	Reset(ctx context.Context, key string) error
+}
+
+var (
+	// ErrAccountLocked is responded to login attempts on a locked account.
+	ErrAccountLocked = NewDeniedError(NewAPIError(http.StatusLocked, nil, "account temporarily locked"), DenialAccountLocked)
+	// ErrTooManyLogins is responded to login attempts from a locked client.
+	ErrTooManyLogins = NewDeniedError(NewAPIError(http.StatusTooManyRequests, nil, "too many failed login attempts"), DenialLoginRateLimited)
+)
+
+// LoginThrottle is a middleware protecting authentication endpoints from
+// password guessing and credential stuffing. Attempts are counted per
+// account and per client IP address, and both are locked out for an
+// exponentially growing time once their limit of failures is reached.
+// Locked accounts are responded to with 423 Locked and locked clients with
+// 429 Too Many Requests, both with Retry-After.
+type LoginThrottle struct {
+	Store LoginStore
+	// Account returns the account a request tries to log in to. Only
+	// clients are throttled when it is not set or returns an empty string.
+	Account func(*http.Request) string
+	// Fingerprint optionally returns a device fingerprint. The attempts of
+	// a device at an address are limited by MaxDeviceFailures, so that a
+	// single device is locked out before the other clients sharing the
+	// address through NAT. The address stays limited by MaxClientFailures
+	// whatever fingerprints are sent.
+	Fingerprint func(*http.Request) string
+	// ClientIP returns the IP address of the client of a request. Defaults
+	// to the address of the connection, which is the address of the proxy
+	// for all clients of a server behind one: set it to e.g.
+	// ForwardedClientIP of the proxy addresses, or all clients are locked
+	// out together.
+	ClientIP func(*http.Request) string
+	// Failed reports whether a response status is a failed attempt.
+	// Defaults to 401 Unauthorized.
+	Failed func(status int) bool
+	// MaxAccountFailures, MaxClientFailures and MaxDeviceFailures are the
+	// failures allowed before a lockout.
+	MaxAccountFailures int
+	MaxClientFailures  int
+	MaxDeviceFailures  int
+	// Lockout is the first lockout, doubled on every further failure up to
+	// MaxLockout.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+	// Metrics, if set, counts the rejected requests by denial reason.
+	Metrics *Metrics
+	// DenialDetails includes denial reasons in error responses.
+	DenialDetails bool
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewLoginThrottle(l infra.Logger, s LoginStore) *LoginThrottle {
+	return &LoginThrottle{
+		Store: s,
+		Failed: func(status int) bool {
+			return status == http.StatusUnauthorized
+		},
+		MaxAccountFailures: 5,
+		MaxClientFailures:  20,
+		MaxDeviceFailures:  5,
+		Lockout:            30 * time.Second,
+		MaxLockout:         time.Hour,
+		Log:                l,
+	}
+}
+
+// loginKey is a key attempts are counted by.
+type loginKey struct {
+	key string
+	max int
+	// locked is responded to when the key is locked out.
+	locked APIError
+}
+
+// Wrap returns a handler rejecting attempts on locked accounts and from
+// locked clients and recording the outcome of other attempts.
+func (t *LoginThrottle) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := requestIP(r)
+		if t.ClientIP != nil {
+			ip = t.ClientIP(r)
+		}
+		keys := []loginKey{{key: "client:" + ip, max: t.MaxClientFailures, locked: ErrTooManyLogins}}
+		if t.Fingerprint != nil {
+			if fp := t.Fingerprint(r); fp != "" {
+				keys = append(keys, loginKey{key: "device:" + ip + "|" + fp, max: t.MaxDeviceFailures, locked: ErrTooManyLogins})
+			}
+		}
+		var account string
+		if t.Account != nil {
+			if a := t.Account(r); a != "" {
+				account = "account:" + a
+				keys = append(keys, loginKey{key: account, max: t.MaxAccountFailures, locked: ErrAccountLocked})
+			}
+		}
+		for i, k := range keys {
+			if err := t.begin(r.Context(), k); err != nil {
+				for _, started := range keys[:i] {
+					t.end(r.Context(), started, false)
+				}
+				deny(t.Log, t.Metrics, t.DenialDetails, w, r, err)
+				return
+			}
+		}
+		rw := newResponseWriter(w)
+		defer rw.release()
+		defer func() {
+			// a panicking attempt is ended without counting it as failed,
+			// as an attempt left pending would lock the keys out for good
+			if p := recover(); p != nil {
+				for _, k := range keys {
+					t.end(r.Context(), k, false)
+				}
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+		failed := rw.status == http.StatusUnauthorized
+		if t.Failed != nil {
+			failed = t.Failed(rw.status)
+		}
+		for _, k := range keys {
+			t.end(r.Context(), k, failed)
+		}
+		if !failed && rw.status < 300 && account != "" {
+			if err := t.Store.Reset(r.Context(), account); err != nil {
+				t.Log.Printf("restflex: login store: %v", err)
+			}
+		}
+	})
+}
+
+// begin starts an attempt of k, returning the error to respond with if k
+// is locked out.
+func (t *LoginThrottle) begin(ctx context.Context, k loginKey) APIError {
+	a, started, err := t.Store.Begin(ctx, k.key, k.max)
+	if err != nil {
+		t.Log.Printf("restflex: login store: %v", err)
+		return NewServiceUnavailable(0, http.StatusText(http.StatusServiceUnavailable))
+	}
+	if started {
+		return nil
+	}
+	// a key without a lockout has its remaining attempts in progress
+	d := max(time.Until(a.LockedUntil), time.Second)
+	return NewDeniedError(NewRetryAfterError(k.locked, d), denialReason(k.locked))
+}
+
+func (t *LoginThrottle) end(ctx context.Context, k loginKey, failed bool) {
+	a, err := t.Store.End(ctx, k.key, failed, func(failures int) time.Duration {
+		return t.lockout(failures, k.max)
+	})
+	if err != nil {
+		t.Log.Printf("restflex: login store: %v", err)
+		return
+	}
+	if failed && !a.LockedUntil.IsZero() && a.Failures >= k.max {
+		t.Log.Printf("restflex: login locked %s until %s after %d failures", k.key, a.LockedUntil.Format(time.RFC3339), a.Failures)
+	}
+}
+
+// lockout returns the lockout after failures with max allowed.
+func (t *LoginThrottle) lockout(failures, max int) time.Duration {
+	if failures < max {
+		return 0
+	}
+	d := t.Lockout
+	for i := max; i < failures && d < t.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, t.MaxLockout)
+}
+
+// requestIP returns the IP address of the client of r.
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedClientIP returns a function returning the IP address of the
+// client of a request received through the trusted proxies. The address is
+// the rightmost address of the X-Forwarded-For header not of a trusted
+// proxy, as the addresses left of it may be forged by the client. Requests
+// which are not from a trusted proxy are from the client itself.
+func ForwardedClientIP(trusted ...netip.Prefix) func(*http.Request) string {
+	isTrusted := func(s string) bool {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		return slices.ContainsFunc(trusted, func(p netip.Prefix) bool {
+			return p.Contains(addr)
+		})
+	}
+	return func(r *http.Request) string {
+		ip := requestIP(r)
+		if !isTrusted(ip) {
+			return ip
+		}
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(forwarded[i])
+			if addr == "" {
+				continue
+			}
+			if !isTrusted(addr) {
+				return addr
+			}
+			ip = addr
+		}
+		return ip
+	}
+}
+
+// MemoryLoginStore is a LoginStore keeping login attempts in memory.
+// Attempts of a key are forgotten TTL after its last attempt or lockout.
+type MemoryLoginStore struct {
+	// TTL defaults to 24 hours.
+	TTL time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*loginEntry
+	swept    time.Time
+}
+
+type loginEntry struct {
+	LoginAttempts
+	// updated is the time of the latest attempt.
+	updated time.Time
+}
+
+func NewMemoryLoginStore() *MemoryLoginStore {
+	return &MemoryLoginStore{
+		TTL:      24 * time.Hour,
+		attempts: make(map[string]*loginEntry),
+	}
+}
+
+func (s *MemoryLoginStore) Begin(_ context.Context, key string, limit int) (LoginAttempts, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	e, ok := s.attempts[key]
+	if !ok {
+		e = &loginEntry{}
+		s.attempts[key] = e
+	}
+	if now.Before(e.LockedUntil) || e.Pending >= max(limit-e.Failures, 1) {
+		return e.LoginAttempts, false, nil
+	}
+	e.Pending++
+	e.updated = now
+	return e.LoginAttempts, true, nil
+}
+
+func (s *MemoryLoginStore) End(_ context.Context, key string, failed bool, lockout func(int) time.Duration) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.attempts[key]
+	if !ok {
+		// reset while the attempt was in progress
+		e = &loginEntry{}
+		s.attempts[key] = e
+	}
+	e.Pending = max(e.Pending-1, 0)
+	e.updated = time.Now()
+	if failed {
+		e.Failures++
+		if d := lockout(e.Failures); d > 0 {
+			e.LockedUntil = e.updated.Add(d)
+		}
+	}
+	return e.LoginAttempts, nil
+}
+
+func (s *MemoryLoginStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep forgets the expired keys at most once a minute, or once per TTL if
+// it is shorter. It is called with s.mu held.
+func (s *MemoryLoginStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < min(s.TTL, time.Minute) {
+		return
+	}
+	s.swept = now
+	for key, e := range s.attempts {
+		if e.Pending == 0 && now.Sub(e.updated) > s.TTL && now.Sub(e.LockedUntil) > s.TTL {
+			delete(s.attempts, key)
+		}
+	}
+}
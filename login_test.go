@@ -0,0 +1,201 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	throttle := restflex.NewLoginThrottle(logger, restflex.NewMemoryLoginStore())
+	throttle.MaxAccountFailures = 2
+	throttle.MaxClientFailures = 4
+	throttle.Account = func(r *http.Request) string {
+		return r.URL.Query().Get("user")
+	}
+	h := throttle.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	resttest.Get("/login").WithQuery("user", "alice").WithQuery("password", "wrong").To(h).Expect(t).Status(http.StatusUnauthorized)
+	resttest.Get("/login").WithQuery("user", "alice").WithQuery("password", "secret").To(h).Expect(t).Status(http.StatusNoContent)
+	for range 2 {
+		resttest.Get("/login").WithQuery("user", "alice").WithQuery("password", "wrong").To(h).Expect(t).Status(http.StatusUnauthorized)
+	}
+	resttest.Get("/login").WithQuery("user", "alice").WithQuery("password", "secret").To(h).Expect(t).
+		Status(http.StatusLocked).
+		Header("Retry-After", "30").
+		Error("account temporarily locked")
+
+	resttest.Get("/login").WithQuery("user", "bob").WithQuery("password", "wrong").To(h).Expect(t).Status(http.StatusUnauthorized)
+	resttest.Get("/login").WithQuery("user", "carol").To(h).Expect(t).
+		Status(http.StatusTooManyRequests).
+		Error("too many failed login attempts")
+	logger.ExpectCount(t, "login locked", 2)
+}
+
+func TestLoginThrottle_fingerprint(t *testing.T) {
+	t.Parallel()
+	throttle := restflex.NewLoginThrottle(resttest.NewLogger(), restflex.NewMemoryLoginStore())
+	throttle.MaxClientFailures = 3
+	throttle.MaxDeviceFailures = 2
+	throttle.Fingerprint = func(r *http.Request) string {
+		return r.Header.Get("X-Device")
+	}
+	h := throttle.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	for range 2 {
+		resttest.Get("/login").WithHeader("X-Device", "a").To(h).Expect(t).Status(http.StatusUnauthorized)
+	}
+	resttest.Get("/login").WithHeader("X-Device", "a").To(h).Expect(t).Status(http.StatusTooManyRequests)
+	resttest.Get("/login").WithHeader("X-Device", "b").To(h).Expect(t).Status(http.StatusUnauthorized)
+	resttest.Get("/login").WithHeader("X-Device", "c").To(h).Expect(t).
+		Status(http.StatusTooManyRequests).
+		Error("too many failed login attempts")
+}
+
+func TestLoginThrottle_parallel(t *testing.T) {
+	t.Parallel()
+	throttle := restflex.NewLoginThrottle(resttest.NewLogger(), restflex.NewMemoryLoginStore())
+	throttle.MaxAccountFailures = 2
+	throttle.Account = func(r *http.Request) string {
+		return "alice"
+	}
+	release := make(chan struct{})
+	h := throttle.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	const n = 6
+	statuses := make(chan int, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+			statuses <- rec.Code
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(statuses)
+	var failed int
+	for status := range statuses {
+		if status == http.StatusUnauthorized {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("expected 2 attempts to reach the handler, but got %d", failed)
+	}
+}
+
+func TestMemoryLoginStore_expiry(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := restflex.NewMemoryLoginStore()
+	store.TTL = 10 * time.Millisecond
+	if _, started, err := store.Begin(ctx, "client:a", 5); err != nil || !started {
+		t.Fatalf("expected attempt to start, got %v, %v", started, err)
+	}
+	if a, err := store.End(ctx, "client:a", true, func(int) time.Duration { return 0 }); err != nil || a.Failures != 1 {
+		t.Fatalf("expected 1 failure, got %+v, %v", a, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, _, err := store.Begin(ctx, "client:b", 5); err != nil {
+		t.Fatal(err)
+	}
+	if a, _, _ := store.Begin(ctx, "client:a", 5); a.Failures != 0 {
+		t.Errorf("expected failures to expire, got %+v", a)
+	}
+}
+
+func TestLoginThrottle_panic(t *testing.T) {
+	t.Parallel()
+	store := restflex.NewMemoryLoginStore()
+	throttle := &restflex.LoginThrottle{Store: store, MaxClientFailures: 1, Lockout: time.Minute, MaxLockout: time.Hour, Log: resttest.NewLogger()}
+	h := throttle.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	for range 3 {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected the panic to be propagated")
+				}
+			}()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/panic", nil))
+		}()
+	}
+	resttest.Post("/login").To(h).Expect(t).Status(http.StatusUnauthorized)
+	resttest.Post("/login").To(h).Expect(t).Status(http.StatusTooManyRequests)
+}
+
+func TestLoginThrottle_proxy(t *testing.T) {
+	t.Parallel()
+	throttle := restflex.NewLoginThrottle(resttest.NewLogger(), restflex.NewMemoryLoginStore())
+	throttle.MaxClientFailures = 1
+	throttle.ClientIP = restflex.ForwardedClientIP(netip.MustParsePrefix("192.0.2.0/24"))
+	h := throttle.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	resttest.Post("/login").WithHeader("X-Forwarded-For", "198.51.100.1").To(h).Expect(t).Status(http.StatusUnauthorized)
+	resttest.Post("/login").WithHeader("X-Forwarded-For", "198.51.100.1").To(h).Expect(t).Status(http.StatusTooManyRequests)
+	resttest.Post("/login").WithHeader("X-Forwarded-For", "198.51.100.2").To(h).Expect(t).Status(http.StatusUnauthorized)
+}
+
+func TestForwardedClientIP(t *testing.T) {
+	t.Parallel()
+	clientIP := restflex.ForwardedClientIP(netip.MustParsePrefix("10.0.0.0/8"))
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "198.51.100.1:1234", want: "198.51.100.1"},
+		{name: "untrusted proxy", remoteAddr: "198.51.100.1:1234", forwarded: []string{"203.0.113.1"}, want: "198.51.100.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwarded: []string{"203.0.113.1"}, want: "203.0.113.1"},
+		{name: "forged", remoteAddr: "10.0.0.1:1234", forwarded: []string{"1.2.3.4, 203.0.113.1"}, want: "203.0.113.1"},
+		{name: "proxy chain", remoteAddr: "10.0.0.1:1234", forwarded: []string{"203.0.113.1", "10.0.0.2"}, want: "203.0.113.1"},
+		{name: "no header", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodPost, "/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("expected %q, but got %q", tt.want, got)
+			}
+		})
+	}
+}
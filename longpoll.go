@@ -0,0 +1,90 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChangeTokenHeader is the response header carrying the change token a
+// long-polling client passes to its next poll.
+const ChangeTokenHeader = "X-Change-Token"
+
+// LongPoll serves a long-poll request. It calls wait with a context which
+// is done after timeout and responds with 200 OK and the data returned by
+// wait, or 204 No Content if the timeout expires or the client goes away
+// first. The change token returned by wait, or token on timeout, is set in
+// the X-Change-Token header for the next poll. Other errors from wait are
+// returned for the handler to return.
+func LongPoll(ctx context.Context, w http.ResponseWriter, token string, timeout time.Duration, wait func(ctx context.Context) (next string, data any, err error)) error {
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	next, data, err := wait(pollCtx)
+	if err != nil {
+		if pollCtx.Err() != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) {
+			w.Header().Set(ChangeTokenHeader, token)
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		return err
+	}
+	w.Header().Set(ChangeTokenHeader, next)
+	w.Header().Set("Cache-Control", "no-store")
+	return WriteJSON(w, http.StatusOK, data)
+}
+
+// Changes notifies long-polling waiters of changes. Its tokens are version
+// numbers increased by every change.
+type Changes struct {
+	mu      sync.Mutex
+	version uint64
+	changed chan struct{}
+}
+
+func NewChanges() *Changes {
+	return &Changes{
+		changed: make(chan struct{}),
+	}
+}
+
+// Token returns the token of the current version.
+func (c *Changes) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strconv.FormatUint(c.version, 10)
+}
+
+// Notify records a change and wakes up waiters.
+func (c *Changes) Notify() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Wait returns the token of the current version once it differs from
+// token, or the error of ctx if it is done first. An empty token waits for
+// the next change.
+func (c *Changes) Wait(ctx context.Context, token string) (string, error) {
+	for {
+		c.mu.Lock()
+		current, changed := strconv.FormatUint(c.version, 10), c.changed
+		c.mu.Unlock()
+		if token != "" && current != token {
+			return current, nil
+		}
+		if token == "" {
+			token = current
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestLongPoll(t *testing.T) {
+	t.Parallel()
+	changes := restflex.NewChanges()
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		token := r.URL.Query().Get("token")
+		return restflex.LongPoll(ctx, w, token, 50*time.Millisecond, func(ctx context.Context) (string, any, error) {
+			next, err := changes.Wait(ctx, token)
+			return next, map[string]string{"version": next}, err
+		})
+	}))
+
+	resttest.Get("/events").WithQuery("token", "0").To(api).Expect(t).
+		Status(http.StatusNoContent).
+		Header(restflex.ChangeTokenHeader, "0")
+
+	changes.Notify()
+	resttest.Get("/events").WithQuery("token", "0").To(api).Expect(t).
+		Status(http.StatusOK).
+		Header(restflex.ChangeTokenHeader, "1").
+		JSONPath("$.version", "1")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		changes.Notify()
+	}()
+	resttest.Get("/events").WithQuery("token", "1").To(api).Expect(t).
+		Status(http.StatusOK).
+		Header(restflex.ChangeTokenHeader, "2")
+}
@@ -0,0 +1,39 @@
+package restflex
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"kkn.fi/infra"
+)
+
+// DefaultMethods are the methods allowed by Server unless Methods is set.
+// TRACE and CONNECT are rejected.
+var DefaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// AllowMethods returns a middleware rejecting requests with other methods
+// with 405 Method Not Allowed and an Allow header listing the methods.
+func AllowMethods(l infra.Logger, methods ...string) Middleware {
+	allowed := slices.Clone(methods)
+	allow := []string{strings.Join(allowed, ", ")}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(allowed, r.Method) {
+				w.Header()["Allow"] = allow
+				status := http.StatusMethodNotAllowed
+				writeError(l, w, status, http.StatusText(status))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
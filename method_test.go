@@ -0,0 +1,62 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestAllowMethods(t *testing.T) {
+	t.Parallel()
+	h := restflex.AllowMethods(resttest.NewLogger(), http.MethodGet, http.MethodPost)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	resttest.Get("/").To(h).Expect(t).Status(http.StatusNoContent)
+	resttest.Delete("/").To(h).Expect(t).
+		Status(http.StatusMethodNotAllowed).
+		Header("Allow", "GET, POST").
+		Error(http.StatusText(http.StatusMethodNotAllowed))
+}
+
+func TestServer_Methods_default(t *testing.T) {
+	t.Parallel()
+	srv := restflex.NewServer(resttest.NewLogger(), "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = srv.RunListener(ctx, ln)
+	}()
+	for method, want := range map[string]int{
+		http.MethodGet:   http.StatusNoContent,
+		http.MethodTrace: http.StatusMethodNotAllowed,
+	} {
+		req, err := http.NewRequest(method, "http://"+ln.Addr().String(), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Errorf("%v: expected status code %d, but got %d", method, want, res.StatusCode)
+		}
+		if want == http.StatusMethodNotAllowed && strings.Contains(res.Header.Get("Allow"), http.MethodTrace) {
+			t.Errorf("expected TRACE not to be allowed, got %q", res.Header.Get("Allow"))
+		}
+	}
+}
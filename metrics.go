@@ -0,0 +1,308 @@
+package restflex
+
+import (
+	"expvar"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics publishes request counters via expvar under a single map named by
+// its prefix:
+//
+//	requests        responses by status class, e.g. {"2xx": 10, "5xx": 1}
+//	routes          responses by route pattern and status class, e.g.
+//	                {"GET /users/{id}": {"2xx": 10}, "unmatched": {"4xx": 1}}
+//	in_flight       requests being served
+//	last_error      time of the latest 5xx response in RFC 3339 format
+//	request_bytes   request body sizes by route pattern as histograms, e.g.
+//	                {"POST /users": {"1024": 10, "8192": 2, "sum": 14000}}
+//	response_bytes  response body sizes by route pattern as histograms
+//	slo             good and bad requests of routes with an SLO and its
+//	                objective, e.g.
+//	                {"GET /users/{id}": {"good": 999, "bad": 1, "objective": 0.999}}
+//	denials         requests rejected for security reasons by denial
+//	                reason, e.g. {"unauthenticated": 3, "replayed": 1}
+//
+// The histograms count the bodies of each size bucket, keyed by its upper
+// bound in bytes or "+Inf", and the total size in "sum". Unlike Prometheus
+// buckets the counts are not cumulative. Request bodies of unknown length
+// are measured by the bytes the handler reads.
+//
+// Routes are labelled by the pattern the request matched, such as
+// "GET /users/{id}", instead of the path so that path parameters do not grow
+// the number of routes. Requests served outside an http.ServeMux route are
+// counted as "unmatched".
+type Metrics struct {
+	requests      *expvar.Map
+	routes        *expvar.Map
+	byRoute       sync.Map // route pattern -> *expvar.Map
+	requestBytes  *expvar.Map
+	responseBytes *expvar.Map
+	bySize        sync.Map // route pattern -> *routeSizes
+	slos          *expvar.Map
+	bySLO         sync.Map // route pattern -> *expvar.Map
+	inFlight      *expvar.Int
+	lastError     atomic.Int64
+	denials       *expvar.Map
+}
+
+// UnmatchedRoute is the route of requests without a route pattern.
+const UnmatchedRoute = "unmatched"
+
+// statusClasses are the expvar keys of status classes 1xx-5xx.
+var statusClasses = [...]string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// NewMetrics creates and publishes Metrics named prefix. Like expvar.Publish
+// it panics if the name is already in use.
+func NewMetrics(prefix string) *Metrics {
+	m := &Metrics{
+		requests: new(expvar.Map),
+		routes:   new(expvar.Map),
+		inFlight: new(expvar.Int),
+		denials:  new(expvar.Map),
+
+		requestBytes:  new(expvar.Map),
+		responseBytes: new(expvar.Map),
+		slos:          new(expvar.Map),
+	}
+	for _, class := range statusClasses {
+		m.requests.Add(class, 0)
+	}
+	vars := expvar.NewMap(prefix)
+	vars.Set("requests", m.requests)
+	vars.Set("routes", m.routes)
+	vars.Set("in_flight", m.inFlight)
+	vars.Set("request_bytes", m.requestBytes)
+	vars.Set("response_bytes", m.responseBytes)
+	vars.Set("slo", m.slos)
+	vars.Set("denials", m.denials)
+	vars.Set("last_error", expvar.Func(func() any {
+		t := m.LastError()
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339Nano)
+	}))
+	return m
+}
+
+// WithMetrics counts the requests served by the handler in m.
+func WithMetrics(m *Metrics) Option {
+	return func(h *handler) {
+		h.Metrics = m
+	}
+}
+
+// Requests returns the number of responses with status class, e.g. "5xx".
+func (m *Metrics) Requests(class string) int64 {
+	if v, ok := m.requests.Get(class).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// RouteRequests returns the number of responses of route with status class.
+func (m *Metrics) RouteRequests(route, class string) int64 {
+	if counters, ok := m.byRoute.Load(route); ok {
+		if v, ok := counters.(*expvar.Map).Get(class).(*expvar.Int); ok {
+			return v.Value()
+		}
+	}
+	return 0
+}
+
+// InFlight returns the number of requests being served.
+func (m *Metrics) InFlight() int64 {
+	return m.inFlight.Value()
+}
+
+// RequestSizes returns the request body size histogram of route.
+func (m *Metrics) RequestSizes(route string) map[string]int64 {
+	if sizes, ok := m.bySize.Load(route); ok {
+		return histogram(sizes.(*routeSizes).request)
+	}
+	return nil
+}
+
+// ResponseSizes returns the response body size histogram of route.
+func (m *Metrics) ResponseSizes(route string) map[string]int64 {
+	if sizes, ok := m.bySize.Load(route); ok {
+		return histogram(sizes.(*routeSizes).response)
+	}
+	return nil
+}
+
+func histogram(m *expvar.Map) map[string]int64 {
+	counts := make(map[string]int64)
+	m.Do(func(kv expvar.KeyValue) {
+		counts[kv.Key] = kv.Value.(*expvar.Int).Value()
+	})
+	return counts
+}
+
+// SLORequests returns the number of good and bad requests of route.
+func (m *Metrics) SLORequests(route string) (good, bad int64) {
+	if counters, ok := m.bySLO.Load(route); ok {
+		good, _ := counters.(*expvar.Map).Get("good").(*expvar.Int)
+		bad, _ := counters.(*expvar.Map).Get("bad").(*expvar.Int)
+		return good.Value(), bad.Value()
+	}
+	return 0, 0
+}
+
+// Denials returns the number of requests rejected for reason.
+func (m *Metrics) Denials(reason DenialReason) int64 {
+	if v, ok := m.denials.Get(string(reason)).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// LastError returns the time of the latest 5xx response or the zero time.
+func (m *Metrics) LastError() time.Time {
+	n := m.lastError.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func (m *Metrics) start() {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(1)
+}
+
+// end balances start. It is deferred so that panicking requests are not
+// left in flight.
+func (m *Metrics) end() {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(-1)
+}
+
+func (m *Metrics) done(route string, status int) {
+	if m == nil {
+		return
+	}
+	if i := status/100 - 1; i >= 0 && i < len(statusClasses) {
+		m.requests.Add(statusClasses[i], 1)
+		m.route(route).Add(statusClasses[i], 1)
+	}
+	if status >= 500 {
+		m.lastError.Store(time.Now().UnixNano())
+	}
+}
+
+// route returns the counters of route, creating them on first use.
+func (m *Metrics) route(route string) *expvar.Map {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	if counters, ok := m.byRoute.Load(route); ok {
+		return counters.(*expvar.Map)
+	}
+	counters, loaded := m.byRoute.LoadOrStore(route, new(expvar.Map))
+	if !loaded {
+		m.routes.Set(route, counters.(*expvar.Map))
+	}
+	return counters.(*expvar.Map)
+}
+
+func (m *Metrics) denied(reason DenialReason) {
+	if m == nil {
+		return
+	}
+	m.denials.Add(string(reason), 1)
+}
+
+// sizeBuckets are the upper bounds of the body size histogram buckets.
+var sizeBuckets = [...]int64{1 << 10, 8 << 10, 64 << 10, 512 << 10, 4 << 20}
+
+// sizeBucketKeys are the expvar keys of sizeBuckets followed by the key of
+// larger sizes.
+var sizeBucketKeys = [...]string{"1024", "8192", "65536", "524288", "4194304", "+Inf"}
+
+// routeSizes holds the body size histograms of a route.
+type routeSizes struct {
+	request  *expvar.Map
+	response *expvar.Map
+}
+
+// observeSizes records the request and response body sizes of route.
+func (m *Metrics) observeSizes(route string, request, response int64) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	sizes, ok := m.bySize.Load(route)
+	if !ok {
+		var loaded bool
+		sizes, loaded = m.bySize.LoadOrStore(route, &routeSizes{
+			request:  new(expvar.Map),
+			response: new(expvar.Map),
+		})
+		if !loaded {
+			m.requestBytes.Set(route, sizes.(*routeSizes).request)
+			m.responseBytes.Set(route, sizes.(*routeSizes).response)
+		}
+	}
+	observeSize(sizes.(*routeSizes).request, request)
+	observeSize(sizes.(*routeSizes).response, response)
+}
+
+func observeSize(histogram *expvar.Map, size int64) {
+	i := 0
+	for i < len(sizeBuckets) && size > sizeBuckets[i] {
+		i++
+	}
+	histogram.Add(sizeBucketKeys[i], 1)
+	histogram.Add("sum", size)
+}
+
+// countingBody counts the bytes read from a request body of unknown length.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// observeSLO counts a request of route with status served in elapsed time
+// as good or bad by slo.
+func (m *Metrics) observeSLO(route string, slo *SLO, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	counters, ok := m.bySLO.Load(route)
+	if !ok {
+		c := new(expvar.Map)
+		c.Add("good", 0)
+		c.Add("bad", 0)
+		objective := new(expvar.Float)
+		objective.Set(slo.Objective)
+		c.Set("objective", objective)
+		var loaded bool
+		if counters, loaded = m.bySLO.LoadOrStore(route, c); !loaded {
+			m.slos.Set(route, c)
+		}
+	}
+	if slo.good(status, elapsed) {
+		counters.(*expvar.Map).Add("good", 1)
+	} else {
+		counters.(*expvar.Map).Add("bad", 1)
+	}
+}
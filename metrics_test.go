@@ -0,0 +1,159 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	name := uniqueVarName(t)
+	metrics := restflex.NewMetrics(name)
+	var inFlight int64
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		inFlight = metrics.InFlight()
+		switch r.URL.Path {
+		case "/missing":
+			return restflex.ErrNotFound
+		case "/broken":
+			return restflex.ErrInternal
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), restflex.WithMetrics(metrics))
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusNoContent)
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusNoContent)
+	resttest.Get("/missing").To(api).Expect(t).Status(http.StatusNotFound)
+	resttest.Get("/broken").To(api).Expect(t).Status(http.StatusInternalServerError)
+
+	for class, want := range map[string]int64{"2xx": 2, "4xx": 1, "5xx": 1} {
+		if got := metrics.Requests(class); got != want {
+			t.Errorf("expected %d %v responses, but got %d", want, class, got)
+		}
+	}
+	if inFlight != 1 {
+		t.Errorf("expected 1 request in flight while serving, but got %d", inFlight)
+	}
+	if n := metrics.InFlight(); n != 0 {
+		t.Errorf("expected no requests in flight, but got %d", n)
+	}
+	if metrics.LastError().IsZero() {
+		t.Error("expected last error time to be set")
+	}
+
+	var published struct {
+		Requests  map[string]int64 `json:"requests"`
+		LastError string           `json:"last_error"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.Requests["5xx"] != 1 || published.LastError == "" {
+		t.Errorf("unexpected published metrics: %+v", published)
+	}
+}
+
+func TestMetrics_panic(t *testing.T) {
+	t.Parallel()
+	metrics := restflex.NewMetrics(uniqueVarName(t))
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		panic("boom")
+	}), restflex.WithMetrics(metrics))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to be propagated")
+			}
+		}()
+		api.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if n := metrics.InFlight(); n != 0 {
+		t.Errorf("expected no requests in flight after a panic, but got %d", n)
+	}
+}
+
+func TestMetricsRoutes(t *testing.T) {
+	t.Parallel()
+	name := uniqueVarName(t)
+	metrics := restflex.NewMetrics(name)
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), restflex.WithMetrics(metrics))
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{id}", api)
+	for _, path := range []string{"/users/1", "/users/2", "/users/3"} {
+		resttest.Get(path).To(mux).Expect(t).Status(http.StatusNoContent)
+	}
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusNoContent)
+
+	if n := metrics.RouteRequests("GET /users/{id}", "2xx"); n != 3 {
+		t.Errorf("expected 3 responses of the route pattern, but got %d", n)
+	}
+	if n := metrics.RouteRequests("/users/1", "2xx"); n != 0 {
+		t.Errorf("expected no responses labelled by path, but got %d", n)
+	}
+	if n := metrics.RouteRequests(restflex.UnmatchedRoute, "2xx"); n != 1 {
+		t.Errorf("expected 1 unmatched response, but got %d", n)
+	}
+	var published struct {
+		Routes map[string]map[string]int64 `json:"routes"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if len(published.Routes) != 2 {
+		t.Errorf("expected 2 published routes, but got %v", published.Routes)
+	}
+}
+
+func TestMetricsSizes(t *testing.T) {
+	t.Parallel()
+	metrics := restflex.NewMetrics(uniqueVarName(t))
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return restflex.WriteJSON(w, http.StatusOK, strings.Repeat("x", 10*len(b)))
+	}), restflex.WithMetrics(metrics))
+	mux := http.NewServeMux()
+	mux.Handle("POST /echo", api)
+	resttest.Post("/echo").WithBody("application/json", []byte(`"small"`)).To(mux).Expect(t).Status(http.StatusOK)
+	resttest.Post("/echo").WithBody("application/json", bytes.Repeat([]byte("x"), 2000)).To(mux).Expect(t).Status(http.StatusOK)
+
+	requests := metrics.RequestSizes("POST /echo")
+	if requests["1024"] != 1 || requests["8192"] != 1 || requests["sum"] != 2007 {
+		t.Errorf("unexpected request size histogram: %v", requests)
+	}
+	responses := metrics.ResponseSizes("POST /echo")
+	if responses["1024"] != 1 || responses["65536"] != 1 {
+		t.Errorf("unexpected response size histogram: %v", responses)
+	}
+	if sizes := metrics.RequestSizes(restflex.UnmatchedRoute); sizes != nil {
+		t.Errorf("expected no sizes of unmatched requests, but got %v", sizes)
+	}
+}
+
+var varNames atomic.Int64
+
+// uniqueVarName returns an expvar name not used by earlier runs of the test
+// with -count.
+func uniqueVarName(t *testing.T) string {
+	return fmt.Sprintf("%v_%d", t.Name(), varNames.Add(1))
+}
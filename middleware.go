@@ -0,0 +1,7 @@
+package restflex
+
+import "net/http"
+
+// Middleware wraps an http.Handler with additional behaviour. Configurable
+// middlewares in this package expose a Wrap method satisfying this type.
+type Middleware func(http.Handler) http.Handler
@@ -0,0 +1,130 @@
+package restflex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MiddlewareSpan is the execution of a traced middleware in a request.
+type MiddlewareSpan struct {
+	Name  string
+	Start time.Time
+	// Duration is the time from entering the middleware to it returning.
+	Duration time.Duration
+	// Self is Duration minus the time spent in the handlers it wraps.
+	Self time.Duration
+}
+
+type middlewareTrace struct {
+	mu    sync.Mutex
+	spans []*MiddlewareSpan
+}
+
+type middlewareTraceContextKey struct{}
+
+// tracedContextKey identifies the span of a Traced middleware in the request
+// context.
+type tracedContextKey struct {
+	_ byte
+}
+
+// TraceMiddlewares returns a middleware recording the execution of the
+// middlewares wrapped with Traced inside it, for requests for which enabled
+// returns true, such as ones carrying a debug header. Each middleware is
+// reported with its own duration in a Server-Timing trailer, and the spans
+// are available to the handler and tracing with MiddlewareSpans.
+func TraceMiddlewares(enabled func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			trace := &middlewareTrace{}
+			DeclareTrailers(w, "Server-Timing")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middlewareTraceContextKey{}, trace)))
+			SetTrailer(w, "Server-Timing", trace.serverTiming())
+		})
+	}
+}
+
+// Traced wraps mw so that its execution is recorded under name by
+// TraceMiddlewares.
+func Traced(name string, mw Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		key := &tracedContextKey{}
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span, _ := r.Context().Value(key).(*MiddlewareSpan)
+			if span == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			trace := r.Context().Value(middlewareTraceContextKey{}).(*middlewareTrace)
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			trace.mu.Lock()
+			span.Self -= time.Since(start)
+			trace.mu.Unlock()
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace, _ := r.Context().Value(middlewareTraceContextKey{}).(*middlewareTrace)
+			if trace == nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+			span := &MiddlewareSpan{Name: name, Start: time.Now()}
+			trace.mu.Lock()
+			trace.spans = append(trace.spans, span)
+			trace.mu.Unlock()
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key, span)))
+			trace.mu.Lock()
+			span.Duration = time.Since(span.Start)
+			span.Self += span.Duration
+			trace.mu.Unlock()
+		})
+	}
+}
+
+// MiddlewareSpans returns the spans of the traced middlewares of the
+// request in the order they were entered. Middlewares which have not
+// returned yet have a zero Duration.
+func MiddlewareSpans(ctx context.Context) []MiddlewareSpan {
+	trace, _ := ctx.Value(middlewareTraceContextKey{}).(*middlewareTrace)
+	if trace == nil {
+		return nil
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	spans := make([]MiddlewareSpan, len(trace.spans))
+	for i, s := range trace.spans {
+		spans[i] = *s
+	}
+	return spans
+}
+
+// serverTiming returns the Server-Timing value of the self durations of
+// the spans in milliseconds.
+func (t *middlewareTrace) serverTiming() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	metrics := make([]string, len(t.spans))
+	for i, s := range t.spans {
+		metrics[i] = fmt.Sprintf("%d-%s;dur=%.3f", i, serverTimingToken(s.Name), float64(s.Self)/float64(time.Millisecond))
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// serverTimingToken replaces characters not allowed in a Server-Timing
+// metric name.
+func serverTimingToken(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
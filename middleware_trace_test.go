@@ -0,0 +1,58 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+)
+
+func TestTraced(t *testing.T) {
+	t.Parallel()
+	sleep := func(d time.Duration) restflex.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(d)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	var ctx context.Context
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h = restflex.Traced("inner", sleep(20*time.Millisecond))(h)
+	h = restflex.Traced("outer auth", sleep(time.Millisecond))(h)
+	h = restflex.TraceMiddlewares(func(r *http.Request) bool {
+		return r.Header.Get("X-Debug") != ""
+	})(h)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Debug", "1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	spans := restflex.MiddlewareSpans(ctx)
+	if len(spans) != 2 || spans[0].Name != "outer auth" || spans[1].Name != "inner" {
+		t.Fatalf("expected spans of outer and inner, got %+v", spans)
+	}
+	if spans[1].Self < 20*time.Millisecond || spans[0].Self >= 20*time.Millisecond || spans[0].Duration < spans[1].Duration {
+		t.Errorf("unexpected durations %+v", spans)
+	}
+	timing := rec.Result().Trailer.Get("Server-Timing")
+	if !regexp.MustCompile(`^0-outer_auth;dur=[0-9.]+, 1-inner;dur=[0-9.]+$`).MatchString(timing) {
+		t.Errorf("unexpected Server-Timing trailer %q", timing)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if spans := restflex.MiddlewareSpans(ctx); spans != nil || rec.Result().Trailer.Get("Server-Timing") != "" {
+		t.Errorf("expected tracing to be disabled, got %+v", spans)
+	}
+}
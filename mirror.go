@@ -0,0 +1,180 @@
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// MirrorHeader marks the requests sent to a shadow target.
+const MirrorHeader = "X-Mirrored-Request"
+
+// Mirror copies a sample of requests, bodies included, to a shadow target
+// such as a new implementation under test. The body is copied as the
+// primary handler reads it, and the copy is sent in the background after
+// the handler has returned. Responses of the shadow target are discarded,
+// so the primary response is never affected: requests are not mirrored
+// when their bodies exceed MaxBodyBytes or are not read to the end by the
+// handler, or Concurrency copies are already in flight.
+type Mirror struct {
+	Target *url.URL
+	// Client sends the copies. Defaults to a client with a 10 second
+	// timeout.
+	Client *http.Client
+	// Percent is the percentage of requests mirrored.
+	Percent float64
+	// MaxBodyBytes is the largest body mirrored. Defaults to 1 MiB.
+	MaxBodyBytes int64
+	// Concurrency limits the copies in flight. Defaults to 16.
+	Concurrency int
+	// RedactHeaders are removed from the copies. Names ending with "*"
+	// match the headers starting with the rest of the name. Defaults to the
+	// credential headers Authorization, Cookie, Proxy-Authorization and
+	// X-Api-Key and the request signature headers X-Signature*.
+	RedactHeaders []string
+	// Redact, if set, returns the body sent to the shadow target, such as
+	// the body with personal data masked.
+	Redact func(r *http.Request, body []byte) []byte
+	Log    infra.Logger
+
+	inflight atomic.Int64
+	dropped  atomic.Uint64
+}
+
+func NewMirror(l infra.Logger, target *url.URL, percent float64) *Mirror {
+	return &Mirror{
+		Target:        target,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		Percent:       percent,
+		MaxBodyBytes:  1 << 20,
+		Concurrency:   16,
+		RedactHeaders: []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key", SignatureHeader + "*"},
+		Log:           l,
+	}
+}
+
+// Dropped returns the number of sampled requests not mirrored because the
+// copies in flight were at the limit or the body was too large or not read
+// to the end.
+func (m *Mirror) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+func (m *Mirror) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(MirrorHeader) != "" || !chance(m.Percent) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// the copy is made before the handler may modify the request
+		req, err := m.copyRequest(r)
+		if err != nil {
+			m.Log.Printf("restflex: mirror %v %v: %v", r.Method, r.URL.Path, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		var tee *teeBody
+		if r.Body != nil && r.Body != http.NoBody {
+			tee = &teeBody{ReadCloser: r.Body, limit: m.MaxBodyBytes}
+			r.Body = tee
+		}
+		next.ServeHTTP(w, r)
+		if tee != nil {
+			if !tee.eof || tee.buf.Len() > int(m.MaxBodyBytes) {
+				m.dropped.Add(1)
+				return
+			}
+			body := tee.buf.Bytes()
+			if m.Redact != nil {
+				body = m.Redact(r, body)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+		if m.inflight.Add(1) > int64(max(m.Concurrency, 1)) {
+			m.inflight.Add(-1)
+			m.dropped.Add(1)
+			return
+		}
+		go func() {
+			defer m.inflight.Add(-1)
+			m.send(req)
+		}()
+	})
+}
+
+// copyRequest returns the copy of r sent to the shadow target, without its
+// body.
+func (m *Mirror) copyRequest(r *http.Request) (*http.Request, error) {
+	u := *m.Target
+	u.Path = strings.TrimSuffix(m.Target.Path, "/") + "/" + strings.TrimPrefix(r.URL.Path, "/")
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range m.RedactHeaders {
+		prefix, ok := strings.CutSuffix(h, "*")
+		if !ok {
+			req.Header.Del(h)
+			continue
+		}
+		prefix = http.CanonicalHeaderKey(prefix)
+		for name := range req.Header {
+			if strings.HasPrefix(name, prefix) {
+				delete(req.Header, name)
+			}
+		}
+	}
+	req.Header.Set(MirrorHeader, "1")
+	req.Host = r.Host
+	return req, nil
+}
+
+func (m *Mirror) send(req *http.Request) {
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		m.Log.Printf("restflex: mirror %v %v: %v", req.Method, req.URL, err)
+		return
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// teeBody copies up to limit+1 bytes of the body read by the handler, so
+// that a body over the limit is detected without buffering it.
+type teeBody struct {
+	io.ReadCloser
+	limit int64
+	buf   bytes.Buffer
+	eof   bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit + 1 - int64(b.buf.Len()); room > 0 {
+		b.buf.Write(p[:min(int64(n), room)])
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
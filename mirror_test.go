@@ -0,0 +1,98 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type mirroredRequest struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+func TestMirror(t *testing.T) {
+	t.Parallel()
+	mirrored := make(chan mirroredRequest, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mirrored <- mirroredRequest{path: r.URL.RequestURI(), header: r.Header, body: string(b)}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+	target, _ := url.Parse(shadow.URL + "/shadow")
+	m := restflex.NewMirror(resttest.NewLogger(), target, 100)
+	m.Redact = func(r *http.Request, body []byte) []byte {
+		return bytes.ReplaceAll(body, []byte("4111"), []byte("****"))
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(b)
+	}))
+
+	res := resttest.Post("/payments").WithQuery("v", "2").
+		WithHeader("Authorization", "Bearer secret").
+		WithHeader("X-Api-Key", "key").
+		WithHeader(restflex.SignatureNonceHeader, "n1").
+		WithBody("application/json", []byte(`{"card":"4111"}`)).
+		To(h).Expect(t).Status(http.StatusCreated)
+	if string(res.Body) != `{"card":"4111"}` {
+		t.Errorf("primary handler read body %s", res.Body)
+	}
+	select {
+	case got := <-mirrored:
+		if got.path != "/shadow/payments?v=2" || got.body != `{"card":"****"}` {
+			t.Errorf("mirrored %+v", got)
+		}
+		if got.header.Get("Authorization") != "" || got.header.Get("X-Api-Key") != "" || got.header.Get(restflex.SignatureNonceHeader) != "" || got.header.Get(restflex.MirrorHeader) != "1" {
+			t.Errorf("mirrored headers %v", got.header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
+
+func TestMirror_skipped(t *testing.T) {
+	t.Parallel()
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected mirrored request %v", r.URL)
+	}))
+	defer shadow.Close()
+	target, _ := url.Parse(shadow.URL)
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+
+	unsampled := restflex.NewMirror(resttest.NewLogger(), target, 0)
+	resttest.Get("/").To(unsampled.Wrap(echo)).Expect(t).Status(http.StatusOK)
+
+	large := restflex.NewMirror(resttest.NewLogger(), target, 100)
+	large.MaxBodyBytes = 4
+	res := resttest.Post("/").WithBody("application/json", []byte(`"too large"`)).To(large.Wrap(echo)).Expect(t).
+		Status(http.StatusOK)
+	if string(res.Body) != `"too large"` {
+		t.Errorf("primary handler read body %s", res.Body)
+	}
+	if large.Dropped() != 1 {
+		t.Errorf("expected 1 dropped request, got %d", large.Dropped())
+	}
+
+	unread := restflex.NewMirror(resttest.NewLogger(), target, 100)
+	resttest.Post("/").WithBody("application/json", []byte(`{}`)).To(unread.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))).Expect(t).Status(http.StatusAccepted)
+	if unread.Dropped() != 1 {
+		t.Errorf("expected a request with an unread body to be dropped, got %d", unread.Dropped())
+	}
+}
@@ -0,0 +1,66 @@
+package restflex
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"kkn.fi/infra"
+)
+
+// moduleRegistry holds the registered feature modules.
+var moduleRegistry = struct {
+	mu      sync.Mutex
+	modules map[string]RouteGroup
+}{
+	modules: make(map[string]RouteGroup),
+}
+
+// RegisterModule registers the routes of a feature module of a modular
+// monolith, so that modules register themselves in their init functions
+// and main only imports them:
+//
+//	func init() {
+//		restflex.RegisterModule(restflex.RouteGroup{Name: "billing", Routes: routes})
+//	}
+//
+// The Only and Except environments of the group apply when the modules are
+// mounted. RegisterModule panics if a module with the same name is already
+// registered or the group has no routes.
+func RegisterModule(g RouteGroup) {
+	if g.Routes == nil {
+		panic("restflex: RegisterModule " + g.Name + " without routes")
+	}
+	moduleRegistry.mu.Lock()
+	defer moduleRegistry.mu.Unlock()
+	if _, ok := moduleRegistry.modules[g.Name]; ok {
+		panic("restflex: RegisterModule called twice for module " + g.Name)
+	}
+	moduleRegistry.modules[g.Name] = g
+}
+
+// Modules returns the registered modules ordered by name.
+func Modules() []RouteGroup {
+	moduleRegistry.mu.Lock()
+	defer moduleRegistry.mu.Unlock()
+	modules := make([]RouteGroup, 0, len(moduleRegistry.modules))
+	for _, g := range moduleRegistry.modules {
+		modules = append(modules, g)
+	}
+	slices.SortFunc(modules, func(a, b RouteGroup) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return modules
+}
+
+// MountModules registers the routes of the registered modules enabled in
+// env on mux in the order of their names, logging the mounted modules.
+func (env Environment) MountModules(l infra.Logger, mux Router) {
+	modules := Modules()
+	env.Mount(l, mux, modules...)
+	for _, g := range modules {
+		if g.Enabled(env) {
+			l.Printf("restflex: mounted module %s", g.Name)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func init() {
+	restflex.RegisterModule(restflex.RouteGroup{Name: "module-test-billing", Routes: func(mux restflex.Router) {
+		mux.HandleFunc("GET /module-test/invoices", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}})
+	restflex.RegisterModule(restflex.RouteGroup{Name: "module-test-debug", Except: []restflex.Environment{restflex.Production}, Routes: func(mux restflex.Router) {
+		mux.HandleFunc("GET /module-test/debug", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}})
+}
+
+func TestMountModules(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	mux := http.NewServeMux()
+	restflex.Production.MountModules(logger, mux)
+
+	resttest.Get("/module-test/invoices").To(mux).Expect(t).Status(http.StatusOK)
+	resttest.Get("/module-test/debug").To(mux).Expect(t).Status(http.StatusNotFound)
+	logger.ExpectCount(t, "restflex: mounted module module-test-billing", 1)
+	logger.ExpectCount(t, "restflex: not mounting module-test-debug routes in production", 1)
+}
+
+func TestRegisterModule_duplicate(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected RegisterModule to panic")
+		}
+	}()
+	restflex.RegisterModule(restflex.RouteGroup{Name: "module-test-billing", Routes: func(restflex.Router) {}})
+}
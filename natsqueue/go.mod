@@ -0,0 +1,22 @@
+module kkn.fi/restflex/natsqueue
+
+go 1.23.0
+
+require (
+	github.com/nats-io/nats.go v1.48.0
+	kkn.fi/restflex v0.0.0
+)
+
+require (
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
+	kkn.fi/httpx v0.2.0 // indirect
+	kkn.fi/infra v0.13.2 // indirect
+)
+
+replace kkn.fi/restflex => ../
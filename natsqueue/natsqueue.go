@@ -0,0 +1,104 @@
+// Package natsqueue serves restflex APIs over NATS with a
+// restflex.QueueAdapter.
+//
+// It is a module of its own, so that restflex does not depend on the NATS
+// client. Requests are consumed from a core NATS subscription with Queue,
+// or from a JetStream consumer with JetStream, and responses published to
+// the reply subjects with core NATS:
+//
+//	sub, err := nc.QueueSubscribeSync("api", "api")
+//	...
+//	a := restflex.NewQueueAdapter(l, natsqueue.New(nc, sub), api)
+//	err = a.Run(ctx)
+package natsqueue
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"kkn.fi/restflex"
+)
+
+// Subscription is the part of *nats.Subscription requests are received
+// with.
+type Subscription interface {
+	NextMsgWithContext(ctx context.Context) (*nats.Msg, error)
+}
+
+// Publisher is the part of *nats.Conn responses are published with.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// Queue is a restflex.MessageQueue of a core NATS subscription. Core NATS
+// does not redeliver messages, so the messages have neither Ack nor Nack,
+// and a request which panics is dropped. The reply subject of a request
+// message is its ReplyTo, so requests can be sent with nats.Conn.Request.
+type Queue struct {
+	pub Publisher
+	sub Subscription
+}
+
+func New(pub Publisher, sub Subscription) *Queue {
+	return &Queue{pub: pub, sub: sub}
+}
+
+func (q *Queue) Receive(ctx context.Context) (*restflex.QueueMessage, error) {
+	m, err := q.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &restflex.QueueMessage{Data: m.Data, ReplyTo: m.Reply}, nil
+}
+
+func (q *Queue) Publish(ctx context.Context, subject string, data []byte) error {
+	return q.pub.Publish(subject, data)
+}
+
+// JetStream is a restflex.MessageQueue of a JetStream consumer. Messages
+// are acknowledged once their responses have been published, returned to
+// the stream with Nak when their requests panic, and report the number of
+// deliveries of JetStream, so that restflex.QueueAdapter.MaxDeliveries
+// applies. Responses are published with core NATS, as reply subjects are
+// usually not bound to a stream.
+type JetStream struct {
+	pub  Publisher
+	msgs jetstream.MessagesContext
+}
+
+// NewJetStream returns a JetStream receiving requests from msgs, such as
+// returned by jetstream.Consumer.Messages.
+func NewJetStream(pub Publisher, msgs jetstream.MessagesContext) *JetStream {
+	return &JetStream{pub: pub, msgs: msgs}
+}
+
+func (q *JetStream) Receive(ctx context.Context) (*restflex.QueueMessage, error) {
+	m, err := q.msgs.Next(jetstream.NextContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	msg := &restflex.QueueMessage{
+		Data:    m.Data(),
+		ReplyTo: m.Headers().Get(ReplyToHeader),
+		Ack: func(ctx context.Context) error {
+			return m.Ack()
+		},
+		Nack: func(ctx context.Context) error {
+			return m.Nak()
+		},
+	}
+	if md, err := m.Metadata(); err == nil {
+		msg.Deliveries = int(md.NumDelivered)
+	}
+	return msg, nil
+}
+
+func (q *JetStream) Publish(ctx context.Context, subject string, data []byte) error {
+	return q.pub.Publish(subject, data)
+}
+
+// ReplyToHeader is the header of a JetStream message which holds the reply
+// subject of its request, as the reply subject of a JetStream message is
+// used for acknowledgements. A reply_to of the request takes precedence.
+const ReplyToHeader = "Reply-To"
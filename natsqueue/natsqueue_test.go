@@ -0,0 +1,152 @@
+//go:build !integration
+
+package natsqueue_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/natsqueue"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	data, _ := json.Marshal(restflex.QueueRequest{ID: "a", Method: http.MethodGet, Path: "/orders/1"})
+	sub := make(subscription, 1)
+	sub <- &nats.Msg{Subject: "api", Reply: "_INBOX.1", Data: data}
+	pub := make(publisher, 1)
+	a := restflex.NewQueueAdapter(resttest.NewLogger(), natsqueue.New(pub, sub), api)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	m := <-pub
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	var res restflex.QueueResponse
+	if err := json.Unmarshal(m.Data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "_INBOX.1" || res.ID != "a" || res.Status != http.StatusNoContent {
+		t.Errorf("expected the response to be published to the reply subject, but got %+v to %s", res, m.Subject)
+	}
+}
+
+func TestJetStream(t *testing.T) {
+	t.Parallel()
+	data, _ := json.Marshal(restflex.QueueRequest{ID: "a", Method: http.MethodGet, Path: "/orders/1"})
+	poison, _ := json.Marshal(restflex.QueueRequest{ID: "b", Method: http.MethodGet, Path: "/panic"})
+	acks := make(chan string, 2)
+	msgs := &messages{msgs: make(chan jetstream.Msg, 2), stop: make(chan struct{})}
+	msgs.msgs <- &msg{name: "a", data: data, header: nats.Header{natsqueue.ReplyToHeader: {"replies"}}, delivered: 1, acks: acks}
+	msgs.msgs <- &msg{name: "b", data: poison, delivered: 5, acks: acks}
+	pub := make(publisher, 1)
+	logger := resttest.NewLogger()
+	a := restflex.NewQueueAdapter(logger, natsqueue.NewJetStream(pub, msgs), api)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	got := map[string]bool{<-acks: true, <-acks: true}
+	cancel()
+	msgs.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	if !got["a: ack"] || !got["b: ack"] {
+		t.Errorf("expected the served and the dead-lettered message to be acknowledged, but got %v", got)
+	}
+	m := <-pub
+	var res restflex.QueueResponse
+	if err := json.Unmarshal(m.Data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "replies" || res.ID != "a" || res.Status != http.StatusNoContent {
+		t.Errorf("expected the response to be published to the Reply-To subject, but got %+v to %s", res, m.Subject)
+	}
+	logger.ExpectCount(t, "error: restflex: queue: request b dead-lettered after 5 deliveries", 1)
+}
+
+var api = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/panic" {
+		panic("poison")
+	}
+	w.WriteHeader(http.StatusNoContent)
+})
+
+type subscription chan *nats.Msg
+
+func (s subscription) NextMsgWithContext(ctx context.Context) (*nats.Msg, error) {
+	select {
+	case m := <-s:
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type publisher chan *nats.Msg
+
+func (p publisher) Publish(subject string, data []byte) error {
+	p <- &nats.Msg{Subject: subject, Data: data}
+	return nil
+}
+
+// messages is a jetstream.MessagesContext of the messages sent to msgs.
+type messages struct {
+	jetstream.MessagesContext
+	msgs chan jetstream.Msg
+	stop chan struct{}
+}
+
+func (m *messages) Next(opts ...jetstream.NextOpt) (jetstream.Msg, error) {
+	select {
+	case msg := <-m.msgs:
+		return msg, nil
+	case <-m.stop:
+		return nil, jetstream.ErrMsgIteratorClosed
+	}
+}
+
+func (m *messages) Stop() {
+	close(m.stop)
+}
+
+// msg is a jetstream.Msg which reports its acknowledgements to acks.
+type msg struct {
+	jetstream.Msg
+	name      string
+	data      []byte
+	header    nats.Header
+	delivered uint64
+	acks      chan<- string
+}
+
+func (m *msg) Data() []byte         { return m.data }
+func (m *msg) Headers() nats.Header { return m.header }
+
+func (m *msg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+
+func (m *msg) Ack() error {
+	m.acks <- m.name + ": ack"
+	return nil
+}
+
+func (m *msg) Nak() error {
+	m.acks <- m.name + ": nak"
+	return nil
+}
@@ -0,0 +1,160 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// NonceStore records used single-use tokens. Implementations must be safe
+// for concurrent use and may forget tokens after they expire.
+type NonceStore interface {
+	// Use marks nonce as used until expires and reports whether it had not
+	// been used before.
+	Use(ctx context.Context, nonce string, expires time.Time) (bool, error)
+}
+
+var (
+	// ErrNonceMissing is responded to requests without a token.
+	ErrNonceMissing = NewDeniedError(NewAPIError(http.StatusBadRequest, nil, "token required"), DenialNonceMissing)
+	// ErrNonceUsed is responded to requests replaying a used token.
+	ErrNonceUsed = NewDeniedError(NewAPIError(http.StatusGone, nil, "token already used"), DenialNonceUsed)
+	// ErrNonceExpired is responded to requests with an expired token.
+	ErrNonceExpired = NewDeniedError(NewAPIError(http.StatusGone, nil, "token expired"), DenialNonceExpired)
+)
+
+// Nonces is a middleware enforcing single-use tokens on sensitive endpoints,
+// such as unsubscribe links or invite acceptance. A token is consumed before
+// the handler is called so that concurrent replays are rejected too.
+type Nonces struct {
+	Store NonceStore
+	// Token returns the token of a request. Defaults to the "token" query
+	// parameter.
+	Token func(*http.Request) string
+	// Verify checks that a token was issued by the server, e.g. by its
+	// signature, and returns its expiry time. Used tokens are remembered
+	// until they expire. Tokens failing verification are rejected with the
+	// returned error, or 400 Bad Request if it is not an APIError. It is
+	// required as tokens made up by clients must not be accepted.
+	Verify func(token string) (expires time.Time, err error)
+	// Metrics, if set, counts the rejected requests by denial reason.
+	Metrics *Metrics
+	// DenialDetails includes denial reasons in error responses.
+	DenialDetails bool
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewNonces(l infra.Logger, s NonceStore, verify func(token string) (time.Time, error)) *Nonces {
+	if verify == nil {
+		panic("restflex: nil Nonces verify function")
+	}
+	return &Nonces{
+		Store: s,
+		Token: func(r *http.Request) string {
+			return r.URL.Query().Get("token")
+		},
+		Verify: verify,
+		Log:    l,
+	}
+}
+
+// Wrap returns a handler consuming the token of each request before calling
+// next. It panics if Verify is not set.
+func (n *Nonces) Wrap(next http.Handler) http.Handler {
+	if n.Verify == nil {
+		panic("restflex: nil Nonces verify function")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := n.consume(r); err != nil {
+			deny(n.Log, n.Metrics, n.DenialDetails, w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (n *Nonces) consume(r *http.Request) APIError {
+	var token string
+	if n.Token != nil {
+		token = n.Token(r)
+	} else {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return ErrNonceMissing
+	}
+	expires, err := n.Verify(token)
+	if err != nil {
+		var apiErr APIError
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+		return NewAPIError(http.StatusBadRequest, err, "invalid token")
+	}
+	if !time.Now().Before(expires) {
+		return ErrNonceExpired
+	}
+	unused, err := n.Store.Use(r.Context(), token, expires)
+	if err != nil {
+		n.Log.Printf("restflex: nonce store: %v", err)
+		return NewServiceUnavailable(0, http.StatusText(http.StatusServiceUnavailable))
+	}
+	if !unused {
+		return ErrNonceUsed
+	}
+	return nil
+}
+
+// writeAPIError writes err as a JSON error response with details, which may
+// be nil.
+func writeAPIError(l infra.Logger, w http.ResponseWriter, err APIError, details map[string]any) {
+	setRetryAfter(w, err)
+	if details == nil {
+		writeError(l, w, err.StatusCode(), err.Errors()...)
+		return
+	}
+	msg := NewErrorMessage(err.Errors()...)
+	msg.Details = details
+	w.Header()["Content-Type"] = jsonContentType
+	if err := WriteJSON(w, err.StatusCode(), msg); err != nil {
+		l.Printf("restflex: error while writing error response: %v", err)
+	}
+}
+
+// MemoryNonceStore is a NonceStore keeping used tokens in memory. Expired
+// tokens are forgotten at most once a minute.
+type MemoryNonceStore struct {
+	mu    sync.Mutex
+	used  map[string]time.Time
+	swept time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		used: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryNonceStore) Use(_ context.Context, nonce string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if exp, ok := s.used[nonce]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.used[nonce] = expires
+	if now.Sub(s.swept) >= time.Minute {
+		s.swept = now
+		for k, exp := range s.used {
+			if !now.Before(exp) {
+				delete(s.used, k)
+			}
+		}
+	}
+	return true, nil
+}
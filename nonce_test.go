@@ -0,0 +1,68 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestNonces(t *testing.T) {
+	t.Parallel()
+	nonces := restflex.NewNonces(resttest.NewLogger(), restflex.NewMemoryNonceStore(), func(token string) (time.Time, error) {
+		switch token {
+		case "forged":
+			return time.Time{}, errors.New("bad signature")
+		case "old":
+			return time.Now().Add(-time.Minute), nil
+		}
+		return time.Now().Add(time.Hour), nil
+	})
+	h := nonces.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	resttest.Post("/invites/accept").WithQuery("token", "abc").To(h).Expect(t).Status(http.StatusNoContent)
+	resttest.Post("/invites/accept").WithQuery("token", "abc").To(h).Expect(t).
+		Status(http.StatusGone).
+		Error(restflex.ErrNonceUsed.Errors()...)
+	resttest.Post("/invites/accept").To(h).Expect(t).
+		Status(http.StatusBadRequest).
+		Error(restflex.ErrNonceMissing.Errors()...)
+	resttest.Post("/invites/accept").WithQuery("token", "forged").To(h).Expect(t).
+		Status(http.StatusBadRequest).
+		Error("invalid token")
+	resttest.Post("/invites/accept").WithQuery("token", "old").To(h).Expect(t).
+		Status(http.StatusGone).
+		Error(restflex.ErrNonceExpired.Errors()...)
+}
+
+func TestNonces_verify_required(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Wrap to panic without Verify")
+		}
+	}()
+	nonces := &restflex.Nonces{Store: restflex.NewMemoryNonceStore()}
+	nonces.Wrap(http.NotFoundHandler())
+}
+
+func TestNonces_default_token(t *testing.T) {
+	t.Parallel()
+	nonces := &restflex.Nonces{
+		Store: restflex.NewMemoryNonceStore(),
+		Verify: func(token string) (time.Time, error) {
+			return time.Now().Add(time.Hour), nil
+		},
+		Log: resttest.NewLogger(),
+	}
+	h := nonces.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	resttest.Post("/invites/accept").WithQuery("token", "abc").To(h).Expect(t).Status(http.StatusNoContent)
+}
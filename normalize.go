@@ -0,0 +1,71 @@
+package restflex
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"kkn.fi/infra"
+)
+
+// Normalize returns a middleware normalizing requests before routing, so
+// that equivalent requests match the same routes and the checks made on
+// them. Duplicate slashes in the path are collapsed, path segments are
+// decoded and re-encoded in a canonical form, and default ports are
+// stripped from the Host. Paths with dot segments, plain or encoded, or with
+// slashes or backslashes encoded in segments, as used for path traversal,
+// are rejected with 400 Bad Request.
+func Normalize(l infra.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, rawPath, ok := normalizePath(r.URL.EscapedPath())
+			if !ok {
+				writeError(l, w, http.StatusBadRequest, "invalid request path")
+				return
+			}
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			u.Path, u.RawPath = path, ""
+			if rawPath != (&url.URL{Path: path}).EscapedPath() {
+				u.RawPath = rawPath
+			}
+			r2.URL = &u
+			r2.Host = stripDefaultPort(r.Host, r.TLS != nil)
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// normalizePath returns the decoded and the canonically encoded form of
+// the escaped path p. It reports false for paths which are malformed or
+// contain dot segments or encoded separators.
+func normalizePath(p string) (path, rawPath string, ok bool) {
+	if p == "" {
+		return "/", "/", true
+	}
+	segments := strings.Split(p, "/")
+	decoded := make([]string, 0, len(segments))
+	encoded := make([]string, 0, len(segments))
+	for i, s := range segments {
+		if s == "" && i > 0 && i < len(segments)-1 {
+			continue
+		}
+		d, err := url.PathUnescape(s)
+		if err != nil || d == "." || d == ".." || strings.ContainsAny(d, "/\\") {
+			return "", "", false
+		}
+		decoded = append(decoded, d)
+		encoded = append(encoded, url.PathEscape(d))
+	}
+	return strings.Join(decoded, "/"), strings.Join(encoded, "/"), true
+}
+
+// stripDefaultPort removes the default port of the scheme from host.
+func stripDefaultPort(host string, tls bool) string {
+	port := ":80"
+	if tls {
+		port = ":443"
+	}
+	return strings.TrimSuffix(host, port)
+}
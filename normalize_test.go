@@ -0,0 +1,60 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		target  string
+		host    string
+		status  int
+		path    string
+		rawPath string
+		outHost string
+	}{
+		{name: "clean", target: "/users/1", host: "api.example.com", status: http.StatusOK, path: "/users/1", rawPath: "/users/1", outHost: "api.example.com"},
+		{name: "duplicate slashes", target: "//users///1/", host: "api.example.com:80", status: http.StatusOK, path: "/users/1/", rawPath: "/users/1/", outHost: "api.example.com"},
+		{name: "encoded letters", target: "/us%65rs/a%20b", host: "api.example.com:8080", status: http.StatusOK, path: "/users/a b", rawPath: "/users/a%20b", outHost: "api.example.com:8080"},
+		{name: "encoded slash", target: "/files/a%2fb", status: http.StatusBadRequest},
+		{name: "encoded backslash", target: "/files/a%5cb", status: http.StatusBadRequest},
+		{name: "encoded traversal", target: "/files/%2e%2e/secret", status: http.StatusBadRequest},
+		{name: "partly encoded traversal", target: "/files/.%2E/secret", status: http.StatusBadRequest},
+		{name: "dot segment", target: "/files/../secret", status: http.StatusBadRequest},
+		{name: "encoded dot", target: "/files/a%2etxt", status: http.StatusOK, path: "/files/a.txt", rawPath: "/files/a.txt", outHost: "example.com"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got *http.Request
+			h := restflex.Normalize(resttest.NewLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+tt.target, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected status code %d, but got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got.URL.Path != tt.path || got.URL.EscapedPath() != tt.rawPath || got.Host != tt.outHost {
+				t.Errorf("expected %q %q %q, got %q %q %q", tt.path, tt.rawPath, tt.outHost, got.URL.Path, got.URL.EscapedPath(), got.Host)
+			}
+		})
+	}
+}
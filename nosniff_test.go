@@ -0,0 +1,68 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestWithNoSniff(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		handler     func(w http.ResponseWriter)
+		status      int
+		contentType string
+	}{
+		{
+			name:        "raw bytes",
+			handler:     func(w http.ResponseWriter) { _, _ = io.WriteString(w, `{"id":1}`) },
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+		},
+		{
+			name: "explicit status",
+			handler: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"id":1}`)
+			},
+			status:      http.StatusCreated,
+			contentType: "application/json; charset=utf-8",
+		},
+		{
+			name: "explicit content type",
+			handler: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/csv")
+				_, _ = io.WriteString(w, "id\n1\n")
+			},
+			status:      http.StatusOK,
+			contentType: "text/csv",
+		},
+		{
+			name:    "no content",
+			handler: func(w http.ResponseWriter) { w.WriteHeader(http.StatusNoContent) },
+			status:  http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				tt.handler(w)
+				return nil
+			}), restflex.WithNoSniff())
+			resttest.Get("/").To(api).Expect(t).
+				Status(tt.status).
+				Header("Content-Type", tt.contentType).
+				Header("X-Content-Type-Options", "nosniff")
+		})
+	}
+}
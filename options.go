@@ -0,0 +1,33 @@
+package restflex
+
+// Option configures a handler created with NewHandlerWithContext.
+type Option func(*handler)
+
+// WithLogPolicy sets the levels response log lines are written at.
+func WithLogPolicy(p LogPolicy) Option {
+	return func(h *handler) {
+		h.LogPolicy = p
+	}
+}
+
+// WithErrorMetadata adds the status, request ID and time of the request to
+// JSON error messages so that client-side error reports are self-describing.
+// It is off by default as clients may not expect the fields.
+func WithErrorMetadata() Option {
+	return func(h *handler) {
+		h.ErrorMetadata = true
+	}
+}
+
+// WithNoSniff sets X-Content-Type-Options: nosniff on every response and
+// the Content-Type of responses written without one to application/json, so
+// that browsers do not interpret raw bytes written by handlers as HTML or
+// scripts.
+func WithNoSniff() Option {
+	return func(h *handler) {
+		h.NoSniff = true
+	}
+}
+
+// noSniff is the shared X-Content-Type-Options header value.
+var noSniff = []string{"nosniff"}
@@ -0,0 +1,55 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Event is a domain event emitted by a handler, such as "user.created".
+type Event struct {
+	Type    string
+	Payload any
+	// ID optionally identifies the event. EventStream sends it as the event
+	// ID, which a reconnecting client reports in the Last-Event-ID header.
+	ID string
+}
+
+// Outbox stores the events of a request in its transaction, for example in
+// an outbox table relayed to a message broker, so that events are published
+// if and only if the changes of the request are committed.
+type Outbox interface {
+	Save(ctx context.Context, tx Tx, events []Event) error
+}
+
+// ErrNoTransaction is returned by Emit outside a request run by
+// Transactions.
+var ErrNoTransaction = errors.New("restflex: no transaction")
+
+// eventCollector collects the events emitted during a request.
+type eventCollector struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+type eventCollectorContextKey struct{}
+
+// Emit records events to be saved to the Outbox of Transactions and passed
+// to its OnCommit hook when the response succeeds with a 2xx status. Events
+// of failed requests are dropped.
+func Emit(ctx context.Context, events ...Event) error {
+	c, ok := ctx.Value(eventCollectorContextKey{}).(*eventCollector)
+	if !ok {
+		return ErrNoTransaction
+	}
+	c.mu.Lock()
+	c.events = append(c.events, events...)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *eventCollector) collected() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.events
+}
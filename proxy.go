@@ -0,0 +1,44 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"kkn.fi/infra"
+)
+
+// NewProxy returns a reverse proxy handler forwarding requests to target.
+// Upstream requests are retried and hedged according to policy, which may be
+// nil. Upstream failures are answered with JSON formatted error responses.
+// Requests proxied within a restflex handler are sent as sub-requests of it;
+// see SubRequest.
+func NewProxy(l infra.Logger, target *url.URL, policy *RetryPolicy) *httputil.ReverseProxy {
+	p := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			SubRequest(pr.In.Context(), pr.Out, 1)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var apiErr APIError
+			if errors.As(err, &apiErr) {
+				setRetryAfter(w, err)
+				writeError(l, w, apiErr.StatusCode(), apiErr.Errors()...)
+				return
+			}
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			l.Printf("restflex: proxy %v %v: %v", r.Method, target, err)
+			writeError(l, w, status, http.StatusText(status))
+		},
+	}
+	if policy != nil {
+		p.Transport = policy.Transport(http.DefaultTransport)
+	}
+	return p
+}
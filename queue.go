@@ -0,0 +1,338 @@
+package restflex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"kkn.fi/infra"
+)
+
+// QueueMessage is a message received from a message queue.
+type QueueMessage struct {
+	Data []byte
+	// ReplyTo is the subject of the reply if the queue supports one, such as
+	// the reply subject of a NATS message. A ReplyTo of the request takes
+	// precedence.
+	ReplyTo string
+	// Ack, if set, acknowledges the message, such as deleting an SQS
+	// message, once the response has been published.
+	Ack func(ctx context.Context) error
+	// Nack, if set, returns the message to the queue for redelivery, such
+	// as resetting the visibility timeout of an SQS message, when its
+	// request panicked.
+	Nack func(ctx context.Context) error
+	// Deliveries is the number of times the message has been delivered,
+	// this delivery included, if the queue reports it, such as the
+	// ApproximateReceiveCount of an SQS message. Zero if unknown.
+	Deliveries int
+}
+
+// MessageQueue is a message queue API requests are consumed from and
+// responses published to. Implementations wrap a client of a queue, such as
+// those of the kkn.fi/restflex/natsqueue and kkn.fi/restflex/sqsqueue
+// modules for NATS and SQS.
+type MessageQueue interface {
+	// Receive returns the next request message, blocking until one arrives
+	// or ctx is done.
+	Receive(ctx context.Context) (*QueueMessage, error)
+	// Publish sends data to subject.
+	Publish(ctx context.Context, subject string, data []byte) error
+}
+
+// QueueRequest is an API request sent over a message queue.
+type QueueRequest struct {
+	// ID correlates the response with the request.
+	ID      string      `json:"id"`
+	ReplyTo string      `json:"reply_to,omitempty"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// QueueResponse is the response to a QueueRequest.
+type QueueResponse struct {
+	ID     string      `json:"id"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// QueueAdapter serves API requests consumed from a message queue with the
+// same handler, router and middlewares included, as HTTP requests and
+// publishes the responses to the reply subjects, so that internal consumers
+// can use the API without HTTP. Requests without a reply subject are
+// handled and their responses dropped.
+type QueueAdapter struct {
+	Queue   MessageQueue
+	Handler http.Handler
+	// Concurrency is the number of requests served at the same time.
+	// Defaults to 1.
+	Concurrency int
+	// MaxDeliveries is the number of deliveries after which a message whose
+	// request panics is dead-lettered and acknowledged instead of returned
+	// to the queue, so that a poison message is not redelivered forever.
+	// It applies to queues which report QueueMessage.Deliveries. Zero means
+	// no limit. Defaults to 5.
+	MaxDeliveries int
+	// DeadLetter, if set, is called with a message before it is
+	// dead-lettered, such as to publish it to a dead-letter queue. If it
+	// fails, the message is returned to the queue instead.
+	DeadLetter func(ctx context.Context, msg *QueueMessage) error
+	Log        infra.Logger
+}
+
+func NewQueueAdapter(l infra.Logger, q MessageQueue, h http.Handler) *QueueAdapter {
+	return &QueueAdapter{
+		Queue:         q,
+		Handler:       h,
+		Concurrency:   1,
+		MaxDeliveries: 5,
+		Log:           l,
+	}
+}
+
+// Run serves requests until ctx is done and returns after the requests in
+// flight have been served. Requests in flight are served to completion with
+// a context which is not cancelled with ctx, so that shutting down does not
+// abort them halfway and have the queue redeliver them. It returns nil when
+// ctx is done, or the error of Receive.
+func (a *QueueAdapter) Run(ctx context.Context) error {
+	serveCtx := context.WithoutCancel(ctx)
+	sem := make(chan struct{}, max(a.Concurrency, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		msg, err := a.Queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			a.serve(serveCtx, msg)
+		}()
+	}
+}
+
+// serve serves the request of msg and publishes its response. A panic of
+// the handler is logged and the message returned to the queue, or
+// dead-lettered once it has been delivered MaxDeliveries times.
+func (a *QueueAdapter) serve(ctx context.Context, msg *QueueMessage) {
+	var req QueueRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		a.Log.Printf("restflex: queue: malformed request: %v", err)
+		a.ack(ctx, msg)
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			a.Log.Printf("error: restflex: queue: request %s panicked: %v", req.ID, p)
+			a.retry(ctx, msg, req.ID)
+		}
+	}()
+	res := QueueResponse{ID: req.ID, Status: http.StatusBadRequest}
+	if r, err := http.NewRequestWithContext(ctx, req.Method, req.Path, bytes.NewReader(req.Body)); err != nil {
+		a.Log.Printf("restflex: queue: request %s: %v", req.ID, err)
+	} else {
+		if req.Header != nil {
+			r.Header = req.Header
+		}
+		r.RemoteAddr = "queue"
+		w := &queueResponseWriter{header: make(http.Header)}
+		a.Handler.ServeHTTP(w, r)
+		res.Status, res.Header, res.Body = w.statusCode(), w.header, w.body.Bytes()
+	}
+	replyTo := req.ReplyTo
+	if replyTo == "" {
+		replyTo = msg.ReplyTo
+	}
+	if replyTo != "" {
+		data, err := json.Marshal(res)
+		if err == nil {
+			err = a.Queue.Publish(ctx, replyTo, data)
+		}
+		if err != nil {
+			// leave the message unacknowledged for the queue to redeliver
+			a.Log.Printf("error: restflex: queue: response to %s: %v", req.ID, err)
+			return
+		}
+	}
+	a.ack(ctx, msg)
+}
+
+func (a *QueueAdapter) ack(ctx context.Context, msg *QueueMessage) {
+	if msg.Ack == nil {
+		return
+	}
+	if err := msg.Ack(ctx); err != nil {
+		a.Log.Printf("restflex: queue: ack: %v", err)
+	}
+}
+
+// retry returns msg to the queue unless it has been delivered MaxDeliveries
+// times, in which case it is dead-lettered and acknowledged.
+func (a *QueueAdapter) retry(ctx context.Context, msg *QueueMessage, id string) {
+	if a.MaxDeliveries <= 0 || msg.Deliveries < a.MaxDeliveries {
+		a.nack(ctx, msg)
+		return
+	}
+	if a.DeadLetter != nil {
+		if err := a.DeadLetter(ctx, msg); err != nil {
+			a.Log.Printf("error: restflex: queue: dead letter %s: %v", id, err)
+			a.nack(ctx, msg)
+			return
+		}
+	}
+	a.Log.Printf("error: restflex: queue: request %s dead-lettered after %d deliveries", id, msg.Deliveries)
+	a.ack(ctx, msg)
+}
+
+func (a *QueueAdapter) nack(ctx context.Context, msg *QueueMessage) {
+	if msg.Nack == nil {
+		return
+	}
+	if err := msg.Nack(ctx); err != nil {
+		a.Log.Printf("restflex: queue: nack: %v", err)
+	}
+}
+
+// queueResponseWriter records the response to a queued request.
+type queueResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *queueResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *queueResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *queueResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *queueResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// ErrQueueClosed is returned by a closed MemoryQueue.
+var ErrQueueClosed = errors.New("restflex: queue closed")
+
+// MemoryQueue is an in-process MessageQueue, for tests and for serving
+// requests within a process. Requests are received from the subject given
+// to NewMemoryQueue. Messages returned to the queue are redelivered with
+// their delivery count.
+type MemoryQueue struct {
+	subject string
+	buffer  int
+	retries chan memoryMessage
+
+	mu       sync.Mutex
+	subjects map[string]chan []byte
+	closed   chan struct{}
+}
+
+// memoryMessage is a request message returned to a MemoryQueue.
+type memoryMessage struct {
+	data       []byte
+	deliveries int
+}
+
+func NewMemoryQueue(subject string, buffer int) *MemoryQueue {
+	return &MemoryQueue{
+		subject:  subject,
+		buffer:   buffer,
+		retries:  make(chan memoryMessage, buffer),
+		subjects: make(map[string]chan []byte),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Messages returns the messages published to subject.
+func (q *MemoryQueue) Messages(subject string) <-chan []byte {
+	return q.channel(subject)
+}
+
+func (q *MemoryQueue) channel(subject string) chan []byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c, ok := q.subjects[subject]
+	if !ok {
+		c = make(chan []byte, q.buffer)
+		q.subjects[subject] = c
+	}
+	return c
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context) (*QueueMessage, error) {
+	var m memoryMessage
+	select {
+	case m = <-q.retries:
+	case m.data = <-q.channel(q.subject):
+	case <-q.closed:
+		return nil, ErrQueueClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	m.deliveries++
+	return &QueueMessage{
+		Data:       m.data,
+		Deliveries: m.deliveries,
+		Nack: func(ctx context.Context) error {
+			select {
+			case q.retries <- m:
+				return nil
+			case <-q.closed:
+				return ErrQueueClosed
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}, nil
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, subject string, data []byte) error {
+	select {
+	case q.channel(subject) <- data:
+		return nil
+	case <-q.closed:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close makes Receive and Publish fail with ErrQueueClosed.
+func (q *MemoryQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-q.closed:
+	default:
+		close(q.closed)
+	}
+}
@@ -0,0 +1,188 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestQueueAdapter(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}", restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if r.PathValue("id") != "1" {
+			return restflex.ErrNotFound
+		}
+		return restflex.WriteJSON(w, http.StatusOK, map[string]string{"id": "1", "user": r.Header.Get("X-User")})
+	})))
+	q := restflex.NewMemoryQueue("api", 4)
+	a := restflex.NewQueueAdapter(logger, q, mux)
+	a.Concurrency = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	requests := []restflex.QueueRequest{
+		{ID: "a", ReplyTo: "replies", Method: http.MethodGet, Path: "/items/1", Header: http.Header{"X-User": {"ann"}}},
+		{ID: "b", ReplyTo: "replies", Method: http.MethodGet, Path: "/items/2"},
+	}
+	if err := q.Publish(ctx, "api", []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range requests {
+		data, _ := json.Marshal(req)
+		if err := q.Publish(ctx, "api", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	responses := make(map[string]restflex.QueueResponse)
+	for range requests {
+		var res restflex.QueueResponse
+		if err := json.Unmarshal(<-q.Messages("replies"), &res); err != nil {
+			t.Fatal(err)
+		}
+		responses[res.ID] = res
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+
+	if res := responses["a"]; res.Status != http.StatusOK || string(res.Body) != `{"id":"1","user":"ann"}`+"\n" || res.Header.Get("Content-Type") == "" {
+		t.Errorf("response a = %+v, body %s", res, res.Body)
+	}
+	if res := responses["b"]; res.Status != http.StatusNotFound || string(res.Body) != `{"errors":["item not found"]}`+"\n" {
+		t.Errorf("response b = %+v, body %s", res, res.Body)
+	}
+	logger.ExpectCount(t, "restflex: queue: malformed request", 1)
+}
+
+func TestQueueAdapter_panic(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	var calls atomic.Int32
+	q := restflex.NewMemoryQueue("api", 4)
+	a := restflex.NewQueueAdapter(logger, q, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	data, _ := json.Marshal(restflex.QueueRequest{ID: "a", ReplyTo: "replies", Method: http.MethodPost, Path: "/orders"})
+	if err := q.Publish(ctx, "api", data); err != nil {
+		t.Fatal(err)
+	}
+	var res restflex.QueueResponse
+	if err := json.Unmarshal(<-q.Messages("replies"), &res); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	if res.ID != "a" || res.Status != http.StatusNoContent {
+		t.Errorf("expected the redelivered request to be served, but got %+v", res)
+	}
+	logger.ExpectCount(t, "error: restflex: queue: request a panicked", 1)
+}
+
+func TestQueueAdapter_poison(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	var calls atomic.Int32
+	q := restflex.NewMemoryQueue("api", 4)
+	a := restflex.NewQueueAdapter(logger, q, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		panic("poison")
+	}))
+	a.MaxDeliveries = 3
+	deadLetters := make(chan *restflex.QueueMessage, 1)
+	a.DeadLetter = func(ctx context.Context, msg *restflex.QueueMessage) error {
+		deadLetters <- msg
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	data, _ := json.Marshal(restflex.QueueRequest{ID: "a", ReplyTo: "replies", Method: http.MethodPost, Path: "/orders"})
+	if err := q.Publish(ctx, "api", data); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-deadLetters
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	if msg.Deliveries != 3 || string(msg.Data) != string(data) {
+		t.Errorf("expected the message to be dead-lettered on the third delivery, but got %d deliveries of %s", msg.Deliveries, msg.Data)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 calls of the handler, but got %d", n)
+	}
+	logger.ExpectCount(t, "error: restflex: queue: request a panicked", 3)
+	logger.ExpectCount(t, "error: restflex: queue: request a dead-lettered after 3 deliveries", 1)
+}
+
+func TestQueueAdapter_shutdown(t *testing.T) {
+	t.Parallel()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q := restflex.NewMemoryQueue("api", 4)
+	a := restflex.NewQueueAdapter(resttest.NewLogger(), q, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		if err := r.Context().Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	data, _ := json.Marshal(restflex.QueueRequest{ID: "a", ReplyTo: "replies", Method: http.MethodPost, Path: "/orders"})
+	if err := q.Publish(ctx, "api", data); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	cancel()
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	select {
+	case data := <-q.Messages("replies"):
+		var res restflex.QueueResponse
+		if err := json.Unmarshal(data, &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != http.StatusNoContent {
+			t.Errorf("expected the request in flight to be served, but got %+v", res)
+		}
+	default:
+		t.Error("expected the response of the request in flight to be published")
+	}
+}
@@ -0,0 +1,142 @@
+package restflex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"kkn.fi/infra"
+)
+
+// RequestIDHeader is the header carrying the ID of a request. An ID sent by
+// the client is used if it is valid; otherwise one is generated. The ID is
+// returned in the response header of the same name.
+const RequestIDHeader = "X-Request-Id"
+
+// ParentRequestIDHeader is the header carrying the ID of the request a
+// sub-request, such as an operation of a batch or a proxied request, is
+// made for. It is included in log lines; see SubRequest.
+const ParentRequestIDHeader = "X-Parent-Request-Id"
+
+// requestInfo describes the request being served for logging.
+type requestInfo struct {
+	id       string
+	parentID string
+	method   string
+	route    string
+	log      infra.Logger
+
+	mu          sync.Mutex
+	principal   string
+	experiments string
+	// formatted caches the fields for log lines.
+	formatted string
+}
+
+type requestInfoContextKey struct{}
+
+// withRequestInfo returns r with a requestInfo in its context, reusing one
+// set by an enclosing handler, and sets the request ID response header.
+func withRequestInfo(l infra.Logger, w http.ResponseWriter, r *http.Request) (*http.Request, *requestInfo) {
+	if info, ok := r.Context().Value(requestInfoContextKey{}).(*requestInfo); ok {
+		return r, info
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if !isValidRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	parentID := r.Header.Get(ParentRequestIDHeader)
+	if !isValidRequestID(parentID) {
+		parentID = ""
+	}
+	info := &requestInfo{
+		id:        id,
+		parentID:  parentID,
+		method:    r.Method,
+		route:     r.Pattern,
+		log:       l,
+		principal: Principal(r.Context()),
+	}
+	if variants, ok := r.Context().Value(variantsContextKey{}).(map[string]string); ok {
+		info.experiments = formatVariants(variants, ":", ",")
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoContextKey{}, info)), info
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// isValidRequestID reports whether a client supplied request ID is safe to
+// log and echo back.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the ID of the request being served or an empty string
+// outside a request.
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoContextKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// ParentRequestID returns the ID of the request the request being served is
+// a sub-request of, or an empty string.
+func ParentRequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoContextKey{}).(*requestInfo); ok {
+		return info.parentID
+	}
+	return ""
+}
+
+// SubRequest sets the request ID headers of sub-request n of the request
+// being served in ctx, so that a batched or proxied call can be followed end
+// to end in logs: the parent request ID and a sub-request ID derived from
+// it, e.g. "4f1c2a.3".
+func SubRequest(ctx context.Context, sub *http.Request, n int) {
+	id := RequestID(ctx)
+	if id == "" {
+		return
+	}
+	sub.Header.Set(ParentRequestIDHeader, id)
+	sub.Header.Set(RequestIDHeader, id+"."+strconv.Itoa(n))
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal,
+// such as a user or client ID, which is then included in request log lines.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	if info, ok := ctx.Value(requestInfoContextKey{}).(*requestInfo); ok {
+		info.mu.Lock()
+		info.principal = principal
+		info.formatted = ""
+		info.mu.Unlock()
+	}
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// Principal returns the authenticated principal or an empty string.
+func Principal(ctx context.Context) string {
+	principal, _ := ctx.Value(principalContextKey{}).(string)
+	return principal
+}
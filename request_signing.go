@@ -0,0 +1,177 @@
+package restflex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+const (
+	// SignatureTimestampHeader carries the Unix time a request was signed
+	// at.
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// SignatureNonceHeader carries the single-use nonce of a signed
+	// request.
+	SignatureNonceHeader = "X-Signature-Nonce"
+)
+
+var (
+	// ErrSignatureRequired is responded to requests without a valid
+	// signature.
+	ErrSignatureRequired = NewDeniedError(NewAPIError(http.StatusUnauthorized, nil, "valid request signature required"), DenialInvalidSignature)
+	// ErrSignatureExpired is responded to requests signed too far from the
+	// current time.
+	ErrSignatureExpired = NewDeniedError(NewAPIError(http.StatusUnauthorized, nil, "request timestamp outside the allowed clock skew"), DenialExpiredSignature)
+	// ErrRequestReplayed is responded to requests reusing the nonce of an
+	// earlier request.
+	ErrRequestReplayed = NewDeniedError(NewAPIError(http.StatusUnauthorized, nil, "request nonce already used"), DenialReplayed)
+)
+
+// RequestVerification is a middleware verifying signed requests, such as
+// the requests of a payment partner, and rejecting replays. Requests are
+// signed with SignRequest over the method, the host, the path and query,
+// the Content-Type header, the timestamp, the nonce and the SHA-256 hash of
+// the body, and carry the signature in the X-Signature header. Other
+// headers are not signed. Requests must reach the middleware with the host
+// they were signed for, so a proxy in front of it must preserve the Host
+// header. Requests signed more than MaxSkew
+// from the current time or reusing a nonce are rejected. Nonces are
+// recorded in Nonces per key for the time their timestamps are accepted.
+type RequestVerification struct {
+	// Signers verify the signatures by key ID.
+	Signers map[string]Signer
+	// Nonces records the used nonces. It is required.
+	Nonces NonceStore
+	// MaxSkew is the largest accepted difference between the request
+	// timestamp and the current time. Defaults to 5 minutes.
+	MaxSkew time.Duration
+	// MaxBodyBytes is the largest body verified. Defaults to 1 MiB.
+	MaxBodyBytes int64
+	// Metrics, if set, counts the rejected requests by denial reason.
+	Metrics *Metrics
+	// DenialDetails includes denial reasons in error responses.
+	DenialDetails bool
+	Log           infra.Logger
+}
+
+func NewRequestVerification(l infra.Logger, nonces NonceStore, signers ...Signer) *RequestVerification {
+	if nonces == nil {
+		panic("restflex: request verification without a nonce store")
+	}
+	v := &RequestVerification{
+		Signers:      make(map[string]Signer, len(signers)),
+		Nonces:       nonces,
+		MaxSkew:      5 * time.Minute,
+		MaxBodyBytes: 1 << 20,
+		Log:          l,
+	}
+	for _, s := range signers {
+		v.Signers[s.KeyID()] = s
+	}
+	return v
+}
+
+func (v *RequestVerification) Wrap(next http.Handler) http.Handler {
+	if v.Nonces == nil {
+		panic("restflex: request verification without a nonce store")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.verify(r); err != nil {
+			deny(v.Log, v.Metrics, v.DenialDetails, w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (v *RequestVerification) verify(r *http.Request) APIError {
+	params := signatureParams(r.Header.Get(SignatureHeader))
+	s, ok := v.Signers[params["keyid"]]
+	if !ok || params["alg"] != s.Algorithm() {
+		return ErrSignatureRequired
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["sig"])
+	if err != nil {
+		return ErrSignatureRequired
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(SignatureTimestampHeader), 10, 64)
+	if err != nil {
+		return ErrSignatureRequired
+	}
+	signedAt := time.Unix(ts, 0)
+	if skew := time.Since(signedAt).Abs(); skew > v.MaxSkew {
+		return ErrSignatureExpired
+	}
+	nonce := r.Header.Get(SignatureNonceHeader)
+	if nonce == "" {
+		return ErrSignatureRequired
+	}
+	var body []byte
+	if r.Body != nil {
+		if body, err = io.ReadAll(io.LimitReader(r.Body, v.MaxBodyBytes+1)); err != nil {
+			return NewAPIError(http.StatusBadRequest, err, "reading request body failed")
+		}
+		if int64(len(body)) > v.MaxBodyBytes {
+			return NewAPIError(http.StatusRequestEntityTooLarge, nil, http.StatusText(http.StatusRequestEntityTooLarge))
+		}
+		r.Body = readCloser{bytes.NewReader(body), r.Body}
+	}
+	if !s.Verify(signingString(r, ts, nonce, body), sig) {
+		return ErrSignatureRequired
+	}
+	// nonces are recorded only for authentic requests so that forged
+	// requests can't use up the nonces of the signer
+	unused, err := v.Nonces.Use(r.Context(), s.KeyID()+":"+nonce, signedAt.Add(v.MaxSkew))
+	if err != nil {
+		v.Log.Printf("restflex: nonce store: %v", err)
+		return NewServiceUnavailable(0, http.StatusText(http.StatusServiceUnavailable))
+	}
+	if !unused {
+		return ErrRequestReplayed
+	}
+	return nil
+}
+
+// SignRequest signs r with body, which must be the body r sends, at the
+// current time with a random nonce for RequestVerification. The host and
+// the Content-Type header of r are signed, so they must be set before
+// signing.
+func SignRequest(s Signer, r *http.Request, body []byte) error {
+	ts := time.Now().Unix()
+	nonce := newRequestID()
+	sig, err := s.Sign(signingString(r, ts, nonce, body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set(SignatureTimestampHeader, strconv.FormatInt(ts, 10))
+	r.Header.Set(SignatureNonceHeader, nonce)
+	r.Header.Set(SignatureHeader, fmt.Sprintf("keyid=%q, alg=%q, sig=%q", s.KeyID(), s.Algorithm(), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// signingString returns the signed representation of request r.
+func signingString(r *http.Request, ts int64, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	return []byte(strings.Join([]string{
+		r.Method,
+		strings.ToLower(host),
+		r.URL.RequestURI(),
+		r.Header.Get("Content-Type"),
+		strconv.FormatInt(ts, 10),
+		nonce,
+		hex.EncodeToString(sum[:]),
+	}, "\n"))
+}
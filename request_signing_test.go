@@ -0,0 +1,99 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestRequestVerification(t *testing.T) {
+	t.Parallel()
+	partner := restflex.HMACSigner{Key: []byte("partner secret"), ID: "partner-1"}
+	v := restflex.NewRequestVerification(resttest.NewLogger(), restflex.NewMemoryNonceStore(), partner)
+	h := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	body := []byte(`{"amount":100}`)
+	signed := func(s restflex.Signer) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/payments?currency=EUR", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if err := restflex.SignRequest(s, r, body); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	r := signed(partner)
+	replay := r.Clone(r.Context())
+	replay.Body = io.NopCloser(bytes.NewReader(body))
+	if w := serve(r); w.Code != http.StatusOK || w.Body.String() != string(body) {
+		t.Fatalf("signed request: %d %s", w.Code, w.Body)
+	}
+	if w := serve(replay); w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte("nonce already used")) {
+		t.Errorf("replayed request: %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		signer restflex.Signer
+		want   string
+	}{
+		{name: "unsigned", modify: func(r *http.Request) { r.Header.Del(restflex.SignatureHeader) }, want: "valid request signature required"},
+		{name: "unknown key", signer: restflex.HMACSigner{Key: []byte("partner secret"), ID: "partner-2"}, want: "valid request signature required"},
+		{name: "wrong key", signer: restflex.HMACSigner{Key: []byte("guess"), ID: "partner-1"}, want: "valid request signature required"},
+		{name: "tampered body", modify: func(r *http.Request) { r.Body = io.NopCloser(bytes.NewReader([]byte(`{"amount":999}`))) }, want: "valid request signature required"},
+		{name: "tampered query", modify: func(r *http.Request) { r.URL.RawQuery = "currency=USD" }, want: "valid request signature required"},
+		{name: "other host", modify: func(r *http.Request) { r.Host = "sandbox.example.com" }, want: "valid request signature required"},
+		{name: "tampered content type", modify: func(r *http.Request) { r.Header.Set("Content-Type", "application/x-www-form-urlencoded") }, want: "valid request signature required"},
+		{name: "missing nonce", modify: func(r *http.Request) { r.Header.Del(restflex.SignatureNonceHeader) }, want: "valid request signature required"},
+		{name: "old timestamp", modify: func(r *http.Request) {
+			r.Header.Set(restflex.SignatureTimestampHeader, strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10))
+		}, want: "request timestamp outside the allowed clock skew"},
+		{name: "future timestamp", modify: func(r *http.Request) {
+			r.Header.Set(restflex.SignatureTimestampHeader, strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10))
+		}, want: "request timestamp outside the allowed clock skew"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := tt.signer
+			if s == nil {
+				s = partner
+			}
+			r := signed(s)
+			if tt.modify != nil {
+				tt.modify(r)
+			}
+			w := serve(r)
+			if w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte(tt.want)) {
+				t.Errorf("expected 401 %q, got %d %s", tt.want, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestNewRequestVerification_nilNonces(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	restflex.NewRequestVerification(resttest.NewLogger(), nil)
+}
@@ -0,0 +1,67 @@
+package restflex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"kkn.fi/infra"
+)
+
+// ResponseType returns a middleware declaring the response type of a route
+// for development and tests. Successful JSON responses are decoded into a T,
+// rejecting unknown fields, and a mismatch is logged as an error, catching
+// handlers which encode the wrong struct. It costs a decode per response and
+// is not meant for production.
+func ResponseType[T any](l infra.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			if err := checkResponseType[T](cw); err != nil {
+				l.Printf("error: restflex: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// StrictResponseType is like ResponseType but responds with 500 Internal
+// Server Error instead of a mismatching response, so that tests fail.
+func StrictResponseType[T any](l infra.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &captureWriter{ResponseWriter: &discardWriter{header: w.Header()}, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			if err := checkResponseType[T](cw); err != nil {
+				l.Printf("error: restflex: %s %s: %v", r.Method, r.URL.Path, err)
+				w.Header().Del("Content-Length")
+				w.Header().Del("Content-Type")
+				writeError(l, w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cw.flush(w)
+		})
+	}
+}
+
+// checkResponseType returns an error if the captured successful JSON
+// response does not decode into a T.
+func checkResponseType[T any](cw *captureWriter) error {
+	if cw.status < 200 || cw.status >= 300 || cw.body.Len() == 0 {
+		return nil
+	}
+	if !MatchContentType(cw.Header().Get("Content-Type"), "application/json") {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(cw.body.Bytes()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(new(T)); err != nil {
+		return fmt.Errorf("response does not match %T: %v", *new(T), err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("response does not match %T: trailing data", *new(T))
+	}
+	return nil
+}
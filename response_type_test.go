@@ -0,0 +1,51 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type userResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestResponseType(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		body   any
+		status int
+		strict bool
+		want   int
+		logged int
+	}{
+		{name: "matching", body: userResponse{ID: 1, Name: "alice"}, status: http.StatusOK, want: http.StatusOK},
+		{name: "unknown field", body: map[string]any{"id": 1, "email": "alice@example.com"}, status: http.StatusOK, want: http.StatusOK, logged: 1},
+		{name: "wrong type", body: map[string]any{"id": "1"}, status: http.StatusOK, want: http.StatusOK, logged: 1},
+		{name: "error response", body: restflex.NewErrorMessage("not found"), status: http.StatusNotFound, want: http.StatusNotFound},
+		{name: "strict matching", body: userResponse{ID: 1}, status: http.StatusCreated, strict: true, want: http.StatusCreated},
+		{name: "strict mismatch", body: []int{1}, status: http.StatusOK, strict: true, want: http.StatusInternalServerError, logged: 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := resttest.NewLogger()
+			mw := restflex.ResponseType[userResponse](logger)
+			if tt.strict {
+				mw = restflex.StrictResponseType[userResponse](logger)
+			}
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = restflex.WriteJSON(w, tt.status, tt.body)
+			}))
+			resttest.Get("/users/1").To(h).Expect(t).Status(tt.want)
+			logger.ExpectCount(t, "response does not match", tt.logged)
+		})
+	}
+}
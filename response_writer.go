@@ -1,6 +1,9 @@
 package restflex
 
-import "net/http"
+import (
+	"net/http"
+	"sync"
+)
 
 // responseWriter stores whether response has been already written in the
 // isWritten variable.
@@ -8,12 +11,79 @@ type responseWriter struct {
 	http.ResponseWriter
 	isWritten bool
 	status    int
+	// written is the number of body bytes written.
+	written int64
+	// noSniff defaults the Content-Type of responses with a body.
+	noSniff bool
+	// canonicalJSON makes WriteJSON emit canonical JSON.
+	canonicalJSON bool
+}
+
+// responseWriterPool reuses responseWriter wrappers across requests.
+var responseWriterPool = sync.Pool{
+	New: func() any {
+		return new(responseWriter)
+	},
+}
+
+// newResponseWriter returns a pooled responseWriter wrapping w. It must be
+// released once the request has been served and not be used after that.
+//
+// Pooling saves an allocation per request, but makes a handler which keeps
+// using the writer after returning, such as from a goroutine, write to the
+// response of whichever request reuses it. That breaks the contract of
+// http.ResponseWriter in any case; a released writer panics until reused,
+// and the race detector reports the writes once it is reused.
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	rw := responseWriterPool.Get().(*responseWriter)
+	rw.ResponseWriter = w
+	rw.status = http.StatusOK
+	rw.isWritten = false
+	rw.written = 0
+	rw.noSniff = false
+	rw.canonicalJSON = false
+	return rw
+}
+
+// release returns w to the pool, poisoning it so that it panics if used
+// before it is reused.
+func (w *responseWriter) release() {
+	w.ResponseWriter = releasedWriter{}
+	responseWriterPool.Put(w)
+}
+
+// releasedWriter is the http.ResponseWriter of a released responseWriter.
+type releasedWriter struct{}
+
+const usedAfterRelease = "restflex: response writer used after the handler returned"
+
+func (releasedWriter) Header() http.Header {
+	panic(usedAfterRelease)
+}
+
+func (releasedWriter) Write([]byte) (int, error) {
+	panic(usedAfterRelease)
+}
+
+func (releasedWriter) WriteHeader(int) {
+	panic(usedAfterRelease)
+}
+
+func (releasedWriter) Flush() {
+	panic(usedAfterRelease)
 }
 
 // WriteHeader calls normal http.ResponseWriter.WriteHeader() to set the status and
-// sets variable isWritten to true.
+// sets variable isWritten to true. Informational responses such as 103 Early
+// Hints are passed through without being recorded.
 func (w *responseWriter) WriteHeader(status int) {
+	if w.noSniff && !w.isWritten && bodyAllowed(status) {
+		w.defaultContentType()
+	}
 	w.ResponseWriter.WriteHeader(status)
+	if isInformational(status) {
+		return
+	}
 	w.status = status
 	w.isWritten = true
 }
@@ -21,7 +91,77 @@ func (w *responseWriter) WriteHeader(status int) {
 // Write calls http.ResponseWriter.Write() to write given bytes and sets
 // variable isWritten to true.
 func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.noSniff && !w.isWritten {
+		w.defaultContentType()
+	}
 	i, err := w.ResponseWriter.Write(b)
 	w.isWritten = true
+	w.written += int64(i)
 	return i, err
 }
+
+// Flush sends any buffered data to the client if the underlying
+// http.ResponseWriter supports flushing. Streaming handlers need this to
+// write a response body in parts before setting trailers.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+		w.isWritten = true
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter for
+// http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// isInformational reports whether status is a 1xx informational status code
+// which is followed by the final response. 101 Switching Protocols is final.
+func isInformational(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// defaultContentType sets the Content-Type of a response written without
+// one to JSON.
+func (w *responseWriter) defaultContentType() {
+	h := w.Header()
+	if _, ok := h["Content-Type"]; !ok {
+		h["Content-Type"] = jsonContentType
+	}
+}
+
+// bodyAllowed reports whether a response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// hookWriter calls hook once before the response header is written, or when
+// runHook is called if nothing was written.
+type hookWriter struct {
+	http.ResponseWriter
+	once sync.Once
+	hook func()
+}
+
+func (w *hookWriter) runHook() {
+	w.once.Do(w.hook)
+}
+
+func (w *hookWriter) WriteHeader(status int) {
+	if !isInformational(status) {
+		w.runHook()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	w.runHook()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying http.ResponseWriter for
+// http.ResponseController.
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
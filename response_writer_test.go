@@ -47,3 +47,68 @@ func TestResponseWriter_Write(t *testing.T) {
 		}
 	})
 }
+
+func TestResponseWriter_WriteHeader_informational(t *testing.T) {
+	t.Run("informational status is not recorded", func(t *testing.T) {
+		t.Parallel()
+		rec := httptest.NewRecorder()
+		rw := &responseWriter{
+			ResponseWriter: rec,
+			status:         http.StatusOK,
+		}
+		EarlyHints(rw, "</app.js>; rel=preload; as=script")
+		if rw.isWritten {
+			t.Error("expecting isWritten to be false after 103 Early Hints")
+		}
+		rw.WriteHeader(http.StatusCreated)
+		if !rw.isWritten {
+			t.Error("expecting isWritten to be true after final status")
+		}
+		if rw.status != http.StatusCreated {
+			t.Errorf("expecting status %v, got %v", http.StatusCreated, rw.status)
+		}
+	})
+}
+
+func TestNewResponseWriter_resets_pooled_writer(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+	rw.WriteHeader(http.StatusTeapot)
+	rw.release()
+
+	rw = newResponseWriter(httptest.NewRecorder())
+	defer rw.release()
+	if rw.isWritten {
+		t.Error("expecting isWritten to be false for a reused writer")
+	}
+	if rw.status != http.StatusOK {
+		t.Errorf("expecting status %v, got %v", http.StatusOK, rw.status)
+	}
+}
+
+func TestResponseWriter_used_after_release(t *testing.T) {
+	tests := []struct {
+		name string
+		use  func(w http.ResponseWriter)
+	}{
+		{name: "Header", use: func(w http.ResponseWriter) { w.Header() }},
+		{name: "Write", use: func(w http.ResponseWriter) { w.Write([]byte("late")) }},
+		{name: "WriteHeader", use: func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }},
+		{name: "Flush", use: func(w http.ResponseWriter) { w.(http.Flusher).Flush() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rw := newResponseWriter(rec)
+			rw.release()
+			defer func() {
+				if p := recover(); p != usedAfterRelease {
+					t.Errorf("expected a panic of a use after release, got %v", p)
+				}
+				if rec.Body.Len() != 0 || rec.Code != http.StatusOK {
+					t.Errorf("expected the released response to stay untouched, got %d %q", rec.Code, rec.Body)
+				}
+			}()
+			tt.use(rw)
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package restflex
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"kkn.fi/httpx"
 	"kkn.fi/infra"
@@ -18,37 +21,71 @@ type handler struct {
 	httpx.HandlerWithContext
 	// Log logs messages
 	Log infra.Logger
+	// LogPolicy chooses the levels of response log lines.
+	LogPolicy LogPolicy
+	// Metrics counts served requests when set.
+	Metrics *Metrics
+	// Alerter is notified of 5xx responses and panics when set.
+	Alerter *Alerter
+	// Settings overrides the minimum level of LogPolicy when set.
+	Settings *Settings
+	// HTMLErrors writes error responses as HTML to clients preferring it.
+	HTMLErrors bool
+	// NoSniff guards responses against content sniffing.
+	NoSniff bool
+	// ErrorMetadata adds request metadata to error messages.
+	ErrorMetadata bool
+	// UTF8JSON rejects JSON requests in other charsets.
+	UTF8JSON bool
+	// Latin1JSON transcodes ISO-8859-1 JSON requests to UTF-8.
+	Latin1JSON bool
+	// StripBOM strips byte order marks from JSON requests.
+	StripBOM bool
+	// CanonicalJSON makes WriteJSON emit canonical JSON.
+	CanonicalJSON bool
+	// DenialDetails adds denial reasons to error details.
+	DenialDetails bool
+	// SLO is the service level objective of the route when set.
+	SLO *SLO
 }
 
-func NewHandlerWithContext(l infra.Logger, h httpx.HandlerWithContext) http.Handler {
+func NewHandlerWithContext(l infra.Logger, h httpx.HandlerWithContext, opts ...Option) http.Handler {
 	api := &handler{
 		Log:                l,
 		HandlerWithContext: h,
+		LogPolicy:          DefaultLogPolicy(),
+	}
+	for _, opt := range opts {
+		opt(api)
 	}
 	return api
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if method := r.Method; method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
-		correctContentTypeFound := false
-		acceptedContentTypes := []string{
-			"application/json",
-			"application/x-www-form-urlencoded",
-		}
-		contentType := r.Header.Get("Content-Type")
-		for _, v := range strings.Split(contentType, ",") {
-			t, _, err := mime.ParseMediaType(v)
-			if err != nil {
-				continue
-			}
-			for _, acceptedContentType := range acceptedContentTypes {
-				if strings.HasPrefix(t, acceptedContentType) {
-					correctContentTypeFound = true
-					break
+	var start time.Time
+	if h.SLO != nil {
+		start = time.Now()
+	}
+	r, info := withRequestInfo(h.Log, w, r)
+	log := requestLogger{info: info}
+	h.Metrics.start()
+	defer h.Metrics.end()
+	if h.NoSniff {
+		w.Header()["X-Content-Type-Options"] = noSniff
+	}
+	if h.Alerter != nil {
+		defer func() {
+			if p := recover(); p != nil {
+				// http.ErrAbortHandler aborts a response deliberately
+				if p != http.ErrAbortHandler {
+					h.Alerter.Panic()
 				}
+				panic(p)
 			}
-		}
-		if !correctContentTypeFound {
+		}()
+	}
+	if method := r.Method; method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		if !MatchContentType(r.Header.Get("Content-Type"), acceptedContentTypes...) {
 			msg := "POST, PUT, and PATCH methods require request content type of "
 			for i, acceptedContentType := range acceptedContentTypes {
 				msg += fmt.Sprintf("%q", acceptedContentType)
@@ -56,46 +93,112 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					msg += " or "
 				}
 			}
-			h.Error(w, http.StatusUnsupportedMediaType, msg)
+			h.error(w, r, http.StatusUnsupportedMediaType, msg)
+			h.Metrics.done(info.route, http.StatusUnsupportedMediaType)
 			return
 		}
+		var d bodyDecoding
+		d.stripBOM = h.StripBOM && MatchContentType(r.Header.Get("Content-Type"), "application/json")
+		if h.UTF8JSON || h.Latin1JSON {
+			latin1, ok := h.checkCharset(w, r)
+			if !ok {
+				h.Metrics.done(info.route, http.StatusUnsupportedMediaType)
+				return
+			}
+			d.latin1 = latin1
+		}
+		if d != (bodyDecoding{}) {
+			r = r.WithContext(context.WithValue(r.Context(), bodyDecodingContextKey{}, d))
+			r.Body = d.wrap(r.Body)
+		}
 	}
-	rw := &responseWriter{
-		ResponseWriter: w,
-		status:         http.StatusOK,
+	requestSize := r.ContentLength
+	var body *countingBody
+	if h.Metrics != nil && requestSize < 0 && r.Body != nil && r.Body != http.NoBody {
+		body = &countingBody{ReadCloser: r.Body}
+		r.Body = body
 	}
+	rw := newResponseWriter(w)
+	defer rw.release()
+	rw.noSniff = h.NoSniff
+	rw.canonicalJSON = h.CanonicalJSON
 	ctx := r.Context()
 	err := h.ServeHTTPWithContext(ctx, rw, r)
-	h.Log.Printf("error: %v is written: %v", err, rw.isWritten)
-	if err == nil && !rw.isWritten {
-		status := http.StatusNotImplemented
-		h.Error(rw, status, http.StatusText(status))
-		return
+	err = h.writeResult(rw, r, err)
+	policy := h.LogPolicy
+	if h.Settings != nil {
+		policy.MinLevel = h.Settings.LogLevel()
 	}
-	var apiError APIError
-	isAPIErr := errors.As(err, &apiError)
-	switch responseStatus := rw.status; {
-	case responseStatus > 399 && responseStatus < 500:
-		h.Log.Printf("client error: %v", responseStatus)
-	case responseStatus == 500 || responseStatus > 501:
-		if !isAPIErr {
-			h.Log.Printf("server error: %v: %v", responseStatus, err)
+	policy.logResponse(log, rw.status, err)
+	h.Metrics.done(info.route, rw.status)
+	if h.Metrics != nil {
+		if body != nil {
+			requestSize = body.n
 		}
+		h.Metrics.observeSizes(info.route, max(requestSize, 0), rw.written)
+		if h.SLO != nil {
+			h.Metrics.observeSLO(info.route, h.SLO, rw.status, time.Since(start))
+		}
+	}
+	if rw.status >= 500 {
+		h.Alerter.ServerError()
 	}
+}
+
+// writeResult writes the response for the error returned by a handler and
+// returns the error to log. A handler returning nil without writing a
+// response is not implemented. Errors other than APIErrors are responded to
+// with an incident reference, which is added to the returned error so that
+// reports from users can be correlated with the log.
+func (h handler) writeResult(rw *responseWriter, r *http.Request, err error) error {
 	if err == nil {
-		return
+		if !rw.isWritten {
+			status := http.StatusNotImplemented
+			h.error(rw, r, status, http.StatusText(status))
+		}
+		return nil
 	}
-	if isAPIErr {
-		h.Error(rw, apiError.StatusCode(), apiError.Errors()...)
-		return
+	if apiError, ok := errorAs[APIError](err); ok {
+		setRetryAfter(rw, err)
+		var details map[string]any
+		if detailed, ok := errorAs[DetailedError](err); ok {
+			details = detailed.Details()
+		}
+		if reason := denialReason(err); reason != "" {
+			logDenial(h.Log, r, err, reason)
+			h.Metrics.denied(reason)
+			if h.DenialDetails {
+				details = denialDetails(details, reason)
+			}
+		}
+		h.errorMessage(rw, r, apiError.StatusCode(), "", details, apiError.Errors()...)
+		return err
 	}
+	incident := newIncident(RequestID(r.Context()), time.Now())
 	status := http.StatusInternalServerError
-	h.Error(rw, status, http.StatusText(status))
+	h.errorMessage(rw, r, status, incident, nil, http.StatusText(status))
+	return fmt.Errorf("incident %s: %w", incident, err)
+}
+
+// newIncident returns a short incident reference for the request with ID
+// requestID failing at t.
+func newIncident(requestID string, t time.Time) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%d", requestID, t.UnixNano()))
+	return hex.EncodeToString(sum[:5])
 }
 
 // ErrorMessage is JSON formatted error message targetted to be consumed by machine.
 type ErrorMessage struct {
 	Errors []string `json:"errors"`
+	// Status, RequestID and Timestamp describe the failed request. They are
+	// included by handlers created WithErrorMetadata.
+	Status    int    `json:"status,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	// Incident references the log entry of an internal server error.
+	Incident string `json:"incident,omitempty"`
+	// Details holds the details of a DetailedError.
+	Details map[string]any `json:"details,omitempty"`
 }
 
 func NewErrorMessage(errors ...string) *ErrorMessage {
@@ -106,13 +209,185 @@ func NewErrorMessage(errors ...string) *ErrorMessage {
 
 // Error writes a JSON formatted error response.
 func (h handler) Error(w http.ResponseWriter, statusCode int, messages ...string) {
-	w.WriteHeader(statusCode)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	msg := NewErrorMessage(messages...)
-	if errOnError := EncodeJSON(w, &msg); errOnError != nil {
-		h.Log.Printf("restflex: error while writing error response: %v", errOnError)
+	writeError(h.Log, w, statusCode, messages...)
+}
+
+// error writes an error response to r as HTML or JSON.
+func (h handler) error(w http.ResponseWriter, r *http.Request, statusCode int, messages ...string) {
+	h.errorMessage(w, r, statusCode, "", nil, messages...)
+}
+
+// errorMessage writes an error response with an optional incident
+// reference and details. The messages are translated to the Locale of r;
+// see TranslateErrors.
+func (h handler) errorMessage(w http.ResponseWriter, r *http.Request, statusCode int, incident string, details map[string]any, messages ...string) {
+	messages = localizeMessages(r.Context(), messages)
+	if h.HTMLErrors {
+		AddVary(w.Header(), "Accept")
+		if prefersHTML(r.Header.Get("Accept")) {
+			writeHTMLError(h.Log, w, statusCode, RequestID(r.Context()), incident, details, messages...)
+			return
+		}
+	}
+	if h.ErrorMetadata || incident != "" || details != nil {
+		msg := NewErrorMessage(messages...)
+		msg.Incident = incident
+		msg.Details = details
+		if h.ErrorMetadata {
+			msg.Status = statusCode
+			msg.RequestID = RequestID(r.Context())
+			msg.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		w.Header()["Content-Type"] = jsonContentType
+		if err := WriteJSON(w, statusCode, msg); err != nil {
+			h.Log.Printf("restflex: error while writing error response: %v", err)
+		}
 		return
 	}
+	h.Error(w, statusCode, messages...)
+}
+
+// jsonContentType is shared by error responses to avoid allocating it.
+var jsonContentType = []string{"application/json; charset=utf-8"}
+
+// precomputedErrors holds the encoded error responses with a single message
+// of the stock errors and common status texts, keyed by the message.
+var precomputedErrors = precomputeErrors(
+	[]APIError{ErrAuth, ErrNotFound, ErrInvalidRequestBody, ErrBadRequest, ErrInternal},
+	http.StatusBadRequest,
+	http.StatusUnauthorized,
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusUnsupportedMediaType,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusNotImplemented,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+)
+
+// encodedError is a precomputed error response body with its Content-Length
+// header value.
+type encodedError struct {
+	body          []byte
+	contentLength []string
+}
+
+func precomputeErrors(errs []APIError, statusCodes ...int) map[string]encodedError {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Errors()...)
+	}
+	for _, code := range statusCodes {
+		messages = append(messages, http.StatusText(code))
+	}
+	encoded := make(map[string]encodedError, len(messages))
+	for _, m := range messages {
+		b, err := json.Marshal(NewErrorMessage(m))
+		if err != nil {
+			panic(err)
+		}
+		// json.Encoder, used for other responses, ends messages with a newline.
+		b = append(b, '\n')
+		encoded[m] = encodedError{
+			body:          b,
+			contentLength: []string{strconv.Itoa(len(b))},
+		}
+	}
+	return encoded
+}
+
+// writeError writes a JSON formatted error response logging failures to l.
+// Responses with a single well known message are written without encoding.
+func writeError(l infra.Logger, w http.ResponseWriter, statusCode int, messages ...string) {
+	h := w.Header()
+	h["Content-Type"] = jsonContentType
+	if len(messages) == 1 {
+		if e, ok := precomputedErrors[messages[0]]; ok {
+			h["Content-Length"] = e.contentLength
+			w.WriteHeader(statusCode)
+			if _, err := w.Write(e.body); err != nil {
+				l.Printf("restflex: error while writing error response: %v", err)
+			}
+			return
+		}
+	}
+	if err := WriteJSON(w, statusCode, NewErrorMessage(messages...)); err != nil {
+		l.Printf("restflex: error while writing error response: %v", err)
+	}
+}
+
+// maxBufferedResponse is the size up to which WriteJSON buffers a response
+// to send it with a Content-Length header instead of chunked encoding.
+const maxBufferedResponse = 64 << 10
+
+// WriteJSON writes v encoded as JSON with statusCode. Responses up to 64 KiB
+// are sent with a Content-Length header; larger ones are streamed.
+func WriteJSON(w http.ResponseWriter, statusCode int, v any) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header()["Content-Type"] = jsonContentType
+	}
+	if canonicalJSON(w) {
+		b, cause := CanonicalJSON(v)
+		if cause != nil {
+			return NewAPIError(http.StatusInternalServerError, cause)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)+1))
+		w.WriteHeader(statusCode)
+		_, err := w.Write(append(b, '\n'))
+		return err
+	}
+	bw := &bufferedResponseWriter{ResponseWriter: w, statusCode: statusCode}
+	if cause := json.NewEncoder(bw).Encode(v); cause != nil {
+		return NewAPIError(http.StatusInternalServerError, cause)
+	}
+	return bw.flush()
+}
+
+// bufferedResponseWriter buffers a response body up to maxBufferedResponse
+// bytes before writing the status code.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	buf        []byte
+	streaming  bool
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	if len(w.buf)+len(b) <= maxBufferedResponse {
+		w.buf = append(w.buf, b...)
+		return len(b), nil
+	}
+	w.streaming = true
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+	return w.ResponseWriter.Write(b)
+}
+
+// flush writes a buffered response with its Content-Length.
+func (w *bufferedResponseWriter) flush() error {
+	if w.streaming {
+		return nil
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(w.buf)))
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, err := w.ResponseWriter.Write(w.buf)
+	return err
+}
+
+// acceptedContentTypes are the request content types of POST, PUT and PATCH
+// requests.
+var acceptedContentTypes = []string{
+	"application/json",
+	"application/x-www-form-urlencoded",
 }
 
 // EncodeJSON encodes a JSON message to HTTP response.
@@ -124,7 +399,9 @@ func EncodeJSON(w http.ResponseWriter, msg any) error {
 	return nil
 }
 
-// DecodeJSON reads a JSON message from HTTP request.
+// DecodeJSON reads a JSON message from HTTP request. Bodies starting with a
+// byte order mark are rejected unless the handler strips it; see
+// WithBOMStripping.
 func DecodeJSON(body io.Reader, o any) error {
 	decoder := json.NewDecoder(body)
 	if cause := decoder.Decode(o); cause != nil {
@@ -132,3 +409,22 @@ func DecodeJSON(body io.Reader, o any) error {
 	}
 	return nil
 }
+
+// DecodeJSONRaw reads a JSON message from the body of r and returns the raw
+// body along with it, for example to verify a signature or keep an audit
+// trail. A body buffered with BufferBody is not read again but decoded like
+// r.Body, e.g. with its byte order mark stripped or transcoded to UTF-8; see
+// WithBOMStripping and WithLatin1JSON.
+func DecodeJSONRaw(r *http.Request, o any) ([]byte, error) {
+	if buf, ok := r.Context().Value(bufferedBodyContextKey{}).(*bufferedBody); ok {
+		return buf.data, DecodeJSON(buf.reader(r.Context()), o)
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, NewAPIError(http.StatusBadRequest, err)
+	}
+	if err := DecodeJSON(bytes.NewReader(b), o); err != nil {
+		return b, err
+	}
+	return b, nil
+}
@@ -14,13 +14,18 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"kkn.fi/httpx"
 	"kkn.fi/infra"
 	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
 )
 
 func TestMain(m *testing.M) {
+	if os.Getenv(upgradedEnv) != "" {
+		os.Exit(serveUpgraded())
+	}
 	if infra.IsCI() {
 		log.SetOutput(io.Discard)
 	}
@@ -95,7 +100,7 @@ func Test_default_response_is_HTTP_501(t *testing.T) {
 
 			req := httptest.NewRequest(tt.method, "/", nil)
 			rec := httptest.NewRecorder()
-			srv := restflex.NewHandlerWithContext(log.Default(), tt.handler)
+			srv := restflex.NewHandlerWithContext(resttest.NewLogger(), tt.handler)
 			srv.ServeHTTP(rec, req)
 
 			res := rec.Result()
@@ -122,7 +127,7 @@ func Test_default_response_is_501_not_implemented(t *testing.T) {
 	t.Parallel()
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
-	srv := restflex.NewHandlerWithContext(log.Default(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	srv := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}))
 	srv.ServeHTTP(rec, req)
@@ -172,6 +177,18 @@ func Test_request_with_body_has_JSON_content_type(t *testing.T) {
 			requestContentType: "application/json; charset=utf-8",
 			wantStatus:         http.StatusOK,
 		},
+		{
+			name:               "POST with content type prefix",
+			method:             http.MethodPost,
+			requestContentType: "application/jsonp",
+			wantStatus:         http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "POST with content type list",
+			method:             http.MethodPost,
+			requestContentType: "text/plain, application/json",
+			wantStatus:         http.StatusUnsupportedMediaType,
+		},
 		{
 			name:               "PUT with content type",
 			method:             http.MethodPut,
@@ -252,7 +269,7 @@ func Test_request_with_body_has_JSON_content_type(t *testing.T) {
 				req.Header.Set("Content-Type", tt.requestContentType)
 			}
 			rec := httptest.NewRecorder()
-			srv := restflex.NewHandlerWithContext(log.Default(), httpx.HandlerWithContextFunc(
+			srv := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(
 				func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 					expectedURL := "https://example.com"
 					if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
@@ -304,3 +321,127 @@ func Test_request_with_body_has_JSON_content_type(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkHandler_ServeHTTP(b *testing.B) {
+	srv := restflex.NewHandlerWithContext(log.New(io.Discard, "", 0), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := &discardWriter{header: make(http.Header)}
+		for pb.Next() {
+			srv.ServeHTTP(w, req)
+		}
+	})
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func TestWithErrorMetadata(t *testing.T) {
+	t.Parallel()
+	notFound := httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.ErrNotFound
+	})
+	tests := []struct {
+		name     string
+		opts     []restflex.Option
+		metadata bool
+	}{
+		{name: "enabled", opts: []restflex.Option{restflex.WithErrorMetadata()}, metadata: true},
+		{name: "disabled"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := restflex.NewHandlerWithContext(resttest.NewLogger(), notFound, tt.opts...)
+			res := resttest.Get("/").WithHeader(restflex.RequestIDHeader, "req-1").To(api).Expect(t).
+				Status(http.StatusNotFound).
+				Error(restflex.ErrNotFound.Errors()...)
+			var msg restflex.ErrorMessage
+			if err := json.Unmarshal(res.Body, &msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.metadata {
+				if msg.Status != 0 || msg.RequestID != "" || msg.Timestamp != "" {
+					t.Errorf("expected no metadata, got %+v", msg)
+				}
+				return
+			}
+			if msg.Status != http.StatusNotFound || msg.RequestID != "req-1" {
+				t.Errorf("expected status and request ID, got %+v", msg)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, msg.Timestamp); err != nil {
+				t.Errorf("expected timestamp, got %q", msg.Timestamp)
+			}
+		})
+	}
+}
+
+func TestIncidentReference(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return errors.New("database unavailable")
+	}))
+	res := resttest.Get("/").To(api).Expect(t).
+		Status(http.StatusInternalServerError).
+		Error(http.StatusText(http.StatusInternalServerError))
+	var msg restflex.ErrorMessage
+	if err := json.Unmarshal(res.Body, &msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msg.Incident) != 10 {
+		t.Fatalf("expected incident reference, got %q", msg.Incident)
+	}
+	logger.ExpectCount(t, "incident "+msg.Incident+": database unavailable", 1)
+
+	resttest.Get("/").To(restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.ErrNotFound
+	}))).Expect(t).Status(http.StatusNotFound)
+	logger.ExpectCount(t, "incident", 1)
+}
+
+func TestNotFoundOrGone(t *testing.T) {
+	t.Parallel()
+	deletedAt := map[string]time.Time{
+		"1": {},
+		"2": time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("EET", 2*60*60)),
+	}
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return restflex.NotFoundOrGone("order", deletedAt[r.URL.Query().Get("id")])
+	}))
+
+	res := resttest.Get("/orders").WithQuery("id", "1").To(api).Expect(t).
+		Status(http.StatusNotFound).
+		Error(restflex.ErrNotFound.Errors()...)
+	if strings.Contains(string(res.Body), "details") {
+		t.Errorf("expected no details, got %s", res.Body)
+	}
+	resttest.Get("/orders").WithQuery("id", "2").To(api).Expect(t).
+		Status(http.StatusGone).
+		Error("order has been deleted").
+		JSONPath("$.details.resource", "order").
+		JSONPath("$.details.deleted_at", "2024-03-01T10:00:00Z")
+}
+
+func TestDetailedError_wrapped(t *testing.T) {
+	t.Parallel()
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		err := restflex.NewDetailedError(restflex.NewAPIError(http.StatusConflict, nil, "order is locked"), map[string]any{"order": "1"})
+		return restflex.NewRetryAfterError(err, time.Second)
+	}))
+	resttest.Get("/orders/1").To(api).Expect(t).
+		Status(http.StatusConflict).
+		Header("Retry-After", "1").
+		Error("order is locked").
+		JSONPath("$.details.order", "1")
+}
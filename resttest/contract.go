@@ -0,0 +1,581 @@
+package resttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Contract is an OpenAPI 3 document which requests and responses of an API
+// are validated against, so that tests fail when the implementation drifts
+// from the published contract. The document is typically the one produced
+// for the routes of the API:
+//
+//	routes := restflex.NewRoutes(http.NewServeMux())
+//	// register the routes
+//	contract := resttest.NewContract(t, restflex.OpenAPISpec("orders", "", routes.Patterns()))
+//	resttest.Get("/orders/1").To(routes).Expect(t).Status(http.StatusOK).Conforms(contract)
+//
+// A request has to match an operation of the document and carry its
+// required parameters. A response has to have a documented status code,
+// either exactly, by its class such as 4XX, or by default. JSON bodies are
+// validated against the schemas of the documented media types; bodies of
+// operations and responses without documented content are not checked.
+//
+// Schemas support local $refs, type (including lists of types and
+// nullable), enum, const, properties, required, additionalProperties,
+// items, allOf, anyOf, oneOf, minimum, maximum, minLength, maxLength,
+// pattern, minItems, maxItems and the date-time format.
+type Contract struct {
+	doc   map[string]any
+	paths []contractPath
+}
+
+// contractPath is a path template of the document such as /orders/{id}.
+type contractPath struct {
+	segments []string
+	item     map[string]any
+}
+
+// NewContract returns the contract of doc, which is an OpenAPI document
+// encoded as JSON or a value encoded as one, such as the map returned by
+// restflex.OpenAPISpec. The test fails if doc is not an OpenAPI 3 document.
+func NewContract(t testing.TB, doc any) *Contract {
+	t.Helper()
+	c, err := ParseContract(doc)
+	if err != nil {
+		t.Fatalf("resttest: contract: %v", err)
+	}
+	return c
+}
+
+// ParseContract returns the contract of doc like NewContract, or an error.
+func ParseContract(doc any) (*Contract, error) {
+	data, ok := doc.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	c := &Contract{}
+	if err := json.Unmarshal(data, &c.doc); err != nil {
+		return nil, err
+	}
+	if v, _ := c.doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		return nil, fmt.Errorf("not an OpenAPI 3 document: openapi %q", v)
+	}
+	paths, _ := c.doc["paths"].(map[string]any)
+	templates := make([]string, 0, len(paths))
+	for template := range paths {
+		templates = append(templates, template)
+	}
+	slices.Sort(templates)
+	for _, template := range templates {
+		item, _ := c.resolve(paths[template]).(map[string]any)
+		c.paths = append(c.paths, contractPath{
+			segments: strings.Split(strings.Trim(template, "/"), "/"),
+			item:     item,
+		})
+	}
+	return c, nil
+}
+
+// Handler returns a handler serving requests with h and reporting requests
+// and responses not conforming to the contract to t, for validating all of
+// the traffic of a test.
+func (c *Contract) Handler(t testing.TB, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Helper()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("resttest: %v %v: reading request body: %v", r.Method, r.URL.Path, err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := c.ValidateRequest(r, body); err != nil {
+			t.Error(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if err := c.ValidateResponse(r, rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+			t.Error(err)
+		}
+		for key, values := range rec.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+	})
+}
+
+// Conforms asserts that the request and the response conform to contract.
+func (r *Response) Conforms(contract *Contract) *Response {
+	r.t.Helper()
+	if err := contract.ValidateRequest(r.req, r.reqBody); err != nil {
+		r.t.Error(err)
+	}
+	if err := contract.ValidateResponse(r.req, r.StatusCode, r.Response.Header, r.Body); err != nil {
+		r.t.Error(err)
+	}
+	return r
+}
+
+// ValidateRequest returns an error describing how r with body does not
+// conform to the contract, or nil.
+func (c *Contract) ValidateRequest(r *http.Request, body []byte) error {
+	item, op, params, err := c.operation(r)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range c.parameters(item, op) {
+		name, _ := p["name"].(string)
+		in, _ := p["in"].(string)
+		required, _ := p["required"].(bool)
+		values := parameterValues(r, in, name, params)
+		if len(values) == 0 {
+			if required || in == "path" {
+				errs = append(errs, fmt.Errorf("missing required %s parameter %q", in, name))
+			}
+			continue
+		}
+		schema, _ := c.resolve(p["schema"]).(map[string]any)
+		if schema == nil {
+			continue
+		}
+		errs = append(errs, c.validate(parameterValue(values, c.schemaTypes(schema)), schema, in+" parameter "+name)...)
+	}
+	if rb, ok := c.resolve(op["requestBody"]).(map[string]any); ok {
+		required, _ := rb["required"].(bool)
+		content, _ := rb["content"].(map[string]any)
+		switch {
+		case len(body) == 0 && required:
+			errs = append(errs, errors.New("missing required request body"))
+		case len(body) > 0:
+			errs = append(errs, c.validateContent(content, r.Header.Get("Content-Type"), body, "request body")...)
+		}
+	}
+	return contractError(r, "request", errs)
+}
+
+// ValidateResponse returns an error describing how a response to r with
+// status code, header and body does not conform to the contract, or nil.
+func (c *Contract) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	_, op, _, err := c.operation(r)
+	if err != nil {
+		return err
+	}
+	responses, _ := op["responses"].(map[string]any)
+	code := strconv.Itoa(status)
+	res, ok := responses[code]
+	if !ok {
+		res, ok = responses[code[:1]+"XX"]
+	}
+	if !ok {
+		res, ok = responses["default"]
+	}
+	if !ok {
+		return contractError(r, "response", []error{fmt.Errorf("undocumented status code %d", status)})
+	}
+	var errs []error
+	content, _ := c.resolve(res).(map[string]any)["content"].(map[string]any)
+	if len(content) > 0 && len(body) > 0 && r.Method != http.MethodHead {
+		errs = c.validateContent(content, header.Get("Content-Type"), body, "response body")
+	}
+	return contractError(r, "response "+code, errs)
+}
+
+func contractError(r *http.Request, what string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Errorf("resttest: %v %v: %s does not conform to the contract:\n\t%s", r.Method, r.URL.Path, what, strings.Join(msgs, "\n\t"))
+}
+
+// operation returns the path item and the operation matching r, and the
+// values of the path parameters. Paths with more literal segments take
+// precedence over paths with parameters.
+func (c *Contract) operation(r *http.Request) (item, op map[string]any, params map[string]string, err error) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	best := -1
+	for _, p := range c.paths {
+		if len(p.segments) != len(segments) {
+			continue
+		}
+		literals, values, ok := matchPath(p.segments, segments)
+		if !ok || literals <= best {
+			continue
+		}
+		if o, ok := p.item[strings.ToLower(r.Method)].(map[string]any); ok {
+			best, item, op, params = literals, p.item, o, values
+		}
+	}
+	if op == nil {
+		return nil, nil, nil, fmt.Errorf("resttest: %v %v: no operation in the contract", r.Method, r.URL.Path)
+	}
+	return item, op, params, nil
+}
+
+func matchPath(template, segments []string) (literals int, params map[string]string, ok bool) {
+	for i, t := range template {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if segments[i] == "" {
+				return 0, nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[t[1:len(t)-1]] = segments[i]
+			continue
+		}
+		if t != segments[i] {
+			return 0, nil, false
+		}
+		literals++
+	}
+	return literals, params, true
+}
+
+// parameters returns the parameters of op, overriding the parameters of
+// its path item with the same name and location.
+func (c *Contract) parameters(item, op map[string]any) []map[string]any {
+	var params []map[string]any
+	for _, list := range []any{item["parameters"], op["parameters"]} {
+		list, _ := list.([]any)
+		for _, p := range list {
+			p, ok := c.resolve(p).(map[string]any)
+			if !ok {
+				continue
+			}
+			params = slices.DeleteFunc(params, func(q map[string]any) bool {
+				return q["name"] == p["name"] && q["in"] == p["in"]
+			})
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+func parameterValues(r *http.Request, in, name string, path map[string]string) []string {
+	switch in {
+	case "path":
+		if v, ok := path[name]; ok {
+			return []string{v}
+		}
+	case "query":
+		return r.URL.Query()[name]
+	case "header":
+		return r.Header.Values(name)
+	case "cookie":
+		if cookie, err := r.Cookie(name); err == nil {
+			return []string{cookie.Value}
+		}
+	}
+	return nil
+}
+
+// parameterValue converts the values of a parameter to the JSON value
+// described by types. Values which can't be converted are returned as
+// strings to fail validation.
+func parameterValue(values []string, types []string) any {
+	if slices.Contains(types, "array") {
+		list := make([]any, 0, len(values))
+		for _, v := range values {
+			for _, s := range strings.Split(v, ",") {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	v := values[0]
+	switch {
+	case slices.Contains(types, "integer"), slices.Contains(types, "number"):
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case slices.Contains(types, "boolean"):
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// validateContent validates body of contentType against the documented
+// content.
+func (c *Contract) validateContent(content map[string]any, contentType string, body []byte, what string) []error {
+	if len(content) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return []error{fmt.Errorf("%s: invalid content type %q", what, contentType)}
+	}
+	media, ok := content[mediaType]
+	if !ok {
+		media, ok = content[mediaType[:strings.IndexByte(mediaType, '/')+1]+"*"]
+	}
+	if !ok {
+		media, ok = content["*/*"]
+	}
+	if !ok {
+		return []error{fmt.Errorf("%s: undocumented content type %q", what, mediaType)}
+	}
+	m, _ := c.resolve(media).(map[string]any)
+	schema, _ := c.resolve(m["schema"]).(map[string]any)
+	if schema == nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []error{fmt.Errorf("%s: %v", what, err)}
+	}
+	return c.validate(v, schema, what+": $")
+}
+
+// resolve returns the value referenced by a local $ref of v, or v.
+func (c *Contract) resolve(v any) any {
+	for range 32 {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v
+		}
+		v = c.lookup(ref)
+	}
+	return nil
+}
+
+// lookup returns the value of the document at a local reference such as
+// #/components/schemas/Order.
+func (c *Contract) lookup(ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	var v any = c.doc
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[token]
+	}
+	return v
+}
+
+// schemaTypes returns the types allowed by schema.
+func (c *Contract) schemaTypes(schema map[string]any) []string {
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = append(types, t)
+	case []any:
+		for _, t := range t {
+			if t, ok := t.(string); ok {
+				types = append(types, t)
+			}
+		}
+	}
+	if nullable, _ := schema["nullable"].(bool); nullable {
+		types = append(types, "null")
+	}
+	return types
+}
+
+// validate returns the errors of validating v against schema. The errors
+// are prefixed with path.
+func (c *Contract) validate(v any, schema map[string]any, path string) []error {
+	schema, _ = c.resolve(schema).(map[string]any)
+	if schema == nil {
+		return nil
+	}
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	for _, s := range schemaList(schema["allOf"]) {
+		errs = append(errs, c.validate(v, s, path)...)
+	}
+	if list := schemaList(schema["anyOf"]); len(list) > 0 && c.matches(v, list) == 0 {
+		fail("does not match any schema of anyOf")
+	}
+	if list := schemaList(schema["oneOf"]); len(list) > 0 {
+		if n := c.matches(v, list); n != 1 {
+			fail("matches %d schemas of oneOf instead of one", n)
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		fail("%s is not one of %s", jsonString(v), jsonString(enum))
+	}
+	if want, ok := schema["const"]; ok && !reflect.DeepEqual(want, v) {
+		fail("expected %s, got %s", jsonString(want), jsonString(v))
+	}
+	if types := c.schemaTypes(schema); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(v, t) }) {
+		fail("expected %s, got %s", strings.Join(types, " or "), jsonType(v))
+		return errs
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := v[name]; !ok {
+					fail("missing required property %q", name)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if s, ok := properties[name].(map[string]any); ok {
+				errs = append(errs, c.validate(v[name], s, path+"."+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unknown property %q", name)
+				}
+			case map[string]any:
+				errs = append(errs, c.validate(v[name], additional, path+"."+name)...)
+			}
+		}
+	case []any:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, e := range v {
+				errs = append(errs, c.validate(e, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema, "minLength"); ok && n < min {
+			fail("expected at least %v characters, got %q", min, v)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && n > max {
+			fail("expected at most %v characters, got %q", max, v)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil {
+				fail("invalid pattern %q: %v", pattern, err)
+			} else if !re.MatchString(v) {
+				fail("%q does not match pattern %q", v, pattern)
+			}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				fail("%q is not a date-time", v)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && v < min {
+			fail("expected at least %v, got %v", min, v)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && v > max {
+			fail("expected at most %v, got %v", max, v)
+		}
+	}
+	return errs
+}
+
+// matches returns the number of schemas v is valid against.
+func (c *Contract) matches(v any, schemas []map[string]any) int {
+	n := 0
+	for _, s := range schemas {
+		if len(c.validate(v, s, "")) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func schemaList(v any) []map[string]any {
+	list, _ := v.([]any)
+	schemas := make([]map[string]any, 0, len(list))
+	for _, s := range list {
+		if s, ok := s.(map[string]any); ok {
+			schemas = append(schemas, s)
+		}
+	}
+	return schemas
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+// hasType reports whether the JSON value v is of the JSON schema type t.
+func hasType(v any, t string) bool {
+	if t == "number" {
+		_, ok := v.(float64)
+		return ok
+	}
+	if t == "integer" {
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	}
+	return jsonType(v) == t
+}
+
+// jsonType returns the JSON schema type of the JSON value v.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,178 @@
+//go:build !integration
+
+package resttest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+const usersContract = `{
+	"openapi": "3.1.0",
+	"info": {"title": "users", "version": "1.0.0"},
+	"paths": {
+		"/users": {
+			"post": {
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}
+				},
+				"responses": {
+					"201": {"description": "created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+					"4XX": {"description": "error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+				}
+			}
+		},
+		"/users/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+			"get": {
+				"parameters": [{"name": "name", "in": "query", "required": true, "schema": {"type": "string", "minLength": 1}}],
+				"responses": {
+					"200": {"description": "user", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}
+				}
+			}
+		},
+		"/users/me": {
+			"get": {
+				"responses": {"200": {"description": "user"}}
+			}
+		}
+	},
+	"components": {
+		"schemas": {
+			"User": {
+				"type": "object",
+				"required": ["id", "name"],
+				"additionalProperties": false,
+				"properties": {
+					"id": {"type": "integer", "minimum": 1},
+					"name": {"type": "string"},
+					"roles": {"type": "array", "items": {"type": "string", "enum": ["admin", "member"]}}
+				}
+			},
+			"Error": {
+				"type": "object",
+				"required": ["errors"],
+				"properties": {"errors": {"type": "array", "items": {"type": "string"}}}
+			}
+		}
+	}
+}`
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+	contract := resttest.NewContract(t, []byte(usersContract))
+	api := newAPI()
+	resttest.Get("/users/1").WithQuery("name", "Ada").To(api).Expect(t).Status(http.StatusOK).Conforms(contract)
+	resttest.Post("/users").WithJSON(map[string]any{"id": 2, "name": "Grace", "roles": []string{"member"}}).To(api).Expect(t).Status(http.StatusCreated).Conforms(contract)
+	resttest.Post("/users").WithJSON(map[string]any{"id": 2, "name": ""}).To(api).Expect(t).Status(http.StatusBadRequest).Conforms(contract)
+
+	srv := resttest.NewServer(t, contract.Handler(t, api))
+	srv.Get("/users/1").WithQuery("name", "Ada").Expect(t).Status(http.StatusOK)
+}
+
+func TestContract_ValidateRequest(t *testing.T) {
+	t.Parallel()
+	contract := resttest.NewContract(t, []byte(usersContract))
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   string
+	}{
+		{name: "valid", method: http.MethodGet, target: "/users/1?name=Ada"},
+		{name: "literal path", method: http.MethodGet, target: "/users/me"},
+		{name: "unknown operation", method: http.MethodDelete, target: "/users/1", want: "no operation in the contract"},
+		{name: "unknown path", method: http.MethodGet, target: "/orders", want: "no operation in the contract"},
+		{name: "invalid path parameter", method: http.MethodGet, target: "/users/ada?name=Ada", want: "path parameter id: expected integer, got string"},
+		{name: "missing query parameter", method: http.MethodGet, target: "/users/1", want: `missing required query parameter "name"`},
+		{name: "empty query parameter", method: http.MethodGet, target: "/users/1?name=", want: "query parameter name: expected at least 1 characters"},
+		{name: "missing body", method: http.MethodPost, target: "/users", want: "missing required request body"},
+		{name: "invalid body", method: http.MethodPost, target: "/users", body: `{"id":1,"name":"Ada","roles":["root"]}`, want: `request body: $.roles[0]: "root" is not one of ["admin","member"]`},
+		{name: "unknown property", method: http.MethodPost, target: "/users", body: `{"id":1,"name":"Ada","email":"ada@example.com"}`, want: `unknown property "email"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set("Content-Type", "application/json")
+			err := contract.ValidateRequest(r, []byte(tt.body))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("expected a valid request, but got %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("expected error %q, but got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestContract_ValidateResponse(t *testing.T) {
+	t.Parallel()
+	contract := resttest.NewContract(t, []byte(usersContract))
+	tests := []struct {
+		name        string
+		target      string
+		status      int
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "valid", target: "/users/1", status: http.StatusOK, contentType: "application/json", body: `{"id":1,"name":"Ada"}`},
+		{name: "undocumented content", target: "/users/me", status: http.StatusOK, contentType: "text/plain", body: "Ada"},
+		{name: "undocumented status", target: "/users/1", status: http.StatusNotFound, want: "undocumented status code 404"},
+		{name: "undocumented content type", target: "/users/1", status: http.StatusOK, contentType: "text/html", body: "<p>Ada</p>", want: `undocumented content type "text/html"`},
+		{name: "missing property", target: "/users/1", status: http.StatusOK, contentType: "application/json", body: `{"id":1}`, want: `$: missing required property "name"`},
+		{name: "wrong type", target: "/users/1", status: http.StatusOK, contentType: "application/json; charset=utf-8", body: `{"id":1.5,"name":"Ada"}`, want: "$.id: expected integer, got number"},
+		{name: "minimum", target: "/users/1", status: http.StatusOK, contentType: "application/json", body: `{"id":0,"name":"Ada"}`, want: "$.id: expected at least 1, got 0"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			header := http.Header{"Content-Type": {tt.contentType}}
+			err := contract.ValidateResponse(r, tt.status, header, []byte(tt.body))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("expected a valid response, but got %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("expected error %q, but got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestContract_OpenAPISpec(t *testing.T) {
+	t.Parallel()
+	routes := restflex.NewRoutes(http.NewServeMux())
+	routes.Handle("GET /contract/orders/{id}", restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if r.PathValue("id") == "missing" {
+			return restflex.ErrNotFound
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})))
+	restflex.DeclareErrors("GET /contract/orders/{id}", restflex.ErrNotFound)
+	contract := resttest.NewContract(t, restflex.OpenAPISpec("orders", "", routes.Patterns()))
+	resttest.Get("/contract/orders/1").To(routes).Expect(t).Status(http.StatusNoContent).Conforms(contract)
+	resttest.Get("/contract/orders/missing").To(routes).Expect(t).Status(http.StatusNotFound).Conforms(contract)
+
+	r := httptest.NewRequest(http.MethodGet, "/contract/orders/missing", nil)
+	header := http.Header{"Content-Type": {"application/json"}}
+	if err := contract.ValidateResponse(r, http.StatusNotFound, header, []byte(`{"errors":"not found"}`)); err == nil || !strings.Contains(err.Error(), "$.errors: expected array, got string") {
+		t.Errorf("expected the error message schema to be enforced, but got %v", err)
+	}
+	if _, err := resttest.ParseContract([]byte(`{"swagger":"2.0"}`)); err == nil {
+		t.Error("expected an error parsing a Swagger 2.0 document")
+	}
+}
@@ -0,0 +1,57 @@
+package resttest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookup returns the value at path in a decoded JSON document. Paths start
+// with "$" followed by ".name" object member and "[n]" array index steps.
+func lookup(doc any, path string) (any, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("JSON path %q must start with $", path)
+	}
+	v := doc
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("JSON path %q: %q is not an object", path, name)
+			}
+			if v, ok = obj[name]; !ok {
+				return nil, fmt.Errorf("JSON path %q: no member %q", path, name)
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %q: unterminated index", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("JSON path %q: invalid index %q", path, rest[1:end])
+			}
+			rest = rest[end+1:]
+			arr, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("JSON path %q: index %d of a non-array", path, i)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("JSON path %q: index %d out of range", path, i)
+			}
+			v = arr[i]
+		default:
+			return nil, fmt.Errorf("JSON path %q: unexpected %q", path, rest)
+		}
+	}
+	return v, nil
+}
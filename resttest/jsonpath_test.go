@@ -0,0 +1,42 @@
+//go:build !integration
+
+package resttest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"a":{"b":[{"c":1},{"c":2}]},"d":"x"}`), &doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		path    string
+		want    any
+		wantErr bool
+	}{
+		{path: "$", want: doc},
+		{path: "$.d", want: "x"},
+		{path: "$.a.b[1].c", want: 2.0},
+		{path: "$.a.b[2]", wantErr: true},
+		{path: "$.missing", wantErr: true},
+		{path: "$.d[0]", wantErr: true},
+		{path: "a.b", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+			got, err := lookup(doc, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
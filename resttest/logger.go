@@ -0,0 +1,124 @@
+package resttest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Level is the severity of a logged line.
+type Level string
+
+const (
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// Entry is a logged line.
+type Entry struct {
+	Level   Level
+	Message string
+}
+
+// Logger records logged lines for assertions. It can be used wherever
+// restflex expects an infra.Logger. The level of a line is taken from a
+// leading "debug:", "info:", "warn:" or "error:", optionally after a
+// "restflex:" prefix, and is LevelInfo otherwise.
+type Logger struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+func (l *Logger) Printf(format string, v ...any) {
+	l.record(fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Print(v ...any) {
+	l.record(fmt.Sprint(v...))
+}
+
+func (l *Logger) Println(v ...any) {
+	l.record(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+func (l *Logger) record(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, Entry{Level: levelOf(msg), Message: msg})
+}
+
+func levelOf(msg string) Level {
+	msg = strings.TrimPrefix(msg, "restflex: ")
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.HasPrefix(msg, string(level)+":") {
+			return level
+		}
+	}
+	return LevelInfo
+}
+
+// Entries returns the logged lines in order.
+func (l *Logger) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry(nil), l.entries...)
+}
+
+// Reset forgets the logged lines.
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+// Count returns the number of logged lines containing substr.
+func (l *Logger) Count(substr string) int {
+	n := 0
+	for _, e := range l.Entries() {
+		if strings.Contains(e.Message, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// CountLevel returns the number of lines logged at level.
+func (l *Logger) CountLevel(level Level) int {
+	n := 0
+	for _, e := range l.Entries() {
+		if e.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// ExpectCount asserts that exactly n logged lines contain substr.
+func (l *Logger) ExpectCount(t testing.TB, substr string, n int) {
+	t.Helper()
+	if got := l.Count(substr); got != n {
+		t.Errorf("expected %d log lines containing %q, got %d:\n%v", n, substr, got, l)
+	}
+}
+
+// ExpectNone asserts that no logged line contains substr.
+func (l *Logger) ExpectNone(t testing.TB, substr string) {
+	t.Helper()
+	l.ExpectCount(t, substr, 0)
+}
+
+// String returns the logged lines, one per line.
+func (l *Logger) String() string {
+	var b strings.Builder
+	for _, e := range l.Entries() {
+		fmt.Fprintf(&b, "[%v] %v\n", e.Level, e.Message)
+	}
+	return b.String()
+}
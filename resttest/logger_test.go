@@ -0,0 +1,30 @@
+//go:build !integration
+
+package resttest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	api := restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusInternalServerError)
+		return errors.New("database is down")
+	}))
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusInternalServerError)
+
+	logger.ExpectCount(t, "server error", 1)
+	logger.ExpectNone(t, "client error")
+	if n := logger.CountLevel(resttest.LevelError); n == 0 {
+		t.Errorf("expected error level lines, got:\n%v", logger)
+	}
+}
@@ -0,0 +1,51 @@
+package resttest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"kkn.fi/restflex"
+)
+
+// Mock is an http.Handler serving canned responses registered for route
+// patterns, letting clients be developed against an API without running
+// its real handlers. Requests matching no pattern get a JSON 404 response.
+type Mock struct {
+	mux *http.ServeMux
+}
+
+func NewMock() *Mock {
+	return &Mock{
+		mux: http.NewServeMux(),
+	}
+}
+
+// JSON registers a response with status and body encoded as JSON for
+// pattern, such as "GET /users/{id}". Patterns follow http.ServeMux.
+func (m *Mock) JSON(pattern string, status int, body any) *Mock {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		panic("resttest: mock " + pattern + ": " + err.Error())
+	}
+	m.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write(encoded)
+	})
+	return m
+}
+
+// Error registers a restflex.ErrorMessage response with status for pattern.
+func (m *Mock) Error(pattern string, status int, messages ...string) *Mock {
+	return m.JSON(pattern, status, restflex.NewErrorMessage(messages...))
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := m.mux.Handler(r); pattern == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(restflex.NewErrorMessage("no mock response for " + r.Method + " " + r.URL.Path))
+		return
+	}
+	m.mux.ServeHTTP(w, r)
+}
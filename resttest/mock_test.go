@@ -0,0 +1,27 @@
+//go:build !integration
+
+package resttest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex/resttest"
+)
+
+func TestMock(t *testing.T) {
+	t.Parallel()
+	mock := resttest.NewMock().
+		JSON("GET /users/{id}", http.StatusOK, map[string]any{"id": 1, "name": "Ada"}).
+		Error("DELETE /users/{id}", http.StatusForbidden, "not allowed")
+
+	resttest.Get("/users/1").To(mock).Expect(t).
+		Status(http.StatusOK).
+		JSONPath("$.name", "Ada")
+	resttest.Delete("/users/1").To(mock).Expect(t).
+		Status(http.StatusForbidden).
+		Error("not allowed")
+	resttest.Get("/groups").To(mock).Expect(t).
+		Status(http.StatusNotFound).
+		Error("no mock response for GET /groups")
+}
@@ -0,0 +1,102 @@
+package resttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+
+	"kkn.fi/restflex"
+)
+
+// Response is a response whose assertions report failures to the test.
+// Assertions return the response for chaining.
+type Response struct {
+	*http.Response
+	// Body is the response body.
+	Body []byte
+
+	t    testing.TB
+	name string
+	// req and reqBody are the request the response was received for.
+	req     *http.Request
+	reqBody []byte
+}
+
+// Status asserts the response status code.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.StatusCode != code {
+		r.t.Errorf("%v: expected status code %d, but got %d: %s", r.name, code, r.StatusCode, r.Body)
+	}
+	return r
+}
+
+// Header asserts the value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Response.Header.Get(key); got != value {
+		r.t.Errorf("%v: expected header %v %q, got %q", r.name, key, value, got)
+	}
+	return r
+}
+
+// JSON decodes the response body into v.
+func (r *Response) JSON(v any) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Errorf("%v: decoding response body: %v: %s", r.name, err, r.Body)
+	}
+	return r
+}
+
+// JSONPath asserts the value at a JSON path such as "$.items[0].id". Want is
+// compared with the value after converting both to their JSON
+// representation, so numbers of any Go type compare equal.
+func (r *Response) JSONPath(path string, want any) *Response {
+	r.t.Helper()
+	var doc any
+	if err := json.Unmarshal(r.Body, &doc); err != nil {
+		r.t.Errorf("%v: decoding response body: %v: %s", r.name, err, r.Body)
+		return r
+	}
+	got, err := lookup(doc, path)
+	if err != nil {
+		r.t.Errorf("%v: %v", r.name, err)
+		return r
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		r.t.Errorf("%v: encoding expected value: %v", r.name, err)
+		return r
+	}
+	var normalized any
+	if err := json.Unmarshal(wantJSON, &normalized); err != nil {
+		r.t.Errorf("%v: decoding expected value: %v", r.name, err)
+		return r
+	}
+	if !reflect.DeepEqual(got, normalized) {
+		gotJSON, _ := json.Marshal(got)
+		r.t.Errorf("%v: expected %v to be %s, got %s", r.name, path, wantJSON, gotJSON)
+	}
+	return r
+}
+
+// Error asserts that the response is a restflex.ErrorMessage containing the
+// given messages.
+func (r *Response) Error(messages ...string) *Response {
+	r.t.Helper()
+	var msg restflex.ErrorMessage
+	if err := json.NewDecoder(bytes.NewReader(r.Body)).Decode(&msg); err != nil {
+		r.t.Errorf("%v: expected error message, got %s", r.name, r.Body)
+		return r
+	}
+	for _, m := range messages {
+		if !slices.Contains(msg.Errors, m) {
+			r.t.Errorf("%v: expected error %q, got %q", r.name, m, msg.Errors)
+		}
+	}
+	return r
+}
@@ -0,0 +1,200 @@
+// Package resttest provides helpers for testing restflex APIs.
+//
+// Requests are built fluently and checked with chained assertions:
+//
+//	resttest.Get("/users/1").To(api).Expect(t).Status(200).JSONPath("$.id", 1)
+//
+// Requests are served in-process when sent To a handler, or over HTTP when
+// created with the methods of a Server.
+package resttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Server is an API under test served over HTTP.
+type Server struct {
+	*httptest.Server
+}
+
+// NewServer starts serving h. The server is closed when the test finishes.
+func NewServer(t testing.TB, h http.Handler) *Server {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return &Server{
+		Server: srv,
+	}
+}
+
+// Request returns a request with method and path sent to the server.
+func (s *Server) Request(method, path string) *Request {
+	r := NewRequest(method, path)
+	r.server = s
+	return r
+}
+
+func (s *Server) Get(path string) *Request {
+	return s.Request(http.MethodGet, path)
+}
+
+func (s *Server) Post(path string) *Request {
+	return s.Request(http.MethodPost, path)
+}
+
+func (s *Server) Put(path string) *Request {
+	return s.Request(http.MethodPut, path)
+}
+
+func (s *Server) Patch(path string) *Request {
+	return s.Request(http.MethodPatch, path)
+}
+
+func (s *Server) Delete(path string) *Request {
+	return s.Request(http.MethodDelete, path)
+}
+
+// Request is a request under construction.
+type Request struct {
+	method  string
+	path    string
+	query   url.Values
+	header  http.Header
+	host    string
+	body    []byte
+	bodyErr error
+	handler http.Handler
+	server  *Server
+}
+
+// NewRequest returns a request with method and path. Send it To a handler
+// before calling Expect.
+func NewRequest(method, path string) *Request {
+	return &Request{
+		method: method,
+		path:   path,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+func Get(path string) *Request {
+	return NewRequest(http.MethodGet, path)
+}
+
+func Post(path string) *Request {
+	return NewRequest(http.MethodPost, path)
+}
+
+func Put(path string) *Request {
+	return NewRequest(http.MethodPut, path)
+}
+
+func Patch(path string) *Request {
+	return NewRequest(http.MethodPatch, path)
+}
+
+func Delete(path string) *Request {
+	return NewRequest(http.MethodDelete, path)
+}
+
+// To sets the handler serving the request in-process.
+func (r *Request) To(h http.Handler) *Request {
+	r.handler = h
+	return r
+}
+
+// WithHeader adds a request header.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// WithHost sets the host the request is sent to, such as the Host header.
+func (r *Request) WithHost(host string) *Request {
+	r.host = host
+	return r
+}
+
+// WithQuery adds a query parameter.
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithBody sets the request body and its content type.
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+// WithJSON sets the request body to v encoded as JSON.
+func (r *Request) WithJSON(v any) *Request {
+	body, err := json.Marshal(v)
+	r.bodyErr = err
+	return r.WithBody("application/json", body)
+}
+
+func (r *Request) target() string {
+	if len(r.query) == 0 {
+		return r.path
+	}
+	return r.path + "?" + r.query.Encode()
+}
+
+// Expect sends the request and returns its response for assertions.
+func (r *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+	if r.bodyErr != nil {
+		t.Fatalf("resttest: encoding request body: %v", r.bodyErr)
+	}
+	var res *http.Response
+	switch {
+	case r.server != nil:
+		req, err := http.NewRequest(r.method, r.server.URL+r.target(), bytes.NewReader(r.body))
+		if err != nil {
+			t.Fatalf("resttest: %v", err)
+		}
+		req.Header = r.header.Clone()
+		if r.host != "" {
+			req.Host = r.host
+		}
+		res, err = r.server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("resttest: %v %v: %v", r.method, r.target(), err)
+		}
+	case r.handler != nil:
+		req := httptest.NewRequest(r.method, r.target(), bytes.NewReader(r.body))
+		req.Header = r.header.Clone()
+		if r.host != "" {
+			req.Host = r.host
+		}
+		rec := httptest.NewRecorder()
+		r.handler.ServeHTTP(rec, req)
+		res = rec.Result()
+	default:
+		t.Fatalf("resttest: %v %v: request has no handler or server", r.method, r.path)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("resttest: reading response body: %v", err)
+	}
+	req := httptest.NewRequest(r.method, r.target(), nil)
+	req.Header = r.header
+	return &Response{
+		Response: res,
+		Body:     body,
+		t:        t,
+		name:     r.method + " " + r.target(),
+		req:      req,
+		reqBody:  r.body,
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !integration
+
+package resttest_test
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type user struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+func newAPI() http.Handler {
+	return restflex.NewHandlerWithContext(log.Default(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if r.Method == http.MethodPost {
+			var u user
+			if err := restflex.DecodeJSON(r.Body, &u); err != nil {
+				return err
+			}
+			if u.Name == "" {
+				return restflex.NewBadRequest("name is required")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			return json.NewEncoder(w).Encode(u)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(user{ID: 1, Name: r.URL.Query().Get("name"), Roles: []string{"admin"}})
+	}))
+}
+
+func TestRequest_in_process(t *testing.T) {
+	t.Parallel()
+	api := newAPI()
+	resttest.Get("/users/1").WithQuery("name", "Ada").To(api).Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		JSONPath("$.id", 1).
+		JSONPath("$.name", "Ada").
+		JSONPath("$.roles[0]", "admin")
+	resttest.Post("/users").WithJSON(user{}).To(api).Expect(t).
+		Status(http.StatusBadRequest).
+		Error("name is required")
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	srv := resttest.NewServer(t, newAPI())
+	var got user
+	srv.Post("/users").WithJSON(user{ID: 2, Name: "Grace"}).Expect(t).
+		Status(http.StatusCreated).
+		JSON(&got)
+	if got.Name != "Grace" {
+		t.Errorf("expected name %q, got %q", "Grace", got.Name)
+	}
+}
@@ -0,0 +1,116 @@
+package resttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update resttest snapshot files in testdata")
+
+// timestampPattern matches RFC 3339 timestamps within JSON strings.
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`)
+
+// Snapshot asserts that the JSON response body matches the snapshot stored
+// in testdata/name.golden.json. Run tests with -update to write snapshots.
+func (r *Response) Snapshot(name string) *Response {
+	r.t.Helper()
+	Snapshot(r.t, name, r.Body)
+	return r
+}
+
+// Snapshot asserts that body, a JSON document, matches the snapshot stored in
+// testdata/name.golden.json. The document is canonicalized before comparison:
+// object keys are sorted, it is indented, and RFC 3339 timestamps are replaced
+// with a placeholder. Run tests with -update to write snapshots.
+func Snapshot(t testing.TB, name string, body []byte) {
+	t.Helper()
+	got, err := canonicalize(body)
+	if err != nil {
+		t.Fatalf("resttest: snapshot %v: %v", name, err)
+	}
+	file := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("resttest: snapshot %v: %v", name, err)
+		}
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatalf("resttest: snapshot %v: %v", name, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("resttest: snapshot %v: %v (run with -update to create it)", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("resttest: snapshot %v differs (run with -update to accept):\n%s", name, diff(string(want), string(got)))
+	}
+}
+
+func canonicalize(body []byte) ([]byte, error) {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	doc = normalizeTimestamps(doc)
+	// Maps are encoded with sorted keys.
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func normalizeTimestamps(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalizeTimestamps(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = normalizeTimestamps(e)
+		}
+	case string:
+		if timestampPattern.MatchString(v) {
+			if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return "<timestamp>"
+			}
+		}
+	}
+	return v
+}
+
+// diff returns the lines of want and got that differ, prefixed with - and +.
+func diff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		fmt.Fprintf(&b, "line %d:\n-%s\n+%s\n", i+1, w, g)
+	}
+	return b.String()
+}
@@ -0,0 +1,31 @@
+//go:build !integration
+
+package resttest
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Parallel()
+	got, err := canonicalize([]byte(`{"b":1,"a":{"created":"2024-01-02T03:04:05.123Z","n":1.50}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{
+  "a": {
+    "created": "<timestamp>",
+    "n": 1.50
+  },
+  "b": 1
+}
+`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+	Snapshot(t, "user", []byte(`{"name":"Ada","id":1,"updated":"2025-06-01T10:00:00+03:00"}`))
+}
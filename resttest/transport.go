@@ -0,0 +1,43 @@
+package resttest
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// Transport returns an http.RoundTripper serving requests with h in-process
+// without opening sockets, for fast tests of clients against an API.
+func Transport(h http.Handler) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		in := req.Clone(req.Context())
+		in.RequestURI = req.URL.RequestURI()
+		in.RemoteAddr = "192.0.2.1:1234"
+		if in.Host == "" {
+			in.Host = req.URL.Host
+		}
+		if in.Body == nil {
+			in.Body = http.NoBody
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, in)
+		res := rec.Result()
+		res.Request = req
+		return res, nil
+	})
+}
+
+// HTTPClient returns an http.Client serving requests with h in-process.
+func HTTPClient(h http.Handler) *http.Client {
+	return &http.Client{
+		Transport: Transport(h),
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,33 @@
+//go:build !integration
+
+package resttest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex/client"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	c, err := client.New("http://api.test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.HTTPClient = resttest.HTTPClient(newAPI())
+
+	var got user
+	if err := c.Post(context.Background(), "/users", user{ID: 3, Name: "Lin"}, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Name != "Lin" {
+		t.Errorf("expected name %q, got %q", "Lin", got.Name)
+	}
+	err = c.Post(context.Background(), "/users", user{}, nil)
+	if !client.IsStatus(err, http.StatusBadRequest) || err.Error() != "name is required" {
+		t.Errorf("expected 400 API error, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package restflex
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures retrying and hedging of idempotent upstream requests.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first.
+	MaxAttempts int
+	// PerTryTimeout limits the duration of a single attempt. Zero means no limit.
+	PerTryTimeout time.Duration
+	// Backoff is the base delay before a retry. It doubles on each retry up to
+	// MaxBackoff and is randomized with full jitter.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// HedgeDelay, if positive, starts another attempt when no response has
+	// arrived within the delay, using whichever response succeeds first.
+	HedgeDelay time.Duration
+	// Budget limits retries and hedged attempts in proportion to requests.
+	// A nil budget does not limit them.
+	Budget *RetryBudget
+}
+
+// Transport returns an http.RoundTripper applying the policy to requests
+// made with next.
+func (p *RetryPolicy) Transport(next http.RoundTripper) http.RoundTripper {
+	return &retryTransport{
+		next:   next,
+		policy: p,
+	}
+}
+
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Backoff << (retry - 1)
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// RetryBudget limits retries to a ratio of requests so that retries cannot
+// multiply load on an already failing upstream. Each request deposits Ratio
+// tokens up to Max and each retry withdraws one. A nil budget allows all
+// retries.
+type RetryBudget struct {
+	Ratio float64
+	Max   float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget returns a full budget allowing retries for ratio of
+// requests, saving up at most max retries.
+func NewRetryBudget(ratio float64, max int) *RetryBudget {
+	return &RetryBudget{
+		Ratio:  ratio,
+		Max:    float64(max),
+		tokens: float64(max),
+	}
+}
+
+// Deposit records a request, earning Ratio retries.
+func (b *RetryBudget) Deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.Max, b.tokens+b.Ratio)
+}
+
+// Withdraw spends a retry, reporting false if none is left.
+func (b *RetryBudget) Withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// isIdempotent reports whether requests with method may be safely repeated.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+type retryTransport struct {
+	next   http.RoundTripper
+	policy *RetryPolicy
+}
+
+type attemptResult struct {
+	n      int
+	res    *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// failed reports whether the attempt should be retried.
+func (a attemptResult) failed() bool {
+	if a.err != nil {
+		return true
+	}
+	switch a.res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (a attemptResult) discard() {
+	if a.res != nil {
+		_, _ = io.Copy(io.Discard, a.res.Body)
+		a.res.Body.Close()
+	}
+	a.cancel()
+}
+
+// response returns the result with the attempt context cancelled once the
+// response body is closed.
+func (a attemptResult) response() (*http.Response, error) {
+	if a.err != nil {
+		a.cancel()
+		return nil, a.err
+	}
+	a.res.Body = &cancelOnClose{ReadCloser: a.res.Body, cancel: a.cancel}
+	return a.res, nil
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := t.policy
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if p.MaxAttempts < 2 || !isIdempotent(req.Method) || !replayable {
+		return t.next.RoundTrip(req)
+	}
+	p.Budget.Deposit()
+	ctx := req.Context()
+	results := make(chan attemptResult, p.MaxAttempts)
+	var cancels []context.CancelFunc
+	pending := 0
+	start := func() {
+		var actx context.Context
+		var cancel context.CancelFunc
+		if p.PerTryTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, p.PerTryTimeout)
+		} else {
+			actx, cancel = context.WithCancel(ctx)
+		}
+		n := len(cancels)
+		cancels = append(cancels, cancel)
+		pending++
+		go func() {
+			r := t.attempt(req.Clone(actx), cancel)
+			r.n = n
+			results <- r
+		}()
+	}
+	start()
+
+	var hedge <-chan time.Time
+	if p.HedgeDelay > 0 {
+		hedge = time.After(p.HedgeDelay)
+	}
+	var last attemptResult
+loop:
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			if len(cancels) < p.MaxAttempts && p.Budget.Withdraw() {
+				start()
+				hedge = time.After(p.HedgeDelay)
+			}
+			continue
+		case r := <-results:
+			pending--
+			if last.cancel != nil {
+				last.discard()
+			}
+			last = r
+		}
+		if !last.failed() {
+			break
+		}
+		if pending > 0 {
+			// A hedged attempt is still in flight.
+			continue
+		}
+		if ctx.Err() != nil || len(cancels) >= p.MaxAttempts || !p.Budget.Withdraw() {
+			break
+		}
+		select {
+		case <-time.After(p.backoff(len(cancels))):
+			start()
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	if pending > 0 {
+		for n, cancel := range cancels {
+			if n != last.n {
+				cancel()
+			}
+		}
+		go drain(results, pending)
+	}
+	return last.response()
+}
+
+func (t *retryTransport) attempt(req *http.Request, cancel context.CancelFunc) attemptResult {
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return attemptResult{err: err, cancel: cancel}
+		}
+		req.Body = body
+	}
+	res, err := t.next.RoundTrip(req)
+	return attemptResult{res: res, err: err, cancel: cancel}
+}
+
+// drain releases the resources of attempts still in flight after a response
+// has been chosen.
+func drain(results <-chan attemptResult, pending int) {
+	for ; pending > 0; pending-- {
+		(<-results).discard()
+	}
+}
+
+// cancelOnClose cancels the context of a request when its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
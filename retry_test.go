@@ -0,0 +1,144 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func newProxy(t *testing.T, upstream http.Handler, policy *restflex.RetryPolicy) http.Handler {
+	t.Helper()
+	backend := httptest.NewServer(upstream)
+	t.Cleanup(backend.Close)
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return restflex.NewProxy(resttest.NewLogger(), target, policy)
+}
+
+func TestProxy_retries_idempotent_requests(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		failures   int32
+		wantStatus int
+		wantCalls  int32
+	}{
+		{
+			name:       "GET is retried",
+			method:     http.MethodGet,
+			failures:   2,
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name:       "GET gives up after max attempts",
+			method:     http.MethodGet,
+			failures:   5,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  3,
+		},
+		{
+			name:       "POST is not retried",
+			method:     http.MethodPost,
+			failures:   1,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			proxy := newProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = io.WriteString(w, "ok")
+			}), &restflex.RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     time.Millisecond,
+			})
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest(tt.method, "/", strings.NewReader("")))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status code %d, but got %d", tt.wantStatus, rec.Code)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestProxy_hedges_slow_requests(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	proxy := newProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		_, _ = io.WriteString(w, "fast")
+	}), &restflex.RetryPolicy{
+		MaxAttempts: 2,
+		HedgeDelay:  20 * time.Millisecond,
+	})
+	rec := httptest.NewRecorder()
+	begin := time.Now()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("expected hedged response quickly, took %v", elapsed)
+	}
+	if body := rec.Body.String(); body != "fast" {
+		t.Errorf("expected body %q, got %q", "fast", body)
+	}
+}
+
+func TestProxy_retry_budget(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	proxy := newProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}), &restflex.RetryPolicy{
+		MaxAttempts: 3,
+		Budget:      restflex.NewRetryBudget(0, 1),
+	})
+	for i := 0; i < 2; i++ {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 upstream calls with a budget of one retry, got %d", got)
+	}
+}
+
+func TestProxy_upstream_unavailable(t *testing.T) {
+	t.Parallel()
+	target, _ := url.Parse("http://127.0.0.1:1")
+	proxy := restflex.NewProxy(resttest.NewLogger(), target, nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status code %d, but got %d", http.StatusBadGateway, rec.Code)
+	}
+	if ct := rec.Result().Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected JSON error response, got content type %q", ct)
+	}
+}
@@ -0,0 +1,291 @@
+package restflex
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// Server serves a REST API over HTTP or HTTPS. HTTPS is served when
+// TLSConfig is set; see NewTLSConfig.
+//
+// Addr is a TCP address or, prefixed with "unix:", the path of a unix domain
+// socket. Listeners passed by systemd socket activation are served with
+// RunListener; see SystemdListeners. Run serves on the listener inherited
+// from a previous process instead of Addr; see Upgrade.
+type Server struct {
+	*http.Server
+	// Log logs messages
+	Log infra.Logger
+	// ShutdownTimeout is the time in-flight requests are given to complete
+	// when the server is shut down.
+	ShutdownTimeout time.Duration
+	// DrainLogInterval is the interval of logging the number of requests in
+	// flight during shutdown. Zero logs only the outcome.
+	DrainLogInterval time.Duration
+	// SocketMode is the file mode of a unix domain socket. Defaults to 0660.
+	SocketMode os.FileMode
+	// ChallengeAddr is the address serving ACME HTTP-01 challenges when
+	// certificates are managed with Autocert. Defaults to ":http".
+	ChallengeAddr string
+	// HTTP3 is an optional HTTP/3 server run alongside the server; see
+	// HTTP3Server.
+	HTTP3 HTTP3Server
+	// Methods are the request methods served; others are rejected with 405
+	// Method Not Allowed. Defaults to DefaultMethods.
+	Methods []string
+	// MaxConnections limits the number of concurrent connections. Zero
+	// means no limit.
+	MaxConnections int
+	// MaxConnectionsPerIP limits the number of concurrent connections of a
+	// client IP address. Zero means no limit.
+	MaxConnectionsPerIP int
+	// UpgradeSignals are signals upgrading the running server, such as
+	// syscall.SIGHUP; see Upgrade.
+	UpgradeSignals []os.Signal
+
+	challenge    http.Handler
+	admin        http.Handler
+	adminAddr    string
+	startupHooks []startupHook
+	ready        atomic.Bool
+	inFlight     atomic.Int64
+	draining     atomic.Bool
+	wrapped      bool
+
+	mu sync.Mutex
+	// listener is the listener of the running server and stop shuts it
+	// down, for Upgrade.
+	listener net.Listener
+	stop     context.CancelFunc
+}
+
+// Defaults of the http.Server created by NewServer protecting against slow
+// clients, such as slowloris attacks, and oversized headers. The zero values
+// of http.Server mean no limits.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultMaxHeaderBytes    = 64 << 10
+)
+
+// NewServer returns a server with safe defaults for the header read timeout,
+// idle timeout and header size. Read and write timeouts are left unset so as
+// not to cut off streaming responses; set them per route with Deadlines.
+func NewServer(l infra.Logger, addr string, h http.Handler) *Server {
+	return &Server{
+		Server: &http.Server{
+			Addr:              addr,
+			Handler:           h,
+			ReadHeaderTimeout: DefaultReadHeaderTimeout,
+			IdleTimeout:       DefaultIdleTimeout,
+			MaxHeaderBytes:    DefaultMaxHeaderBytes,
+		},
+		Log:             l,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// Run serves requests until ctx is done and then shuts the server down
+// gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	return s.RunListener(ctx, ln)
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	if ln, err := InheritedListener(); ln != nil || err != nil {
+		return ln, err
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+		if s.TLSConfig != nil {
+			addr = ":https"
+		}
+	}
+	return s.listenAddr(addr)
+}
+
+// listenAddr listens on a TCP address or a unix domain socket path prefixed
+// with "unix:".
+func (s *Server) listenAddr(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return s.listenUnix(path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (s *Server) listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		// Remove a socket left behind by a previous process.
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode := s.SocketMode
+	if mode == 0 {
+		mode = 0o660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// RunListener serves requests accepted on ln until ctx is done and then
+// shuts the server down gracefully.
+func (s *Server) RunListener(ctx context.Context, ln net.Listener) error {
+	if s.challenge != nil {
+		stop, err := s.serveChallenges()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		defer stop()
+	}
+	if s.admin != nil {
+		stop, err := s.serveAdmin()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		defer stop()
+	}
+	if s.HTTP3 != nil {
+		stop := s.serveHTTP3()
+		defer stop()
+	}
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	s.mu.Lock()
+	s.listener, s.stop = ln, stop
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.listener, s.stop = nil, nil
+		s.mu.Unlock()
+	}()
+	if len(s.UpgradeSignals) > 0 {
+		s.upgradeOnSignal(ctx)
+	}
+	if s.MaxConnections > 0 || s.MaxConnectionsPerIP > 0 {
+		// Connections over the limits get a 503 response over plain HTTP
+		// and are closed without one over TLS.
+		ln = newLimitListener(s.Log, ln, s.MaxConnections, s.MaxConnectionsPerIP, s.TLSConfig == nil)
+	}
+	if !s.wrapped {
+		methods := s.Methods
+		if methods == nil {
+			methods = DefaultMethods
+		}
+		s.Handler = s.trackInFlight(AllowMethods(s.Log, methods...)(s.handler()))
+		s.wrapped = true
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if s.TLSConfig != nil {
+			errc <- s.ServeTLS(ln, "", "")
+			return
+		}
+		errc <- s.Serve(ln)
+	}()
+	starting := make(chan error, 1)
+	go func() {
+		starting <- s.startup(ctx)
+	}()
+	var startupErr error
+	select {
+	case err := <-errc:
+		return err
+	case startupErr = <-starting:
+		if startupErr == nil {
+			s.ready.Store(true)
+			select {
+			case err := <-errc:
+				s.ready.Store(false)
+				return err
+			case <-ctx.Done():
+			}
+		}
+	case <-ctx.Done():
+	}
+	s.ready.Store(false)
+	s.Log.Printf("restflex: shutting down server on %v", ln.Addr())
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.ShutdownTimeout)
+	defer cancel()
+	if err := s.drain(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return startupErr
+}
+
+func (s *Server) handler() http.Handler {
+	if s.Handler == nil {
+		return http.DefaultServeMux
+	}
+	return s.Handler
+}
+
+// Upgrade passes the listener of the running server to a new instance of
+// the executable with Upgrade and shuts the server down gracefully: Run
+// returns once the requests in flight have completed, while the new process
+// accepts the new connections. Upgrade is called on UpgradeSignals.
+func (s *Server) Upgrade() (*os.Process, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil, errors.New("restflex: upgrade of a server not running")
+	}
+	p, err := Upgrade(s.listener)
+	if err != nil {
+		return nil, err
+	}
+	s.Log.Printf("restflex: upgraded server on %v to process %d", s.listener.Addr(), p.Pid)
+	s.stop()
+	s.listener, s.stop = nil, nil
+	return p, nil
+}
+
+// upgradeOnSignal upgrades the server on UpgradeSignals until ctx is done.
+func (s *Server) upgradeOnSignal(ctx context.Context) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, s.UpgradeSignals...)
+	go func() {
+		defer signal.Stop(sigc)
+		for {
+			select {
+			case <-sigc:
+				p, err := s.Upgrade()
+				if err != nil {
+					s.Log.Printf("error: restflex: %v", err)
+					continue
+				}
+				_ = p.Release()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,128 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_Run_unix_socket(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "api.sock")
+	srv := restflex.NewServer(resttest.NewLogger(), "unix:"+path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.SocketMode = 0o600
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	var (
+		res *http.Response
+		err error
+	)
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("http://api/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status code %d, but got %d", http.StatusNoContent, res.StatusCode)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("expected socket mode %v, got %v", os.FileMode(0o600), mode)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error on shutdown: %v", err)
+	}
+}
+
+func TestSystemdListeners_not_activated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := restflex.SystemdListeners()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(listeners) != 0 {
+		t.Errorf("expected no listeners for another process, got %v", listeners)
+	}
+	if v := os.Getenv("LISTEN_FDS"); v != "" {
+		t.Errorf("expected LISTEN_FDS to be unset, got %q", v)
+	}
+}
+
+func TestNewServer_defaults(t *testing.T) {
+	t.Parallel()
+	srv := restflex.NewServer(resttest.NewLogger(), ":0", http.NotFoundHandler())
+	if srv.ReadHeaderTimeout != restflex.DefaultReadHeaderTimeout {
+		t.Errorf("expected read header timeout %v, got %v", restflex.DefaultReadHeaderTimeout, srv.ReadHeaderTimeout)
+	}
+	if srv.IdleTimeout != restflex.DefaultIdleTimeout {
+		t.Errorf("expected idle timeout %v, got %v", restflex.DefaultIdleTimeout, srv.IdleTimeout)
+	}
+	if srv.MaxHeaderBytes != restflex.DefaultMaxHeaderBytes {
+		t.Errorf("expected max header bytes %v, got %v", restflex.DefaultMaxHeaderBytes, srv.MaxHeaderBytes)
+	}
+}
+
+func TestServer_slow_headers(t *testing.T) {
+	t.Parallel()
+	srv := restflex.NewServer(resttest.NewLogger(), "127.0.0.1:0", http.NotFoundHandler())
+	srv.ReadHeaderTimeout = 50 * time.Millisecond
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = srv.RunListener(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: api\r\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var b [1]byte
+	start := time.Now()
+	for {
+		if _, err := conn.Read(b[:]); err != nil {
+			break
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected connection with incomplete headers to be closed, waited %v", d)
+	}
+}
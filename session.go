@@ -0,0 +1,284 @@
+package restflex
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// CookieCodec encrypts and authenticates cookie values with AES-GCM so that
+// clients can neither read nor modify them.
+type CookieCodec struct {
+	aead cipher.AEAD
+}
+
+// NewCookieCodec returns a codec using key, which must be 16, 24 or 32
+// random bytes.
+func NewCookieCodec(key []byte) (*CookieCodec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CookieCodec{aead: aead}, nil
+}
+
+// Encode returns value sealed for the cookie name.
+func (c *CookieCodec) Encode(name string, value []byte) string {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(value)+c.aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return base64.RawURLEncoding.EncodeToString(c.aead.Seal(nonce, nonce, value, []byte(name)))
+}
+
+// Decode returns the value sealed by Encode for the cookie name.
+func (c *CookieCodec) Decode(name, encoded string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < c.aead.NonceSize() {
+		return nil, errors.New("restflex: cookie value too short")
+	}
+	nonce, sealed := b[:c.aead.NonceSize()], b[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, sealed, []byte(name))
+}
+
+// SessionStore stores session values on the server side, keyed by session
+// ID, when they should not be kept in the cookie.
+type SessionStore interface {
+	// Load returns the values of session id. Found is false if there is no
+	// such session or it has expired.
+	Load(ctx context.Context, id string) (values map[string]string, found bool, err error)
+	Save(ctx context.Context, id string, values map[string]string, expires time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Session is the session of a request.
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	oldID     string
+	values    map[string]string
+	changed   bool
+	destroyed bool
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Get returns the value of key or an empty string.
+func (s *Session) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// Set sets the value of key.
+func (s *Session) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.changed = true
+}
+
+// Delete removes key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.changed = true
+}
+
+// Renew gives the session a new ID, keeping its values. Call it when the
+// privilege level changes, such as on login, to prevent session fixation.
+// The session stored under the old ID is deleted; without a Store, the old
+// cookie value stays valid until it expires.
+func (s *Session) Renew() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = newSessionID()
+	s.changed = true
+}
+
+// Destroy removes the session and its cookie, e.g. on logout. Without a
+// Store, a copy of the cookie stays valid until it expires.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]string)
+	s.destroyed = true
+	s.changed = true
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type sessionContextKey struct{}
+
+// SessionFrom returns the session of the request.
+func SessionFrom(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionContextKey{}).(*Session)
+	return s, ok
+}
+
+// Sessions is a middleware providing cookie based sessions for first-party
+// browser clients which can't hold bearer tokens safely. Session cookies are
+// encrypted with Codec and are HttpOnly. Session values are kept in the
+// cookie unless Store is set, in which case the cookie holds only the
+// session ID.
+//
+// Without a Store nothing on the server records which sessions exist, so a
+// session can't be revoked: a copy of its cookie, such as one captured
+// before Renew or Destroy, stays valid until MaxAge has passed. Set a Store
+// where sessions must end on logout or login.
+type Sessions struct {
+	Codec *CookieCodec
+	// Store keeps session values on the server when set.
+	Store      SessionStore
+	CookieName string
+	Path       string
+	Domain     string
+	// MaxAge is the lifetime of a session since it was last changed.
+	MaxAge time.Duration
+	// Secure restricts the cookie to HTTPS. NewSessions sets it; a
+	// Sessions created otherwise sends the cookie over HTTP unless set.
+	Secure   bool
+	SameSite http.SameSite
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewSessions(l infra.Logger, codec *CookieCodec) *Sessions {
+	return &Sessions{
+		Codec:      codec,
+		CookieName: "session",
+		Path:       "/",
+		MaxAge:     24 * time.Hour,
+		Secure:     true,
+		SameSite:   http.SameSiteLaxMode,
+		Log:        l,
+	}
+}
+
+// sessionCookie is the encrypted content of a session cookie.
+type sessionCookie struct {
+	ID      string            `json:"id"`
+	Values  map[string]string `json:"values,omitempty"`
+	Expires int64             `json:"exp"`
+}
+
+// Wrap returns a handler loading the session of each request before calling
+// next and saving it when it has changed.
+func (s *Sessions) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := s.load(r)
+		sw := &hookWriter{ResponseWriter: w, hook: func() { s.save(w, r, session) }}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+		sw.runHook()
+	})
+}
+
+// load returns the session of r or a new empty one.
+func (s *Sessions) load(r *http.Request) *Session {
+	session := &Session{id: newSessionID(), values: make(map[string]string)}
+	cookie, err := r.Cookie(s.CookieName)
+	if err != nil {
+		return session
+	}
+	b, err := s.Codec.Decode(s.CookieName, cookie.Value)
+	if err != nil {
+		s.Log.Printf("restflex: session cookie: %v", err)
+		return session
+	}
+	var c sessionCookie
+	if err := json.Unmarshal(b, &c); err != nil || time.Now().Unix() >= c.Expires {
+		return session
+	}
+	if s.Store == nil {
+		session.id = c.ID
+		if c.Values != nil {
+			session.values = c.Values
+		}
+		return session
+	}
+	values, found, err := s.Store.Load(r.Context(), c.ID)
+	if err != nil {
+		s.Log.Printf("restflex: session store: %v", err)
+		return session
+	}
+	if found {
+		session.id = c.ID
+		session.values = values
+	}
+	return session
+}
+
+// save writes the session cookie if the session has changed.
+func (s *Sessions) save(w http.ResponseWriter, r *http.Request, session *Session) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if !session.changed {
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     s.CookieName,
+		Path:     s.Path,
+		Domain:   s.Domain,
+		Secure:   s.Secure,
+		HttpOnly: true,
+		SameSite: s.SameSite,
+	}
+	if s.Store != nil && session.oldID != "" {
+		if err := s.Store.Delete(r.Context(), session.oldID); err != nil {
+			s.Log.Printf("restflex: session store: %v", err)
+		}
+	}
+	if session.destroyed {
+		if s.Store != nil {
+			if err := s.Store.Delete(r.Context(), session.id); err != nil {
+				s.Log.Printf("restflex: session store: %v", err)
+			}
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		return
+	}
+	expires := time.Now().Add(s.MaxAge)
+	c := sessionCookie{ID: session.id, Expires: expires.Unix()}
+	if s.Store == nil {
+		c.Values = session.values
+	} else if err := s.Store.Save(r.Context(), session.id, session.values, expires); err != nil {
+		s.Log.Printf("restflex: session store: %v", err)
+		return
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		s.Log.Printf("restflex: session cookie: %v", err)
+		return
+	}
+	cookie.Value = s.Codec.Encode(s.CookieName, b)
+	cookie.MaxAge = int(s.MaxAge.Seconds())
+	http.SetCookie(w, cookie)
+}
@@ -0,0 +1,80 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestCookieCodec(t *testing.T) {
+	t.Parallel()
+	codec, err := restflex.NewCookieCodec(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoded := codec.Encode("session", []byte("alice"))
+	if got, err := codec.Decode("session", encoded); err != nil || string(got) != "alice" {
+		t.Errorf("expected %q, got %q (%v)", "alice", got, err)
+	}
+	if _, err := codec.Decode("other", encoded); err == nil {
+		t.Error("expected value of another cookie to be rejected")
+	}
+	tampered := []byte(encoded)
+	tampered[len(tampered)-1] ^= 'A' ^ 'B'
+	if _, err := codec.Decode("session", string(tampered)); err == nil {
+		t.Error("expected tampered value to be rejected")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+	codec, err := restflex.NewCookieCodec(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sessions := restflex.NewSessions(resttest.NewLogger(), codec)
+	h := sessions.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := restflex.SessionFrom(r.Context())
+		if !ok {
+			t.Fatal("expected session in context")
+		}
+		switch r.URL.Path {
+		case "/login":
+			session.Renew()
+			session.Set("user", "alice")
+		case "/logout":
+			session.Destroy()
+		}
+		_, _ = w.Write([]byte(session.Get("user")))
+	}))
+	serve := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("/"); len(rec.Result().Cookies()) != 0 {
+		t.Errorf("expected no cookie for an unchanged session, got %v", rec.Result().Cookies())
+	}
+	login := serve("/login").Result().Cookies()
+	if len(login) != 1 || !login[0].HttpOnly || !login[0].Secure || login[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("expected a secure session cookie, got %v", login)
+	}
+	if body := serve("/", login...).Body.String(); body != "alice" {
+		t.Errorf("expected session value %q, got %q", "alice", body)
+	}
+	logout := serve("/logout", login...).Result().Cookies()
+	if len(logout) != 1 || logout[0].MaxAge >= 0 {
+		t.Errorf("expected session cookie to be removed, got %v", logout)
+	}
+}
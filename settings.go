@@ -0,0 +1,201 @@
+package restflex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// RuntimeSettings are the settings of Settings changeable while the process
+// runs. Unset fields are left unchanged by Settings.Apply.
+type RuntimeSettings struct {
+	LogLevel    string          `json:"log_level,omitempty"`
+	Maintenance *bool           `json:"maintenance,omitempty"`
+	Flags       map[string]bool `json:"flags,omitempty"`
+}
+
+// Settings holds runtime settings which can be changed without restarting
+// the process through its admin Handler or by reloading them on SIGHUP with
+// Watch. Handlers created with WithSettings log at its log level, and Wrap
+// responds 503 Service Unavailable in maintenance mode.
+type Settings struct {
+	// MaintenanceRetryAfter is sent in the Retry-After header of responses
+	// in maintenance mode. Defaults to a minute.
+	MaintenanceRetryAfter time.Duration
+	// Log logs messages
+	Log infra.Logger
+
+	logLevel    atomic.Int32
+	maintenance atomic.Bool
+	mu          sync.RWMutex
+	flags       map[string]bool
+}
+
+func NewSettings(l infra.Logger) *Settings {
+	s := &Settings{
+		MaintenanceRetryAfter: time.Minute,
+		Log:                   l,
+	}
+	s.logLevel.Store(int32(LevelInfo))
+	return s
+}
+
+// WithSettings makes the handler log at the log level of s.
+func WithSettings(s *Settings) Option {
+	return func(h *handler) {
+		h.Settings = s
+	}
+}
+
+// LogLevel returns the lowest level of response log lines.
+func (s *Settings) LogLevel() LogLevel {
+	return LogLevel(s.logLevel.Load())
+}
+
+// SetLogLevel sets the lowest level of response log lines.
+func (s *Settings) SetLogLevel(l LogLevel) {
+	s.logLevel.Store(int32(l))
+}
+
+// Maintenance reports whether maintenance mode is on.
+func (s *Settings) Maintenance() bool {
+	return s.maintenance.Load()
+}
+
+// SetMaintenance turns maintenance mode on or off.
+func (s *Settings) SetMaintenance(on bool) {
+	s.maintenance.Store(on)
+}
+
+// Flag reports whether the feature flag name is on.
+func (s *Settings) Flag(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flags[name]
+}
+
+// Apply changes the settings set in rs. Flags are merged with the current
+// ones.
+func (s *Settings) Apply(rs RuntimeSettings) error {
+	if rs.LogLevel != "" {
+		level, err := ParseLogLevel(rs.LogLevel)
+		if err != nil {
+			return err
+		}
+		s.SetLogLevel(level)
+	}
+	if rs.Maintenance != nil {
+		s.SetMaintenance(*rs.Maintenance)
+	}
+	if len(rs.Flags) > 0 {
+		s.mu.Lock()
+		flags := make(map[string]bool, len(s.flags)+len(rs.Flags))
+		for name, on := range s.flags {
+			flags[name] = on
+		}
+		for name, on := range rs.Flags {
+			flags[name] = on
+		}
+		s.flags = flags
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Current returns the current settings.
+func (s *Settings) Current() RuntimeSettings {
+	maintenance := s.Maintenance()
+	s.mu.RLock()
+	flags := make(map[string]bool, len(s.flags))
+	for name, on := range s.flags {
+		flags[name] = on
+	}
+	s.mu.RUnlock()
+	return RuntimeSettings{
+		LogLevel:    s.LogLevel().String(),
+		Maintenance: &maintenance,
+		Flags:       flags,
+	}
+}
+
+func (s *Settings) String() string {
+	rs := s.Current()
+	return fmt.Sprintf("log_level=%v maintenance=%v flags=%v", rs.LogLevel, *rs.Maintenance, rs.Flags)
+}
+
+// Handler returns an admin handler responding to GET with the current
+// settings and to PATCH by applying the settings of the JSON request body.
+// It must not be exposed publicly.
+func (s *Settings) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPatch:
+			var rs RuntimeSettings
+			if err := DecodeJSON(r.Body, &rs); err != nil {
+				writeError(s.Log, w, http.StatusBadRequest, ErrInvalidRequestBody.Errors()...)
+				return
+			}
+			if err := s.Apply(rs); err != nil {
+				writeError(s.Log, w, http.StatusBadRequest, err.Error())
+				return
+			}
+			s.Log.Printf("restflex: runtime settings changed: %v", s)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PATCH")
+			status := http.StatusMethodNotAllowed
+			writeError(s.Log, w, status, http.StatusText(status))
+			return
+		}
+		if err := WriteJSON(w, http.StatusOK, s.Current()); err != nil {
+			s.Log.Printf("restflex: error while writing settings: %v", err)
+		}
+	})
+}
+
+// Wrap returns a handler responding 503 Service Unavailable with a
+// Retry-After header in maintenance mode instead of calling next.
+func (s *Settings) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Maintenance() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		err := NewServiceUnavailable(s.MaintenanceRetryAfter, "service is under maintenance")
+		setRetryAfter(w, err)
+		writeError(s.Log, w, err.StatusCode(), err.Errors()...)
+	})
+}
+
+// Watch applies the settings returned by load, for example read from a
+// configuration file, when the process receives SIGHUP. It returns when ctx
+// is done.
+func (s *Settings) Watch(ctx context.Context, load func() (RuntimeSettings, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		rs, err := load()
+		if err == nil {
+			err = s.Apply(rs)
+		}
+		if err != nil {
+			s.Log.Printf("restflex: settings reload: %v", err)
+			continue
+		}
+		s.Log.Printf("restflex: reloaded runtime settings: %v", s)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestSettings(t *testing.T) {
+	t.Parallel()
+	logger := resttest.NewLogger()
+	settings := restflex.NewSettings(logger)
+	api := settings.Wrap(restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if settings.Flag("beta") {
+			w.WriteHeader(http.StatusAccepted)
+			return nil
+		}
+		return restflex.ErrNotFound
+	}), restflex.WithSettings(settings)))
+	admin := settings.Handler()
+
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusNotFound)
+	logger.ExpectCount(t, "client error: 404", 1)
+
+	resttest.Patch("/settings").WithJSON(map[string]any{
+		"log_level": "warn",
+		"flags":     map[string]bool{"beta": true},
+	}).To(admin).Expect(t).Status(http.StatusOK).
+		JSONPath("$.log_level", "warn").
+		JSONPath("$.flags.beta", true)
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusAccepted)
+
+	if err := settings.Apply(restflex.RuntimeSettings{Flags: map[string]bool{"beta": false}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Reset()
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusNotFound)
+	logger.ExpectNone(t, "client error")
+
+	resttest.Patch("/settings").WithJSON(map[string]any{"maintenance": true}).To(admin).Expect(t).Status(http.StatusOK)
+	res := resttest.Get("/").To(api).Expect(t).Status(http.StatusServiceUnavailable)
+	res.Header("Retry-After", "60")
+
+	resttest.Patch("/settings").WithJSON(map[string]any{"log_level": "loud"}).To(admin).Expect(t).Status(http.StatusBadRequest)
+	resttest.Delete("/settings").To(admin).Expect(t).Status(http.StatusMethodNotAllowed)
+}
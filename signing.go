@@ -0,0 +1,175 @@
+package restflex
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kkn.fi/infra"
+)
+
+// SignatureHeader is the header carrying the detached signature of a
+// response body or of a signed request.
+const SignatureHeader = "X-Signature"
+
+// Signer signs and verifies response bodies.
+type Signer interface {
+	// Algorithm names the signature algorithm, such as "hmac-sha256".
+	Algorithm() string
+	// KeyID identifies the key so that keys can be rotated.
+	KeyID() string
+	Sign(body []byte) ([]byte, error)
+	Verify(body, signature []byte) bool
+}
+
+// HMACSigner signs with HMAC-SHA256 and a key shared with consumers.
+type HMACSigner struct {
+	Key []byte
+	ID  string
+}
+
+func (s HMACSigner) Algorithm() string { return "hmac-sha256" }
+
+func (s HMACSigner) KeyID() string { return s.ID }
+
+func (s HMACSigner) Sign(body []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write(body)
+	return mac.Sum(nil), nil
+}
+
+func (s HMACSigner) Verify(body, signature []byte) bool {
+	sum, _ := s.Sign(body)
+	return hmac.Equal(sum, signature)
+}
+
+// Ed25519Signer signs with an Ed25519 private key. Consumers verify with an
+// Ed25519Signer holding only the public key.
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+	ID         string
+}
+
+func (s Ed25519Signer) Algorithm() string { return "ed25519" }
+
+func (s Ed25519Signer) KeyID() string { return s.ID }
+
+func (s Ed25519Signer) Sign(body []byte) ([]byte, error) {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("restflex: no Ed25519 private key")
+	}
+	return ed25519.Sign(s.PrivateKey, body), nil
+}
+
+func (s Ed25519Signer) Verify(body, signature []byte) bool {
+	public := s.PublicKey
+	if public == nil && len(s.PrivateKey) == ed25519.PrivateKeySize {
+		public = s.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	return len(public) == ed25519.PublicKeySize && ed25519.Verify(public, body, signature)
+}
+
+// ResponseSigning is a middleware signing response bodies so that consumers
+// can verify their integrity through caching proxies and other
+// intermediaries. JSON bodies are canonicalized, see CanonicalJSON, before
+// they are signed and sent, so that they can be verified even if an
+// intermediary re-encodes them. The signature is sent in the X-Signature
+// header as keyid="...", alg="...", sig="<base64>".
+type ResponseSigning struct {
+	Signer Signer
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewResponseSigning(l infra.Logger, s Signer) *ResponseSigning {
+	return &ResponseSigning{
+		Signer: s,
+		Log:    l,
+	}
+}
+
+// Wrap returns a handler signing the responses of next. Responses are
+// buffered to be signed.
+func (s *ResponseSigning) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &captureWriter{ResponseWriter: &discardWriter{header: w.Header()}, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+		body := cw.body.Bytes()
+		if isJSON(w.Header().Get("Content-Type")) && len(body) > 0 {
+			canonical, err := canonicalizeJSON(body)
+			if err != nil {
+				s.Log.Printf("restflex: response signing: %v", err)
+			} else {
+				body = canonical
+			}
+		}
+		sig, err := s.Signer.Sign(body)
+		if err != nil {
+			s.Log.Printf("restflex: response signing: %v", err)
+			writeError(s.Log, w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		w.Header().Set(SignatureHeader, fmt.Sprintf("keyid=%q, alg=%q, sig=%q", s.Signer.KeyID(), s.Signer.Algorithm(), base64.StdEncoding.EncodeToString(sig)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(cw.status)
+		_, _ = w.Write(body)
+	})
+}
+
+// VerifySignature verifies the X-Signature header value of a response with
+// body against s. JSON bodies are canonicalized first if contentType is
+// JSON.
+func VerifySignature(s Signer, header, contentType string, body []byte) error {
+	params := signatureParams(header)
+	if params["keyid"] != s.KeyID() || params["alg"] != s.Algorithm() {
+		return fmt.Errorf("restflex: signature key %q %q does not match", params["keyid"], params["alg"])
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["sig"])
+	if err != nil {
+		return fmt.Errorf("restflex: malformed signature: %v", err)
+	}
+	if isJSON(contentType) && len(body) > 0 {
+		if body, err = canonicalizeJSON(body); err != nil {
+			return err
+		}
+	}
+	if !s.Verify(body, sig) {
+		return errors.New("restflex: invalid signature")
+	}
+	return nil
+}
+
+// signatureParams returns the parameters of an X-Signature header value.
+func signatureParams(header string) map[string]string {
+	params := make(map[string]string)
+	for _, p := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			v = unquoted
+		}
+		params[k] = v
+	}
+	return params
+}
+
+// canonicalizeJSON re-encodes the JSON text b as canonical JSON with a
+// trailing newline like WriteJSON.
+func canonicalizeJSON(b []byte) ([]byte, error) {
+	canonical, err := CanonicalJSON(json.RawMessage(b))
+	if err != nil {
+		return nil, err
+	}
+	return append(canonical, '\n'), nil
+}
+
+func isJSON(contentType string) bool {
+	return MatchContentType(contentType, "application/json", "application/problem+json")
+}
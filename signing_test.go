@@ -0,0 +1,54 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestResponseSigning(t *testing.T) {
+	t.Parallel()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name     string
+		signer   restflex.Signer
+		verifier restflex.Signer
+	}{
+		{name: "HMAC", signer: restflex.HMACSigner{Key: []byte("secret"), ID: "k1"}, verifier: restflex.HMACSigner{Key: []byte("secret"), ID: "k1"}},
+		{name: "Ed25519", signer: restflex.Ed25519Signer{PrivateKey: private, ID: "k2"}, verifier: restflex.Ed25519Signer{PublicKey: public, ID: "k2"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := restflex.NewResponseSigning(resttest.NewLogger(), tt.signer).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{ "b": 1.0, "a": [true] }`))
+			}))
+			res := resttest.Get("/").To(h).Expect(t).Status(http.StatusOK)
+			if want := "{\"a\":[true],\"b\":1}\n"; string(res.Body) != want {
+				t.Errorf("expected canonical body %q, got %q", want, res.Body)
+			}
+			header := res.Response.Header.Get(restflex.SignatureHeader)
+			if err := restflex.VerifySignature(tt.verifier, header, "application/json", res.Body); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			reencoded := []byte("{\"b\": 1, \"a\": [true]}")
+			if err := restflex.VerifySignature(tt.verifier, header, "application/json", reencoded); err != nil {
+				t.Errorf("expected re-encoded body to verify, got %v", err)
+			}
+			if err := restflex.VerifySignature(tt.verifier, header, "application/json", []byte(`{"a":[false],"b":1}`)); err == nil {
+				t.Error("expected tampered body to fail verification")
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package restflex
+
+import "time"
+
+// SLO is the service level objective of a route. A request is good when it
+// is responded to without a 5xx status within Latency, and the objective
+// is the share of good requests to meet. The good and bad requests of the
+// route are counted in Metrics together with the objective, so that
+// alerting can compute the rate at which the error budget burns.
+type SLO struct {
+	// Objective is the target share of good requests, e.g. 0.999.
+	Objective float64
+	// Latency is the longest response time of a good request. Zero
+	// counts requests of any latency as good.
+	Latency time.Duration
+}
+
+// WithSLO annotates the route of the handler with slo. The requests are
+// counted in the Metrics set WithMetrics.
+func WithSLO(slo SLO) Option {
+	return func(h *handler) {
+		h.SLO = &slo
+	}
+}
+
+// good reports whether a response with status served in elapsed time meets
+// the objective.
+func (slo *SLO) good(status int, elapsed time.Duration) bool {
+	return status < 500 && (slo.Latency <= 0 || elapsed <= slo.Latency)
+}
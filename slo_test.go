@@ -0,0 +1,70 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestSLO(t *testing.T) {
+	t.Parallel()
+	name := uniqueVarName(t)
+	metrics := restflex.NewMetrics(name)
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		switch r.PathValue("id") {
+		case "missing":
+			return restflex.ErrNotFound
+		case "broken":
+			return restflex.ErrInternal
+		case "slow":
+			time.Sleep(60 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), restflex.WithMetrics(metrics), restflex.WithSLO(restflex.SLO{Objective: 0.99, Latency: 50 * time.Millisecond}))
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{id}", api)
+	resttest.Get("/users/1").To(mux).Expect(t).Status(http.StatusNoContent)
+	resttest.Get("/users/missing").To(mux).Expect(t).Status(http.StatusNotFound)
+	resttest.Get("/users/broken").To(mux).Expect(t).Status(http.StatusInternalServerError)
+	resttest.Get("/users/slow").To(mux).Expect(t).Status(http.StatusNoContent)
+
+	if good, bad := metrics.SLORequests("GET /users/{id}"); good != 2 || bad != 2 {
+		t.Errorf("expected 2 good and 2 bad requests, but got %d and %d", good, bad)
+	}
+	var published struct {
+		SLO map[string]struct {
+			Good      int64   `json:"good"`
+			Bad       int64   `json:"bad"`
+			Objective float64 `json:"objective"`
+		} `json:"slo"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if slo := published.SLO["GET /users/{id}"]; slo.Good != 2 || slo.Bad != 2 || slo.Objective != 0.99 {
+		t.Errorf("unexpected published SLO: %+v", published.SLO)
+	}
+}
+
+func TestSLOWithoutLatency(t *testing.T) {
+	t.Parallel()
+	metrics := restflex.NewMetrics(uniqueVarName(t))
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}), restflex.WithMetrics(metrics), restflex.WithSLO(restflex.SLO{Objective: 0.999}))
+	resttest.Get("/").To(api).Expect(t).Status(http.StatusNoContent)
+	if good, bad := metrics.SLORequests(restflex.UnmatchedRoute); good != 1 || bad != 0 {
+		t.Errorf("expected 1 good request, but got %d good and %d bad", good, bad)
+	}
+}
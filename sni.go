@@ -0,0 +1,100 @@
+package restflex
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"kkn.fi/infra"
+)
+
+// CertificateProvider provides the certificate of a server name, for
+// example from a tenant database or a secret store. Implementations should
+// cache certificates as they are requested on every TLS handshake.
+type CertificateProvider interface {
+	Certificate(ctx context.Context, serverName string) (*tls.Certificate, error)
+}
+
+// CertificateProviderFunc is a function implementing CertificateProvider.
+type CertificateProviderFunc func(ctx context.Context, serverName string) (*tls.Certificate, error)
+
+func (f CertificateProviderFunc) Certificate(ctx context.Context, serverName string) (*tls.Certificate, error) {
+	return f(ctx, serverName)
+}
+
+// CertificateMap is a CertificateProvider of fixed certificates by server
+// name. Keys of the form "*.example.com" match one level of subdomains.
+type CertificateMap map[string]*tls.Certificate
+
+func (m CertificateMap) Certificate(_ context.Context, serverName string) (*tls.Certificate, error) {
+	if cert, ok := m[serverName]; ok {
+		return cert, nil
+	}
+	if _, domain, ok := strings.Cut(serverName, "."); ok {
+		if cert, ok := m["*."+domain]; ok {
+			return cert, nil
+		}
+	}
+	return nil, nil
+}
+
+// SNI selects certificates and TLS configurations by the server name
+// requested by clients, so that one listener can serve several custom
+// domains, such as those of white-label tenants.
+type SNI struct {
+	Provider CertificateProvider
+	// Configs overrides the TLS configuration of server names, for example
+	// to require client certificates on one host only. Configurations
+	// without certificates get theirs from Provider.
+	Configs map[string]*tls.Config
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewSNI(l infra.Logger, p CertificateProvider) *SNI {
+	return &SNI{
+		Provider: p,
+		Configs:  make(map[string]*tls.Config),
+		Log:      l,
+	}
+}
+
+// GetCertificate returns the certificate of the requested server name for
+// tls.Config.GetCertificate.
+func (s *SNI) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := normalizeHost(hello.ServerName)
+	cert, err := s.Provider.Certificate(hello.Context(), name)
+	if err != nil {
+		s.Log.Printf("restflex: certificate of %q: %v", name, err)
+		return nil, err
+	}
+	if cert == nil {
+		s.Log.Printf("restflex: no certificate for %q", name)
+		return nil, fmt.Errorf("restflex: no certificate for %q", name)
+	}
+	return cert, nil
+}
+
+// GetConfigForClient returns the TLS configuration of the requested server
+// name for tls.Config.GetConfigForClient, or nil for the default one.
+func (s *SNI) GetConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	cfg, ok := s.Configs[normalizeHost(hello.ServerName)]
+	if !ok {
+		return nil, nil
+	}
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil {
+		cfg = cfg.Clone()
+		cfg.GetCertificate = s.GetCertificate
+	}
+	return cfg, nil
+}
+
+// SNI configures the server to serve HTTPS with certificates and TLS
+// configurations selected by sni.
+func (s *Server) SNI(sni *SNI) {
+	cfg := NewTLSConfig()
+	cfg.GetCertificate = sni.GetCertificate
+	cfg.GetConfigForClient = sni.GetConfigForClient
+	s.TLSConfig = cfg
+}
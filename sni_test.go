@@ -0,0 +1,67 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestSNI(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	load := func(name string) *tls.Certificate {
+		certFile, keyFile := writeCertificate(t, dir, name)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return &cert
+	}
+	logger := resttest.NewLogger()
+	sni := restflex.NewSNI(logger, restflex.CertificateMap{
+		"api.example.com":    load("api.example.com"),
+		"*.tenants.example":  load("tenants.example"),
+		"secure.example.com": load("secure.example.com"),
+	})
+	sni.Configs["secure.example.com"] = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s := restflex.NewServer(logger, ":0", nil)
+	s.SNI(sni)
+
+	tests := []struct {
+		serverName string
+		commonName string
+	}{
+		{serverName: "api.example.com", commonName: "api.example.com"},
+		{serverName: "API.example.com", commonName: "api.example.com"},
+		{serverName: "acme.tenants.example", commonName: "tenants.example"},
+		{serverName: "unknown.example.com"},
+	}
+	for _, tt := range tests {
+		cert, err := s.TLSConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if tt.commonName == "" {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.serverName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.serverName, err)
+		}
+		if got := certificateCommonName(t, cert); got != tt.commonName {
+			t.Errorf("%s: expected certificate of %q, got %q", tt.serverName, tt.commonName, got)
+		}
+	}
+	logger.ExpectCount(t, `no certificate for "unknown.example.com"`, 1)
+
+	cfg, err := s.TLSConfig.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "secure.example.com"})
+	if err != nil || cfg == nil || cfg.ClientAuth != tls.RequireAnyClientCert || cfg.GetCertificate == nil {
+		t.Errorf("expected per-host configuration, got %+v (%v)", cfg, err)
+	}
+	if cfg, _ := s.TLSConfig.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "api.example.com"}); cfg != nil {
+		t.Errorf("expected default configuration, got %+v", cfg)
+	}
+}
@@ -0,0 +1,22 @@
+module kkn.fi/restflex/sqsqueue
+
+go 1.23.0
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.41.1
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.42.21
+	kkn.fi/restflex v0.0.0
+)
+
+require (
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.4.17 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.7.17 // indirect
+	github.com/aws/smithy-go v1.24.0 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	kkn.fi/httpx v0.2.0 // indirect
+	kkn.fi/infra v0.13.2 // indirect
+)
+
+replace kkn.fi/restflex => ../
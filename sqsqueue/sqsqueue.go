@@ -0,0 +1,108 @@
+// Package sqsqueue serves restflex APIs over Amazon SQS with a
+// restflex.QueueAdapter.
+//
+// It is a module of its own, so that restflex does not depend on the AWS
+// SDK. Requests are received from the queue given to New and responses sent
+// to the queue whose URL is the reply_to of a request:
+//
+//	q := sqsqueue.New(sqs.NewFromConfig(cfg), requestsURL)
+//	a := restflex.NewQueueAdapter(l, q, api)
+//	err := a.Run(ctx)
+package sqsqueue
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"kkn.fi/restflex"
+)
+
+// API is the part of *sqs.Client a Queue uses.
+type API interface {
+	ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, opts ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	SendMessage(ctx context.Context, in *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, opts ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, in *sqs.ChangeMessageVisibilityInput, opts ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Queue is a restflex.MessageQueue of an SQS queue. Messages are received
+// with long polling and deleted once their responses have been sent. A
+// message whose request panics is made visible again for redelivery, and
+// reports its ApproximateReceiveCount, so that
+// restflex.QueueAdapter.MaxDeliveries applies. A redrive policy of the
+// queue dead-letters messages of requests which fail in other ways, such
+// as responses which cannot be sent.
+type Queue struct {
+	api API
+	url string
+	// WaitTime is the number of seconds a receive waits for messages.
+	// Defaults to 20, the maximum of SQS.
+	WaitTime int32
+	// Batch is the maximum number of messages received at a time. Defaults
+	// to 10, the maximum of SQS.
+	Batch int32
+
+	pending []types.Message
+}
+
+func New(api API, url string) *Queue {
+	return &Queue{
+		api:      api,
+		url:      url,
+		WaitTime: 20,
+		Batch:    10,
+	}
+}
+
+// Receive returns the next request message. Receive must not be called
+// concurrently, which restflex.QueueAdapter does not.
+func (q *Queue) Receive(ctx context.Context) (*restflex.QueueMessage, error) {
+	for len(q.pending) == 0 {
+		out, err := q.api.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(q.url),
+			MaxNumberOfMessages:         q.Batch,
+			WaitTimeSeconds:             q.WaitTime,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount},
+		})
+		if err != nil {
+			return nil, err
+		}
+		q.pending = out.Messages
+	}
+	m := q.pending[0]
+	q.pending = q.pending[1:]
+	msg := &restflex.QueueMessage{
+		Data: []byte(aws.ToString(m.Body)),
+		Ack: func(ctx context.Context) error {
+			_, err := q.api.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(q.url),
+				ReceiptHandle: m.ReceiptHandle,
+			})
+			return err
+		},
+		Nack: func(ctx context.Context) error {
+			_, err := q.api.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(q.url),
+				ReceiptHandle:     m.ReceiptHandle,
+				VisibilityTimeout: 0,
+			})
+			return err
+		},
+	}
+	if n, err := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		msg.Deliveries = n
+	}
+	return msg, nil
+}
+
+// Publish sends data to the queue whose URL is subject.
+func (q *Queue) Publish(ctx context.Context, subject string, data []byte) error {
+	_, err := q.api.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(subject),
+		MessageBody: aws.String(string(data)),
+	})
+	return err
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+
+package sqsqueue_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+	"kkn.fi/restflex/sqsqueue"
+)
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	req := func(id, path string) *string {
+		data, _ := json.Marshal(restflex.QueueRequest{ID: id, ReplyTo: "https://sqs/replies", Method: http.MethodGet, Path: path})
+		return aws.String(string(data))
+	}
+	api := &fakeAPI{
+		received: make(chan []types.Message, 1),
+		calls:    make(chan string, 4),
+	}
+	api.received <- []types.Message{
+		{Body: req("a", "/orders/1"), ReceiptHandle: aws.String("a"), Attributes: map[string]string{"ApproximateReceiveCount": "1"}},
+		{Body: req("b", "/panic"), ReceiptHandle: aws.String("b"), Attributes: map[string]string{"ApproximateReceiveCount": "1"}},
+		{Body: req("c", "/panic"), ReceiptHandle: aws.String("c"), Attributes: map[string]string{"ApproximateReceiveCount": "5"}},
+	}
+	logger := resttest.NewLogger()
+	a := restflex.NewQueueAdapter(logger, sqsqueue.New(api, "https://sqs/requests"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("poison")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	calls := make(map[string]bool)
+	for range 4 {
+		calls[<-api.calls] = true
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	for _, want := range []string{
+		`send https://sqs/replies {"id":"a","status":204}`,
+		"delete a",
+		"change visibility b 0",
+		"delete c",
+	} {
+		if !calls[want] {
+			t.Errorf("expected call %q, but got %v", want, calls)
+		}
+	}
+	logger.ExpectCount(t, "error: restflex: queue: request c dead-lettered after 5 deliveries", 1)
+}
+
+// fakeAPI is an SQS API which receives the batches sent to received and
+// reports the other calls to calls.
+type fakeAPI struct {
+	received chan []types.Message
+	calls    chan string
+}
+
+func (api *fakeAPI) ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, opts ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	if aws.ToString(in.QueueUrl) != "https://sqs/requests" || len(in.MessageSystemAttributeNames) == 0 {
+		return nil, &types.QueueDoesNotExist{}
+	}
+	select {
+	case msgs := <-api.received:
+		return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (api *fakeAPI) SendMessage(ctx context.Context, in *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	api.calls <- "send " + aws.ToString(in.QueueUrl) + " " + aws.ToString(in.MessageBody)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (api *fakeAPI) DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, opts ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	api.calls <- "delete " + aws.ToString(in.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (api *fakeAPI) ChangeMessageVisibility(ctx context.Context, in *sqs.ChangeMessageVisibilityInput, opts ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	api.calls <- "change visibility " + aws.ToString(in.ReceiptHandle) + " " + strconv.Itoa(int(in.VisibilityTimeout))
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
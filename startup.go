@@ -0,0 +1,82 @@
+package restflex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// startupHook is a function run by the server before it is ready.
+type startupHook struct {
+	name    string
+	timeout time.Duration
+	fn      func(context.Context) error
+}
+
+// StartupError reports the failure of a startup hook.
+type StartupError struct {
+	Hook     string
+	Duration time.Duration
+	Err      error
+}
+
+func (e *StartupError) Error() string {
+	return fmt.Sprintf("restflex: startup hook %q failed after %v: %v", e.Hook, e.Duration.Round(time.Millisecond), e.Err)
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// OnStartup registers a hook, such as a database migration or a cache
+// warm-up, run when the server starts. Hooks run in registration order while
+// the server accepts connections but reports not ready; see Readiness. A
+// hook taking longer than timeout has its context cancelled. Zero means no
+// timeout. The server is shut down if a hook fails.
+func (s *Server) OnStartup(name string, timeout time.Duration, fn func(context.Context) error) {
+	s.startupHooks = append(s.startupHooks, startupHook{name: name, timeout: timeout, fn: fn})
+}
+
+// Ready reports whether the startup hooks have completed and the server is
+// not shutting down.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Readiness returns a handler responding 204 No Content when the server is
+// ready and 503 Service Unavailable otherwise, for load balancer and
+// orchestrator readiness probes.
+func (s *Server) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			status := http.StatusServiceUnavailable
+			writeError(s.Log, w, status, http.StatusText(status))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// startup runs the startup hooks in order.
+func (s *Server) startup(ctx context.Context) error {
+	for _, hook := range s.startupHooks {
+		start := time.Now()
+		err := runHook(ctx, hook)
+		d := time.Since(start)
+		if err != nil {
+			return &StartupError{Hook: hook.name, Duration: d, Err: err}
+		}
+		s.Log.Printf("restflex: startup hook %q completed in %v", hook.name, d.Round(time.Millisecond))
+	}
+	return nil
+}
+
+func runHook(ctx context.Context, hook startupHook) error {
+	if hook.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.timeout)
+		defer cancel()
+	}
+	return hook.fn(ctx)
+}
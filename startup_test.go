@@ -0,0 +1,88 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_OnStartup(t *testing.T) {
+	t.Parallel()
+	srv := restflex.NewServer(resttest.NewLogger(), "", http.NotFoundHandler())
+	srv.Handler = srv.Readiness()
+	release := make(chan struct{})
+	var order []string
+	srv.OnStartup("migrate", 0, func(ctx context.Context) error {
+		order = append(order, "migrate")
+		<-release
+		return nil
+	})
+	srv.OnStartup("warm up", time.Second, func(ctx context.Context) error {
+		order = append(order, "warm up")
+		return nil
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.RunListener(ctx, ln)
+	}()
+
+	status := func() int {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if s := status(); s != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d during startup, but got %d", http.StatusServiceUnavailable, s)
+	}
+	close(release)
+	for i := 0; i < 50 && !srv.Ready(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := status(); s != http.StatusNoContent {
+		t.Errorf("expected status code %d after startup, but got %d", http.StatusNoContent, s)
+	}
+	if len(order) != 2 || order[0] != "migrate" || order[1] != "warm up" {
+		t.Errorf("expected hooks to run in order, got %v", order)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if srv.Ready() {
+		t.Error("expected server not to be ready after shutdown")
+	}
+}
+
+func TestServer_OnStartup_failure(t *testing.T) {
+	t.Parallel()
+	srv := restflex.NewServer(resttest.NewLogger(), "", http.NotFoundHandler())
+	srv.OnStartup("warm up", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = srv.RunListener(context.Background(), ln)
+	var startupErr *restflex.StartupError
+	if !errors.As(err, &startupErr) || startupErr.Hook != "warm up" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected warm up to time out, got %v", err)
+	}
+}
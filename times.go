@@ -0,0 +1,175 @@
+package restflex
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Time is a point in time in JSON bodies and query parameters. It accepts
+// RFC 3339 timestamps and Unix epoch seconds or milliseconds, as numbers or
+// strings, and is written as an RFC 3339 timestamp in UTC. Integer epochs
+// with an absolute value of at least 1e11 are taken as milliseconds.
+type Time struct {
+	time.Time
+}
+
+// Date is a calendar date in the form 2006-01-02. RFC 3339 timestamps are
+// accepted too, keeping the date in their own time zone.
+type Date struct {
+	time.Time
+}
+
+// Duration is a duration written in the format of time.Duration.String, such
+// as "1m30s". Plain numbers are accepted as seconds.
+type Duration time.Duration
+
+// Millis is a duration written as an integer number of milliseconds. Strings
+// in the format of time.Duration are accepted too.
+type Millis time.Duration
+
+// epochMillisThreshold is the smallest absolute integer epoch taken as
+// milliseconds rather than seconds, about the year 5138 in seconds.
+const epochMillisThreshold = 1e11
+
+func (t Time) MarshalText() ([]byte, error) {
+	return t.UTC().AppendFormat(nil, time.RFC3339Nano), nil
+}
+
+func (t *Time) UnmarshalText(b []byte) error {
+	s := string(b)
+	if v, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		t.Time = v
+		return nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n >= epochMillisThreshold || n <= -epochMillisThreshold {
+			t.Time = time.UnixMilli(n).UTC()
+		} else {
+			t.Time = time.Unix(n, 0).UTC()
+		}
+		return nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		sec, frac := math.Modf(f)
+		t.Time = time.Unix(int64(sec), int64(frac*1e9)).UTC()
+		return nil
+	}
+	return fmt.Errorf("restflex: invalid time %q, expected RFC 3339 or Unix epoch", s)
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(t)
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, t)
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return d.AppendFormat(nil, time.DateOnly), nil
+}
+
+func (d *Date) UnmarshalText(b []byte) error {
+	s := string(b)
+	if v, err := time.Parse(time.DateOnly, s); err == nil {
+		d.Time = v
+		return nil
+	}
+	if v, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		d.Time = time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+		return nil
+	}
+	return fmt.Errorf("restflex: invalid date %q, expected YYYY-MM-DD", s)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(d)
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, d)
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := parseDuration(string(b), time.Second)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(d)
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, d)
+}
+
+func (m Millis) MarshalText() ([]byte, error) {
+	return strconv.AppendInt(nil, time.Duration(m).Milliseconds(), 10), nil
+}
+
+func (m *Millis) UnmarshalText(b []byte) error {
+	v, err := parseDuration(string(b), time.Millisecond)
+	if err != nil {
+		return err
+	}
+	*m = Millis(v)
+	return nil
+}
+
+func (m Millis) MarshalJSON() ([]byte, error) {
+	return m.MarshalText()
+}
+
+func (m *Millis) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONText(b, m)
+}
+
+// parseDuration parses s as a time.Duration string or a number of units.
+func parseDuration(s string, unit time.Duration) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return time.Duration(f * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("restflex: invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// marshalJSONText writes the text of v as a JSON string.
+func marshalJSONText(v encoding.TextMarshaler) ([]byte, error) {
+	text, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// unmarshalJSONText reads a JSON string or number b into v. A JSON null
+// leaves v unchanged.
+func unmarshalJSONText(b []byte, v encoding.TextUnmarshaler) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		return v.UnmarshalText([]byte(s))
+	}
+	return v.UnmarshalText(b)
+}
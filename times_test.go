@@ -0,0 +1,69 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+)
+
+func TestTimeTypes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "RFC 3339", in: `{"time":"2024-03-01T12:00:00+02:00"}`, want: `{"time":"2024-03-01T10:00:00Z","date":"0001-01-01","duration":"0s","millis":0}`},
+		{name: "epoch seconds", in: `{"time":1709287200}`, want: `{"time":"2024-03-01T10:00:00Z","date":"0001-01-01","duration":"0s","millis":0}`},
+		{name: "epoch milliseconds string", in: `{"time":"1709287200500"}`, want: `{"time":"2024-03-01T10:00:00.5Z","date":"0001-01-01","duration":"0s","millis":0}`},
+		{name: "date", in: `{"date":"2024-03-01"}`, want: `{"time":"0001-01-01T00:00:00Z","date":"2024-03-01","duration":"0s","millis":0}`},
+		{name: "date from timestamp", in: `{"date":"2024-03-01T23:30:00-05:00"}`, want: `{"time":"0001-01-01T00:00:00Z","date":"2024-03-01","duration":"0s","millis":0}`},
+		{name: "durations", in: `{"duration":"1m30s","millis":1500}`, want: `{"time":"0001-01-01T00:00:00Z","date":"0001-01-01","duration":"1m30s","millis":1500}`},
+		{name: "numeric durations", in: `{"duration":90,"millis":"1.5s"}`, want: `{"time":"0001-01-01T00:00:00Z","date":"0001-01-01","duration":"1m30s","millis":1500}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var v struct {
+				Time     restflex.Time     `json:"time"`
+				Date     restflex.Date     `json:"date"`
+				Duration restflex.Duration `json:"duration"`
+				Millis   restflex.Millis   `json:"millis"`
+			}
+			if err := json.Unmarshal([]byte(tt.in), &v); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTimeTypes_invalid(t *testing.T) {
+	t.Parallel()
+	var tm restflex.Time
+	if err := tm.UnmarshalText([]byte("yesterday")); err == nil {
+		t.Error("expected error for invalid time")
+	}
+	var d restflex.Date
+	if err := d.UnmarshalText([]byte("2024-13-01")); err == nil {
+		t.Error("expected error for invalid date")
+	}
+	var m restflex.Millis
+	if err := json.Unmarshal([]byte(`true`), &m); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+	if err := m.UnmarshalText([]byte("250")); err != nil || time.Duration(m) != 250*time.Millisecond {
+		t.Errorf("expected 250ms, got %v (%v)", time.Duration(m), err)
+	}
+}
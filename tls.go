@@ -0,0 +1,156 @@
+package restflex
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"kkn.fi/infra"
+)
+
+// NewTLSConfig returns a TLS configuration with modern defaults: TLS 1.2 as
+// the minimum version and only forward secret AEAD cipher suites.
+func NewTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{
+			tls.X25519,
+			tls.CurveP256,
+		},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// RequireClientCertificates configures cfg to require and verify client
+// certificates issued by one of the certificate authorities in cas.
+func RequireClientCertificates(cfg *tls.Config, cas *x509.CertPool) {
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = cas
+}
+
+// LoadCertPool reads PEM encoded certificates from file into a new pool.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("restflex: no certificates found in " + file)
+	}
+	return pool, nil
+}
+
+// CertificateReloader serves a certificate and key read from files and
+// reloads them without restarting the server. Use GetCertificate as the
+// tls.Config.GetCertificate function.
+type CertificateReloader struct {
+	CertFile string
+	KeyFile  string
+	// Log logs messages
+	Log infra.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertificateReloader loads the certificate and key from the given files.
+func NewCertificateReloader(l infra.Logger, certFile, keyFile string) (*CertificateReloader, error) {
+	c := &CertificateReloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Log:      l,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the certificate and key files. The previous certificate is
+// kept if reading fails.
+func (c *CertificateReloader) Reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate.
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Watch reloads the certificate when the process receives SIGHUP or when
+// either file has been modified, checking modification times every interval.
+// It returns when ctx is done.
+func (c *CertificateReloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			modTime, err := c.latestModTime()
+			if err != nil {
+				c.Log.Printf("restflex: certificate reload: %v", err)
+				continue
+			}
+			c.mu.RLock()
+			changed := modTime.After(c.modTime)
+			c.mu.RUnlock()
+			if !changed {
+				continue
+			}
+		}
+		if err := c.Reload(); err != nil {
+			c.Log.Printf("restflex: certificate reload: %v", err)
+			continue
+		}
+		c.Log.Printf("restflex: reloaded certificate %v", c.CertFile)
+	}
+}
+
+func (c *CertificateReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.CertFile, c.KeyFile} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,194 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its
+// key to dir and returns the file names.
+func writeCertificate(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	certFile = filepath.Join(dir, commonName+".crt")
+	keyFile = filepath.Join(dir, commonName+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func certificateCommonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "first.example")
+	r, err := restflex.NewCertificateReloader(resttest.NewLogger(), certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, _ := r.GetCertificate(nil)
+	if got := certificateCommonName(t, cert); got != "first.example" {
+		t.Errorf("expected certificate %q, got %q", "first.example", got)
+	}
+
+	second, secondKey := writeCertificate(t, dir, "second.example")
+	if err := os.Rename(second, certFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.Rename(secondKey, keyFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, _ = r.GetCertificate(nil)
+	if got := certificateCommonName(t, cert); got != "second.example" {
+		t.Errorf("expected reloaded certificate %q, got %q", "second.example", got)
+	}
+}
+
+func TestNewServerFromConfig_certificate_reload(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := restflex.DefaultConfig()
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeCertificate(t, dir, "first.example")
+	cfg.TLSReloadInterval = 10 * time.Millisecond
+	srv, err := restflex.NewServerFromConfig(resttest.NewLogger(), cfg, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.RunListener(ctx, ln)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("RunListener() = %v", err)
+		}
+	}()
+
+	second, secondKey := writeCertificate(t, dir, "second.example")
+	future := time.Now().Add(time.Hour)
+	for _, file := range []string{second, secondKey} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := os.Rename(second, cfg.TLSCertFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.Rename(secondKey, cfg.TLSKeyFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		cert, _ := srv.TLSConfig.GetCertificate(nil)
+		if certificateCommonName(t, cert) == "second.example" {
+			return
+		}
+	}
+	t.Error("expected the running server to reload the modified certificate")
+}
+
+func TestServer_Run_TLS(t *testing.T) {
+	t.Parallel()
+	certFile, keyFile := writeCertificate(t, t.TempDir(), "localhost")
+	r, err := restflex.NewCertificateReloader(resttest.NewLogger(), certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := restflex.NewServer(resttest.NewLogger(), "127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLSConfig = restflex.NewTLSConfig()
+	srv.TLSConfig.GetCertificate = r.GetCertificate
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln.Close()
+	srv.Addr = ln.Addr().String()
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+
+	pool, err := restflex.LoadCertPool(certFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "localhost"}}}
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("https://" + srv.Addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status code %d, but got %d", http.StatusNoContent, res.StatusCode)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error on shutdown: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package restflex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SpanContext identifies the span of a distributed trace a request belongs
+// to. Trace IDs are 32 and span IDs 16 lowercase hex digits.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	// ParentID is the span ID of the caller, if any.
+	ParentID string
+	Sampled  bool
+}
+
+// IsValid reports whether sc has valid non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return isHexID(sc.TraceID, 32) && isHexID(sc.SpanID, 16)
+}
+
+// Propagator extracts and injects span contexts from and to HTTP headers
+// in a tracing system's format.
+type Propagator interface {
+	// Extract returns the span context carried by h.
+	Extract(h http.Header) (SpanContext, bool)
+	// Inject sets the headers carrying sc to h.
+	Inject(h http.Header, sc SpanContext)
+}
+
+// Propagators extracts the first span context found by its propagators and
+// injects with all of them, for example to support both W3C Trace Context
+// and B3 during a migration.
+type Propagators []Propagator
+
+func (ps Propagators) Extract(h http.Header) (SpanContext, bool) {
+	for _, p := range ps {
+		if sc, ok := p.Extract(h); ok {
+			return sc, true
+		}
+	}
+	return SpanContext{}, false
+}
+
+func (ps Propagators) Inject(h http.Header, sc SpanContext) {
+	for _, p := range ps {
+		p.Inject(h, sc)
+	}
+}
+
+// TraceContext propagates W3C Trace Context traceparent headers.
+type TraceContext struct{}
+
+func (TraceContext) Extract(h http.Header) (SpanContext, bool) {
+	parts := strings.Split(h.Get("Traceparent"), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags&1 == 1}
+	return sc, sc.IsValid()
+}
+
+func (TraceContext) Inject(h http.Header, sc SpanContext) {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set("Traceparent", "00-"+sc.TraceID+"-"+sc.SpanID+"-"+flags)
+}
+
+// B3 propagates Zipkin B3 headers. Both the multiple header and the single
+// b3 header formats are extracted; SingleHeader chooses the injected one.
+type B3 struct {
+	SingleHeader bool
+}
+
+func (B3) Extract(h http.Header) (SpanContext, bool) {
+	if b3 := h.Get("B3"); b3 != "" {
+		parts := strings.Split(b3, "-")
+		if len(parts) < 2 {
+			return SpanContext{}, false
+		}
+		sc := SpanContext{TraceID: padTraceID(parts[0]), SpanID: parts[1]}
+		if len(parts) > 2 {
+			sc.Sampled = parts[2] == "1" || parts[2] == "d"
+		}
+		return sc, sc.IsValid()
+	}
+	sc := SpanContext{
+		TraceID:  padTraceID(h.Get("X-B3-Traceid")),
+		SpanID:   h.Get("X-B3-Spanid"),
+		ParentID: h.Get("X-B3-Parentspanid"),
+		Sampled:  h.Get("X-B3-Sampled") == "1" || h.Get("X-B3-Flags") == "1",
+	}
+	return sc, sc.IsValid()
+}
+
+func (p B3) Inject(h http.Header, sc SpanContext) {
+	sampled := "0"
+	if sc.Sampled {
+		sampled = "1"
+	}
+	if p.SingleHeader {
+		h.Set("B3", sc.TraceID+"-"+sc.SpanID+"-"+sampled)
+		return
+	}
+	h.Set("X-B3-TraceId", sc.TraceID)
+	h.Set("X-B3-SpanId", sc.SpanID)
+	if sc.ParentID != "" {
+		h.Set("X-B3-ParentSpanId", sc.ParentID)
+	}
+	h.Set("X-B3-Sampled", sampled)
+}
+
+// Datadog propagates Datadog headers. Datadog uses 64-bit decimal IDs which
+// are the lower 64 bits of the trace ID.
+type Datadog struct{}
+
+func (Datadog) Extract(h http.Header) (SpanContext, bool) {
+	traceID, err := strconv.ParseUint(h.Get("X-Datadog-Trace-Id"), 10, 64)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	spanID, err := strconv.ParseUint(h.Get("X-Datadog-Parent-Id"), 10, 64)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	priority, _ := strconv.Atoi(h.Get("X-Datadog-Sampling-Priority"))
+	sc := SpanContext{
+		TraceID: fmt.Sprintf("%032x", traceID),
+		SpanID:  fmt.Sprintf("%016x", spanID),
+		Sampled: priority > 0,
+	}
+	return sc, sc.IsValid()
+}
+
+func (Datadog) Inject(h http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	traceID, err := strconv.ParseUint(sc.TraceID[16:], 16, 64)
+	if err != nil {
+		return
+	}
+	spanID, err := strconv.ParseUint(sc.SpanID, 16, 64)
+	if err != nil {
+		return
+	}
+	priority := "0"
+	if sc.Sampled {
+		priority = "1"
+	}
+	h.Set("X-Datadog-Trace-Id", strconv.FormatUint(traceID, 10))
+	h.Set("X-Datadog-Parent-Id", strconv.FormatUint(spanID, 10))
+	h.Set("X-Datadog-Sampling-Priority", priority)
+}
+
+type spanContextKey struct{}
+
+// WithSpanContext returns a copy of ctx carrying sc.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFrom returns the span context of ctx.
+func SpanContextFrom(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// Trace returns a middleware extracting the span context of requests with p.
+// Handlers see a new span of the caller's trace, or of a new trace if the
+// request carries none, via SpanContextFrom. Outgoing requests propagate it
+// with client.Propagate.
+func Trace(p Propagator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sc, ok := p.Extract(r.Header)
+			if ok {
+				sc.ParentID = sc.SpanID
+			} else {
+				sc = SpanContext{TraceID: newTraceID(32), Sampled: true}
+			}
+			sc.SpanID = newTraceID(16)
+			next.ServeHTTP(w, r.WithContext(WithSpanContext(r.Context(), sc)))
+		})
+	}
+}
+
+func newTraceID(digits int) string {
+	b := make([]byte, digits/2)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// padTraceID pads 64-bit trace IDs to 128 bits.
+func padTraceID(id string) string {
+	if len(id) == 16 {
+		return "0000000000000000" + id
+	}
+	return id
+}
+
+// isHexID reports whether id consists of n lowercase hex digits, not all
+// of them zero.
+func isHexID(id string, n int) bool {
+	if len(id) != n {
+		return false
+	}
+	zero := true
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
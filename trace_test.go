@@ -0,0 +1,109 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/restflex"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestPropagators(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		propagator restflex.Propagator
+		header     http.Header
+		want       restflex.SpanContext
+	}{
+		{
+			name:       "W3C trace context",
+			propagator: restflex.TraceContext{},
+			header:     http.Header{"Traceparent": {"00-" + testTraceID + "-" + testSpanID + "-01"}},
+			want:       restflex.SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true},
+		},
+		{
+			name:       "B3 multiple headers",
+			propagator: restflex.B3{},
+			header:     http.Header{"X-B3-Traceid": {testTraceID}, "X-B3-Spanid": {testSpanID}, "X-B3-Sampled": {"1"}},
+			want:       restflex.SpanContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true},
+		},
+		{
+			name:       "B3 single header with 64-bit trace ID",
+			propagator: restflex.B3{SingleHeader: true},
+			header:     http.Header{"B3": {"a3ce929d0e0e4736-" + testSpanID + "-0"}},
+			want:       restflex.SpanContext{TraceID: "0000000000000000a3ce929d0e0e4736", SpanID: testSpanID},
+		},
+		{
+			name:       "Datadog",
+			propagator: restflex.Datadog{},
+			header:     http.Header{"X-Datadog-Trace-Id": {"11803532876627986230"}, "X-Datadog-Parent-Id": {"67667974448284343"}, "X-Datadog-Sampling-Priority": {"1"}},
+			want:       restflex.SpanContext{TraceID: "0000000000000000a3ce929d0e0e4736", SpanID: testSpanID, Sampled: true},
+		},
+		{
+			name:       "first match of several",
+			propagator: restflex.Propagators{restflex.TraceContext{}, restflex.B3{}},
+			header:     http.Header{"X-B3-Traceid": {testTraceID}, "X-B3-Spanid": {testSpanID}},
+			want:       restflex.SpanContext{TraceID: testTraceID, SpanID: testSpanID},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sc, ok := tt.propagator.Extract(tt.header)
+			if !ok || sc != tt.want {
+				t.Fatalf("expected %+v, but got %+v (%v)", tt.want, sc, ok)
+			}
+			h := http.Header{}
+			tt.propagator.Inject(h, sc)
+			if got, ok := tt.propagator.Extract(h); !ok || got.TraceID != sc.TraceID || got.SpanID != sc.SpanID || got.Sampled != sc.Sampled {
+				t.Errorf("expected injected %+v to round trip, but got %+v from %v", sc, got, h)
+			}
+		})
+	}
+}
+
+func TestPropagatorRejectsInvalidHeaders(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{
+		"",
+		"00-" + testTraceID + "-" + testSpanID,
+		"00-00000000000000000000000000000000-" + testSpanID + "-01",
+		"ff-" + testTraceID + "-" + testSpanID + "-01",
+		"00-" + testTraceID + "-" + testSpanID + "-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01",
+	} {
+		if sc, ok := (restflex.TraceContext{}).Extract(http.Header{"Traceparent": {v}}); ok {
+			t.Errorf("expected %q to be rejected, but got %+v", v, sc)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	t.Parallel()
+	var got restflex.SpanContext
+	h := restflex.Trace(restflex.B3{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = restflex.SpanContextFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-B3-TraceId", testTraceID)
+	req.Header.Set("X-B3-SpanId", testSpanID)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got.TraceID != testTraceID || got.ParentID != testSpanID || !got.IsValid() || got.SpanID == testSpanID {
+		t.Errorf("expected a new span of trace %v with parent %v, but got %+v", testTraceID, testSpanID, got)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !got.IsValid() || got.TraceID == testTraceID || got.ParentID != "" {
+		t.Errorf("expected a new trace, but got %+v", got)
+	}
+}
@@ -0,0 +1,20 @@
+package restflex
+
+import "net/http"
+
+// DeclareTrailers announces the names of trailers the handler will set after
+// writing the response body. It must be called before the response status or
+// body is written.
+func DeclareTrailers(w http.ResponseWriter, names ...string) {
+	for _, name := range names {
+		w.Header().Add("Trailer", http.CanonicalHeaderKey(name))
+	}
+}
+
+// SetTrailer sets a trailer value. It may be called after the response body
+// has been written, for example with a checksum or record count computed
+// while streaming. Trailers not declared with DeclareTrailers are still sent
+// to clients supporting them.
+func SetTrailer(w http.ResponseWriter, name, value string) {
+	w.Header().Set(http.TrailerPrefix+http.CanonicalHeaderKey(name), value)
+}
@@ -0,0 +1,52 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestSetTrailer(t *testing.T) {
+	t.Parallel()
+	h := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		restflex.DeclareTrailers(w, "x-record-count")
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		count := 0
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "{\"n\":%d}\n", i)
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				return err
+			}
+			count++
+		}
+		restflex.SetTrailer(w, "X-Record-Count", fmt.Sprint(count))
+		restflex.SetTrailer(w, "X-Undeclared", "yes")
+		return nil
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if _, err := io.Copy(io.Discard, res.Body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := res.Trailer.Get("X-Record-Count"); got != "3" {
+		t.Errorf("expected trailer X-Record-Count %q, got %q", "3", got)
+	}
+	if got := res.Trailer.Get("X-Undeclared"); got != "yes" {
+		t.Errorf("expected trailer X-Undeclared %q, got %q", "yes", got)
+	}
+}
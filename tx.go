@@ -0,0 +1,135 @@
+package restflex
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"net/http"
+
+	"kkn.fi/infra"
+)
+
+// Tx is a database transaction.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// TxStarter begins transactions.
+type TxStarter interface {
+	BeginTx(ctx context.Context) (Tx, error)
+}
+
+// SQLTxStarter begins transactions of a database/sql database. Handlers get
+// the *sql.Tx with SQLTxFrom.
+type SQLTxStarter struct {
+	DB   *sql.DB
+	Opts *sql.TxOptions
+}
+
+func (s SQLTxStarter) BeginTx(ctx context.Context) (Tx, error) {
+	return s.DB.BeginTx(ctx, s.Opts)
+}
+
+// Transactions is a middleware running each request in a transaction which
+// is committed when the response status is 2xx or 3xx and rolled back on
+// other statuses and panics. The response is held back until the transaction
+// has been committed, so that a failed commit results in 500 Internal Server
+// Error instead of a success the client can't rely on.
+//
+// Events emitted by handlers with Emit are saved to Outbox in the
+// transaction and passed to OnCommit after the commit, only when the
+// response status is 2xx.
+type Transactions struct {
+	Starter TxStarter
+	// Outbox saves emitted events before the commit when set.
+	Outbox Outbox
+	// OnCommit is called with emitted events after the commit when set,
+	// for example to notify a relay publishing the outbox.
+	OnCommit func(ctx context.Context, events []Event)
+	// Log logs messages
+	Log infra.Logger
+}
+
+func NewTransactions(l infra.Logger, s TxStarter) *Transactions {
+	return &Transactions{
+		Starter: s,
+		Log:     l,
+	}
+}
+
+type txContextKey struct{}
+
+// TxFrom returns the transaction of the request.
+func TxFrom(ctx context.Context) (Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(Tx)
+	return tx, ok
+}
+
+// SQLTxFrom returns the transaction of the request begun by SQLTxStarter.
+func SQLTxFrom(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// Wrap returns a handler calling next in a transaction.
+func (t *Transactions) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, err := t.Starter.BeginTx(r.Context())
+		if err != nil {
+			t.Log.Printf("restflex: begin transaction: %v", err)
+			status := http.StatusServiceUnavailable
+			writeError(t.Log, w, status, http.StatusText(status))
+			return
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				if err := tx.Rollback(); err != nil {
+					t.Log.Printf("restflex: roll back transaction: %v", err)
+				}
+			}
+		}()
+		// the response headers are held back with the response, so that an
+		// error written after a failed commit does not carry the Location
+		// or ETag of the rolled back success
+		header := w.Header().Clone()
+		cw := &captureWriter{ResponseWriter: &discardWriter{header: header}, status: http.StatusOK}
+		flush := func() {
+			clear(w.Header())
+			maps.Copy(w.Header(), header)
+			cw.flush(w)
+		}
+		collector := &eventCollector{}
+		ctx := context.WithValue(r.Context(), txContextKey{}, tx)
+		ctx = context.WithValue(ctx, eventCollectorContextKey{}, collector)
+		next.ServeHTTP(cw, r.WithContext(ctx))
+		if cw.status >= 400 {
+			flush()
+			return
+		}
+		var events []Event
+		if cw.status < 300 {
+			events = collector.collected()
+		}
+		if len(events) > 0 && t.Outbox != nil {
+			if err := t.Outbox.Save(r.Context(), tx, events); err != nil {
+				t.Log.Printf("restflex: save events to outbox: %v", err)
+				status := http.StatusInternalServerError
+				writeError(t.Log, w, status, http.StatusText(status))
+				return
+			}
+		}
+		committed = true
+		if err := tx.Commit(); err != nil {
+			t.Log.Printf("restflex: commit transaction: %v", err)
+			status := http.StatusInternalServerError
+			writeError(t.Log, w, status, http.StatusText(status))
+			return
+		}
+		if len(events) > 0 && t.OnCommit != nil {
+			t.OnCommit(r.Context(), events)
+		}
+		flush()
+	})
+}
@@ -0,0 +1,136 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+type fakeTx struct {
+	commitErr  error
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.committed = true
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.rolledBack = true
+	return nil
+}
+
+type fakeTxStarter struct {
+	tx *fakeTx
+}
+
+func (s fakeTxStarter) BeginTx(ctx context.Context) (restflex.Tx, error) {
+	return s.tx, nil
+}
+
+func TestTransactions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		err        error
+		commitErr  error
+		status     int
+		committed  bool
+		rolledBack bool
+	}{
+		{name: "success", status: http.StatusCreated, committed: true},
+		{name: "client error", err: restflex.ErrBadRequest, status: http.StatusBadRequest, rolledBack: true},
+		{name: "server error", err: errors.New("boom"), status: http.StatusInternalServerError, rolledBack: true},
+		{name: "commit failure", commitErr: errors.New("serialization failure"), status: http.StatusInternalServerError, committed: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := resttest.NewLogger()
+			tx := &fakeTx{commitErr: tt.commitErr}
+			txs := restflex.NewTransactions(logger, fakeTxStarter{tx: tx})
+			api := txs.Wrap(restflex.NewHandlerWithContext(logger, httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				if got, ok := restflex.TxFrom(ctx); !ok || got != tx {
+					t.Error("expected transaction in context")
+				}
+				if tt.err != nil {
+					return tt.err
+				}
+				w.Header().Set("Location", "/items/1")
+				return restflex.WriteJSON(w, http.StatusCreated, map[string]int{"id": 1})
+			})))
+			res := resttest.Post("/").WithJSON(map[string]string{}).To(api).Expect(t).Status(tt.status)
+			location := ""
+			if tt.status == http.StatusCreated {
+				location = "/items/1"
+			}
+			res.Header("Location", location)
+			if tx.committed != tt.committed || tx.rolledBack != tt.rolledBack {
+				t.Errorf("expected committed %v and rolled back %v, got %v and %v", tt.committed, tt.rolledBack, tx.committed, tx.rolledBack)
+			}
+		})
+	}
+}
+
+type fakeOutbox struct {
+	saved []restflex.Event
+}
+
+func (o *fakeOutbox) Save(ctx context.Context, tx restflex.Tx, events []restflex.Event) error {
+	o.saved = append(o.saved, events...)
+	return nil
+}
+
+func TestTransactions_events(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		status int
+		events int
+	}{
+		{name: "success", status: http.StatusCreated, events: 1},
+		{name: "redirect", status: http.StatusSeeOther, events: 0},
+		{name: "failure", status: http.StatusConflict, events: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := resttest.NewLogger()
+			outbox := &fakeOutbox{}
+			var published []restflex.Event
+			txs := restflex.NewTransactions(logger, fakeTxStarter{tx: &fakeTx{}})
+			txs.Outbox = outbox
+			txs.OnCommit = func(ctx context.Context, events []restflex.Event) {
+				published = events
+			}
+			api := txs.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := restflex.Emit(r.Context(), restflex.Event{Type: "user.created", Payload: 1}); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			resttest.Post("/").To(api).Expect(t).Status(tt.status)
+			if len(outbox.saved) != tt.events || len(published) != tt.events {
+				t.Errorf("expected %d saved and published events, got %v and %v", tt.events, outbox.saved, published)
+			}
+		})
+	}
+}
+
+func TestEmit_without_transaction(t *testing.T) {
+	t.Parallel()
+	if err := restflex.Emit(context.Background(), restflex.Event{Type: "user.created"}); !errors.Is(err, restflex.ErrNoTransaction) {
+		t.Errorf("expected %v, got %v", restflex.ErrNoTransaction, err)
+	}
+}
@@ -0,0 +1,83 @@
+package restflex
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// ListenerFDEnv is the environment variable passing the file descriptor of
+// an inherited listener to an upgraded process.
+const ListenerFDEnv = "RESTFLEX_LISTENER_FD"
+
+// inheritedListenerFD is the descriptor of the listener in the upgraded
+// process; the first of exec.Cmd.ExtraFiles.
+const inheritedListenerFD = 3
+
+// Upgrade starts a new instance of the running executable with the same
+// arguments, passing ln to it, for upgrading a service without dropping
+// connections. The new process serves on the inherited listener with Run
+// while the caller shuts its server down gracefully, for example by
+// cancelling the context passed to Run once Upgrade returns; Server.Upgrade
+// does both. The listener is inherited rather than opened again with
+// SO_REUSEPORT, which is not portable and has the kernel drop the
+// connections queued on the listener of the old process when it closes.
+func Upgrade(ln net.Listener) (*os.Process, error) {
+	var (
+		f   *os.File
+		err error
+	)
+	switch ln := ln.(type) {
+	case *net.TCPListener:
+		f, err = ln.File()
+	case *net.UnixListener:
+		// The socket file must outlive the listener of this process.
+		ln.SetUnlinkOnClose(false)
+		f, err = ln.File()
+	default:
+		return nil, fmt.Errorf("restflex: cannot pass listener of type %T", ln)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Env = append(os.Environ(), ListenerFDEnv+"="+strconv.Itoa(inheritedListenerFD))
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+// InheritedListener returns the listener passed by Upgrade to this process,
+// or nil if there is none. The environment variable is unset so that child
+// processes do not inherit it.
+func InheritedListener() (net.Listener, error) {
+	v, ok := os.LookupEnv(ListenerFDEnv)
+	if !ok {
+		return nil, nil
+	}
+	os.Unsetenv(ListenerFDEnv)
+	fd, err := strconv.Atoi(v)
+	if err != nil || fd < 0 {
+		return nil, errors.New("restflex: invalid " + ListenerFDEnv)
+	}
+	f := os.NewFile(uintptr(fd), "inherited")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("restflex: inherited listener: %w", err)
+	}
+	return ln, nil
+}
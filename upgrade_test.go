@@ -0,0 +1,49 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+)
+
+func TestInheritedListener_none(t *testing.T) {
+	t.Parallel()
+	if _, ok := os.LookupEnv(restflex.ListenerFDEnv); ok {
+		t.Skip("listener inherited")
+	}
+	ln, err := restflex.InheritedListener()
+	if ln != nil || err != nil {
+		t.Errorf("expected no listener and no error, got %v and %v", ln, err)
+	}
+}
+
+// upgradedEnv is set in the environment of the process started by
+// Server.Upgrade in TestServer_Upgrade.
+const upgradedEnv = "RESTFLEX_TEST_UPGRADED"
+
+// serveUpgraded runs the upgraded server of TestServer_Upgrade until it is
+// asked to stop, returning the exit code of the process.
+func serveUpgraded() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := restflex.NewServer(log.Default(), "127.0.0.1:1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stop" {
+			cancel()
+		}
+		_, _ = io.WriteString(w, "upgraded")
+	}))
+	if err := srv.Run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
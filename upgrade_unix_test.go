@@ -0,0 +1,125 @@
+//go:build !integration && unix
+
+package restflex_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestServer_Run_inherited_listener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// InheritedListener takes ownership of the descriptor.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Setenv(restflex.ListenerFDEnv, strconv.Itoa(fd))
+
+	srv := restflex.NewServer(resttest.NewLogger(), "127.0.0.1:1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	// The inherited listener and ln share the socket; close ln so that
+	// connections are accepted by the server only.
+	ln.Close()
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		if res, err = http.Get("http://" + ln.Addr().String()); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status code %d, but got %d", http.StatusNoContent, res.StatusCode)
+	}
+	if _, ok := os.LookupEnv(restflex.ListenerFDEnv); ok {
+		t.Errorf("expected %v to be unset", restflex.ListenerFDEnv)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServer_Upgrade(t *testing.T) {
+	t.Setenv(upgradedEnv, "1")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	url := "http://" + ln.Addr().String()
+	srv := restflex.NewServer(resttest.NewLogger(), "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "old")
+	}))
+	if _, err := srv.Upgrade(); err == nil {
+		t.Error("expected an error upgrading a server not running")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.RunListener(context.Background(), ln)
+	}()
+	get := func(want string) {
+		t.Helper()
+		var body string
+		for range 100 {
+			if res, err := http.Get(url); err == nil {
+				b, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if body = string(b); body == want {
+					return
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("expected response %q, got %q", want, body)
+	}
+	get("old")
+
+	p, err := srv.Upgrade()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the upgraded server to shut down")
+	}
+	get("upgraded")
+	if res, err := http.Get(url + "/stop"); err == nil {
+		res.Body.Close()
+	}
+	if state, err := p.Wait(); err != nil || !state.Success() {
+		t.Errorf("expected the upgraded process to exit cleanly, got %v, %v", state, err)
+	}
+}
@@ -0,0 +1,60 @@
+package restflex
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AddVary adds request header names to the Vary header of h. Names already
+// listed are not repeated and nothing is added once Vary is "*".
+func AddVary(h http.Header, headers ...string) {
+	current := VaryHeaders(h)
+	for _, name := range headers {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, c := range current {
+			if c == name || c == "*" {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		if name == "*" {
+			current = current[:0]
+		}
+		current = append(current, name)
+	}
+	if len(current) > 0 {
+		h.Set("Vary", strings.Join(current, ", "))
+	}
+}
+
+// VaryHeaders returns the canonicalized header names listed in the Vary
+// header of h.
+func VaryHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// Vary returns a middleware declaring that responses vary on the given
+// request headers.
+func Vary(headers ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddVary(w.Header(), headers...)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
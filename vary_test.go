@@ -0,0 +1,79 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial []string
+		add     []string
+		want    string
+	}{
+		{
+			name: "empty",
+			add:  []string{"accept-encoding"},
+			want: "Accept-Encoding",
+		},
+		{
+			name:    "duplicates are ignored",
+			initial: []string{"Accept, Accept-Encoding"},
+			add:     []string{"accept", "Accept-Language"},
+			want:    "Accept, Accept-Encoding, Accept-Language",
+		},
+		{
+			name:    "star absorbs other headers",
+			initial: []string{"*"},
+			add:     []string{"Accept"},
+			want:    "*",
+		},
+		{
+			name:    "star replaces other headers",
+			initial: []string{"Accept"},
+			add:     []string{"*"},
+			want:    "*",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := http.Header{}
+			for _, v := range tt.initial {
+				h.Add("Vary", v)
+			}
+			restflex.AddVary(h, tt.add...)
+			if got := h.Get("Vary"); got != tt.want {
+				t.Errorf("expected Vary %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCache_does_not_store_responses_varying_on_unkeyed_headers(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, "%d", calls)
+	})
+	cache := restflex.NewCache(resttest.NewLogger(), restflex.NewMemoryCacheStore(), time.Minute)
+	srv := cache.Wrap(restflex.Vary("Accept-Encoding")(next))
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got, want := rec.Body.String(), fmt.Sprint(i); got != want {
+			t.Errorf("request %d: expected %q, got %q", i, want, got)
+		}
+	}
+}
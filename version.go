@@ -0,0 +1,76 @@
+package restflex
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ResourceVersionHeader carries the version of a resource in responses and
+// the version an update is based on in requests.
+const ResourceVersionHeader = "X-Resource-Version"
+
+var (
+	// ErrPreconditionRequired is returned by CheckResourceVersion when a
+	// required version is missing from the request.
+	ErrPreconditionRequired = NewAPIError(http.StatusPreconditionRequired, nil, "resource version required")
+)
+
+// SetResourceVersion sets version as the X-Resource-Version and the strong
+// ETag of a create or update response, for the client to send back in the
+// If-Match header of its next update.
+func SetResourceVersion(w http.ResponseWriter, version string) {
+	w.Header().Set(ResourceVersionHeader, version)
+	w.Header().Set("ETag", `"`+version+`"`)
+}
+
+// RequestResourceVersion returns the version an update is based on from the
+// If-Match header or, when it is missing, the X-Resource-Version header.
+// The If-Match value "*" and lists of entity tags are returned as they are.
+func RequestResourceVersion(r *http.Request) (string, bool) {
+	if v := r.Header.Get("If-Match"); v != "" {
+		return v, true
+	}
+	if v := r.Header.Get(ResourceVersionHeader); v != "" {
+		return v, true
+	}
+	return "", false
+}
+
+// CheckResourceVersion implements optimistic locking of an update to a
+// resource at version current. It returns a 412 Precondition Failed error
+// telling the current version in its details if the request is based on
+// another version, and ErrPreconditionRequired if required is set and the
+// request has no version. Weak entity tags never match.
+func CheckResourceVersion(r *http.Request, current string, required bool) error {
+	v, ok := RequestResourceVersion(r)
+	if !ok {
+		if required {
+			return ErrPreconditionRequired
+		}
+		return nil
+	}
+	if r.Header.Get("If-Match") == "" {
+		if v == current {
+			return nil
+		}
+	} else if matchesETag(v, current) {
+		return nil
+	}
+	return NewDetailedError(NewAPIError(http.StatusPreconditionFailed, nil, "resource has been modified"), map[string]any{
+		"current_version": current,
+	})
+}
+
+// matchesETag reports whether the If-Match header value ifMatch matches the
+// strong entity tag of version.
+func matchesETag(ifMatch, version string) bool {
+	if strings.TrimSpace(ifMatch) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == `"`+version+`"` {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+//go:build !integration
+
+package restflex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"kkn.fi/httpx"
+	"kkn.fi/restflex"
+	"kkn.fi/restflex/resttest"
+)
+
+func TestCheckResourceVersion(t *testing.T) {
+	t.Parallel()
+	api := restflex.NewHandlerWithContext(resttest.NewLogger(), httpx.HandlerWithContextFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if err := restflex.CheckResourceVersion(r, "7", r.URL.Query().Get("required") == "true"); err != nil {
+			return err
+		}
+		restflex.SetResourceVersion(w, "8")
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}))
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		query  string
+		status int
+	}{
+		{name: "no version", status: http.StatusNoContent},
+		{name: "required", query: "true", status: http.StatusPreconditionRequired},
+		{name: "if-match", header: "If-Match", value: `"7"`, status: http.StatusNoContent},
+		{name: "if-match list", header: "If-Match", value: `"6", "7"`, status: http.StatusNoContent},
+		{name: "if-match any", header: "If-Match", value: "*", status: http.StatusNoContent},
+		{name: "if-match stale", header: "If-Match", value: `"6"`, status: http.StatusPreconditionFailed},
+		{name: "if-match weak", header: "If-Match", value: `W/"7"`, status: http.StatusPreconditionFailed},
+		{name: "version header", header: restflex.ResourceVersionHeader, value: "7", status: http.StatusNoContent},
+		{name: "version header stale", header: restflex.ResourceVersionHeader, value: "6", status: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := resttest.Post("/items/1").WithJSON(map[string]string{"name": "item"})
+			if tt.header != "" {
+				req = req.WithHeader(tt.header, tt.value)
+			}
+			if tt.query != "" {
+				req = req.WithQuery("required", tt.query)
+			}
+			res := req.To(api).Expect(t).Status(tt.status)
+			switch tt.status {
+			case http.StatusNoContent:
+				res.Header(restflex.ResourceVersionHeader, "8").Header("ETag", `"8"`)
+			case http.StatusPreconditionFailed:
+				res.JSONPath("$.details.current_version", "7")
+			}
+		})
+	}
+}